@@ -42,6 +42,17 @@ const (
 	KindCityBlock = 38808
 )
 
+// Nostr event kinds used by ATTN Protocol.
+const (
+	// KindDeletion is the NIP-09 deletion request kind (5), used to withdraw
+	// promotions and attention offers.
+	KindDeletion = 5
+
+	// KindRelayList is the NIP-65 relay list kind (10002), used to find the
+	// relays a party reads from and writes to.
+	KindRelayList = 10002
+)
+
 // NIP-51 list type identifiers for ATTN Protocol.
 // Used for user preference lists (blocked promotions, trusted marketplaces, etc.)
 const (
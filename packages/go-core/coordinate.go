@@ -0,0 +1,26 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseCoordinate splits an 'a' tag coordinate, kind:pubkey:d_tag. The d tag
+// may itself contain colons. A malformed coordinate yields kind 0 and an error.
+// It does not allocate unless the coordinate is malformed.
+func ParseCoordinate(coordinate string) (kind int, pubkey string, d_tag string, err error) {
+	kind_part, rest, found := strings.Cut(coordinate, ":")
+	if !found {
+		return 0, "", "", fmt.Errorf("coordinate format invalid: expected kind:pubkey:identifier")
+	}
+	pubkey, d_tag, found = strings.Cut(rest, ":")
+	if !found {
+		return 0, "", "", fmt.Errorf("coordinate format invalid: expected kind:pubkey:identifier")
+	}
+	kind, err = strconv.Atoi(kind_part)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("coordinate kind must be numeric: %s", kind_part)
+	}
+	return kind, pubkey, d_tag, nil
+}
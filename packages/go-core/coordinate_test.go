@@ -0,0 +1,18 @@
+package core
+
+import "testing"
+
+func TestParseCoordinate(t *testing.T) {
+	kind, pubkey, d_tag, err := ParseCoordinate("38188:mk:org.attnprotocol:marketplace:mk-1")
+	if err != nil || kind != KindMarketplace || pubkey != "mk" || d_tag != "org.attnprotocol:marketplace:mk-1" {
+		t.Errorf("unexpected parse %d %q %q %v", kind, pubkey, d_tag, err)
+	}
+	if _, _, d_tag, err := ParseCoordinate("34236:pk:"); err != nil || d_tag != "" {
+		t.Errorf("expected an empty d tag to parse, got %q %v", d_tag, err)
+	}
+	for _, malformed := range []string{"", "38188", "38188:mk", "video:pk:d"} {
+		if kind, _, _, err := ParseCoordinate(malformed); err == nil || kind != 0 {
+			t.Errorf("%q: expected an error and kind 0, got %d %v", malformed, kind, err)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultValidityBlocks is how many blocks PROMOTION and ATTENTION offers stay
+// matchable under DefaultExpiryPolicy: about one day of blocks.
+const DefaultValidityBlocks = 144
+
+// ExpiryPolicy sets how many blocks after its block height (its t tag) an
+// event stays valid. An event published at block h with a window of n blocks
+// expires at block h+n. A window of zero never expires.
+type ExpiryPolicy struct {
+	// Blocks is the window for kinds not in Kinds.
+	Blocks int64
+
+	// Kinds sets the window per event kind.
+	Kinds map[int]int64
+
+	// Marketplaces sets the window for events that reference a marketplace,
+	// keyed by marketplace coordinate (38188:pubkey:d_tag). It takes
+	// precedence over Kinds and Blocks.
+	Marketplaces map[string]int64
+}
+
+// DefaultExpiryPolicy expires PROMOTION and ATTENTION offers after
+// DefaultValidityBlocks. Other kinds never expire.
+var DefaultExpiryPolicy = ExpiryPolicy{
+	Kinds: map[int]int64{
+		KindPromotion: DefaultValidityBlocks,
+		KindAttention: DefaultValidityBlocks,
+	},
+}
+
+// marketplacePrefix starts every marketplace coordinate.
+var marketplacePrefix = strconv.Itoa(KindMarketplace) + ":"
+
+// Window returns the validity window of an event in blocks.
+func (p ExpiryPolicy) Window(event *nostr.Event) int64 {
+	if len(p.Marketplaces) > 0 {
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], marketplacePrefix) {
+				if window, ok := p.Marketplaces[tag[1]]; ok {
+					return window
+				}
+			}
+		}
+	}
+	if window, ok := p.Kinds[event.Kind]; ok {
+		return window
+	}
+	return p.Blocks
+}
+
+// ExpiresAt returns the block height at which an event expires. ok is false
+// when the event never expires or has no valid block height.
+func (p ExpiryPolicy) ExpiresAt(event *nostr.Event) (block_height int64, ok bool) {
+	window := p.Window(event)
+	if window <= 0 {
+		return 0, false
+	}
+	published, ok := EventBlockHeight(event)
+	if !ok {
+		return 0, false
+	}
+	return published + window, true
+}
+
+// IsExpired reports whether an event has expired at current_height.
+func (p ExpiryPolicy) IsExpired(event *nostr.Event, current_height int64) bool {
+	expires_at, ok := p.ExpiresAt(event)
+	return ok && current_height >= expires_at
+}
+
+// IsExpired reports whether an event has expired at current_height under
+// DefaultExpiryPolicy.
+func IsExpired(event *nostr.Event, current_height int64) bool {
+	return DefaultExpiryPolicy.IsExpired(event, current_height)
+}
+
+// EventBlockHeight returns the block height of an event's t tag. ok is false
+// when the tag is missing or not a height ParseBlockHeight accepts.
+func EventBlockHeight(event *nostr.Event) (block_height int64, ok bool) {
+	t_tag := event.Tags.Find("t")
+	if t_tag == nil {
+		return 0, false
+	}
+	block_height, err := ParseBlockHeight(t_tag[1])
+	if err != nil {
+		return 0, false
+	}
+	return block_height, true
+}
+
+// ParseBlockHeight parses a block height written as base-10 digits, as in the 't' tag.
+// Signs, whitespace and leading zeros are rejected so every height has one spelling.
+func ParseBlockHeight(value string) (int64, error) {
+	if value == "" || (len(value) > 1 && value[0] == '0') {
+		return 0, fmt.Errorf("block height must be base-10 digits without leading zeros")
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, fmt.Errorf("block height must be base-10 digits without leading zeros")
+		}
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// Withdraws reports whether deletion is a NIP-09 deletion request that
+// withdraws event: it is by the same author and names the event by ID, or by
+// coordinate if it is no older than the event.
+func Withdraws(deletion, event *nostr.Event) bool {
+	if deletion.Kind != KindDeletion || deletion.PubKey != event.PubKey {
+		return false
+	}
+	var coordinate string
+	if d_tag := event.Tags.Find("d"); d_tag != nil {
+		coordinate = strconv.Itoa(event.Kind) + ":" + event.PubKey + ":" + d_tag[1]
+	}
+	for _, tag := range deletion.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch {
+		case tag[0] == "e" && tag[1] == event.ID:
+			return true
+		case tag[0] == "a" && coordinate != "" && tag[1] == coordinate && deletion.CreatedAt >= event.CreatedAt:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestExpiryPolicy(t *testing.T) {
+	marketplace := "38188:mk:org.attnprotocol:marketplace:mk-1"
+	promotion := &nostr.Event{Kind: KindPromotion, Tags: nostr.Tags{{"t", "870000"}, {"a", marketplace}}}
+	attention := &nostr.Event{Kind: KindAttention, Tags: nostr.Tags{{"t", "870000"}}}
+	match := &nostr.Event{Kind: KindMatch, Tags: nostr.Tags{{"t", "870000"}}}
+
+	tests := []struct {
+		name    string
+		policy  ExpiryPolicy
+		event   *nostr.Event
+		height  int64
+		expired bool
+	}{
+		{"default before window", DefaultExpiryPolicy, promotion, 870143, false},
+		{"default at window", DefaultExpiryPolicy, promotion, 870144, true},
+		{"default attention", DefaultExpiryPolicy, attention, 870200, true},
+		{"default other kinds", DefaultExpiryPolicy, match, 990000, false},
+		{"zero policy", ExpiryPolicy{}, promotion, 990000, false},
+		{"fallback window", ExpiryPolicy{Blocks: 6}, match, 870006, true},
+		{"kind window", ExpiryPolicy{Blocks: 6, Kinds: map[int]int64{KindPromotion: 12}}, promotion, 870006, false},
+		{"marketplace window", ExpiryPolicy{Kinds: map[int]int64{KindPromotion: 144}, Marketplaces: map[string]int64{marketplace: 3}}, promotion, 870003, true},
+		{"other marketplace", ExpiryPolicy{Marketplaces: map[string]int64{"38188:other:x": 3}}, promotion, 870003, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.IsExpired(tt.event, tt.height); got != tt.expired {
+				t.Errorf("expected expired %v at %d, got %v", tt.expired, tt.height, got)
+			}
+		})
+	}
+
+	if !IsExpired(promotion, 870144) {
+		t.Error("expected IsExpired to use the default policy")
+	}
+	if IsExpired(&nostr.Event{Kind: KindPromotion, Tags: nostr.Tags{{"t", "soon"}}}, 990000) {
+		t.Error("expected an event without a valid block height never to expire")
+	}
+	if expires_at, ok := DefaultExpiryPolicy.ExpiresAt(promotion); !ok || expires_at != 870144 {
+		t.Errorf("expected expiry at 870144, got %d, %v", expires_at, ok)
+	}
+}
+
+func TestParseBlockHeight(t *testing.T) {
+	if height, err := ParseBlockHeight("870000"); err != nil || height != 870000 {
+		t.Errorf("expected 870000, got %d, %v", height, err)
+	}
+	if height, err := ParseBlockHeight("0"); err != nil || height != 0 {
+		t.Errorf("expected 0, got %d, %v", height, err)
+	}
+	for _, invalid := range []string{"", "-1", "+870000", "0870000", " 870000", "870000.0", "9223372036854775808"} {
+		if _, err := ParseBlockHeight(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+		// Expiry reads t tags with the same rules as validation
+		if _, ok := EventBlockHeight(&nostr.Event{Tags: nostr.Tags{{"t", invalid}}}); ok {
+			t.Errorf("%q: expected no block height", invalid)
+		}
+	}
+}
+
+func TestWithdraws(t *testing.T) {
+	offer := &nostr.Event{ID: "id-1", PubKey: "pr", Kind: KindPromotion, CreatedAt: 100, Tags: nostr.Tags{{"d", "org.attnprotocol:promotion:p-1"}}}
+	coordinate := "38388:pr:org.attnprotocol:promotion:p-1"
+
+	tests := []struct {
+		name      string
+		deletion  *nostr.Event
+		withdraws bool
+	}{
+		{"by coordinate", &nostr.Event{Kind: KindDeletion, PubKey: "pr", CreatedAt: 100, Tags: nostr.Tags{{"a", coordinate}}}, true},
+		{"by event ID", &nostr.Event{Kind: KindDeletion, PubKey: "pr", CreatedAt: 50, Tags: nostr.Tags{{"e", "id-1"}}}, true},
+		{"older coordinate", &nostr.Event{Kind: KindDeletion, PubKey: "pr", CreatedAt: 99, Tags: nostr.Tags{{"a", coordinate}}}, false},
+		{"other author", &nostr.Event{Kind: KindDeletion, PubKey: "mk", CreatedAt: 100, Tags: nostr.Tags{{"a", coordinate}}}, false},
+		{"other event", &nostr.Event{Kind: KindDeletion, PubKey: "pr", CreatedAt: 100, Tags: nostr.Tags{{"e", "id-2"}}}, false},
+		{"not a deletion", &nostr.Event{Kind: KindPromotion, PubKey: "pr", CreatedAt: 100, Tags: nostr.Tags{{"a", coordinate}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Withdraws(tt.deletion, offer); got != tt.withdraws {
+				t.Errorf("expected %v, got %v", tt.withdraws, got)
+			}
+		})
+	}
+}
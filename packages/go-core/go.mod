@@ -2,11 +2,13 @@ module github.com/joinnextblock/attn-protocol/go-core
 
 go 1.24.1
 
-require github.com/nbd-wtf/go-nostr v0.52.3
+require (
+	github.com/btcsuite/btcd/btcec/v2 v2.3.6
+	github.com/nbd-wtf/go-nostr v0.52.3
+)
 
 require (
 	github.com/ImVexed/fasturl v0.0.0-20230304231329-4e41488060f3 // indirect
-	github.com/btcsuite/btcd/btcec/v2 v2.3.6 // indirect
 	github.com/btcsuite/btcd/chaincfg/chainhash v1.1.0 // indirect
 	github.com/bytedance/sonic v1.13.1 // indirect
 	github.com/bytedance/sonic/loader v0.2.4 // indirect
@@ -0,0 +1,275 @@
+package payment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+var (
+	// ErrInvalidInvoice is returned when a BOLT11 invoice cannot be decoded.
+	ErrInvalidInvoice = errors.New("invalid BOLT11 invoice")
+
+	// ErrInvalidInvoiceSignature is returned when an invoice's signature does
+	// not recover its payee, or recovers a different one than its n field.
+	ErrInvalidInvoiceSignature = errors.New("invalid BOLT11 invoice signature")
+)
+
+// Invoice is a decoded BOLT11 invoice.
+type Invoice struct {
+	// Currency is the BOLT11 currency prefix: bc, tb, bcrt or tbs.
+	Currency string
+
+	// AmountMsat is the invoice amount in millisatoshis, or 0 when the invoice
+	// does not name an amount.
+	AmountMsat int64
+
+	// Timestamp is the invoice creation time in seconds since the Unix epoch.
+	Timestamp int64
+
+	// PaymentHash is the hex-encoded SHA-256 hash the payment preimage must match.
+	PaymentHash string
+
+	// Description and DescriptionHash are the d and h fields.
+	Description     string
+	DescriptionHash string
+
+	// Expiry is the x field in seconds, or 0 when absent (3600 by BOLT11 default).
+	Expiry int64
+
+	// Payee is the hex-encoded compressed public key of the node that signed the invoice.
+	Payee string
+}
+
+// BOLT11 tagged field types.
+const (
+	fieldPaymentHash     = 1
+	fieldDescription     = 13
+	fieldPayee           = 19
+	fieldDescriptionHash = 23
+	fieldExpiry          = 6
+)
+
+// signatureWords is the length of the recoverable signature in 5-bit words:
+// 64 bytes of signature and one recovery byte.
+const signatureWords = 104
+
+// DecodeInvoice decodes a BOLT11 invoice and recovers its payee from the
+// signature. Invoices are accepted in either all-lowercase or all-uppercase.
+func DecodeInvoice(invoice string) (*Invoice, error) {
+	hrp, words, err := decodeBech32(strings.ToLower(invoice))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInvoice, err.Error())
+	}
+	if !strings.HasPrefix(hrp, "ln") {
+		return nil, fmt.Errorf("%w: prefix %q is not ln", ErrInvalidInvoice, hrp)
+	}
+	if len(words) < 7+signatureWords {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidInvoice)
+	}
+
+	decoded := &Invoice{}
+	decoded.Currency, decoded.AmountMsat, err = parseAmount(hrp[2:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidInvoice, err.Error())
+	}
+
+	data := words[:len(words)-signatureWords]
+	decoded.Timestamp = int64(wordsToInt(data[:7]))
+
+	var payee string
+	for rest := data[7:]; len(rest) > 0; {
+		if len(rest) < 3 {
+			return nil, fmt.Errorf("%w: truncated field", ErrInvalidInvoice)
+		}
+		field_type := rest[0]
+		length := int(rest[1])<<5 | int(rest[2])
+		if len(rest) < 3+length {
+			return nil, fmt.Errorf("%w: truncated field", ErrInvalidInvoice)
+		}
+		value := rest[3 : 3+length]
+		rest = rest[3+length:]
+
+		// Fields with an unexpected length are skipped, as BOLT11 requires
+		switch field_type {
+		case fieldPaymentHash:
+			if length == 52 && decoded.PaymentHash == "" {
+				decoded.PaymentHash = hex.EncodeToString(wordsToBytes(value))
+			}
+		case fieldDescriptionHash:
+			if length == 52 {
+				decoded.DescriptionHash = hex.EncodeToString(wordsToBytes(value))
+			}
+		case fieldPayee:
+			if length == 53 {
+				payee = hex.EncodeToString(wordsToBytes(value))
+			}
+		case fieldDescription:
+			decoded.Description = string(wordsToBytes(value))
+		case fieldExpiry:
+			decoded.Expiry = int64(wordsToInt(value))
+		}
+	}
+	if decoded.PaymentHash == "" {
+		return nil, fmt.Errorf("%w: missing payment hash", ErrInvalidInvoice)
+	}
+
+	// The signature covers the human-readable part and the data, as bytes
+	signature := wordsToBytes(words[len(words)-signatureWords:])
+	recovery := signature[64]
+	if recovery > 3 {
+		return nil, ErrInvalidInvoiceSignature
+	}
+	hash := sha256.Sum256(append([]byte(hrp), wordsToBytesPadded(data)...))
+	compact := append([]byte{27 + 4 + recovery}, signature[:64]...)
+	key, _, err := ecdsa.RecoverCompact(compact, hash[:])
+	if err != nil {
+		return nil, ErrInvalidInvoiceSignature
+	}
+	decoded.Payee = hex.EncodeToString(key.SerializeCompressed())
+	if payee != "" && payee != decoded.Payee {
+		return nil, ErrInvalidInvoiceSignature
+	}
+	return decoded, nil
+}
+
+// parseAmount splits the part of the human-readable prefix after "ln" into
+// the currency and the amount in millisatoshis.
+func parseAmount(rest string) (string, int64, error) {
+	split := 0
+	for split < len(rest) && rest[split] >= 'a' && rest[split] <= 'z' {
+		split++
+	}
+	currency, amount := rest[:split], rest[split:]
+	if currency == "" {
+		return "", 0, errors.New("missing currency")
+	}
+	if amount == "" {
+		return currency, 0, nil
+	}
+
+	// Amounts are in bitcoin, scaled by an optional multiplier
+	msat_per_unit := int64(100_000_000_000)
+	divisor := int64(1)
+	switch amount[len(amount)-1] {
+	case 'm':
+		msat_per_unit = 100_000_000
+	case 'u':
+		msat_per_unit = 100_000
+	case 'n':
+		msat_per_unit = 100
+	case 'p':
+		msat_per_unit, divisor = 1, 10
+	}
+	if msat_per_unit != 100_000_000_000 || divisor != 1 {
+		amount = amount[:len(amount)-1]
+	}
+	if amount == "" || amount[0] == '0' {
+		return "", 0, fmt.Errorf("invalid amount %q", rest[split:])
+	}
+	value, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || value > (1<<62)/msat_per_unit {
+		return "", 0, fmt.Errorf("invalid amount %q", rest[split:])
+	}
+	if value%divisor != 0 {
+		return "", 0, fmt.Errorf("sub-millisatoshi amount %q", rest[split:])
+	}
+	return currency, value * msat_per_unit / divisor, nil
+}
+
+// bech32Charset maps 5-bit values to bech32 characters.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// decodeBech32 decodes a lowercase bech32 string without the 90-character
+// limit, which BOLT11 invoices exceed. It returns the human-readable part and
+// the data words without the checksum.
+func decodeBech32(text string) (string, []byte, error) {
+	separator := strings.LastIndexByte(text, '1')
+	if separator < 1 || separator+7 > len(text) {
+		return "", nil, errors.New("missing separator or checksum")
+	}
+	hrp := text[:separator]
+	words := make([]byte, 0, len(text)-separator-1)
+	for i := separator + 1; i < len(text); i++ {
+		value := strings.IndexByte(bech32Charset, text[i])
+		if value < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", text[i])
+		}
+		words = append(words, byte(value))
+	}
+	if bech32Polymod(append(bech32ExpandHRP(hrp), words...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+	return hrp, words[:len(words)-6], nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	checksum := uint32(1)
+	for _, value := range values {
+		top := checksum >> 25
+		checksum = (checksum&0x1ffffff)<<5 ^ uint32(value)
+		for i := 0; i < 5; i++ {
+			if (top>>i)&1 == 1 {
+				checksum ^= generator[i]
+			}
+		}
+	}
+	return checksum
+}
+
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+	expanded = append(expanded, 0)
+	for i := 0; i < len(hrp); i++ {
+		expanded = append(expanded, hrp[i]&31)
+	}
+	return expanded
+}
+
+// wordsToInt reads 5-bit words as a big-endian integer.
+func wordsToInt(words []byte) uint64 {
+	var value uint64
+	for _, word := range words {
+		value = value<<5 | uint64(word)
+	}
+	return value
+}
+
+// wordsToBytes converts 5-bit words to bytes, dropping incomplete trailing bits.
+func wordsToBytes(words []byte) []byte {
+	bytes := make([]byte, 0, len(words)*5/8)
+	var accumulator uint32
+	bits := 0
+	for _, word := range words {
+		accumulator = accumulator<<5 | uint32(word)
+		bits += 5
+		if bits >= 8 {
+			bits -= 8
+			bytes = append(bytes, byte(accumulator>>bits))
+		}
+	}
+	return bytes
+}
+
+// wordsToBytesPadded converts 5-bit words to bytes, zero-padding the last byte.
+func wordsToBytesPadded(words []byte) []byte {
+	bytes := wordsToBytes(words)
+	if bits := len(words) * 5 % 8; bits != 0 {
+		var last byte
+		for i := len(words) * 5 / 8 * 8; i < len(words)*5; i++ {
+			word, offset := words[i/5], 4-i%5
+			last = last<<1 | (word>>offset)&1
+		}
+		bytes = append(bytes, last<<(8-bits))
+	}
+	return bytes
+}
@@ -0,0 +1,219 @@
+package payment
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+// testInvoice describes an invoice for encodeInvoice.
+type testInvoice struct {
+	amount      string // e.g. "10u"; empty for no amount
+	preimage    [32]byte
+	description string
+	payee       bool // include the n field
+}
+
+// encodeInvoice builds and signs a BOLT11 invoice, so fixtures need no Lightning node.
+func encodeInvoice(t *testing.T, key *btcec.PrivateKey, invoice testInvoice) string {
+	t.Helper()
+	hrp := "lnbc" + invoice.amount
+	payment_hash := sha256.Sum256(invoice.preimage[:])
+
+	data := intToWords(1700000000, 7)
+	data = append(data, field(fieldPaymentHash, bytesToWords(payment_hash[:]))...)
+	if invoice.description != "" {
+		data = append(data, field(fieldDescription, bytesToWords([]byte(invoice.description)))...)
+	}
+	if invoice.payee {
+		data = append(data, field(fieldPayee, bytesToWords(key.PubKey().SerializeCompressed()))...)
+	}
+
+	hash := sha256.Sum256(append([]byte(hrp), wordsToBytesPadded(data)...))
+	compact := ecdsa.SignCompact(key, hash[:], true)
+	signature := append(append([]byte{}, compact[1:]...), compact[0]-27-4)
+	data = append(data, bytesToWords(signature)...)
+	return encodeBech32(hrp, data)
+}
+
+func field(field_type byte, words []byte) []byte {
+	return append([]byte{field_type, byte(len(words) >> 5), byte(len(words) & 31)}, words...)
+}
+
+func intToWords(value uint64, count int) []byte {
+	words := make([]byte, count)
+	for i := count - 1; i >= 0; i-- {
+		words[i] = byte(value & 31)
+		value >>= 5
+	}
+	return words
+}
+
+func bytesToWords(data []byte) []byte {
+	var words []byte
+	var accumulator uint32
+	bits := 0
+	for _, b := range data {
+		accumulator = accumulator<<8 | uint32(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			words = append(words, byte(accumulator>>bits)&31)
+		}
+	}
+	if bits > 0 {
+		words = append(words, byte(accumulator<<(5-bits))&31)
+	}
+	return words
+}
+
+func encodeBech32(hrp string, data []byte) string {
+	values := append(bech32ExpandHRP(hrp), data...)
+	polymod := bech32Polymod(append(values, 0, 0, 0, 0, 0, 0)) ^ 1
+	var encoded strings.Builder
+	encoded.WriteString(hrp + "1")
+	for _, word := range data {
+		encoded.WriteByte(bech32Charset[word])
+	}
+	for i := 0; i < 6; i++ {
+		encoded.WriteByte(bech32Charset[(polymod>>(5*(5-i)))&31])
+	}
+	return encoded.String()
+}
+
+func TestDecodeInvoice_SpecVectors(t *testing.T) {
+	// Examples from BOLT11
+	tests := []struct {
+		name        string
+		invoice     string
+		amount_msat int64
+		description string
+		expiry      int64
+	}{
+		{
+			name:        "donation of any amount",
+			invoice:     "lnbc1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdpl2pkx2ctnv5sxxmmwwd5kgetjypeh2ursdae8g6twvus8g6rfwvs8qun0dfjkxaq9qrsgq357wnc5r2ueh7ck6q93dj32dlqnls087fxdwk8qakdyafkq3yap9us6v52vjjsrvywa6rt52cm9r9zqt8r2t7mlcwspyetp5h2tztugp9lfyql",
+			description: "Please consider supporting this project",
+		},
+		{
+			name:        "coffee in one minute",
+			invoice:     "lnbc2500u1pvjluezsp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygspp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpu9qrsgquk0rl77nj30yxdy8j9vdx85fkpmdla2087ne0xh8nhedh8w27kyke0lp53ut353s06fv3qfegext0eh0ymjpf39tuven09sam30g4vgpfna3rh",
+			amount_msat: 250_000_000,
+			description: "1 cup coffee",
+			expiry:      60,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoice, err := DecodeInvoice(tt.invoice)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if invoice.Currency != "bc" || invoice.Timestamp != 1496314658 {
+				t.Errorf("unexpected currency or timestamp: %+v", invoice)
+			}
+			if invoice.PaymentHash != "0001020304050607080900010203040506070809000102030405060708090102" {
+				t.Errorf("unexpected payment hash %s", invoice.PaymentHash)
+			}
+			if invoice.Payee != "03e7156ae33b0a208d0744199163177e909e80176e55d97a2f221ede0f934dd9ad" {
+				t.Errorf("unexpected payee %s", invoice.Payee)
+			}
+			if invoice.AmountMsat != tt.amount_msat || invoice.Description != tt.description || invoice.Expiry != tt.expiry {
+				t.Errorf("unexpected fields: %+v", invoice)
+			}
+
+			// Uppercase invoices are valid too
+			if _, err := DecodeInvoice(strings.ToUpper(tt.invoice)); err != nil {
+				t.Errorf("expected an uppercase invoice to decode, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeInvoice_Generated(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	preimage := [32]byte{1, 2, 3}
+	encoded := encodeInvoice(t, key, testInvoice{amount: "10u", preimage: preimage, description: "attention", payee: true})
+
+	invoice, err := DecodeInvoice(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payment_hash := sha256.Sum256(preimage[:])
+	if invoice.AmountMsat != 1_000_000 || invoice.Description != "attention" || invoice.PaymentHash != hex.EncodeToString(payment_hash[:]) {
+		t.Errorf("unexpected invoice %+v", invoice)
+	}
+	if invoice.Payee != hex.EncodeToString(key.PubKey().SerializeCompressed()) {
+		t.Errorf("expected the signing key as payee, got %s", invoice.Payee)
+	}
+}
+
+func TestDecodeInvoice_Amounts(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   int64
+	}{
+		{"", 0},
+		{"1", 100_000_000_000},
+		{"2m", 200_000_000},
+		{"25u", 2_500_000},
+		{"300n", 30_000},
+		{"10p", 1},
+	}
+	key, _ := btcec.NewPrivateKey()
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			invoice, err := DecodeInvoice(encodeInvoice(t, key, testInvoice{amount: tt.amount}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if invoice.AmountMsat != tt.want {
+				t.Errorf("expected %d msat, got %d", tt.want, invoice.AmountMsat)
+			}
+		})
+	}
+
+	for _, amount := range []string{"1p", "010u", "5x"} {
+		if _, err := DecodeInvoice(encodeInvoice(t, key, testInvoice{amount: amount})); !errors.Is(err, ErrInvalidInvoice) {
+			t.Errorf("amount %q: expected ErrInvalidInvoice, got %v", amount, err)
+		}
+	}
+}
+
+func TestDecodeInvoice_Invalid(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	other, _ := btcec.NewPrivateKey()
+	encoded := encodeInvoice(t, key, testInvoice{amount: "10u", payee: true})
+
+	// Flip one data character, breaking the checksum
+	position := len(encoded) - 20
+	flipped := encoded[:position] + string(bech32Charset[(strings.IndexByte(bech32Charset, encoded[position])+1)%32]) + encoded[position+1:]
+	if _, err := DecodeInvoice(flipped); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("expected a bad checksum to fail, got %v", err)
+	}
+
+	if _, err := DecodeInvoice("not an invoice"); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("expected garbage to fail, got %v", err)
+	}
+	if _, err := DecodeInvoice(encodeBech32("bc", make([]byte, 120))); !errors.Is(err, ErrInvalidInvoice) {
+		t.Errorf("expected a non-ln prefix to fail, got %v", err)
+	}
+
+	// An n field naming another node than the signer
+	_, words, _ := decodeBech32(encoded)
+	data := words[:len(words)-signatureWords]
+	payee := bytesToWords(other.PubKey().SerializeCompressed())
+	copy(data[len(data)-len(payee):], payee)
+	hash := sha256.Sum256(append([]byte("lnbc10u"), wordsToBytesPadded(data)...))
+	compact := ecdsa.SignCompact(key, hash[:], true)
+	signature := append(append([]byte{}, compact[1:]...), compact[0]-27-4)
+	forged := encodeBech32("lnbc10u", append(data, bytesToWords(signature)...))
+	if _, err := DecodeInvoice(forged); !errors.Is(err, ErrInvalidInvoiceSignature) {
+		t.Errorf("expected a mismatched payee to fail, got %v", err)
+	}
+}
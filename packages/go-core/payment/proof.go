@@ -0,0 +1,291 @@
+// Package payment verifies the payment proofs of ATTENTION_PAYMENT_CONFIRMATION events.
+//
+// payment_proof is a string. Two structured formats are defined; other values
+// are free-form and cannot be verified:
+//
+//	bolt11:<invoice>:<preimage>  a paid BOLT11 invoice and its 32-byte hex preimage
+//	zap:<event_id>               the ID of a NIP-57 zap receipt (kind 9735)
+//
+// Verification needs no Lightning node. A BOLT11 proof holds when the
+// preimage hashes to the invoice's payment hash and the invoice amount equals
+// sats_received. A zap proof holds when the receipt's bolt11 amount equals
+// sats_received and, if the receipt carries a preimage, it matches.
+//
+// Example usage:
+//
+//	proof := payment.BOLT11Proof(invoice, preimage).String()
+//
+//	// Zap receipts are looked up by ID; lookup may be nil for BOLT11 proofs
+//	err := payment.VerifyConfirmation(ctx, event, lookup)
+package payment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrNoProof is returned when a payment confirmation has no payment_proof.
+	ErrNoProof = errors.New("no payment proof")
+
+	// ErrUnstructuredProof is returned for a free-form payment_proof.
+	ErrUnstructuredProof = errors.New("payment proof is not in a structured format")
+
+	// ErrInvalidProof is returned for a structured payment_proof that is malformed.
+	ErrInvalidProof = errors.New("invalid payment proof")
+
+	// ErrPreimageMismatch is returned when a preimage does not hash to the invoice's payment hash.
+	ErrPreimageMismatch = errors.New("preimage does not match the invoice payment hash")
+
+	// ErrAmountMismatch is returned when the paid amount differs from sats_received.
+	ErrAmountMismatch = errors.New("paid amount does not equal sats_received")
+
+	// ErrNoAmount is returned when an invoice does not name an amount.
+	ErrNoAmount = errors.New("invoice has no amount")
+
+	// ErrInvalidZapReceipt is returned when a zap receipt is not a valid kind 9735 event.
+	ErrInvalidZapReceipt = errors.New("invalid zap receipt")
+
+	// ErrNoReceiptLookup is returned when a zap proof is verified without a ReceiptLookup.
+	ErrNoReceiptLookup = errors.New("no zap receipt lookup")
+)
+
+// ProofType names a structured payment proof format.
+type ProofType string
+
+const (
+	// ProofBOLT11 is a paid BOLT11 invoice and its preimage.
+	ProofBOLT11 ProofType = "bolt11"
+
+	// ProofZapReceipt is the ID of a NIP-57 zap receipt.
+	ProofZapReceipt ProofType = "zap"
+)
+
+// Proof is a structured payment proof.
+type Proof struct {
+	Type ProofType
+
+	// Invoice and Preimage are set for ProofBOLT11. The preimage is 64
+	// lowercase hex characters.
+	Invoice  string
+	Preimage string
+
+	// ZapReceiptID is set for ProofZapReceipt.
+	ZapReceiptID string
+}
+
+// BOLT11Proof returns a proof of a paid BOLT11 invoice.
+func BOLT11Proof(invoice, preimage string) Proof {
+	return Proof{Type: ProofBOLT11, Invoice: invoice, Preimage: preimage}
+}
+
+// ZapReceiptProof returns a proof referencing a zap receipt.
+func ZapReceiptProof(receipt_id string) Proof {
+	return Proof{Type: ProofZapReceipt, ZapReceiptID: receipt_id}
+}
+
+// String encodes the proof for payment_proof. Invoices are lowercased.
+func (p Proof) String() string {
+	switch p.Type {
+	case ProofBOLT11:
+		return string(ProofBOLT11) + ":" + strings.ToLower(p.Invoice) + ":" + p.Preimage
+	case ProofZapReceipt:
+		return string(ProofZapReceipt) + ":" + p.ZapReceiptID
+	}
+	return ""
+}
+
+// IsStructured reports whether a payment_proof claims a structured format,
+// that is whether it starts with a known "<type>:" prefix.
+func IsStructured(payment_proof string) bool {
+	return strings.HasPrefix(payment_proof, string(ProofBOLT11)+":") || strings.HasPrefix(payment_proof, string(ProofZapReceipt)+":")
+}
+
+// ParseProof parses a structured payment_proof. It checks the format only;
+// use Verify to check the proof against an amount.
+func ParseProof(payment_proof string) (Proof, error) {
+	if !IsStructured(payment_proof) {
+		return Proof{}, ErrUnstructuredProof
+	}
+	if id, ok := strings.CutPrefix(payment_proof, string(ProofZapReceipt)+":"); ok {
+		if !isHex64(id) {
+			return Proof{}, fmt.Errorf("%w: zap receipt ID must be 64 hex characters", ErrInvalidProof)
+		}
+		return ZapReceiptProof(id), nil
+	}
+
+	rest := strings.TrimPrefix(payment_proof, string(ProofBOLT11)+":")
+	separator := strings.LastIndexByte(rest, ':')
+	if separator < 0 {
+		return Proof{}, fmt.Errorf("%w: expected bolt11:<invoice>:<preimage>", ErrInvalidProof)
+	}
+	invoice, preimage := rest[:separator], rest[separator+1:]
+	if !isInvoiceText(invoice) || !isHex64(preimage) {
+		return Proof{}, fmt.Errorf("%w: expected bolt11:<invoice>:<preimage>", ErrInvalidProof)
+	}
+	return BOLT11Proof(invoice, preimage), nil
+}
+
+// VerifyPreimage checks that a hex-encoded preimage hashes to the invoice's payment hash.
+func VerifyPreimage(invoice *Invoice, preimage string) error {
+	raw, err := hex.DecodeString(preimage)
+	if err != nil || len(raw) != 32 {
+		return fmt.Errorf("%w: preimage must be 32 hex-encoded bytes", ErrInvalidProof)
+	}
+	hash := sha256.Sum256(raw)
+	if hex.EncodeToString(hash[:]) != invoice.PaymentHash {
+		return ErrPreimageMismatch
+	}
+	return nil
+}
+
+// VerifyAmount checks that an invoice is for exactly sats_received.
+func VerifyAmount(invoice *Invoice, sats_received int64) error {
+	if invoice.AmountMsat == 0 {
+		return ErrNoAmount
+	}
+	if invoice.AmountMsat != sats_received*1000 {
+		return fmt.Errorf("%w: invoice is for %d msat, sats_received is %d", ErrAmountMismatch, invoice.AmountMsat, sats_received)
+	}
+	return nil
+}
+
+// VerifyBOLT11 decodes a BOLT11 proof's invoice and checks its preimage and amount.
+func VerifyBOLT11(proof Proof, sats_received int64) (*Invoice, error) {
+	invoice, err := DecodeInvoice(proof.Invoice)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyPreimage(invoice, proof.Preimage); err != nil {
+		return nil, err
+	}
+	if err := VerifyAmount(invoice, sats_received); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
+
+// VerifyZapReceipt checks a NIP-57 zap receipt: its signature, its bolt11
+// amount against sats_received and the zap request's amount tag, and its
+// preimage tag when present.
+func VerifyZapReceipt(receipt *nostr.Event, sats_received int64) (*Invoice, error) {
+	if receipt.Kind != nostr.KindZap {
+		return nil, fmt.Errorf("%w: kind %d", ErrInvalidZapReceipt, receipt.Kind)
+	}
+	if ok, err := receipt.CheckSignature(); !ok || err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidZapReceipt)
+	}
+	bolt11 := receipt.Tags.Find("bolt11")
+	if bolt11 == nil {
+		return nil, fmt.Errorf("%w: missing bolt11 tag", ErrInvalidZapReceipt)
+	}
+	invoice, err := DecodeInvoice(bolt11[1])
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyAmount(invoice, sats_received); err != nil {
+		return nil, err
+	}
+
+	// The zap request in the description tag may name the amount it asked for
+	if description := receipt.Tags.Find("description"); description != nil {
+		var request nostr.Event
+		if err := json.Unmarshal([]byte(description[1]), &request); err != nil || request.Kind != nostr.KindZapRequest {
+			return nil, fmt.Errorf("%w: description is not a zap request", ErrInvalidZapReceipt)
+		}
+		if amount := request.Tags.Find("amount"); amount != nil {
+			if msat, err := strconv.ParseInt(amount[1], 10, 64); err != nil || msat != invoice.AmountMsat {
+				return nil, fmt.Errorf("%w: zap request amount %s differs from the invoice", ErrAmountMismatch, amount[1])
+			}
+		}
+	}
+	if preimage := receipt.Tags.Find("preimage"); preimage != nil {
+		if err := VerifyPreimage(invoice, preimage[1]); err != nil {
+			return nil, err
+		}
+	}
+	return invoice, nil
+}
+
+// ReceiptLookup fetches a zap receipt by event ID.
+type ReceiptLookup func(ctx context.Context, id string) (*nostr.Event, error)
+
+// Verify checks a structured payment_proof against sats_received. lookup
+// fetches zap receipts and may be nil when only BOLT11 proofs are expected.
+func Verify(ctx context.Context, payment_proof string, sats_received int64, lookup ReceiptLookup) error {
+	proof, err := ParseProof(payment_proof)
+	if err != nil {
+		return err
+	}
+	switch proof.Type {
+	case ProofBOLT11:
+		_, err = VerifyBOLT11(proof, sats_received)
+		return err
+	default:
+		if lookup == nil {
+			return ErrNoReceiptLookup
+		}
+		receipt, err := lookup(ctx, proof.ZapReceiptID)
+		if err != nil {
+			return err
+		}
+		// CheckSignature signs over the serialized event, not its ID field, so
+		// the ID is recomputed to bind the receipt to the proof
+		if id := receipt.GetID(); id != proof.ZapReceiptID {
+			return fmt.Errorf("%w: looked up %s, got %s", ErrInvalidZapReceipt, proof.ZapReceiptID, id)
+		}
+		_, err = VerifyZapReceipt(receipt, sats_received)
+		return err
+	}
+}
+
+// VerifyConfirmation verifies the payment_proof of an ATTENTION_PAYMENT_CONFIRMATION
+// event against its sats_received.
+func VerifyConfirmation(ctx context.Context, event *nostr.Event, lookup ReceiptLookup) error {
+	if event.Kind != core.KindAttentionPaymentConfirmation {
+		return fmt.Errorf("%w: kind %d is not a payment confirmation", ErrInvalidProof, event.Kind)
+	}
+	var content core.AttentionPaymentConfirmationData
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidProof, err.Error())
+	}
+	if content.PaymentProof == "" {
+		return ErrNoProof
+	}
+	return Verify(ctx, content.PaymentProof, content.SatsReceived, lookup)
+}
+
+// isInvoiceText reports whether value looks like a lowercase BOLT11 invoice.
+// DecodeInvoice checks the rest.
+func isInvoiceText(value string) bool {
+	if len(value) < 3 || !strings.HasPrefix(value, "ln") {
+		return false
+	}
+	for i := 2; i < len(value); i++ {
+		if c := value[i]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex64(value string) bool {
+	if len(value) != 64 {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		if c := value[i]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
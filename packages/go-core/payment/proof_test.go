@@ -0,0 +1,167 @@
+package payment
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestParseProof(t *testing.T) {
+	preimage := strings.Repeat("ab", 32)
+	id := strings.Repeat("cd", 32)
+
+	proof, err := ParseProof("bolt11:lnbc10u1xyz:" + preimage)
+	if err != nil || proof != BOLT11Proof("lnbc10u1xyz", preimage) {
+		t.Errorf("unexpected BOLT11 proof %+v, %v", proof, err)
+	}
+	proof, err = ParseProof("zap:" + id)
+	if err != nil || proof != ZapReceiptProof(id) {
+		t.Errorf("unexpected zap proof %+v, %v", proof, err)
+	}
+	if round := ZapReceiptProof(id).String(); round != "zap:"+id {
+		t.Errorf("unexpected encoding %s", round)
+	}
+
+	if _, err := ParseProof("lnbc-preimage-placeholder"); err != ErrUnstructuredProof {
+		t.Errorf("expected a free-form proof to be unstructured, got %v", err)
+	}
+	for _, malformed := range []string{"zap:abc", "bolt11:lnbc10u1xyz", "bolt11:bc1xyz:" + preimage, "bolt11:LNBC10U1XYZ:" + preimage, "bolt11:lnbc10u1xyz:" + strings.ToUpper(preimage)} {
+		if _, err := ParseProof(malformed); !errors.Is(err, ErrInvalidProof) {
+			t.Errorf("%s: expected ErrInvalidProof, got %v", malformed, err)
+		}
+	}
+}
+
+func TestVerify_BOLT11(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	preimage := [32]byte{7, 7, 7}
+	invoice := encodeInvoice(t, key, testInvoice{amount: "25u", preimage: preimage})
+	proof := BOLT11Proof(invoice, hex.EncodeToString(preimage[:])).String()
+	ctx := context.Background()
+
+	if err := Verify(ctx, proof, 2500, nil); err != nil {
+		t.Errorf("expected the proof to verify, got %v", err)
+	}
+	if err := Verify(ctx, proof, 2501, nil); !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("expected ErrAmountMismatch, got %v", err)
+	}
+	wrong := BOLT11Proof(invoice, strings.Repeat("00", 32)).String()
+	if err := Verify(ctx, wrong, 2500, nil); err != ErrPreimageMismatch {
+		t.Errorf("expected ErrPreimageMismatch, got %v", err)
+	}
+
+	any_amount := encodeInvoice(t, key, testInvoice{preimage: preimage})
+	if err := Verify(ctx, BOLT11Proof(any_amount, hex.EncodeToString(preimage[:])).String(), 2500, nil); err != ErrNoAmount {
+		t.Errorf("expected ErrNoAmount, got %v", err)
+	}
+}
+
+// zapReceipt builds a signed zap receipt for a BOLT11 invoice, as a zapper would.
+func zapReceipt(t *testing.T, invoice, request_amount, preimage string) *nostr.Event {
+	t.Helper()
+	request := nostr.Event{Kind: nostr.KindZapRequest, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"p", strings.Repeat("a", 64)}}}
+	if request_amount != "" {
+		request.Tags = append(request.Tags, nostr.Tag{"amount", request_amount})
+	}
+	request.Sign(nostr.GeneratePrivateKey())
+	description, _ := json.Marshal(request)
+
+	receipt := &nostr.Event{
+		Kind:      nostr.KindZap,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", strings.Repeat("a", 64)}, {"bolt11", invoice}, {"description", string(description)}},
+	}
+	if preimage != "" {
+		receipt.Tags = append(receipt.Tags, nostr.Tag{"preimage", preimage})
+	}
+	if err := receipt.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+func TestVerify_ZapReceipt(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	preimage := [32]byte{9}
+	invoice := encodeInvoice(t, key, testInvoice{amount: "10u", preimage: preimage})
+	ctx := context.Background()
+
+	receipts := map[string]*nostr.Event{}
+	lookup := func(_ context.Context, id string) (*nostr.Event, error) {
+		if receipt, ok := receipts[id]; ok {
+			return receipt, nil
+		}
+		return nil, errors.New("not found")
+	}
+	add := func(receipt *nostr.Event) string {
+		receipts[receipt.ID] = receipt
+		return ZapReceiptProof(receipt.ID).String()
+	}
+
+	valid := add(zapReceipt(t, invoice, "1000000", hex.EncodeToString(preimage[:])))
+	if err := Verify(ctx, valid, 1000, lookup); err != nil {
+		t.Errorf("expected the zap receipt to verify, got %v", err)
+	}
+	if err := Verify(ctx, valid, 999, lookup); !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("expected ErrAmountMismatch, got %v", err)
+	}
+	if err := Verify(ctx, valid, 1000, nil); err != ErrNoReceiptLookup {
+		t.Errorf("expected ErrNoReceiptLookup, got %v", err)
+	}
+
+	requested := add(zapReceipt(t, invoice, "2000000", ""))
+	if err := Verify(ctx, requested, 1000, lookup); !errors.Is(err, ErrAmountMismatch) {
+		t.Errorf("expected a zap request amount mismatch, got %v", err)
+	}
+	bad_preimage := add(zapReceipt(t, invoice, "", strings.Repeat("00", 32)))
+	if err := Verify(ctx, bad_preimage, 1000, lookup); err != ErrPreimageMismatch {
+		t.Errorf("expected ErrPreimageMismatch, got %v", err)
+	}
+
+	tampered := zapReceipt(t, invoice, "", "")
+	tampered.Content = "changed"
+	if err := Verify(ctx, add(tampered), 1000, lookup); !errors.Is(err, ErrInvalidZapReceipt) {
+		t.Errorf("expected a bad signature to fail, got %v", err)
+	}
+
+	// A receipt served under another receipt's ID keeps a valid signature
+	other := zapReceipt(t, invoice, "", "")
+	forged := zapReceipt(t, invoice, "", "")
+	forged.ID = other.ID
+	if err := Verify(ctx, add(forged), 1000, lookup); !errors.Is(err, ErrInvalidZapReceipt) {
+		t.Errorf("expected a tampered ID to fail, got %v", err)
+	}
+}
+
+func TestVerifyConfirmation(t *testing.T) {
+	key, _ := btcec.NewPrivateKey()
+	preimage := [32]byte{4, 2}
+	invoice := encodeInvoice(t, key, testInvoice{amount: "5u", preimage: preimage})
+	confirmation := func(content core.AttentionPaymentConfirmationData) *nostr.Event {
+		data, _ := json.Marshal(content)
+		return &nostr.Event{Kind: core.KindAttentionPaymentConfirmation, Content: string(data)}
+	}
+	ctx := context.Background()
+
+	paid := confirmation(core.AttentionPaymentConfirmationData{SatsReceived: 500, PaymentProof: BOLT11Proof(invoice, hex.EncodeToString(preimage[:])).String()})
+	if err := VerifyConfirmation(ctx, paid, nil); err != nil {
+		t.Errorf("expected the confirmation to verify, got %v", err)
+	}
+	if err := VerifyConfirmation(ctx, confirmation(core.AttentionPaymentConfirmationData{SatsReceived: 500}), nil); err != ErrNoProof {
+		t.Errorf("expected ErrNoProof, got %v", err)
+	}
+	free_form := confirmation(core.AttentionPaymentConfirmationData{SatsReceived: 500, PaymentProof: "lnbc-preimage-placeholder"})
+	if err := VerifyConfirmation(ctx, free_form, nil); err != ErrUnstructuredProof {
+		t.Errorf("expected ErrUnstructuredProof, got %v", err)
+	}
+	if err := VerifyConfirmation(ctx, &nostr.Event{Kind: core.KindMatch}, nil); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("expected another kind to fail, got %v", err)
+	}
+}
@@ -0,0 +1,292 @@
+// Package relayplugin adapts ATTN Protocol validation to the reject-event hooks
+// used by Go relay frameworks such as khatru.
+//
+// Every check has the hook signature
+//
+//	func(ctx context.Context, event *nostr.Event) (reject bool, msg string)
+//
+// and answers with NIP-01 machine-readable prefixes ("invalid:", "restricted:",
+// "rate-limited:", "error:") so clients can tell why an event was refused.
+// Non-ATTN kinds are always passed through; the relay decides what to do with them.
+//
+// Example usage with khatru:
+//
+//	plugin := relayplugin.NewPlugin(relayplugin.Options{
+//	    RateLimits:       map[int]relayplugin.RateLimit{core.KindAttention: {Events: 10, Interval: time.Minute}},
+//	    CheckAuthorRoles: true,
+//	    Query:            db.QueryEvents,
+//	})
+//	relay.RejectEvent = append(relay.RejectEvent, plugin.RejectEvent)
+//
+// This package has no logging dependencies. Logging should be done at the call site.
+package relayplugin
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// QueryFunc queries the relay's own store.
+// It matches khatru's QueryEvents hook and eventstore's QueryEvents method,
+// so either can be passed directly.
+type QueryFunc func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error)
+
+// RateLimit allows at most Events events of one kind per author within each Interval.
+type RateLimit struct {
+	Events   int
+	Interval time.Duration
+}
+
+// Options holds configuration for a Plugin.
+type Options struct {
+	// RateLimits maps event kinds to per-author rate limits.
+	// Kinds without an entry are not rate limited.
+	RateLimits map[int]RateLimit
+
+	// CheckAuthorRoles rejects events signed by a pubkey that does not hold the
+	// role the kind requires, e.g. a MATCH not signed by the referenced marketplace.
+	CheckAuthorRoles bool
+
+	// AllowedAuthors maps event kinds to the only pubkeys allowed to publish them.
+	// Kinds without an entry are open to every author.
+	AllowedAuthors map[int][]string
+
+	// Query enables referential checks: ATTN coordinates referenced by 'a' tags
+	// must already exist in the relay's store. Nil disables the checks.
+	Query QueryFunc
+
+	// Now returns the current time for rate limiting. Defaults to time.Now.
+	Now func() time.Time
+
+	// Registry validates events in ValidateEvent, so relays can add policy
+	// middleware or experimental kinds. Kinds it has no validator for pass
+	// through. Defaults to validation.NewDefaultRegistry().
+	Registry *validation.Registry
+}
+
+// Plugin holds the state for ATTN Protocol relay checks.
+// It is safe for concurrent use.
+type Plugin struct {
+	options         Options
+	allowed_authors map[int]map[string]bool
+
+	mu      sync.Mutex
+	windows map[rateKey]*rateWindow
+}
+
+// rateKey identifies a rate limit bucket.
+type rateKey struct {
+	kind   int
+	pubkey string
+}
+
+// rateWindow counts events in the current fixed window.
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// maxRateWindows bounds the rate limit table before expired windows are swept.
+const maxRateWindows = 10000
+
+// NewPlugin creates a Plugin with the given options.
+func NewPlugin(options Options) *Plugin {
+	if options.Now == nil {
+		options.Now = time.Now
+	}
+	if options.Registry == nil {
+		options.Registry = validation.NewDefaultRegistry()
+	}
+
+	allowed_authors := make(map[int]map[string]bool, len(options.AllowedAuthors))
+	for kind, pubkeys := range options.AllowedAuthors {
+		allowed := make(map[string]bool, len(pubkeys))
+		for _, pubkey := range pubkeys {
+			allowed[pubkey] = true
+		}
+		allowed_authors[kind] = allowed
+	}
+
+	return &Plugin{
+		options:         options,
+		allowed_authors: allowed_authors,
+		windows:         make(map[rateKey]*rateWindow),
+	}
+}
+
+// RejectEvent runs every configured check in order: validation, author roles,
+// allowed authors, referential checks and finally rate limits, so events that
+// are rejected for other reasons do not consume an author's rate limit.
+func (p *Plugin) RejectEvent(ctx context.Context, event *nostr.Event) (bool, string) {
+	checks := []func(context.Context, *nostr.Event) (bool, string){
+		p.ValidateEvent,
+		p.CheckAuthorRole,
+		p.CheckAllowedAuthors,
+		p.CheckReferences,
+		p.CheckRateLimit,
+	}
+	for _, check := range checks {
+		if reject, msg := check(ctx, event); reject {
+			return true, msg
+		}
+	}
+	return false, ""
+}
+
+// ValidateEvent rejects events that fail the registry's validator for their kind.
+// With the default registry this is validation.ValidateATTNEvent for ATTN Protocol kinds.
+func (p *Plugin) ValidateEvent(ctx context.Context, event *nostr.Event) (bool, string) {
+	if !p.options.Registry.Has(event.Kind) {
+		return false, ""
+	}
+	if result := p.options.Registry.ValidateContext(ctx, event); !result.Valid {
+		return true, "invalid: " + result.Message
+	}
+	return false, ""
+}
+
+// authorRoles maps kinds to the coordinate kind whose pubkey must sign them.
+var authorRoles = map[int]int{
+	core.KindMatch:                        core.KindMarketplace, // MATCH is published by the marketplace
+	core.KindBillboardConfirmation:        core.KindBillboard,   // BILLBOARD_CONFIRMATION is published by the billboard operator
+	core.KindAttentionConfirmation:        core.KindAttention,   // ATTENTION_CONFIRMATION is published by the attention owner
+	core.KindMarketplaceConfirmation:      core.KindMarketplace, // MARKETPLACE_CONFIRMATION is published by the marketplace
+	core.KindAttentionPaymentConfirmation: core.KindAttention,   // ATTENTION_PAYMENT_CONFIRMATION is published by the attention owner
+}
+
+// roleNames describes the coordinate kinds in authorRoles for rejection messages.
+var roleNames = map[int]string{
+	core.KindMarketplace: "marketplace",
+	core.KindBillboard:   "billboard",
+	core.KindAttention:   "attention",
+}
+
+// CheckAuthorRole rejects events whose author does not match the pubkey of the
+// coordinate that holds the required role. Does nothing unless CheckAuthorRoles is set.
+func (p *Plugin) CheckAuthorRole(ctx context.Context, event *nostr.Event) (bool, string) {
+	if !p.options.CheckAuthorRoles {
+		return false, ""
+	}
+	role_kind, ok := authorRoles[event.Kind]
+	if !ok {
+		return false, ""
+	}
+
+	prefix := strconv.Itoa(role_kind) + ":"
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" || !strings.HasPrefix(tag[1], prefix) {
+			continue
+		}
+		_, pubkey, _, err := core.ParseCoordinate(tag[1])
+		if err != nil {
+			return true, "invalid: " + err.Error()
+		}
+		if pubkey != event.PubKey {
+			return true, fmt.Sprintf("invalid: kind %d must be signed by the referenced %s pubkey", event.Kind, roleNames[role_kind])
+		}
+		return false, ""
+	}
+	return true, fmt.Sprintf("invalid: kind %d must reference a %s coordinate", event.Kind, roleNames[role_kind])
+}
+
+// CheckAllowedAuthors rejects events from authors outside the kind's allowlist.
+func (p *Plugin) CheckAllowedAuthors(ctx context.Context, event *nostr.Event) (bool, string) {
+	allowed, ok := p.allowed_authors[event.Kind]
+	if !ok || allowed[event.PubKey] {
+		return false, ""
+	}
+	return true, fmt.Sprintf("restricted: pubkey not allowed to publish kind %d", event.Kind)
+}
+
+// CheckReferences rejects ATTN events whose 'a' tags reference ATTN coordinates
+// that are not in the relay's store. Block (38808), video and list coordinates
+// live outside the marketplace and are not checked. Does nothing unless Query is set.
+func (p *Plugin) CheckReferences(ctx context.Context, event *nostr.Event) (bool, string) {
+	if p.options.Query == nil || !validation.IsATTNProtocolKind(event.Kind) {
+		return false, ""
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		kind, pubkey, d_tag, err := core.ParseCoordinate(tag[1])
+		if err != nil || !validation.IsATTNProtocolKind(kind) {
+			continue
+		}
+
+		found, err := p.exists(ctx, nostr.Filter{
+			Kinds:   []int{kind},
+			Authors: []string{pubkey},
+			Tags:    nostr.TagMap{"d": []string{d_tag}},
+			Limit:   1,
+		})
+		if err != nil {
+			return true, "error: could not check referenced events: " + err.Error()
+		}
+		if !found {
+			return true, fmt.Sprintf("invalid: referenced event %s not found", tag[1])
+		}
+	}
+	return false, ""
+}
+
+// exists reports whether the query returns at least one event, draining the channel.
+func (p *Plugin) exists(ctx context.Context, filter nostr.Filter) (bool, error) {
+	ch, err := p.options.Query(ctx, filter)
+	if err != nil {
+		return false, err
+	}
+	found := false
+	for range ch {
+		found = true
+	}
+	return found, nil
+}
+
+// CheckRateLimit rejects events once an author exceeds the rate limit for the kind.
+// Accepted calls count against the limit.
+func (p *Plugin) CheckRateLimit(ctx context.Context, event *nostr.Event) (bool, string) {
+	limit, ok := p.options.RateLimits[event.Kind]
+	if !ok || limit.Events <= 0 || limit.Interval <= 0 {
+		return false, ""
+	}
+
+	now := p.options.Now()
+	key := rateKey{kind: event.Kind, pubkey: event.PubKey}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.windows) >= maxRateWindows {
+		p.sweep(now)
+	}
+
+	window, ok := p.windows[key]
+	if !ok || now.Sub(window.start) >= limit.Interval {
+		window = &rateWindow{start: now}
+		p.windows[key] = window
+	}
+	if window.count >= limit.Events {
+		return true, fmt.Sprintf("rate-limited: at most %d kind %d events per %s", limit.Events, event.Kind, limit.Interval)
+	}
+	window.count++
+	return false, ""
+}
+
+// sweep removes windows that have expired. Callers must hold p.mu.
+func (p *Plugin) sweep(now time.Time) {
+	for key, window := range p.windows {
+		if now.Sub(window.start) >= p.options.RateLimits[key.kind].Interval {
+			delete(p.windows, key)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package relayplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// createTestMatchEvent creates a valid MATCH event (kind 38888) authored by author
+// that references a marketplace owned by marketplace_pubkey.
+func createTestMatchEvent(author string, marketplace_pubkey string) *nostr.Event {
+	other := strings.Repeat("b", 64)
+	event := &nostr.Event{
+		Kind:      38888,
+		PubKey:    author,
+		CreatedAt: nostr.Now(),
+		Content: `{"ref_match_id":"m1","ref_promotion_id":"p1","ref_attention_id":"at1","ref_billboard_id":"b1",` +
+			`"ref_marketplace_id":"mk1","ref_marketplace_pubkey":"x","ref_promotion_pubkey":"x","ref_attention_pubkey":"x","ref_billboard_pubkey":"x"}`,
+		Tags: nostr.Tags{
+			{"d", "org.attnprotocol:match:m1"},
+			{"t", "870500"},
+			{"a", fmt.Sprintf("38188:%s:org.attnprotocol:marketplace:mk1", marketplace_pubkey)},
+			{"a", fmt.Sprintf("38288:%s:org.attnprotocol:billboard:b1", other)},
+			{"a", fmt.Sprintf("38388:%s:org.attnprotocol:promotion:p1", other)},
+			{"a", fmt.Sprintf("38488:%s:org.attnprotocol:attention:at1", other)},
+			{"p", marketplace_pubkey}, {"p", other}, {"p", other}, {"p", other},
+			{"r", "wss://relay.example.com"},
+			{"k", "34236"},
+		},
+	}
+	event.ID = event.GetID()
+	return event
+}
+
+// queryFrom returns a QueryFunc over a fixed set of events.
+func queryFrom(events ...*nostr.Event) QueryFunc {
+	return func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+		ch := make(chan *nostr.Event, len(events))
+		for _, event := range events {
+			if filter.Matches(event) {
+				ch <- event
+			}
+		}
+		close(ch)
+		return ch, nil
+	}
+}
+
+func TestRejectEvent_Validation(t *testing.T) {
+	plugin := NewPlugin(Options{})
+	marketplace := strings.Repeat("a", 64)
+
+	if reject, msg := plugin.RejectEvent(context.Background(), createTestMatchEvent(marketplace, marketplace)); reject {
+		t.Errorf("expected valid match to pass, got %q", msg)
+	}
+
+	invalid := createTestMatchEvent(marketplace, marketplace)
+	invalid.Tags = invalid.Tags[:1]
+	reject, msg := plugin.RejectEvent(context.Background(), invalid)
+	if !reject || !strings.HasPrefix(msg, "invalid: ") {
+		t.Errorf("expected invalid: rejection, got %v %q", reject, msg)
+	}
+
+	// Non-ATTN kinds pass through
+	if reject, _ := plugin.RejectEvent(context.Background(), &nostr.Event{Kind: 1}); reject {
+		t.Error("expected non-ATTN kind to pass through")
+	}
+}
+
+func TestValidateEvent_Registry(t *testing.T) {
+	// Local policy: MATCH events must list at least two relays
+	two_relays := func(next validation.Validator) validation.Validator {
+		return validation.ValidatorFunc(func(event *nostr.Event) validation.ValidationResult {
+			if event.Kind == 38888 && len(event.Tags.GetAll([]string{"r"})) < 2 {
+				return validation.ValidationResult{Valid: false, Code: "policy", Message: "at least two relays required"}
+			}
+			return next.Validate(event)
+		})
+	}
+	registry := validation.NewDefaultRegistry()
+	registry.Use(two_relays)
+	plugin := NewPlugin(Options{Registry: registry})
+
+	marketplace := strings.Repeat("a", 64)
+	reject, msg := plugin.ValidateEvent(context.Background(), createTestMatchEvent(marketplace, marketplace))
+	if !reject || msg != "invalid: at least two relays required" {
+		t.Errorf("expected policy rejection, got %v %q", reject, msg)
+	}
+}
+
+func TestCheckAuthorRole(t *testing.T) {
+	plugin := NewPlugin(Options{CheckAuthorRoles: true})
+	marketplace := strings.Repeat("a", 64)
+	stranger := strings.Repeat("c", 64)
+
+	if reject, msg := plugin.RejectEvent(context.Background(), createTestMatchEvent(marketplace, marketplace)); reject {
+		t.Errorf("expected marketplace-signed match to pass, got %q", msg)
+	}
+
+	reject, msg := plugin.RejectEvent(context.Background(), createTestMatchEvent(stranger, marketplace))
+	if !reject || !strings.Contains(msg, "signed by the referenced marketplace pubkey") {
+		t.Errorf("expected role rejection, got %v %q", reject, msg)
+	}
+
+	// Role checks are off by default
+	if reject, _ := NewPlugin(Options{}).RejectEvent(context.Background(), createTestMatchEvent(stranger, marketplace)); reject {
+		t.Error("expected role checks to be disabled by default")
+	}
+}
+
+func TestCheckAllowedAuthors(t *testing.T) {
+	marketplace := strings.Repeat("a", 64)
+	plugin := NewPlugin(Options{AllowedAuthors: map[int][]string{38888: {marketplace}}})
+
+	if reject, _ := plugin.CheckAllowedAuthors(context.Background(), createTestMatchEvent(marketplace, marketplace)); reject {
+		t.Error("expected allowed author to pass")
+	}
+
+	other := strings.Repeat("d", 64)
+	reject, msg := plugin.CheckAllowedAuthors(context.Background(), createTestMatchEvent(other, other))
+	if !reject || !strings.HasPrefix(msg, "restricted: ") {
+		t.Errorf("expected restricted: rejection, got %v %q", reject, msg)
+	}
+}
+
+func TestCheckReferences(t *testing.T) {
+	marketplace := strings.Repeat("a", 64)
+	other := strings.Repeat("b", 64)
+	match := createTestMatchEvent(marketplace, marketplace)
+
+	referenced := []*nostr.Event{
+		{Kind: 38188, PubKey: marketplace, Tags: nostr.Tags{{"d", "org.attnprotocol:marketplace:mk1"}}},
+		{Kind: 38288, PubKey: other, Tags: nostr.Tags{{"d", "org.attnprotocol:billboard:b1"}}},
+		{Kind: 38388, PubKey: other, Tags: nostr.Tags{{"d", "org.attnprotocol:promotion:p1"}}},
+		{Kind: 38488, PubKey: other, Tags: nostr.Tags{{"d", "org.attnprotocol:attention:at1"}}},
+	}
+
+	plugin := NewPlugin(Options{Query: queryFrom(referenced...)})
+	if reject, msg := plugin.CheckReferences(context.Background(), match); reject {
+		t.Errorf("expected references to resolve, got %q", msg)
+	}
+
+	plugin = NewPlugin(Options{Query: queryFrom(referenced[:3]...)})
+	reject, msg := plugin.CheckReferences(context.Background(), match)
+	if !reject || !strings.HasPrefix(msg, "invalid: referenced event 38488:") {
+		t.Errorf("expected missing attention rejection, got %v %q", reject, msg)
+	}
+
+	failing := func(ctx context.Context, filter nostr.Filter) (chan *nostr.Event, error) {
+		return nil, errors.New("store offline")
+	}
+	plugin = NewPlugin(Options{Query: failing})
+	if reject, msg := plugin.CheckReferences(context.Background(), match); !reject || !strings.HasPrefix(msg, "error: ") {
+		t.Errorf("expected error: rejection when the store fails, got %v %q", reject, msg)
+	}
+}
+
+func TestCheckRateLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	plugin := NewPlugin(Options{
+		RateLimits: map[int]RateLimit{38888: {Events: 2, Interval: time.Minute}},
+		Now:        func() time.Time { return now },
+	})
+	marketplace := strings.Repeat("a", 64)
+	event := createTestMatchEvent(marketplace, marketplace)
+
+	for i := 0; i < 2; i++ {
+		if reject, msg := plugin.RejectEvent(context.Background(), event); reject {
+			t.Fatalf("event %d: expected to pass, got %q", i, msg)
+		}
+	}
+	reject, msg := plugin.RejectEvent(context.Background(), event)
+	if !reject || !strings.HasPrefix(msg, "rate-limited: ") {
+		t.Errorf("expected rate-limited: rejection, got %v %q", reject, msg)
+	}
+
+	// Another author has a separate budget
+	other := strings.Repeat("e", 64)
+	if reject, _ := plugin.RejectEvent(context.Background(), createTestMatchEvent(other, other)); reject {
+		t.Error("expected a different author to have its own limit")
+	}
+
+	// The window resets after the interval
+	now = now.Add(time.Minute)
+	if reject, _ := plugin.RejectEvent(context.Background(), event); reject {
+		t.Error("expected limit to reset after the interval")
+	}
+
+	// Invalid events do not consume the budget
+	invalid := createTestMatchEvent(marketplace, marketplace)
+	invalid.Tags = invalid.Tags[:1]
+	plugin.RejectEvent(context.Background(), invalid)
+	if reject, _ := plugin.RejectEvent(context.Background(), event); reject {
+		t.Error("expected invalid events not to count against the limit")
+	}
+}
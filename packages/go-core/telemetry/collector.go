@@ -0,0 +1,254 @@
+package telemetry
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the histogram buckets Prometheus clients use by default,
+// in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// CollectorOptions holds configuration for a Collector.
+type CollectorOptions struct {
+	// Buckets are the upper bounds of every histogram's buckets, ascending.
+	// Defaults to DefaultBuckets.
+	Buckets []float64
+}
+
+// Collector is an Instrumentation that keeps metrics in memory and serves
+// them in the Prometheus text format. It ignores spans. It is safe for
+// concurrent use.
+type Collector struct {
+	buckets []float64
+
+	mu         sync.Mutex
+	counters   map[string]*counterSeries
+	histograms map[string]*histogramSeries
+}
+
+type counterSeries struct {
+	name   string
+	labels []Attribute
+	value  float64
+}
+
+type histogramSeries struct {
+	name   string
+	labels []Attribute
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+var _ Instrumentation = (*Collector)(nil)
+
+// NewCollector creates a collector.
+func NewCollector(options CollectorOptions) *Collector {
+	buckets := options.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	return &Collector{
+		buckets:    append([]float64(nil), buckets...),
+		counters:   make(map[string]*counterSeries),
+		histograms: make(map[string]*histogramSeries),
+	}
+}
+
+// Add implements Instrumentation.
+func (c *Collector) Add(name string, delta float64, labels ...Attribute) {
+	labels = sortedLabels(labels)
+	key := seriesKey(name, labels)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	series, ok := c.counters[key]
+	if !ok {
+		series = &counterSeries{name: name, labels: labels}
+		c.counters[key] = series
+	}
+	series.value += delta
+}
+
+// Observe implements Instrumentation.
+func (c *Collector) Observe(name string, value float64, labels ...Attribute) {
+	labels = sortedLabels(labels)
+	key := seriesKey(name, labels)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	series, ok := c.histograms[key]
+	if !ok {
+		series = &histogramSeries{name: name, labels: labels, counts: make([]uint64, len(c.buckets))}
+		c.histograms[key] = series
+	}
+	if i := sort.SearchFloat64s(c.buckets, value); i < len(c.buckets) {
+		series.counts[i]++
+	}
+	series.count++
+	series.sum += value
+}
+
+// StartSpan implements Instrumentation. Spans are not recorded.
+func (c *Collector) StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+// Counter returns the value of a counter, or 0 if it was never added to.
+func (c *Collector) Counter(name string, labels ...Attribute) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if series, ok := c.counters[seriesKey(name, sortedLabels(labels))]; ok {
+		return series.value
+	}
+	return 0
+}
+
+// Histogram returns the number and sum of the values observed in a histogram.
+func (c *Collector) Histogram(name string, labels ...Attribute) (count uint64, sum float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if series, ok := c.histograms[seriesKey(name, sortedLabels(labels))]; ok {
+		return series.count, series.sum
+	}
+	return 0, 0
+}
+
+// WriteTo writes every metric to w in the Prometheus text exposition format,
+// sorted by name and labels.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writer := &countingWriter{w: bufio.NewWriter(w)}
+	counter_keys := sortedKeys(c.counters)
+	last := ""
+	for _, key := range counter_keys {
+		series := c.counters[key]
+		if series.name != last {
+			fmt.Fprintf(writer, "# TYPE %s counter\n", series.name)
+			last = series.name
+		}
+		fmt.Fprintf(writer, "%s%s %s\n", series.name, formatLabels(series.labels, ""), formatValue(series.value))
+	}
+
+	last = ""
+	for _, key := range sortedKeys(c.histograms) {
+		series := c.histograms[key]
+		if series.name != last {
+			fmt.Fprintf(writer, "# TYPE %s histogram\n", series.name)
+			last = series.name
+		}
+		var cumulative uint64
+		for i, bound := range c.buckets {
+			cumulative += series.counts[i]
+			fmt.Fprintf(writer, "%s_bucket%s %d\n", series.name, formatLabels(series.labels, formatValue(bound)), cumulative)
+		}
+		fmt.Fprintf(writer, "%s_bucket%s %d\n", series.name, formatLabels(series.labels, "+Inf"), series.count)
+		fmt.Fprintf(writer, "%s_sum%s %s\n", series.name, formatLabels(series.labels, ""), formatValue(series.sum))
+		fmt.Fprintf(writer, "%s_count%s %d\n", series.name, formatLabels(series.labels, ""), series.count)
+	}
+
+	if err := writer.w.Flush(); err != nil {
+		return writer.n, err
+	}
+	return writer.n, writer.err
+}
+
+// ServeHTTP serves the metrics for Prometheus to scrape.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.WriteTo(w)
+}
+
+// noopSpan is a Span that records nothing.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(attributes ...Attribute) {}
+func (noopSpan) RecordError(err error)                 {}
+func (noopSpan) End()                                  {}
+
+// countingWriter counts the bytes written and keeps the first error.
+type countingWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	if cw.err != nil {
+		return 0, cw.err
+	}
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	cw.err = err
+	return n, err
+}
+
+// sortedLabels returns a copy of labels sorted by key.
+func sortedLabels(labels []Attribute) []Attribute {
+	sorted := append([]Attribute(nil), labels...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Key < sorted[j].Key })
+	return sorted
+}
+
+// seriesKey identifies a series by its name and sorted labels. Keys sort by
+// name first, so each metric's series are written together.
+func seriesKey(name string, labels []Attribute) string {
+	return name + "\x00" + formatLabels(labels, "")
+}
+
+func sortedKeys[V any](series map[string]V) []string {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels formats labels as {key="value",...}, adding le when set.
+func formatLabels(labels []Attribute, le string) string {
+	if len(labels) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, label := range labels {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(label.Key)
+		b.WriteString(`="`)
+		b.WriteString(labelEscaper.Replace(label.Value))
+		b.WriteByte('"')
+	}
+	if le != "" {
+		if len(labels) > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`le="`)
+		b.WriteString(le)
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCollector_WriteTo(t *testing.T) {
+	collector := NewCollector(CollectorOptions{Buckets: []float64{0.1, 1}})
+	collector.Add(MetricRelayOK, 1, String(KeyRelay, "wss://a"), Bool(KeyAccepted, true), String(KeyReason, ""))
+	collector.Add(MetricRelayOK, 2, String(KeyReason, "blocked"), Bool(KeyAccepted, false), String(KeyRelay, "wss://a"))
+	collector.Add(MetricRelayOK, 1, String(KeyRelay, "wss://a"), Bool(KeyAccepted, false), String(KeyReason, "blocked"))
+	collector.Add(MetricConnectFailures, 1, String(KeyRelay, `wss://"b"`))
+	collector.Observe(MetricPublishDuration, 0.05, String(KeyRelay, "wss://a"))
+	collector.Observe(MetricPublishDuration, 0.5, String(KeyRelay, "wss://a"))
+	collector.Observe(MetricPublishDuration, 2, String(KeyRelay, "wss://a"))
+
+	var b strings.Builder
+	if _, err := collector.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	want := `# TYPE attn_relay_connect_failures_total counter
+attn_relay_connect_failures_total{relay="wss://\"b\""} 1
+# TYPE attn_relay_ok_total counter
+attn_relay_ok_total{accepted="false",reason="blocked",relay="wss://a"} 3
+attn_relay_ok_total{accepted="true",reason="",relay="wss://a"} 1
+# TYPE attn_relay_publish_duration_seconds histogram
+attn_relay_publish_duration_seconds_bucket{relay="wss://a",le="0.1"} 1
+attn_relay_publish_duration_seconds_bucket{relay="wss://a",le="1"} 2
+attn_relay_publish_duration_seconds_bucket{relay="wss://a",le="+Inf"} 3
+attn_relay_publish_duration_seconds_sum{relay="wss://a"} 2.55
+attn_relay_publish_duration_seconds_count{relay="wss://a"} 3
+`
+	if b.String() != want {
+		t.Errorf("unexpected exposition:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	if got := collector.Counter(MetricRelayOK, String(KeyRelay, "wss://a"), String(KeyReason, "blocked"), Bool(KeyAccepted, false)); got != 3 {
+		t.Errorf("expected counter 3 in any label order, got %v", got)
+	}
+	if count, sum := collector.Histogram(MetricPublishDuration, String(KeyRelay, "wss://a")); count != 3 || sum != 2.55 {
+		t.Errorf("expected 3 observations summing to 2.55, got %d, %v", count, sum)
+	}
+}
+
+func TestSetDefault(t *testing.T) {
+	if Default() != nil {
+		t.Fatal("expected instrumentation off by default")
+	}
+	collector := NewCollector(CollectorOptions{})
+	SetDefault(collector)
+	defer SetDefault(nil)
+	if Default() != collector {
+		t.Error("expected the collector as default")
+	}
+	SetDefault(nil)
+	if Default() != nil {
+		t.Error("expected nil to turn instrumentation off")
+	}
+}
@@ -0,0 +1,141 @@
+// Package telemetry defines the instrumentation hooks of the ATTN Protocol Go
+// packages: Prometheus-style counters and histograms, and spans shaped like
+// OpenTelemetry's.
+//
+// Instrumentation is off until SetDefault is called. While it is off, each
+// instrumented call costs one atomic load and allocates nothing, so the
+// zero-allocation validation path stays allocation-free.
+//
+// Example usage:
+//
+//	collector := telemetry.NewCollector(telemetry.CollectorOptions{})
+//	telemetry.SetDefault(collector)
+//	http.Handle("/metrics", collector)
+//
+// To export spans, implement Instrumentation over an OpenTelemetry tracer; see
+// the README for an adapter.
+package telemetry
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+)
+
+// Metric names. Durations are in seconds.
+const (
+	// MetricPublishDuration is a histogram of the time from sending an event
+	// to a relay until its OK, labelled by relay and outcome (accepted,
+	// rejected or error).
+	MetricPublishDuration = "attn_relay_publish_duration_seconds"
+
+	// MetricRelayOK counts OK messages, labelled by relay, accepted (true or
+	// false) and reason, the NIP-01 machine-readable prefix of the message.
+	MetricRelayOK = "attn_relay_ok_total"
+
+	// MetricQueryDuration is a histogram of the time a relay takes to answer a
+	// query, labelled by relay and outcome (ok or error).
+	MetricQueryDuration = "attn_relay_query_duration_seconds"
+
+	// MetricConnectFailures counts failed relay connections, labelled by relay.
+	MetricConnectFailures = "attn_relay_connect_failures_total"
+
+	// MetricValidations counts validated events, labelled by kind and code,
+	// which is "valid" for events that pass.
+	MetricValidations = "attn_validation_total"
+
+	// MetricValidationDuration is a histogram of validation time, labelled by kind.
+	MetricValidationDuration = "attn_validation_duration_seconds"
+)
+
+// Span names.
+const (
+	SpanPublish  = "attn.relay.publish"
+	SpanQuery    = "attn.relay.query"
+	SpanValidate = "attn.validation.validate"
+)
+
+// Attribute keys, for metric labels and span attributes.
+const (
+	KeyRelay     = "relay"
+	KeyOutcome   = "outcome"
+	KeyAccepted  = "accepted"
+	KeyReason    = "reason"
+	KeyKind      = "kind"
+	KeyCode      = "code"
+	KeyEventID   = "nostr.event.id"
+	KeyEventKind = "nostr.event.kind"
+	KeyEvents    = "nostr.events"
+)
+
+// Attribute is a metric label or span attribute.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: strconv.Itoa(value)}
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: strconv.FormatBool(value)}
+}
+
+// Instrumentation receives metrics and spans. Implementations must be safe for
+// concurrent use.
+type Instrumentation interface {
+	// Add adds delta to the counter name with the given labels.
+	Add(name string, delta float64, labels ...Attribute)
+
+	// Observe records value in the histogram name with the given labels.
+	Observe(name string, value float64, labels ...Attribute)
+
+	// StartSpan starts a span as a child of any span in ctx, and returns a
+	// context carrying it.
+	StartSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// Span is an operation being traced.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attributes ...Attribute)
+
+	// RecordError records err on the span and marks it failed.
+	RecordError(err error)
+
+	// End completes the span.
+	End()
+}
+
+// holder lets an interface value be stored atomically.
+type holder struct {
+	instrumentation Instrumentation
+}
+
+var current atomic.Pointer[holder]
+
+// SetDefault sets the instrumentation used by every ATTN package. Nil turns
+// instrumentation off.
+func SetDefault(instrumentation Instrumentation) {
+	if instrumentation == nil {
+		current.Store(nil)
+		return
+	}
+	current.Store(&holder{instrumentation: instrumentation})
+}
+
+// Default returns the instrumentation set with SetDefault, or nil when it is off.
+func Default() Instrumentation {
+	if h := current.Load(); h != nil {
+		return h.instrumentation
+	}
+	return nil
+}
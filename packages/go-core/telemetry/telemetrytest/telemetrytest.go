@@ -0,0 +1,111 @@
+// Package telemetrytest provides an Instrumentation that records metrics and
+// spans for tests.
+//
+// Example usage:
+//
+//	recorder := telemetrytest.Install(t)
+//	validation.ValidateATTNEvent(event)
+//	spans := recorder.Spans(telemetry.SpanValidate)
+package telemetrytest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry"
+)
+
+// Recorder is a telemetry.Collector that also records spans.
+type Recorder struct {
+	*telemetry.Collector
+
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// Span is a recorded span.
+type Span struct {
+	Name       string
+	Parent     *Span
+	Attributes []telemetry.Attribute
+	Err        error
+	Ended      bool
+
+	recorder *Recorder
+}
+
+// spanKey carries the current span in a context.
+type spanKey struct{}
+
+// NewRecorder creates a recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{Collector: telemetry.NewCollector(telemetry.CollectorOptions{})}
+}
+
+// Install creates a recorder, sets it as the default instrumentation, and
+// restores the previous one when the test ends.
+func Install(tb testing.TB) *Recorder {
+	tb.Helper()
+	recorder := NewRecorder()
+	previous := telemetry.Default()
+	telemetry.SetDefault(recorder)
+	tb.Cleanup(func() { telemetry.SetDefault(previous) })
+	return recorder
+}
+
+// StartSpan implements telemetry.Instrumentation.
+func (r *Recorder) StartSpan(ctx context.Context, name string, attributes ...telemetry.Attribute) (context.Context, telemetry.Span) {
+	parent, _ := ctx.Value(spanKey{}).(*Span)
+	span := &Span{Name: name, Parent: parent, Attributes: append([]telemetry.Attribute(nil), attributes...), recorder: r}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Spans returns the recorded spans with the given name, or every span when
+// name is empty, in the order they started.
+func (r *Recorder) Spans(name string) []Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var spans []Span
+	for _, span := range r.spans {
+		if name == "" || span.Name == name {
+			spans = append(spans, *span)
+		}
+	}
+	return spans
+}
+
+// Attribute returns the value of the span's last attribute with key.
+func (s Span) Attribute(key string) (string, bool) {
+	for i := len(s.Attributes) - 1; i >= 0; i-- {
+		if s.Attributes[i].Key == key {
+			return s.Attributes[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// SetAttributes implements telemetry.Span.
+func (s *Span) SetAttributes(attributes ...telemetry.Attribute) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.Attributes = append(s.Attributes, attributes...)
+}
+
+// RecordError implements telemetry.Span.
+func (s *Span) RecordError(err error) {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.Err = err
+}
+
+// End implements telemetry.Span.
+func (s *Span) End() {
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.Ended = true
+}
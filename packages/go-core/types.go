@@ -42,6 +42,7 @@ type CityBlockData struct {
 }
 
 // MarketplaceData represents MARKETPLACE event content (kind 38188).
+// The count metrics are encoded even when zero, as ATTN-01 requires them.
 type MarketplaceData struct {
 	Name                 string `json:"name,omitempty"`
 	Description          string `json:"description,omitempty"`
@@ -54,10 +55,10 @@ type MarketplaceData struct {
 	RefMarketplaceID     string `json:"ref_marketplace_id,omitempty"`
 	RefClockPubkey       string `json:"ref_clock_pubkey,omitempty"`
 	RefBlockID           string `json:"ref_block_id,omitempty"`
-	BillboardCount       int64  `json:"billboard_count,omitempty"`
-	PromotionCount       int64  `json:"promotion_count,omitempty"`
-	AttentionCount       int64  `json:"attention_count,omitempty"`
-	MatchCount           int64  `json:"match_count,omitempty"`
+	BillboardCount       int64  `json:"billboard_count"`
+	PromotionCount       int64  `json:"promotion_count"`
+	AttentionCount       int64  `json:"attention_count"`
+	MatchCount           int64  `json:"match_count"`
 }
 
 // BillboardData represents BILLBOARD event content (kind 38288).
@@ -1,10 +1,9 @@
 package validation
 
 import (
-	"encoding/json"
 	"fmt"
-	"strconv"
 
+	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -23,110 +22,138 @@ import (
 //
 // Returns a ValidationResult indicating if the event is valid.
 func ValidateAttentionEvent(event *nostr.Event) ValidationResult {
+	return validateAttention(event, indexTags(event, nil))
+}
+
+// validateAttention implements ValidateAttentionEvent over the event's indexed tags.
+func validateAttention(event *nostr.Event, tags tagIndex) ValidationResult {
 	// Must have d tag (attention identifier)
-	d_tag := getTagValue(event, "d")
+	d_tag := tags.d
 	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (attention identifier)"}
+		return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "Missing 'd' tag (attention identifier)"}
 	}
 
 	// Validate d tag format: org.attnprotocol:attention:<attention_id>
 	if err := validateDTagFormat(38488, d_tag); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidDTag, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
 	}
 
 	// Must have t tag with block height (numeric)
-	block_height := getTagValue(event, "t")
+	block_height := tags.t
 	if block_height == "" {
-		return ValidationResult{Valid: false, Message: "Missing 't' tag (block height)"}
+		return ValidationResult{Valid: false, Code: CodeMissingBlockHeight, Message: "Missing 't' tag (block height)"}
 	}
 
-	if _, err := strconv.Atoi(block_height); err != nil {
-		return ValidationResult{Valid: false, Message: "Invalid block height in 't' tag: must be numeric"}
+	if _, err := core.ParseBlockHeight(block_height); err != nil {
+		return ValidationResult{Valid: false, Code: CodeInvalidBlockHeight, Message: "Invalid block height in 't' tag: must be a non-negative integer"}
 	}
 
 	// Must have marketplace coordinate via a tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)
-	marketplace_coord := getTagValueByPrefix(event, "a", "38188:")
+	marketplace_coord := tags.coordinate(slotMarketplace)
 	if marketplace_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
 	}
 
 	if err := validateCoordinateFormat(marketplace_coord, 38188); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
 	}
 
 	// Must include blocked promotions and blocked promoters list coordinates
-	if !hasListCoordinate(event, "org.attnprotocol:promotion:blocked") {
-		return ValidationResult{Valid: false, Message: "Missing blocked promotions coordinate 'a' tag (format: 30000:<pubkey>:org.attnprotocol:promotion:blocked)"}
+	if !tags.hasList(listPromotionBlocked) {
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing blocked promotions coordinate 'a' tag (format: 30000:<pubkey>:org.attnprotocol:promotion:blocked)"}
 	}
-	if !hasListCoordinate(event, "org.attnprotocol:promoter:blocked") {
-		return ValidationResult{Valid: false, Message: "Missing blocked promoters coordinate 'a' tag (format: 30000:<pubkey>:org.attnprotocol:promoter:blocked)"}
+	if !tags.hasList(listPromoterBlocked) {
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing blocked promoters coordinate 'a' tag (format: 30000:<pubkey>:org.attnprotocol:promoter:blocked)"}
 	}
 
 	// Optional: trusted marketplaces and trusted billboards list coordinates
 	// These are optional per spec - if present, validate format
-	has_trusted_marketplaces := hasListCoordinate(event, "org.attnprotocol:marketplace:trusted")
-	has_trusted_billboards := hasListCoordinate(event, "org.attnprotocol:billboard:trusted")
+	has_trusted_marketplaces := tags.hasList(listMarketplaceTrusted)
+	has_trusted_billboards := tags.hasList(listBillboardTrusted)
 
 	// Must have p tags (attention_pubkey and marketplace_pubkey)
-	p_tags := getTagValues(event, "p")
-	if len(p_tags) < 2 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (attention_pubkey and marketplace_pubkey)"}
+	if tags.p_count < 2 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'p' tags (attention_pubkey and marketplace_pubkey)"}
 	}
 
 	// Must have r tags (relay URLs)
-	r_tags := getTagValues(event, "r")
-	if len(r_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'r' tags (relay URLs)"}
+	if tags.r_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'r' tags (relay URLs)"}
 	}
 
 	// Must have k tags (event kinds)
-	k_tags := getTagValues(event, "k")
-	if len(k_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'k' tags (event kinds)"}
+	if tags.k_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'k' tags (event kinds)"}
 	}
 
-	// Content must be valid JSON
-	var content_data map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	// Content must be a valid JSON object
+	var content attentionContent
+	if !content.decode(event.Content) {
+		return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "Content must be valid JSON"}
 	}
 
 	// Check for required fields in content (per ATTN-01.md)
-	required_fields := []string{"ask", "min_duration", "max_duration", "ref_attention_pubkey", "ref_attention_id", "ref_marketplace_pubkey", "ref_marketplace_id", "blocked_promotions_id", "blocked_promoters_id"}
-	for _, field := range required_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	if field, missing := content.fields.missing(attentionContentFields); missing {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: fmt.Sprintf("Content must include %s", field)}
 	}
 
 	// If trusted lists are present in tags, they should be in content
-	if has_trusted_marketplaces {
-		if _, ok := content_data["trusted_marketplaces_id"]; !ok {
-			return ValidationResult{Valid: false, Message: "trusted_marketplaces_id must be present in content if trusted marketplaces coordinate is in tags"}
-		}
+	if has_trusted_marketplaces && !content.trusted_marketplaces_id {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: "trusted_marketplaces_id must be present in content if trusted marketplaces coordinate is in tags"}
 	}
-	if has_trusted_billboards {
-		if _, ok := content_data["trusted_billboards_id"]; !ok {
-			return ValidationResult{Valid: false, Message: "trusted_billboards_id must be present in content if trusted billboards coordinate is in tags"}
-		}
+	if has_trusted_billboards && !content.trusted_billboards_id {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: "trusted_billboards_id must be present in content if trusted billboards coordinate is in tags"}
 	}
 
 	// Validate ask is positive number
-	if ask, ok := content_data["ask"].(float64); !ok || ask <= 0 {
-		return ValidationResult{Valid: false, Message: "ask must be a positive number"}
+	if ask, ok := content.ask.float(); !ok || ask <= 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "ask must be a positive number"}
 	}
 
 	// Validate durations are positive numbers
-	if min_dur, ok := content_data["min_duration"].(float64); !ok || min_dur <= 0 {
-		return ValidationResult{Valid: false, Message: "min_duration must be a positive number"}
+	min_dur, ok := content.min_duration.float()
+	if !ok || min_dur <= 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "min_duration must be a positive number"}
 	}
-	if max_dur, ok := content_data["max_duration"].(float64); !ok || max_dur <= 0 {
-		return ValidationResult{Valid: false, Message: "max_duration must be a positive number"}
+	max_dur, ok := content.max_duration.float()
+	if !ok || max_dur <= 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "max_duration must be a positive number"}
 	}
-	if min_dur, max_dur := content_data["min_duration"].(float64), content_data["max_duration"].(float64); min_dur > max_dur {
-		return ValidationResult{Valid: false, Message: "min_duration must be <= max_duration"}
+	if min_dur > max_dur {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "min_duration must be <= max_duration"}
 	}
 
 	return ValidationResult{Valid: true, Message: "Valid attention event"}
 }
 
+// attentionContentFields are the required content fields of an Attention event, in the order they are checked.
+var attentionContentFields = []string{"ask", "min_duration", "max_duration", "ref_attention_pubkey", "ref_attention_id", "ref_marketplace_pubkey", "ref_marketplace_id", "blocked_promotions_id", "blocked_promoters_id"}
+
+// attentionContent is the typed content of an Attention event: the fields validation reads.
+type attentionContent struct {
+	fields                  contentFields
+	trusted_marketplaces_id bool
+	trusted_billboards_id   bool
+	ask                     contentValue
+	min_duration            contentValue
+	max_duration            contentValue
+}
+
+// decode scans content into c, returning false if it is not a JSON object.
+func (c *attentionContent) decode(content string) bool {
+	return scanContent(content, func(key string, value contentValue) {
+		c.fields.mark(attentionContentFields, key)
+		switch key {
+		case "trusted_marketplaces_id":
+			c.trusted_marketplaces_id = true
+		case "trusted_billboards_id":
+			c.trusted_billboards_id = true
+		case "ask":
+			c.ask = value
+		case "min_duration":
+			c.min_duration = value
+		case "max_duration":
+			c.max_duration = value
+		}
+	})
+}
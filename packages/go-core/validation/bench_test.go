@@ -0,0 +1,77 @@
+package validation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// validVectors returns the first valid conformance vector for each ATTN kind, keyed by file name.
+func validVectors(tb testing.TB) map[string]*nostr.Event {
+	tb.Helper()
+	paths, err := filepath.Glob(filepath.Join(conformanceDir, "*.json"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	events := make(map[string]*nostr.Event)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		var file conformanceFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			tb.Fatalf("%s: %v", path, err)
+		}
+		for i := range file.Vectors {
+			if file.Vectors[i].Expected.Valid {
+				name := filepath.Base(path)
+				events[name[:len(name)-len(".json")]] = &file.Vectors[i].Event
+				break
+			}
+		}
+	}
+	if len(events) != len(ATTNProtocolKinds) {
+		tb.Fatalf("expected a valid vector for each of %d kinds, found %d", len(ATTNProtocolKinds), len(events))
+	}
+	return events
+}
+
+// Valid events take the fast path: validating one must not allocate.
+func TestValidateATTNEvent_ZeroAllocations(t *testing.T) {
+	for name, event := range validVectors(t) {
+		allocs := testing.AllocsPerRun(100, func() {
+			if result := ValidateATTNEvent(event); !result.Valid {
+				t.Fatalf("%s: %s", name, result.Message)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %v allocations per event, want 0", name, allocs)
+		}
+	}
+}
+
+func BenchmarkValidateATTNEvent(b *testing.B) {
+	for name, event := range validVectors(b) {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				ValidateATTNEvent(event)
+			}
+		})
+	}
+}
+
+func BenchmarkValidateATTNEvent_Invalid(b *testing.B) {
+	event := createTestPromotionEvent(generateTestPubkey(), 870500, generateTestPubkey(), generateTestPubkey(), generateTestPubkey())
+	event.Content = `{"duration":30000}`
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ValidateATTNEvent(event)
+	}
+}
@@ -1,10 +1,9 @@
 package validation
 
 import (
-	"encoding/json"
 	"fmt"
-	"strconv"
 
+	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -20,81 +19,97 @@ import (
 //
 // Returns a ValidationResult indicating if the event is valid.
 func ValidateBillboardEvent(event *nostr.Event) ValidationResult {
+	return validateBillboard(event, indexTags(event, nil))
+}
+
+// validateBillboard implements ValidateBillboardEvent over the event's indexed tags.
+func validateBillboard(event *nostr.Event, tags tagIndex) ValidationResult {
 	// Must have d tag (billboard identifier)
-	d_tag := getTagValue(event, "d")
+	d_tag := tags.d
 	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (billboard identifier)"}
+		return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "Missing 'd' tag (billboard identifier)"}
 	}
 
 	// Validate d tag format: org.attnprotocol:billboard:<billboard_id>
 	if err := validateDTagFormat(38288, d_tag); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidDTag, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
 	}
 
 	// Must have t tag with block height (numeric)
-	block_height := getTagValue(event, "t")
+	block_height := tags.t
 	if block_height == "" {
-		return ValidationResult{Valid: false, Message: "Missing 't' tag (block height)"}
+		return ValidationResult{Valid: false, Code: CodeMissingBlockHeight, Message: "Missing 't' tag (block height)"}
 	}
 
-	if _, err := strconv.Atoi(block_height); err != nil {
-		return ValidationResult{Valid: false, Message: "Invalid block height in 't' tag: must be numeric"}
+	if _, err := core.ParseBlockHeight(block_height); err != nil {
+		return ValidationResult{Valid: false, Code: CodeInvalidBlockHeight, Message: "Invalid block height in 't' tag: must be a non-negative integer"}
 	}
 
 	// Must reference a Marketplace via a tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)
-	marketplace_ref := getTagValueByPrefix(event, "a", "38188:")
+	marketplace_ref := tags.coordinate(slotMarketplace)
 	if marketplace_ref == "" {
-		return ValidationResult{Valid: false, Message: "Must reference a Marketplace via 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Must reference a Marketplace via 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
 	}
 
 	if err := validateCoordinateFormat(marketplace_ref, 38188); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
 	}
 
 	// Must have p tags (billboard_pubkey and marketplace_pubkey)
-	p_tags := getTagValues(event, "p")
-	if len(p_tags) < 2 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (billboard_pubkey and marketplace_pubkey)"}
+	if tags.p_count < 2 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'p' tags (billboard_pubkey and marketplace_pubkey)"}
 	}
 
 	// Must have r tags (relay URLs)
-	r_tags := getTagValues(event, "r")
-	if len(r_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'r' tags (relay URLs)"}
+	if tags.r_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'r' tags (relay URLs)"}
 	}
 
 	// Must have k tag (event kind)
-	k_tag := getTagValue(event, "k")
-	if k_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing required 'k' tag (event kind)"}
+	if tags.k == "" {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'k' tag (event kind)"}
 	}
 
 	// Must have u tag (URL)
-	u_tag := getTagValue(event, "u")
-	if u_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing required 'u' tag (URL)"}
+	if tags.u == "" {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'u' tag (URL)"}
 	}
 
-	// Content must be valid JSON
-	var content_data map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	// Content must be a valid JSON object
+	var content billboardContent
+	if !content.decode(event.Content) {
+		return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "Content must be valid JSON"}
 	}
 
 	// Check for required fields in content (per ATTN-01.md)
 	// description is optional
-	required_fields := []string{"name", "confirmation_fee_sats", "ref_billboard_pubkey", "ref_billboard_id", "ref_marketplace_pubkey", "ref_marketplace_id"}
-	for _, field := range required_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	if field, missing := content.fields.missing(billboardContentFields); missing {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: fmt.Sprintf("Content must include %s", field)}
 	}
 
 	// Validate confirmation_fee_sats is non-negative
-	if conf_fee, ok := content_data["confirmation_fee_sats"].(float64); !ok || conf_fee < 0 {
-		return ValidationResult{Valid: false, Message: "confirmation_fee_sats must be a non-negative number"}
+	if conf_fee, ok := content.confirmation_fee_sats.float(); !ok || conf_fee < 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "confirmation_fee_sats must be a non-negative number"}
 	}
 
 	return ValidationResult{Valid: true, Message: "Valid billboard event"}
 }
 
+// billboardContentFields are the required content fields of a Billboard event, in the order they are checked.
+var billboardContentFields = []string{"name", "confirmation_fee_sats", "ref_billboard_pubkey", "ref_billboard_id", "ref_marketplace_pubkey", "ref_marketplace_id"}
+
+// billboardContent is the typed content of a Billboard event: the fields validation reads.
+type billboardContent struct {
+	fields                contentFields
+	confirmation_fee_sats contentValue
+}
+
+// decode scans content into c, returning false if it is not a JSON object.
+func (c *billboardContent) decode(content string) bool {
+	return scanContent(content, func(key string, value contentValue) {
+		c.fields.mark(billboardContentFields, key)
+		if key == "confirmation_fee_sats" {
+			c.confirmation_fee_sats = value
+		}
+	})
+}
@@ -1,10 +1,10 @@
 package validation
 
 import (
-	"encoding/json"
 	"fmt"
-	"strconv"
 
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/payment"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -29,103 +29,102 @@ import (
 //
 // Returns a ValidationResult indicating if the event is valid and any error message.
 func ValidateBillboardConfirmationEvent(event *nostr.Event) ValidationResult {
+	return validateBillboardConfirmation(event, indexTags(event, nil))
+}
+
+// validateBillboardConfirmation implements ValidateBillboardConfirmationEvent over the event's indexed tags.
+func validateBillboardConfirmation(event *nostr.Event, tags tagIndex) ValidationResult {
 	// Must have d tag (confirmation identifier)
-	d_tag := getTagValue(event, "d")
+	d_tag := tags.d
 	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (confirmation identifier)"}
+		return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "Missing 'd' tag (confirmation identifier)"}
 	}
 
 	// Validate d tag format: org.attnprotocol:billboard-confirmation:<confirmation_id>
 	if err := validateDTagFormat(38588, d_tag); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidDTag, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
 	}
 
 	// Must have t tag with block height (numeric)
-	block_height := getTagValue(event, "t")
+	block_height := tags.t
 	if block_height == "" {
-		return ValidationResult{Valid: false, Message: "Missing 't' tag (block height)"}
+		return ValidationResult{Valid: false, Code: CodeMissingBlockHeight, Message: "Missing 't' tag (block height)"}
 	}
 
-	if _, err := strconv.Atoi(block_height); err != nil {
-		return ValidationResult{Valid: false, Message: "Invalid block height in 't' tag: must be numeric"}
+	if _, err := core.ParseBlockHeight(block_height); err != nil {
+		return ValidationResult{Valid: false, Code: CodeInvalidBlockHeight, Message: "Invalid block height in 't' tag: must be a non-negative integer"}
 	}
 
 	// Must have a tags for marketplace, billboard, promotion, attention, and match coordinates
-	marketplace_coord := getTagValueByPrefix(event, "a", "38188:")
+	marketplace_coord := tags.coordinate(slotMarketplace)
 	if marketplace_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
 	}
 	if err := validateCoordinateFormat(marketplace_coord, 38188); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
 	}
 
-	billboard_coord := getTagValueByPrefix(event, "a", "38288:")
+	billboard_coord := tags.coordinate(slotBillboard)
 	if billboard_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
 	}
 	if err := validateCoordinateFormat(billboard_coord, 38288); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
 	}
 
-	promotion_coord := getTagValueByPrefix(event, "a", "38388:")
+	promotion_coord := tags.coordinate(slotPromotion)
 	if promotion_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
 	}
 	if err := validateCoordinateFormat(promotion_coord, 38388); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
 	}
 
-	attention_coord := getTagValueByPrefix(event, "a", "38488:")
+	attention_coord := tags.coordinate(slotAttention)
 	if attention_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
 	}
 	if err := validateCoordinateFormat(attention_coord, 38488); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
 	}
 
-	match_coord := getTagValueByPrefix(event, "a", "38888:")
+	match_coord := tags.coordinate(slotMatch)
 	if match_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
 	}
 	if err := validateCoordinateFormat(match_coord, 38888); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
 	}
 
 	// Must have e tag with "match" marker
-	if !validateETagWithMarker(event, "match") {
-		return ValidationResult{Valid: false, Message: "Missing 'e' tag with 'match' marker"}
+	if !tags.hasEMarker(markerMatch) {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing 'e' tag with 'match' marker"}
 	}
 
 	// Must have e tags referencing marketplace, billboard, promotion, attention, and match events
-	e_tags := getTagValues(event, "e")
-	if len(e_tags) < 5 {
-		return ValidationResult{Valid: false, Message: "Missing required 'e' tags (must reference marketplace, billboard, promotion, attention, and match events)"}
+	if tags.e_count < 5 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'e' tags (must reference marketplace, billboard, promotion, attention, and match events)"}
 	}
 
 	// Must have p tags for all pubkeys (marketplace, promotion, attention, billboard)
-	p_tags := getTagValues(event, "p")
-	if len(p_tags) < 4 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
+	if tags.p_count < 4 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
 	}
 
 	// Must have r tags (relay URLs)
-	r_tags := getTagValues(event, "r")
-	if len(r_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'r' tags (relay URLs)"}
+	if tags.r_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'r' tags (relay URLs)"}
 	}
 
-	// Content must be valid JSON
-	var content_data map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	// Content must be a valid JSON object
+	fields, ok := decodeContentFields(event.Content, confirmationContentFields)
+	if !ok {
+		return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "Content must be valid JSON"}
 	}
 
 	// Check for required fields in content (per ATTN-01.md) - all ref_ fields
-	required_fields := []string{"ref_match_event_id", "ref_match_id", "ref_marketplace_pubkey", "ref_billboard_pubkey", "ref_promotion_pubkey", "ref_attention_pubkey", "ref_marketplace_id", "ref_billboard_id", "ref_promotion_id", "ref_attention_id"}
-	for _, field := range required_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	if field, missing := fields.missing(confirmationContentFields); missing {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: fmt.Sprintf("Content must include %s", field)}
 	}
 
 	return ValidationResult{Valid: true, Message: "Valid billboard confirmation event"}
@@ -152,103 +151,102 @@ func ValidateBillboardConfirmationEvent(event *nostr.Event) ValidationResult {
 //
 // Returns a ValidationResult indicating if the event is valid and any error message.
 func ValidateAttentionConfirmationEvent(event *nostr.Event) ValidationResult {
+	return validateAttentionConfirmation(event, indexTags(event, nil))
+}
+
+// validateAttentionConfirmation implements ValidateAttentionConfirmationEvent over the event's indexed tags.
+func validateAttentionConfirmation(event *nostr.Event, tags tagIndex) ValidationResult {
 	// Must have d tag (confirmation identifier)
-	d_tag := getTagValue(event, "d")
+	d_tag := tags.d
 	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (confirmation identifier)"}
+		return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "Missing 'd' tag (confirmation identifier)"}
 	}
 
 	// Validate d tag format: org.attnprotocol:attention-confirmation:<confirmation_id>
 	if err := validateDTagFormat(38688, d_tag); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidDTag, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
 	}
 
 	// Must have t tag with block height (numeric)
-	block_height := getTagValue(event, "t")
+	block_height := tags.t
 	if block_height == "" {
-		return ValidationResult{Valid: false, Message: "Missing 't' tag (block height)"}
+		return ValidationResult{Valid: false, Code: CodeMissingBlockHeight, Message: "Missing 't' tag (block height)"}
 	}
 
-	if _, err := strconv.Atoi(block_height); err != nil {
-		return ValidationResult{Valid: false, Message: "Invalid block height in 't' tag: must be numeric"}
+	if _, err := core.ParseBlockHeight(block_height); err != nil {
+		return ValidationResult{Valid: false, Code: CodeInvalidBlockHeight, Message: "Invalid block height in 't' tag: must be a non-negative integer"}
 	}
 
 	// Must have a tags for marketplace, billboard, promotion, attention, and match coordinates
-	marketplace_coord := getTagValueByPrefix(event, "a", "38188:")
+	marketplace_coord := tags.coordinate(slotMarketplace)
 	if marketplace_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
 	}
 	if err := validateCoordinateFormat(marketplace_coord, 38188); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
 	}
 
-	billboard_coord := getTagValueByPrefix(event, "a", "38288:")
+	billboard_coord := tags.coordinate(slotBillboard)
 	if billboard_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
 	}
 	if err := validateCoordinateFormat(billboard_coord, 38288); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
 	}
 
-	promotion_coord := getTagValueByPrefix(event, "a", "38388:")
+	promotion_coord := tags.coordinate(slotPromotion)
 	if promotion_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
 	}
 	if err := validateCoordinateFormat(promotion_coord, 38388); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
 	}
 
-	attention_coord := getTagValueByPrefix(event, "a", "38488:")
+	attention_coord := tags.coordinate(slotAttention)
 	if attention_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
 	}
 	if err := validateCoordinateFormat(attention_coord, 38488); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
 	}
 
-	match_coord := getTagValueByPrefix(event, "a", "38888:")
+	match_coord := tags.coordinate(slotMatch)
 	if match_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
 	}
 	if err := validateCoordinateFormat(match_coord, 38888); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
 	}
 
 	// Must have e tag with "match" marker
-	if !validateETagWithMarker(event, "match") {
-		return ValidationResult{Valid: false, Message: "Missing 'e' tag with 'match' marker"}
+	if !tags.hasEMarker(markerMatch) {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing 'e' tag with 'match' marker"}
 	}
 
 	// Must have e tags referencing marketplace, billboard, promotion, attention, and match events
-	e_tags := getTagValues(event, "e")
-	if len(e_tags) < 5 {
-		return ValidationResult{Valid: false, Message: "Missing required 'e' tags (must reference marketplace, billboard, promotion, attention, and match events)"}
+	if tags.e_count < 5 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'e' tags (must reference marketplace, billboard, promotion, attention, and match events)"}
 	}
 
 	// Must have p tags for all pubkeys (marketplace, promotion, attention, billboard)
-	p_tags := getTagValues(event, "p")
-	if len(p_tags) < 4 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
+	if tags.p_count < 4 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
 	}
 
 	// Must have r tags (relay URLs)
-	r_tags := getTagValues(event, "r")
-	if len(r_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'r' tags (relay URLs)"}
+	if tags.r_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'r' tags (relay URLs)"}
 	}
 
-	// Content must be valid JSON
-	var content_data map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	// Content must be a valid JSON object
+	fields, ok := decodeContentFields(event.Content, confirmationContentFields)
+	if !ok {
+		return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "Content must be valid JSON"}
 	}
 
 	// Check for required fields in content (per ATTN-01.md) - all ref_ fields
-	required_fields := []string{"ref_match_event_id", "ref_match_id", "ref_marketplace_pubkey", "ref_billboard_pubkey", "ref_promotion_pubkey", "ref_attention_pubkey", "ref_marketplace_id", "ref_billboard_id", "ref_promotion_id", "ref_attention_id"}
-	for _, field := range required_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	if field, missing := fields.missing(confirmationContentFields); missing {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: fmt.Sprintf("Content must include %s", field)}
 	}
 
 	return ValidationResult{Valid: true, Message: "Valid attention confirmation event"}
@@ -280,113 +278,112 @@ func ValidateAttentionConfirmationEvent(event *nostr.Event) ValidationResult {
 //
 // Returns a ValidationResult indicating if the event is valid and any error message.
 func ValidateMarketplaceConfirmationEvent(event *nostr.Event) ValidationResult {
+	return validateMarketplaceConfirmation(event, indexTags(event, nil))
+}
+
+// validateMarketplaceConfirmation implements ValidateMarketplaceConfirmationEvent over the event's indexed tags.
+func validateMarketplaceConfirmation(event *nostr.Event, tags tagIndex) ValidationResult {
 	// Must have d tag (confirmation identifier)
-	d_tag := getTagValue(event, "d")
+	d_tag := tags.d
 	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (confirmation identifier)"}
+		return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "Missing 'd' tag (confirmation identifier)"}
 	}
 
 	// Validate d tag format: org.attnprotocol:marketplace-confirmation:<confirmation_id>
 	if err := validateDTagFormat(38788, d_tag); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidDTag, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
 	}
 
 	// Must have t tag with block height (numeric)
-	block_height := getTagValue(event, "t")
+	block_height := tags.t
 	if block_height == "" {
-		return ValidationResult{Valid: false, Message: "Missing 't' tag (block height)"}
+		return ValidationResult{Valid: false, Code: CodeMissingBlockHeight, Message: "Missing 't' tag (block height)"}
 	}
 
-	if _, err := strconv.Atoi(block_height); err != nil {
-		return ValidationResult{Valid: false, Message: "Invalid block height in 't' tag: must be numeric"}
+	if _, err := core.ParseBlockHeight(block_height); err != nil {
+		return ValidationResult{Valid: false, Code: CodeInvalidBlockHeight, Message: "Invalid block height in 't' tag: must be a non-negative integer"}
 	}
 
 	// Must have a tags for marketplace, billboard, promotion, attention, and match coordinates
-	marketplace_coord := getTagValueByPrefix(event, "a", "38188:")
+	marketplace_coord := tags.coordinate(slotMarketplace)
 	if marketplace_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
 	}
 	if err := validateCoordinateFormat(marketplace_coord, 38188); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
 	}
 
-	billboard_coord := getTagValueByPrefix(event, "a", "38288:")
+	billboard_coord := tags.coordinate(slotBillboard)
 	if billboard_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
 	}
 	if err := validateCoordinateFormat(billboard_coord, 38288); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
 	}
 
-	promotion_coord := getTagValueByPrefix(event, "a", "38388:")
+	promotion_coord := tags.coordinate(slotPromotion)
 	if promotion_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
 	}
 	if err := validateCoordinateFormat(promotion_coord, 38388); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
 	}
 
-	attention_coord := getTagValueByPrefix(event, "a", "38488:")
+	attention_coord := tags.coordinate(slotAttention)
 	if attention_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
 	}
 	if err := validateCoordinateFormat(attention_coord, 38488); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
 	}
 
-	match_coord := getTagValueByPrefix(event, "a", "38888:")
+	match_coord := tags.coordinate(slotMatch)
 	if match_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
 	}
 	if err := validateCoordinateFormat(match_coord, 38888); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
 	}
 
 	// Must have e tag with "match" marker
-	if !validateETagWithMarker(event, "match") {
-		return ValidationResult{Valid: false, Message: "Missing 'e' tag with 'match' marker"}
+	if !tags.hasEMarker(markerMatch) {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing 'e' tag with 'match' marker"}
 	}
 
 	// Must have e tag with "billboard_confirmation" marker
-	if !validateETagWithMarker(event, "billboard_confirmation") {
-		return ValidationResult{Valid: false, Message: "Missing 'e' tag with 'billboard_confirmation' marker"}
+	if !tags.hasEMarker(markerBillboardConfirmation) {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing 'e' tag with 'billboard_confirmation' marker"}
 	}
 
 	// Must have e tag with "attention_confirmation" marker
-	if !validateETagWithMarker(event, "attention_confirmation") {
-		return ValidationResult{Valid: false, Message: "Missing 'e' tag with 'attention_confirmation' marker"}
+	if !tags.hasEMarker(markerAttentionConfirmation) {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing 'e' tag with 'attention_confirmation' marker"}
 	}
 
 	// Must have e tags referencing marketplace, billboard, promotion, attention, match, billboard_confirmation, and attention_confirmation events
-	e_tags := getTagValues(event, "e")
-	if len(e_tags) < 7 {
-		return ValidationResult{Valid: false, Message: "Missing required 'e' tags (must reference marketplace, billboard, promotion, attention, match, billboard_confirmation, and attention_confirmation events)"}
+	if tags.e_count < 7 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'e' tags (must reference marketplace, billboard, promotion, attention, match, billboard_confirmation, and attention_confirmation events)"}
 	}
 
 	// Must have p tags for all pubkeys (marketplace, promotion, attention, billboard)
-	p_tags := getTagValues(event, "p")
-	if len(p_tags) < 4 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
+	if tags.p_count < 4 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
 	}
 
 	// Must have r tags (relay URLs)
-	r_tags := getTagValues(event, "r")
-	if len(r_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'r' tags (relay URLs)"}
+	if tags.r_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'r' tags (relay URLs)"}
 	}
 
-	// Content must be valid JSON
-	var content_data map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	// Content must be a valid JSON object
+	fields, ok := decodeContentFields(event.Content, marketplaceConfirmationContentFields)
+	if !ok {
+		return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "Content must be valid JSON"}
 	}
 
 	// Check for required fields in content (per ATTN-01.md) - all ref_ fields
-	required_fields := []string{"ref_match_event_id", "ref_match_id", "ref_billboard_confirmation_event_id", "ref_attention_confirmation_event_id", "ref_marketplace_pubkey", "ref_billboard_pubkey", "ref_promotion_pubkey", "ref_attention_pubkey", "ref_marketplace_id", "ref_billboard_id", "ref_promotion_id", "ref_attention_id"}
-	for _, field := range required_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	if field, missing := fields.missing(marketplaceConfirmationContentFields); missing {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: fmt.Sprintf("Content must include %s", field)}
 	}
 
 	return ValidationResult{Valid: true, Message: "Valid marketplace confirmation event"}
@@ -409,113 +406,157 @@ func ValidateMarketplaceConfirmationEvent(event *nostr.Event) ValidationResult {
 //   - ref_marketplace_confirmation_event_id
 //   - ref_marketplace_pubkey, ref_billboard_pubkey, ref_promotion_pubkey, ref_attention_pubkey
 //   - ref_marketplace_id, ref_billboard_id, ref_promotion_id, ref_attention_id
-//   - payment_proof: Optional payment proof field
+//   - payment_proof: Optional string; when it starts with "bolt11:" or "zap:" it must be
+//     bolt11:<invoice>:<preimage> or zap:<zap_receipt_event_id> (see the payment package)
 //
 // Parameters:
 //   - event: The Nostr event to validate
 //
 // Returns a ValidationResult indicating if the event is valid and any error message.
 func ValidateAttentionPaymentConfirmationEvent(event *nostr.Event) ValidationResult {
+	return validateAttentionPaymentConfirmation(event, indexTags(event, nil))
+}
+
+// validateAttentionPaymentConfirmation implements ValidateAttentionPaymentConfirmationEvent over the event's indexed tags.
+func validateAttentionPaymentConfirmation(event *nostr.Event, tags tagIndex) ValidationResult {
 	// Must have d tag (confirmation identifier)
-	d_tag := getTagValue(event, "d")
+	d_tag := tags.d
 	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (confirmation identifier)"}
+		return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "Missing 'd' tag (confirmation identifier)"}
 	}
 
 	// Validate d tag format: org.attnprotocol:attention-payment-confirmation:<confirmation_id>
 	if err := validateDTagFormat(38988, d_tag); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidDTag, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
 	}
 
 	// Must have t tag with block height (numeric)
-	block_height := getTagValue(event, "t")
+	block_height := tags.t
 	if block_height == "" {
-		return ValidationResult{Valid: false, Message: "Missing 't' tag (block height)"}
+		return ValidationResult{Valid: false, Code: CodeMissingBlockHeight, Message: "Missing 't' tag (block height)"}
 	}
 
-	if _, err := strconv.Atoi(block_height); err != nil {
-		return ValidationResult{Valid: false, Message: "Invalid block height in 't' tag: must be numeric"}
+	if _, err := core.ParseBlockHeight(block_height); err != nil {
+		return ValidationResult{Valid: false, Code: CodeInvalidBlockHeight, Message: "Invalid block height in 't' tag: must be a non-negative integer"}
 	}
 
 	// Must have e tag with "marketplace_confirmation" marker
-	if !validateETagWithMarker(event, "marketplace_confirmation") {
-		return ValidationResult{Valid: false, Message: "Missing 'e' tag with 'marketplace_confirmation' marker"}
+	if !tags.hasEMarker(markerMarketplaceConfirmation) {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing 'e' tag with 'marketplace_confirmation' marker"}
 	}
 
 	// Must have a tags for marketplace, billboard, promotion, attention, and match coordinates
-	marketplace_coord := getTagValueByPrefix(event, "a", "38188:")
+	marketplace_coord := tags.coordinate(slotMarketplace)
 	if marketplace_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing marketplace coordinate 'a' tag (format: 38188:pubkey:org.attnprotocol:marketplace:id)"}
 	}
 	if err := validateCoordinateFormat(marketplace_coord, 38188); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid marketplace coordinate format: %s", err.Error())}
 	}
 
-	billboard_coord := getTagValueByPrefix(event, "a", "38288:")
+	billboard_coord := tags.coordinate(slotBillboard)
 	if billboard_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing billboard coordinate 'a' tag (format: 38288:pubkey:org.attnprotocol:billboard:id)"}
 	}
 	if err := validateCoordinateFormat(billboard_coord, 38288); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid billboard coordinate format: %s", err.Error())}
 	}
 
-	promotion_coord := getTagValueByPrefix(event, "a", "38388:")
+	promotion_coord := tags.coordinate(slotPromotion)
 	if promotion_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing promotion coordinate 'a' tag (format: 38388:pubkey:org.attnprotocol:promotion:id)"}
 	}
 	if err := validateCoordinateFormat(promotion_coord, 38388); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid promotion coordinate format: %s", err.Error())}
 	}
 
-	attention_coord := getTagValueByPrefix(event, "a", "38488:")
+	attention_coord := tags.coordinate(slotAttention)
 	if attention_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing attention coordinate 'a' tag (format: 38488:pubkey:org.attnprotocol:attention:id)"}
 	}
 	if err := validateCoordinateFormat(attention_coord, 38488); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid attention coordinate format: %s", err.Error())}
 	}
 
-	match_coord := getTagValueByPrefix(event, "a", "38888:")
+	match_coord := tags.coordinate(slotMatch)
 	if match_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing match coordinate 'a' tag (format: 38888:pubkey:org.attnprotocol:match:id)"}
 	}
 	if err := validateCoordinateFormat(match_coord, 38888); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid match coordinate format: %s", err.Error())}
 	}
 
 	// Must have p tags for all pubkeys (marketplace, promotion, attention, billboard)
-	p_tags := getTagValues(event, "p")
-	if len(p_tags) < 4 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
+	if tags.p_count < 4 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'p' tags (marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey)"}
 	}
 
 	// Must have r tags (relay URLs)
-	r_tags := getTagValues(event, "r")
-	if len(r_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'r' tags (relay URLs)"}
+	if tags.r_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'r' tags (relay URLs)"}
 	}
 
-	// Content must be valid JSON
-	var content_data map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	// Content must be a valid JSON object
+	var content paymentConfirmationContent
+	if !content.decode(event.Content) {
+		return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "Content must be valid JSON"}
 	}
 
 	// Check for required fields in content (per ATTN-01.md)
 	// Payment fields (no prefix): sats_received, payment_proof (optional)
 	// Reference fields (ref_ prefix): all ref_* fields
-	required_fields := []string{"sats_received", "ref_match_event_id", "ref_match_id", "ref_marketplace_confirmation_event_id", "ref_marketplace_pubkey", "ref_billboard_pubkey", "ref_promotion_pubkey", "ref_attention_pubkey", "ref_marketplace_id", "ref_billboard_id", "ref_promotion_id", "ref_attention_id"}
-	for _, field := range required_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	if field, missing := content.fields.missing(paymentConfirmationContentFields); missing {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: fmt.Sprintf("Content must include %s", field)}
 	}
 
 	// Validate sats_received is positive number
-	if sats_received, ok := content_data["sats_received"].(float64); !ok || sats_received <= 0 {
-		return ValidationResult{Valid: false, Message: "sats_received must be a positive number"}
+	if sats_received, ok := content.sats_received.float(); !ok || sats_received <= 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "sats_received must be a positive number"}
+	}
+
+	// payment_proof is free-form unless it claims a structured format. Only the
+	// format is checked here; payment.VerifyConfirmation checks the payment.
+	if content.payment_proof.kind != contentNull {
+		payment_proof, ok := content.payment_proof.text()
+		if !ok {
+			return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "payment_proof must be a string"}
+		}
+		if payment.IsStructured(payment_proof) {
+			if _, err := payment.ParseProof(payment_proof); err != nil {
+				return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "payment_proof must be bolt11:<invoice>:<preimage> or zap:<event_id>"}
+			}
+		}
 	}
 
 	return ValidationResult{Valid: true, Message: "Valid attention payment confirmation event"}
 }
 
+// confirmationContentFields are the required content fields of Billboard and Attention
+// Confirmation events, in the order they are checked.
+var confirmationContentFields = []string{"ref_match_event_id", "ref_match_id", "ref_marketplace_pubkey", "ref_billboard_pubkey", "ref_promotion_pubkey", "ref_attention_pubkey", "ref_marketplace_id", "ref_billboard_id", "ref_promotion_id", "ref_attention_id"}
+
+// marketplaceConfirmationContentFields are the required content fields of a Marketplace Confirmation event.
+var marketplaceConfirmationContentFields = []string{"ref_match_event_id", "ref_match_id", "ref_billboard_confirmation_event_id", "ref_attention_confirmation_event_id", "ref_marketplace_pubkey", "ref_billboard_pubkey", "ref_promotion_pubkey", "ref_attention_pubkey", "ref_marketplace_id", "ref_billboard_id", "ref_promotion_id", "ref_attention_id"}
+
+// paymentConfirmationContentFields are the required content fields of an Attention Payment Confirmation event.
+var paymentConfirmationContentFields = []string{"sats_received", "ref_match_event_id", "ref_match_id", "ref_marketplace_confirmation_event_id", "ref_marketplace_pubkey", "ref_billboard_pubkey", "ref_promotion_pubkey", "ref_attention_pubkey", "ref_marketplace_id", "ref_billboard_id", "ref_promotion_id", "ref_attention_id"}
+
+// paymentConfirmationContent is the typed content of an Attention Payment Confirmation event: the fields validation reads.
+type paymentConfirmationContent struct {
+	fields        contentFields
+	sats_received contentValue
+	payment_proof contentValue
+}
+
+// decode scans content into c, returning false if it is not a JSON object.
+func (c *paymentConfirmationContent) decode(content string) bool {
+	return scanContent(content, func(key string, value contentValue) {
+		c.fields.mark(paymentConfirmationContentFields, key)
+		switch key {
+		case "sats_received":
+			c.sats_received = value
+		case "payment_proof":
+			c.payment_proof = value
+		}
+	})
+}
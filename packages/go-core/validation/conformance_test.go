@@ -0,0 +1,66 @@
+package validation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// conformanceDir holds the cross-language test vectors shared with the TypeScript core.
+const conformanceDir = "../../../conformance/vectors"
+
+// conformanceFile is one vectors file: every vector for a single kind.
+type conformanceFile struct {
+	Kind    int                 `json:"kind"`
+	Vectors []conformanceVector `json:"vectors"`
+}
+
+// conformanceVector is an event with the verdict every core must reach.
+type conformanceVector struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Event       nostr.Event `json:"event"`
+	Expected    struct {
+		Valid bool   `json:"valid"`
+		Code  string `json:"code"`
+	} `json:"expected"`
+}
+
+func TestConformanceVectors(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join(conformanceDir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no conformance vectors found in %s", conformanceDir)
+	}
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var file conformanceFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		for _, vector := range file.Vectors {
+			vector := vector
+			t.Run(vector.Name, func(t *testing.T) {
+				if vector.Event.Kind != file.Kind {
+					t.Fatalf("vector kind %d does not match file kind %d", vector.Event.Kind, file.Kind)
+				}
+
+				result := ValidateATTNEvent(&vector.Event)
+				if result.Valid != vector.Expected.Valid || result.Code != vector.Expected.Code {
+					t.Errorf("%s: expected valid=%v code=%q, got valid=%v code=%q (%s)",
+						vector.Description, vector.Expected.Valid, vector.Expected.Code, result.Valid, result.Code, result.Message)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,373 @@
+package validation
+
+import (
+	"encoding/json"
+	"strconv"
+	"unicode/utf8"
+)
+
+// contentKind is the JSON type of a content field.
+type contentKind uint8
+
+const (
+	contentNull contentKind = iota
+	contentBool
+	contentNumber
+	contentString
+	contentArray
+	contentObject
+)
+
+// contentValue is a top-level field of an event's JSON content.
+// Numbers carry their decoded value and strings their raw text; validators
+// check the rest by kind.
+type contentValue struct {
+	kind   contentKind
+	number float64
+
+	// raw is a string's text between the quotes, still escaped when escaped is set
+	raw     string
+	escaped bool
+}
+
+// float returns the field's value if it is a JSON number.
+func (value contentValue) float() (float64, bool) {
+	return value.number, value.kind == contentNumber
+}
+
+// text returns the field's value if it is a JSON string. It allocates only
+// when the string contains escape sequences or invalid UTF-8.
+func (value contentValue) text() (string, bool) {
+	if value.kind != contentString {
+		return "", false
+	}
+	if value.escaped || !utf8.ValidString(value.raw) {
+		return unescape(value.raw), true
+	}
+	return value.raw, true
+}
+
+// contentFields is the set of a kind's content fields present in an event,
+// one bit per position in the kind's field list.
+type contentFields uint32
+
+// mark records key if it is in names.
+func (fields *contentFields) mark(names []string, key string) {
+	for i, name := range names {
+		if name == key {
+			*fields |= 1 << i
+			return
+		}
+	}
+}
+
+// missing returns the first name in names that was not marked.
+func (fields contentFields) missing(names []string) (string, bool) {
+	for i, name := range names {
+		if fields&(1<<i) == 0 {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// decodeContentFields scans content and reports which of names it contains.
+// It returns false if content is not a JSON object.
+func decodeContentFields(content string, names []string) (contentFields, bool) {
+	var fields contentFields
+	ok := scanContent(content, func(key string, _ contentValue) {
+		fields.mark(names, key)
+	})
+	return fields, ok
+}
+
+// maxContentDepth matches the nesting limit of encoding/json.
+const maxContentDepth = 10000
+
+// scanContent validates that content is a JSON object and calls visit for each
+// of its top-level fields, in order. It reads content in place and does not
+// allocate, except to decode field names that contain escape sequences or invalid UTF-8.
+//
+// Its verdict matches decoding content into a map[string]interface{} with
+// encoding/json: any syntax error or out-of-range number fails, and a
+// top-level null is accepted as an object without fields.
+func scanContent(content string, visit func(key string, value contentValue)) bool {
+	scanner := contentScanner{data: content}
+	scanner.skipSpace()
+	if scanner.done() {
+		return false
+	}
+
+	switch scanner.peek() {
+	case 'n':
+		if !scanner.literal("null") {
+			return false
+		}
+	case '{':
+		if !scanner.object(visit) {
+			return false
+		}
+	default:
+		return false
+	}
+
+	scanner.skipSpace()
+	return scanner.done()
+}
+
+// contentScanner is a minimal JSON syntax checker over a string.
+type contentScanner struct {
+	data  string
+	pos   int
+	depth int
+}
+
+func (scanner *contentScanner) done() bool {
+	return scanner.pos >= len(scanner.data)
+}
+
+func (scanner *contentScanner) peek() byte {
+	return scanner.data[scanner.pos]
+}
+
+func (scanner *contentScanner) skipSpace() {
+	for !scanner.done() {
+		switch scanner.peek() {
+		case ' ', '\t', '\n', '\r':
+			scanner.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consume skips whitespace and then the expected byte, reporting whether it was there.
+func (scanner *contentScanner) consume(expected byte) bool {
+	scanner.skipSpace()
+	if scanner.done() || scanner.peek() != expected {
+		return false
+	}
+	scanner.pos++
+	return true
+}
+
+// object scans an object; visit, if not nil, receives each member.
+func (scanner *contentScanner) object(visit func(key string, value contentValue)) bool {
+	scanner.depth++
+	if scanner.depth > maxContentDepth {
+		return false
+	}
+	scanner.pos++ // '{'
+
+	scanner.skipSpace()
+	if !scanner.done() && scanner.peek() == '}' {
+		scanner.pos++
+		scanner.depth--
+		return true
+	}
+
+	for {
+		scanner.skipSpace()
+		if scanner.done() || scanner.peek() != '"' {
+			return false
+		}
+		key, escaped, ok := scanner.string()
+		if !ok || !scanner.consume(':') {
+			return false
+		}
+		scanner.skipSpace()
+		value, ok := scanner.value()
+		if !ok {
+			return false
+		}
+		if visit != nil {
+			if escaped || !utf8.ValidString(key) {
+				key = unescape(key)
+			}
+			visit(key, value)
+		}
+
+		scanner.skipSpace()
+		if scanner.done() {
+			return false
+		}
+		switch scanner.peek() {
+		case ',':
+			scanner.pos++
+		case '}':
+			scanner.pos++
+			scanner.depth--
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func (scanner *contentScanner) array() bool {
+	scanner.depth++
+	if scanner.depth > maxContentDepth {
+		return false
+	}
+	scanner.pos++ // '['
+
+	scanner.skipSpace()
+	if !scanner.done() && scanner.peek() == ']' {
+		scanner.pos++
+		scanner.depth--
+		return true
+	}
+
+	for {
+		scanner.skipSpace()
+		if _, ok := scanner.value(); !ok {
+			return false
+		}
+		scanner.skipSpace()
+		if scanner.done() {
+			return false
+		}
+		switch scanner.peek() {
+		case ',':
+			scanner.pos++
+		case ']':
+			scanner.pos++
+			scanner.depth--
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+// value scans any JSON value starting at the current position.
+func (scanner *contentScanner) value() (contentValue, bool) {
+	if scanner.done() {
+		return contentValue{}, false
+	}
+	switch c := scanner.peek(); {
+	case c == '{':
+		return contentValue{kind: contentObject}, scanner.object(nil)
+	case c == '[':
+		return contentValue{kind: contentArray}, scanner.array()
+	case c == '"':
+		raw, escaped, ok := scanner.string()
+		return contentValue{kind: contentString, raw: raw, escaped: escaped}, ok
+	case c == 't':
+		return contentValue{kind: contentBool}, scanner.literal("true")
+	case c == 'f':
+		return contentValue{kind: contentBool}, scanner.literal("false")
+	case c == 'n':
+		return contentValue{kind: contentNull}, scanner.literal("null")
+	case c == '-' || (c >= '0' && c <= '9'):
+		number, ok := scanner.number()
+		return contentValue{kind: contentNumber, number: number}, ok
+	}
+	return contentValue{}, false
+}
+
+func (scanner *contentScanner) literal(word string) bool {
+	if len(scanner.data)-scanner.pos < len(word) || scanner.data[scanner.pos:scanner.pos+len(word)] != word {
+		return false
+	}
+	scanner.pos += len(word)
+	return true
+}
+
+// string scans a string and returns its raw contents between the quotes,
+// and whether they contain escape sequences.
+func (scanner *contentScanner) string() (string, bool, bool) {
+	scanner.pos++ // '"'
+	start := scanner.pos
+	escaped := false
+	for !scanner.done() {
+		c := scanner.peek()
+		switch {
+		case c == '"':
+			raw := scanner.data[start:scanner.pos]
+			scanner.pos++
+			return raw, escaped, true
+		case c == '\\':
+			escaped = true
+			scanner.pos++
+			if scanner.done() {
+				return "", false, false
+			}
+			switch scanner.peek() {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				scanner.pos++
+			case 'u':
+				scanner.pos++
+				for i := 0; i < 4; i++ {
+					if scanner.done() || !isHexDigit(scanner.peek()) {
+						return "", false, false
+					}
+					scanner.pos++
+				}
+			default:
+				return "", false, false
+			}
+		case c < 0x20:
+			return "", false, false
+		default:
+			scanner.pos++
+		}
+	}
+	return "", false, false
+}
+
+// number scans a number per the JSON grammar and parses it as encoding/json does.
+func (scanner *contentScanner) number() (float64, bool) {
+	start := scanner.pos
+	if scanner.peek() == '-' {
+		scanner.pos++
+	}
+	if scanner.done() {
+		return 0, false
+	}
+	if scanner.peek() == '0' {
+		scanner.pos++
+	} else if !scanner.digits() {
+		return 0, false
+	}
+	if !scanner.done() && scanner.peek() == '.' {
+		scanner.pos++
+		if !scanner.digits() {
+			return 0, false
+		}
+	}
+	if !scanner.done() && (scanner.peek() == 'e' || scanner.peek() == 'E') {
+		scanner.pos++
+		if !scanner.done() && (scanner.peek() == '+' || scanner.peek() == '-') {
+			scanner.pos++
+		}
+		if !scanner.digits() {
+			return 0, false
+		}
+	}
+
+	number, err := strconv.ParseFloat(scanner.data[start:scanner.pos], 64)
+	return number, err == nil
+}
+
+// digits scans one or more decimal digits.
+func (scanner *contentScanner) digits() bool {
+	start := scanner.pos
+	for !scanner.done() && scanner.peek() >= '0' && scanner.peek() <= '9' {
+		scanner.pos++
+	}
+	return scanner.pos > start
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// unescape decodes a string's raw text as encoding/json does, resolving
+// escape sequences and replacing invalid UTF-8.
+// raw has already been checked by the scanner, so decoding cannot fail.
+func unescape(raw string) string {
+	var text string
+	json.Unmarshal([]byte(`"`+raw+`"`), &text)
+	return text
+}
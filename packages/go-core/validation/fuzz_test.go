@@ -0,0 +1,341 @@
+package validation
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// seedEvents returns real-looking events for fuzz seed corpora: the conformance
+// vectors plus the fixtures in test_helpers.go.
+func seedEvents(f *testing.F) []*nostr.Event {
+	f.Helper()
+	pubkey := generateTestPubkey()
+	events := []*nostr.Event{
+		createTestMarketplaceEvent(pubkey, 870500),
+		createTestPromotionEvent(pubkey, 870500, pubkey, pubkey, pubkey),
+		createTestAttentionEvent(pubkey, 870500, pubkey),
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(conformanceDir, "*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		var file conformanceFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			f.Fatalf("%s: %v", path, err)
+		}
+		for i := range file.Vectors {
+			events = append(events, &file.Vectors[i].Event)
+		}
+	}
+	return events
+}
+
+// eventTypes maps ATTN kinds to their d tag event type.
+var eventTypes = map[int]string{
+	38188: "marketplace",
+	38288: "billboard",
+	38388: "promotion",
+	38488: "attention",
+	38588: "billboard-confirmation",
+	38688: "attention-confirmation",
+	38788: "marketplace-confirmation",
+	38888: "match",
+	38988: "attention-payment-confirmation",
+}
+
+func FuzzValidateATTNEvent(f *testing.F) {
+	for _, event := range seedEvents(f) {
+		data, _ := json.Marshal(event)
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var event nostr.Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			return
+		}
+
+		result := ValidateATTNEvent(&event)
+		if result.Valid && result.Code != "" {
+			t.Fatalf("valid result has code %q", result.Code)
+		}
+		if !result.Valid && result.Code == "" {
+			t.Fatalf("invalid result has no code: %s", result.Message)
+		}
+		if result.Valid && !IsATTNProtocolKind(event.Kind) {
+			t.Fatalf("kind %d accepted but is not an ATTN kind", event.Kind)
+		}
+		if again := ValidateATTNEvent(&event); again != result {
+			t.Fatalf("validation is not deterministic: %+v then %+v", result, again)
+		}
+	})
+}
+
+func FuzzValidateDTagFormat(f *testing.F) {
+	for _, event := range seedEvents(f) {
+		f.Add(event.Kind, event.Tags.GetD())
+	}
+	f.Add(38808, "org.cityprotocol:block:870500:00000000000000000001a7c")
+	f.Add(38188, "org.attnprotocol:marketplace:")
+	f.Add(38188, "org.attnprotocol:")
+
+	f.Fuzz(func(t *testing.T, kind int, d_tag string) {
+		err := validateDTagFormat(kind, d_tag)
+		if err != nil {
+			return
+		}
+
+		if kind == 38808 {
+			if !strings.HasPrefix(d_tag, "org.cityprotocol:block:") {
+				t.Fatalf("accepted block d tag %q without block prefix", d_tag)
+			}
+			return
+		}
+
+		// An accepted ATTN d tag names the kind's event type and a non-empty identifier
+		event_type, ok := eventTypes[kind]
+		if !ok {
+			t.Fatalf("accepted d tag %q for unknown kind %d", d_tag, kind)
+		}
+		prefix := "org.attnprotocol:" + event_type + ":"
+		if !strings.HasPrefix(d_tag, prefix) || len(d_tag) == len(prefix) {
+			t.Fatalf("accepted d tag %q for kind %d", d_tag, kind)
+		}
+
+		// A coordinate made from an accepted d tag must be accepted too
+		coordinate := strconv.Itoa(kind) + ":" + strings.Repeat("a", 64) + ":" + d_tag
+		if err := validateCoordinateFormat(coordinate, kind); err != nil {
+			t.Fatalf("d tag %q accepted but coordinate %q rejected: %v", d_tag, coordinate, err)
+		}
+	})
+}
+
+func FuzzValidateCoordinateFormat(f *testing.F) {
+	for _, event := range seedEvents(f) {
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "a" {
+				kind, _ := strconv.Atoi(strings.SplitN(tag[1], ":", 2)[0])
+				f.Add(tag[1], kind)
+			}
+		}
+	}
+	f.Add("38188::org.attnprotocol:marketplace:x", 38188)
+	f.Add("38188:pubkey:org.attnprotocol:marketplace:", 38188)
+	f.Add("38188:pubkey:org.attnprotocol:billboard:x", 38188)
+
+	f.Fuzz(func(t *testing.T, coordinate string, kind int) {
+		if err := validateCoordinateFormat(coordinate, kind); err != nil {
+			return
+		}
+
+		parts := strings.SplitN(coordinate, ":", 3)
+		if len(parts) != 3 || parts[1] == "" || parts[2] == "" {
+			t.Fatalf("accepted coordinate %q with empty parts", coordinate)
+		}
+		if parts[0] != strconv.Itoa(kind) {
+			t.Fatalf("accepted coordinate %q for kind %d", coordinate, kind)
+		}
+
+		// Protocol coordinates carry the referenced event's d tag
+		if IsATTNProtocolKind(kind) || kind == 38808 {
+			if err := validateDTagFormat(kind, parts[2]); err != nil {
+				t.Fatalf("accepted coordinate %q whose d tag is rejected: %v", coordinate, err)
+			}
+		}
+	})
+}
+
+func FuzzParseHeight(f *testing.F) {
+	f.Add("870500", 870500.0)
+	f.Add("-1", -1.0)
+	f.Add("870500.5", 870500.5)
+	f.Add("+870500", math.Inf(1))
+	f.Add("", math.NaN())
+
+	f.Fuzz(func(t *testing.T, text string, number float64) {
+		if height, err := parseHeight(text); err == nil {
+			if height < 0 || strconv.FormatInt(height, 10) != text {
+				t.Fatalf("parseHeight(%q) = %d, not a canonical non-negative height", text, height)
+			}
+		}
+		if height, err := parseHeight(number); err == nil {
+			if height < 0 || float64(height) != number {
+				t.Fatalf("parseHeight(%v) = %d, lost precision or sign", number, height)
+			}
+		}
+	})
+}
+
+func FuzzIndexTags(f *testing.F) {
+	for _, event := range seedEvents(f) {
+		data, _ := json.Marshal(event.Tags)
+		f.Add(data)
+	}
+	f.Add([]byte(`[[],["e"],["e","id"],["e","id","","match"],["a"],["a","38188:"],["d",""],["d","x"],["x-custom"]]`))
+
+	f.Fuzz(func(t *testing.T, tags_json []byte) {
+		var tags nostr.Tags
+		if err := json.Unmarshal(tags_json, &tags); err != nil {
+			return
+		}
+		event := &nostr.Event{Kind: 38888, Tags: tags}
+		index := indexTags(event, nil)
+
+		// The index must agree with a plain scan of the tags for every lookup the validators make
+		for name, got := range map[string]string{"d": index.d, "t": index.t, "k": index.k, "u": index.u} {
+			if want := firstTagValue(event, name); got != want {
+				t.Fatalf("%s = %q, want %q", name, got, want)
+			}
+		}
+		for name, got := range map[string]int{"p": index.p_count, "r": index.r_count, "k": index.k_count, "e": index.e_count} {
+			if want := countTagValues(event, name); got != want {
+				t.Fatalf("%s count = %d, want %d", name, got, want)
+			}
+		}
+		for slot, prefix := range []string{"38188:", "38288:", "38388:", "38488:", "38888:", "38808:", "34236:"} {
+			if got, want := index.coordinate(slot), firstTagValueByPrefix(event, "a", prefix); got != want {
+				t.Fatalf("coordinate %s = %q, want %q", prefix, got, want)
+			}
+		}
+		for list, suffix := range map[uint8]string{
+			listPromotionBlocked:   "org.attnprotocol:promotion:blocked",
+			listPromoterBlocked:    "org.attnprotocol:promoter:blocked",
+			listMarketplaceTrusted: "org.attnprotocol:marketplace:trusted",
+			listBillboardTrusted:   "org.attnprotocol:billboard:trusted",
+		} {
+			if got, want := index.hasList(list), hasListTag(event, suffix); got != want {
+				t.Fatalf("list %s = %v, want %v", suffix, got, want)
+			}
+		}
+		for marker, name := range map[uint8]string{
+			markerMatch:                   "match",
+			markerBillboardConfirmation:   "billboard_confirmation",
+			markerAttentionConfirmation:   "attention_confirmation",
+			markerMarketplaceConfirmation: "marketplace_confirmation",
+		} {
+			if got, want := index.hasEMarker(marker), hasMarkedETag(event, name); got != want {
+				t.Fatalf("e marker %s = %v, want %v", name, got, want)
+			}
+		}
+		label, labelled := index.versionLabel()
+		if want, want_labelled := specVersionLabel(event); label != want || labelled != want_labelled {
+			t.Fatalf("version label = %q, %v, want %q, %v", label, labelled, want, want_labelled)
+		}
+		checked := indexTags(event, newAllowedTags(officialTags))
+		if _, disallowed := checked.disallowedTag(); disallowed == onlyOfficialTags(event) {
+			t.Fatalf("disallowed tag = %v, want %v", disallowed, !disallowed)
+		}
+	})
+}
+
+// The helpers below are plain linear scans used as the reference for FuzzIndexTags.
+
+func firstTagValue(event *nostr.Event, tag_name string) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == tag_name {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+func firstTagValueByPrefix(event *nostr.Event, tag_name, prefix string) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == tag_name && strings.HasPrefix(tag[1], prefix) {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+func countTagValues(event *nostr.Event, tag_name string) int {
+	count := 0
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == tag_name {
+			count++
+		}
+	}
+	return count
+}
+
+func hasListTag(event *nostr.Event, suffix string) bool {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], "30000:") && strings.HasSuffix(tag[1], suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMarkedETag(event *nostr.Event, marker string) bool {
+	for _, tag := range event.Tags {
+		if len(tag) >= 4 && tag[0] == "e" && tag[3] == marker {
+			return true
+		}
+	}
+	return false
+}
+
+func onlyOfficialTags(event *nostr.Event) bool {
+	allowed_tags := map[string]bool{"d": true, "t": true, "a": true, "e": true, "p": true, "r": true, "k": true, "u": true, "L": true, "l": true}
+	for _, tag := range event.Tags {
+		if len(tag) > 0 && !allowed_tags[tag[0]] {
+			return false
+		}
+	}
+	return true
+}
+
+func FuzzScanContent(f *testing.F) {
+	for _, event := range seedEvents(f) {
+		f.Add(event.Content)
+	}
+	f.Add(`null`)
+	f.Add(`{"ask":1,"ask":"x","n":[1e400]}`)
+	f.Add("{\"payment_proof\":\"zap:\\u0061b\",\"x\":\"\xff\"}")
+
+	f.Fuzz(func(t *testing.T, content string) {
+		// encoding/json's verdict and values are the reference
+		var want map[string]interface{}
+		want_ok := json.Unmarshal([]byte(content), &want) == nil
+
+		got := map[string]contentValue{}
+		got_ok := scanContent(content, func(key string, value contentValue) {
+			got[key] = value
+		})
+		if got_ok != want_ok {
+			t.Fatalf("scanContent(%q) = %v, encoding/json ok = %v", content, got_ok, want_ok)
+		}
+		if !got_ok {
+			return
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("scanContent(%q) saw %d fields, encoding/json %d", content, len(got), len(want))
+		}
+		for key, value := range want {
+			number, is_number := value.(float64)
+			got_number, got_is_number := got[key].float()
+			if is_number != got_is_number || number != got_number {
+				t.Fatalf("field %q: got %+v, encoding/json %v", key, got[key], value)
+			}
+			if _, is_array := value.([]interface{}); is_array != (got[key].kind == contentArray) {
+				t.Fatalf("field %q: got %+v, encoding/json %v", key, got[key], value)
+			}
+			text, is_string := value.(string)
+			if got_text, got_is_string := got[key].text(); is_string != got_is_string || text != got_text {
+				t.Fatalf("field %q: got %+v, encoding/json %v", key, got[key], value)
+			}
+		}
+	})
+}
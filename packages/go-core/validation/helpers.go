@@ -8,10 +8,10 @@ package validation
 
 import (
 	"fmt"
-	"strconv"
+	"math"
 	"strings"
 
-	"github.com/nbd-wtf/go-nostr"
+	"github.com/joinnextblock/attn-protocol/go-core"
 )
 
 // validateDTagFormat validates that d tag follows the appropriate namespace format.
@@ -37,41 +37,17 @@ func validateDTagFormat(kind int, d_tag string) error {
 		return fmt.Errorf("d tag must start with '%s'", expected_prefix)
 	}
 
-	// Map of event kinds to expected event type in d tag
-	event_type_map := map[int]string{
-		38188: "marketplace",
-		38288: "billboard",
-		38388: "promotion",
-		38488: "attention",
-		38588: "billboard-confirmation",
-		38688: "attention-confirmation",
-		38788: "marketplace-confirmation",
-		38888: "match",
-		38988: "attention-payment-confirmation",
-	}
-
-	expected_type, ok := event_type_map[kind]
+	expected_type, ok := eventTypeForKind(kind)
 	if !ok {
 		return fmt.Errorf("unknown event kind: %d", kind)
 	}
 
-	// Remove the prefix to get the remaining parts: <event_type>:<identifier>
-	remaining := strings.TrimPrefix(d_tag, expected_prefix)
-	if remaining == d_tag {
-		// This shouldn't happen since we checked HasPrefix above, but be safe
-		return fmt.Errorf("d tag must start with 'org.attnprotocol:'")
-	}
-
-	// Split the remaining part by ':' to get event_type and identifier
-	// Format: <event_type>:<identifier> (identifier may contain colons)
-	parts := strings.SplitN(remaining, ":", 2)
-	if len(parts) < 2 {
+	// The remaining part is <event_type>:<identifier> (identifier may contain colons)
+	event_type, identifier, found := strings.Cut(d_tag[len(expected_prefix):], ":")
+	if !found {
 		return fmt.Errorf("d tag format invalid: expected org.attnprotocol:<event_type>:<identifier>, got '%s'", d_tag)
 	}
 
-	event_type := parts[0]
-	identifier := parts[1]
-
 	if event_type != expected_type {
 		return fmt.Errorf("d tag event type mismatch: expected '%s', got '%s'", expected_type, event_type)
 	}
@@ -84,156 +60,76 @@ func validateDTagFormat(kind int, d_tag string) error {
 }
 
 // validateCoordinateFormat validates that coordinate follows format: kind:pubkey:org.attnprotocol:event_type:identifier
-// For City Protocol events (38808), format is: kind:pubkey:org.cityprotocol:event_type:identifier
+// For City Protocol events (38808), format is: kind:pubkey:org.cityprotocol:block:<height>:<hash>
 // For non-protocol events (e.g., video kind 34236), format is: kind:pubkey:d_tag (without org.attnprotocol:)
+//
+// The part after the pubkey is the referenced event's d tag, so protocol coordinates
+// must satisfy validateDTagFormat for their kind.
 func validateCoordinateFormat(coordinate string, expected_kind int) error {
-	parts := strings.Split(coordinate, ":")
-	if len(parts) < 3 {
-		return fmt.Errorf("coordinate format invalid: expected kind:pubkey:identifier")
-	}
-
-	// Parse kind from coordinate
-	coord_kind, err := strconv.Atoi(parts[0])
+	coord_kind, pubkey, identifier, err := core.ParseCoordinate(coordinate)
 	if err != nil {
-		return fmt.Errorf("coordinate kind must be numeric: %s", parts[0])
+		return err
 	}
 
 	if coord_kind != expected_kind {
 		return fmt.Errorf("coordinate kind mismatch: expected %d, got %d", expected_kind, coord_kind)
 	}
 
-	// For City Protocol block events (38808), validate org.cityprotocol: prefix
-	if coord_kind == 38808 {
-		if len(parts) < 4 {
-			return fmt.Errorf("City Protocol coordinate format invalid: expected kind:pubkey:org.cityprotocol:event_type:identifier")
-		}
-		if parts[2] != "org.cityprotocol" {
-			return fmt.Errorf("City Protocol coordinate must include 'org.cityprotocol:' prefix")
-		}
-		if len(parts) < 5 {
-			return fmt.Errorf("City Protocol coordinate format invalid: expected kind:pubkey:org.cityprotocol:event_type:identifier")
-		}
-		if parts[3] == "" {
-			return fmt.Errorf("City Protocol coordinate event type is empty")
-		}
-		return nil
-	}
-
-	// For ATTN Protocol events (38188-38988), validate org.attnprotocol: prefix
-	if coord_kind >= 38188 && coord_kind <= 38988 {
-		if len(parts) < 4 {
-			return fmt.Errorf("protocol coordinate format invalid: expected kind:pubkey:org.attnprotocol:event_type:identifier")
-		}
-		// parts[0] = kind, parts[1] = pubkey, parts[2] = org.attnprotocol, parts[3] = event_type, parts[4+] = identifier
-		if parts[2] != "org.attnprotocol" {
-			return fmt.Errorf("protocol coordinate must include 'org.attnprotocol:' prefix")
-		}
-		if len(parts) < 5 {
-			return fmt.Errorf("protocol coordinate format invalid: expected kind:pubkey:org.attnprotocol:event_type:identifier")
-		}
-		// parts[3] should be the event type (marketplace, etc.)
-		if parts[3] == "" {
-			return fmt.Errorf("protocol coordinate event type is empty")
-		}
-	}
-
-	return nil
-}
-
-// validateETagWithMarker validates that an e tag with the specified marker exists
-func validateETagWithMarker(event *nostr.Event, marker string) bool {
-	for _, tag := range event.Tags {
-		if len(tag) >= 4 && tag[0] == "e" && tag[3] == marker {
-			return true
-		}
+	if pubkey == "" {
+		return fmt.Errorf("coordinate pubkey is empty")
 	}
-	return false
-}
-
-// getETagByMarker gets the e tag value with the specified marker
-func getETagByMarker(event *nostr.Event, marker string) string {
-	for _, tag := range event.Tags {
-		if len(tag) >= 4 && tag[0] == "e" && tag[3] == marker {
-			return tag[1]
-		}
-	}
-	return ""
-}
-
-// getTagValue gets the first value for a tag with the given name
-func getTagValue(event *nostr.Event, tag_name string) string {
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == tag_name {
-			return tag[1]
-		}
+	if identifier == "" {
+		return fmt.Errorf("coordinate identifier is empty")
 	}
-	return ""
-}
 
-// getTagValueByPrefix gets the first tag value that starts with the given prefix
-func getTagValueByPrefix(event *nostr.Event, tag_name, prefix string) string {
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == tag_name && strings.HasPrefix(tag[1], prefix) {
-			return tag[1]
+	// City Protocol block events (38808) and ATTN Protocol events (38188-38988) use namespaced d tags
+	if coord_kind == 38808 || (coord_kind >= 38188 && coord_kind <= 38988) {
+		if err := validateDTagFormat(coord_kind, identifier); err != nil {
+			return fmt.Errorf("coordinate identifier invalid: %s", err.Error())
 		}
 	}
-	return ""
-}
 
-// getTagValues gets all values for tags with the given name
-func getTagValues(event *nostr.Event, tag_name string) []string {
-	var values []string
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == tag_name {
-			values = append(values, tag[1])
-		}
-	}
-	return values
+	return nil
 }
 
-// parseHeight parses a block height from various types
+// parseHeight parses a block height from a JSON number or a string.
+// Heights must be non-negative integers; fractional, non-finite and
+// out-of-range numbers are rejected rather than truncated.
 func parseHeight(value interface{}) (int64, error) {
 	switch v := value.(type) {
 	case float64:
+		if v < 0 || v != math.Trunc(v) || v >= math.MaxInt64 {
+			return 0, fmt.Errorf("block height must be a non-negative integer")
+		}
 		return int64(v), nil
 	case string:
-		return strconv.ParseInt(v, 10, 64)
+		return core.ParseBlockHeight(v)
 	default:
 		return 0, fmt.Errorf("unsupported height type")
 	}
 }
 
-// hasListCoordinate checks if the event has an 'a' tag with a NIP-51 list coordinate
-func hasListCoordinate(event *nostr.Event, suffix string) bool {
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], "30000:") && strings.HasSuffix(tag[1], suffix) {
-			return true
-		}
-	}
-	return false
-}
-
-// validateOfficialTagsOnly validates that only official Nostr tags are used.
-// ATTN-01 limits tags to official Nostr tags: d, t, a, e, p, r, k, u
-// Block events (38808) only use d and p tags per CITY-01 specification.
-func validateOfficialTagsOnly(event *nostr.Event) ValidationResult {
-	allowed_tags := map[string]bool{
-		"d": true, "t": true, "a": true, "e": true,
-		"p": true, "r": true, "k": true, "u": true,
-	}
-
-	for _, tag := range event.Tags {
-		if len(tag) > 0 {
-			tag_name := tag[0]
-			if !allowed_tags[tag_name] {
-				return ValidationResult{
-					Valid:   false,
-					Message: fmt.Sprintf("Non-standard tag '%s' not allowed. Only official Nostr tags are permitted: d, t, a, e, p, r, k, u", tag_name),
-				}
-			}
-		}
-	}
-
-	return ValidationResult{Valid: true, Message: "All tags are official Nostr tags"}
+// eventTypeForKind returns the event type used in d tags for an ATTN Protocol kind.
+func eventTypeForKind(kind int) (string, bool) {
+	switch kind {
+	case 38188:
+		return "marketplace", true
+	case 38288:
+		return "billboard", true
+	case 38388:
+		return "promotion", true
+	case 38488:
+		return "attention", true
+	case 38588:
+		return "billboard-confirmation", true
+	case 38688:
+		return "attention-confirmation", true
+	case 38788:
+		return "marketplace-confirmation", true
+	case 38888:
+		return "match", true
+	case 38988:
+		return "attention-payment-confirmation", true
+	}
+	return "", false
 }
-
@@ -1,10 +1,9 @@
 package validation
 
 import (
-	"encoding/json"
 	"fmt"
-	"strconv"
 
+	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -19,98 +18,123 @@ import (
 //
 // Returns a ValidationResult indicating if the event is valid.
 func ValidateMarketplaceEvent(event *nostr.Event) ValidationResult {
+	return validateMarketplace(event, indexTags(event, nil))
+}
+
+// validateMarketplace implements ValidateMarketplaceEvent over the event's indexed tags.
+func validateMarketplace(event *nostr.Event, tags tagIndex) ValidationResult {
 	// Must have d tag (marketplace identifier)
-	d_tag := getTagValue(event, "d")
+	d_tag := tags.d
 	if d_tag == "" {
-		return ValidationResult{Valid: false, Message: "Missing 'd' tag (marketplace identifier)"}
+		return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "Missing 'd' tag (marketplace identifier)"}
 	}
 
 	// Validate d tag format: org.attnprotocol:marketplace:<marketplace_id>
 	if err := validateDTagFormat(38188, d_tag); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidDTag, Message: fmt.Sprintf("Invalid d tag format: %s", err.Error())}
 	}
 
 	// Must have t tag with block height (numeric)
-	block_height := getTagValue(event, "t")
+	block_height := tags.t
 	if block_height == "" {
-		return ValidationResult{Valid: false, Message: "Missing 't' tag (block height)"}
+		return ValidationResult{Valid: false, Code: CodeMissingBlockHeight, Message: "Missing 't' tag (block height)"}
 	}
 
-	if _, err := strconv.Atoi(block_height); err != nil {
-		return ValidationResult{Valid: false, Message: "Invalid block height in 't' tag: must be numeric"}
+	if _, err := core.ParseBlockHeight(block_height); err != nil {
+		return ValidationResult{Valid: false, Code: CodeInvalidBlockHeight, Message: "Invalid block height in 't' tag: must be a non-negative integer"}
 	}
 
 	// Must have block coordinate a tag (format: 38808:clock_pubkey:org.cityprotocol:block:<height>:<hash>)
-	block_coord := getTagValueByPrefix(event, "a", "38808:")
+	block_coord := tags.coordinate(slotBlock)
 	if block_coord == "" {
-		return ValidationResult{Valid: false, Message: "Missing block coordinate 'a' tag (format: 38808:clock_pubkey:org.cityprotocol:block:<height>:<hash>)"}
+		return ValidationResult{Valid: false, Code: CodeMissingCoordinate, Message: "Missing block coordinate 'a' tag (format: 38808:clock_pubkey:org.cityprotocol:block:<height>:<hash>)"}
 	}
 
 	if err := validateCoordinateFormat(block_coord, 38808); err != nil {
-		return ValidationResult{Valid: false, Message: fmt.Sprintf("Invalid block coordinate format: %s", err.Error())}
+		return ValidationResult{Valid: false, Code: CodeInvalidCoordinate, Message: fmt.Sprintf("Invalid block coordinate format: %s", err.Error())}
 	}
 
 	// Must have k tags (event kinds)
-	k_tags := getTagValues(event, "k")
-	if len(k_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'k' tags (event kinds)"}
+	if tags.k_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'k' tags (event kinds)"}
 	}
 
 	// Must have p tags (marketplace_pubkey and clock_pubkey)
-	p_tags := getTagValues(event, "p")
-	if len(p_tags) < 2 {
-		return ValidationResult{Valid: false, Message: "Missing required 'p' tags (marketplace_pubkey and clock_pubkey)"}
+	if tags.p_count < 2 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'p' tags (marketplace_pubkey and clock_pubkey)"}
 	}
 
 	// Must have r tags (relay URLs)
-	r_tags := getTagValues(event, "r")
-	if len(r_tags) == 0 {
-		return ValidationResult{Valid: false, Message: "Missing required 'r' tags (relay URLs)"}
-	}
-
-	// Content must be valid JSON
-	var content_data map[string]interface{}
-	if err := json.Unmarshal([]byte(event.Content), &content_data); err != nil {
-		return ValidationResult{Valid: false, Message: "Content must be valid JSON"}
+	if tags.r_count == 0 {
+		return ValidationResult{Valid: false, Code: CodeMissingTag, Message: "Missing required 'r' tags (relay URLs)"}
 	}
 
-	// Check for required fields in content (per ATTN-01.md)
-	// Note: ref_clock_pubkey replaces ref_node_pubkey (block events now from City Protocol)
-	required_fields := []string{"name", "description", "admin_pubkey", "min_duration", "max_duration", "match_fee_sats", "confirmation_fee_sats", "ref_marketplace_pubkey", "ref_marketplace_id", "ref_clock_pubkey", "ref_block_id"}
-	for _, field := range required_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	// Content must be a valid JSON object
+	var content marketplaceContent
+	if !content.decode(event.Content) {
+		return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "Content must be valid JSON"}
 	}
 
-	// Check for required count metrics (per ATTN-01.md)
-	// These are required fields that track marketplace statistics
-	required_count_fields := []string{"billboard_count", "promotion_count", "attention_count", "match_count"}
-	for _, field := range required_count_fields {
-		if _, ok := content_data[field]; !ok {
-			return ValidationResult{Valid: false, Message: fmt.Sprintf("Content must include %s", field)}
-		}
+	// Check for required fields and count metrics in content (per ATTN-01.md)
+	if field, missing := content.fields.missing(marketplaceContentFields); missing {
+		return ValidationResult{Valid: false, Code: CodeMissingField, Message: fmt.Sprintf("Content must include %s", field)}
 	}
 
 	// Validate min_duration and max_duration
-	if min_dur, ok := content_data["min_duration"].(float64); !ok || min_dur <= 0 {
-		return ValidationResult{Valid: false, Message: "min_duration must be a positive number"}
+	min_dur, ok := content.min_duration.float()
+	if !ok || min_dur <= 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "min_duration must be a positive number"}
 	}
-	if max_dur, ok := content_data["max_duration"].(float64); !ok || max_dur <= 0 {
-		return ValidationResult{Valid: false, Message: "max_duration must be a positive number"}
+	max_dur, ok := content.max_duration.float()
+	if !ok || max_dur <= 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "max_duration must be a positive number"}
 	}
-	if min_dur, max_dur := content_data["min_duration"].(float64), content_data["max_duration"].(float64); min_dur > max_dur {
-		return ValidationResult{Valid: false, Message: "min_duration must be <= max_duration"}
+	if min_dur > max_dur {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "min_duration must be <= max_duration"}
 	}
 
 	// Validate fees are non-negative
-	if match_fee, ok := content_data["match_fee_sats"].(float64); !ok || match_fee < 0 {
-		return ValidationResult{Valid: false, Message: "match_fee_sats must be a non-negative number"}
+	if match_fee, ok := content.match_fee_sats.float(); !ok || match_fee < 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "match_fee_sats must be a non-negative number"}
 	}
-	if conf_fee, ok := content_data["confirmation_fee_sats"].(float64); !ok || conf_fee < 0 {
-		return ValidationResult{Valid: false, Message: "confirmation_fee_sats must be a non-negative number"}
+	if conf_fee, ok := content.confirmation_fee_sats.float(); !ok || conf_fee < 0 {
+		return ValidationResult{Valid: false, Code: CodeInvalidField, Message: "confirmation_fee_sats must be a non-negative number"}
 	}
 
 	return ValidationResult{Valid: true, Message: "Valid marketplace event"}
 }
 
+// marketplaceContentFields are the required content fields of a Marketplace event, in the order they are checked.
+// ref_clock_pubkey replaces ref_node_pubkey (block events now from City Protocol), and the
+// trailing count metrics track marketplace statistics.
+var marketplaceContentFields = []string{
+	"name", "description", "admin_pubkey", "min_duration", "max_duration", "match_fee_sats", "confirmation_fee_sats",
+	"ref_marketplace_pubkey", "ref_marketplace_id", "ref_clock_pubkey", "ref_block_id",
+	"billboard_count", "promotion_count", "attention_count", "match_count",
+}
+
+// marketplaceContent is the typed content of a Marketplace event: the fields validation reads.
+type marketplaceContent struct {
+	fields                contentFields
+	min_duration          contentValue
+	max_duration          contentValue
+	match_fee_sats        contentValue
+	confirmation_fee_sats contentValue
+}
+
+// decode scans content into c, returning false if it is not a JSON object.
+func (c *marketplaceContent) decode(content string) bool {
+	return scanContent(content, func(key string, value contentValue) {
+		c.fields.mark(marketplaceContentFields, key)
+		switch key {
+		case "min_duration":
+			c.min_duration = value
+		case "max_duration":
+			c.max_duration = value
+		case "match_fee_sats":
+			c.match_fee_sats = value
+		case "confirmation_fee_sats":
+			c.confirmation_fee_sats = value
+		}
+	})
+}
@@ -0,0 +1,281 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrUnsupportedSpecVersion is returned when an event's spec version cannot be read.
+var ErrUnsupportedSpecVersion = errors.New("unsupported spec version")
+
+// kindLegacyFields describes how one kind's SpecVersion1 content differs from the current shape.
+type kindLegacyFields struct {
+	// renamed maps SpecVersion1 field names to their current names
+	renamed map[string]string
+
+	// dropped lists SpecVersion1 fields the current version no longer stores in content
+	dropped []string
+}
+
+// isLegacy reports whether key only appears in SpecVersion1 content.
+func (fields kindLegacyFields) isLegacy(key string) bool {
+	if _, ok := fields.renamed[key]; ok {
+		return true
+	}
+	for _, name := range fields.dropped {
+		if name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyFields holds the SpecVersion1 differences for each ATTN kind.
+// Reference fields lost their ref_ prefix in SpecVersion1, so they are derived
+// from the current field lists.
+var legacyFields = map[int]kindLegacyFields{
+	38188: legacyShape(marketplaceContentFields, "block_height", "kind_list", "relay_list"),
+	38288: legacyShape(billboardContentFields, "block_height"),
+	38388: legacyShape(promotionContentFields, "block_height"),
+	38488: legacyShape(attentionContentFields, "block_height", "kind_list", "relay_list"),
+	38588: legacyShape(confirmationContentFields, "block_height"),
+	38688: legacyShape(confirmationContentFields, "block_height"),
+	38788: legacyShape(marketplaceConfirmationContentFields, "block_height"),
+	38888: legacyShape(matchContentFields, "block_height", "bid", "ask", "duration"),
+	38988: legacyShape(paymentConfirmationContentFields, "block_height"),
+}
+
+// legacyShape derives a kind's SpecVersion1 field names from its current field list.
+func legacyShape(current []string, dropped ...string) kindLegacyFields {
+	renamed := make(map[string]string)
+	for _, field := range current {
+		switch {
+		case field == "ref_clock_pubkey":
+			// Marketplaces referenced the block-producing node before City Protocol clocks
+			renamed["node_pubkey"] = field
+		case strings.HasPrefix(field, "ref_"):
+			renamed[strings.TrimPrefix(field, "ref_")] = field
+		}
+	}
+	return kindLegacyFields{renamed: renamed, dropped: dropped}
+}
+
+// UpgradeEvent returns a copy of the event rewritten to the current spec version.
+// Events already in the current version are copied unchanged.
+//
+// Upgrading a SpecVersion1 event renames reference fields to ref_*, moves
+// block_height, kind_list and relay_list from content to t, k and r tags, drops
+// the bid, ask and duration MATCH events used to repeat, fills the marketplace
+// statistics SpecVersion1 did not publish with zero, and namespaces plain d tags
+// and coordinate identifiers.
+//
+// The copy keeps the original ID, pubkey and signature for provenance but is not
+// signed in its new form: use it for ingestion, never republish it.
+func UpgradeEvent(event *nostr.Event) (*nostr.Event, error) {
+	version := DetectSpecVersion(event)
+	if version == core.SpecVersionUnknown {
+		value, _ := specVersionLabel(event)
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedSpecVersion, value)
+	}
+	return upgradeEvent(event, version)
+}
+
+// upgradeEvent upgrades an event known to be written for version.
+func upgradeEvent(event *nostr.Event, version core.SpecVersion) (*nostr.Event, error) {
+	upgraded := *event
+	upgraded.Tags = make(nostr.Tags, 0, len(event.Tags)+1)
+	for _, tag := range event.Tags {
+		upgraded.Tags = append(upgraded.Tags, append(nostr.Tag(nil), tag...))
+	}
+
+	switch version {
+	case core.CurrentSpecVersion:
+		return &upgraded, nil
+	case core.SpecVersion1:
+		if err := upgradeFromVersion1(&upgraded); err != nil {
+			return nil, err
+		}
+		return &upgraded, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedSpecVersion, version)
+	}
+}
+
+// upgradeFromVersion1 rewrites a copied SpecVersion1 event in place.
+func upgradeFromVersion1(event *nostr.Event) error {
+	legacy, ok := legacyFields[event.Kind]
+	if !ok {
+		return fmt.Errorf("kind %d is not an ATTN Protocol kind", event.Kind)
+	}
+
+	var content map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil || content == nil {
+		return fmt.Errorf("content must be a JSON object")
+	}
+
+	for old_name, new_name := range legacy.renamed {
+		value, ok := content[old_name]
+		if !ok {
+			continue
+		}
+		if _, exists := content[new_name]; !exists {
+			content[new_name] = value
+		}
+		delete(content, old_name)
+	}
+
+	// Block height moved to the t tag
+	if raw, ok := content["block_height"]; ok {
+		if event.Tags.Find("t") == nil {
+			var value interface{}
+			json.Unmarshal(raw, &value)
+			height, err := parseHeight(value)
+			if err != nil {
+				return fmt.Errorf("invalid block_height: %w", err)
+			}
+			event.Tags = append(event.Tags, nostr.Tag{"t", strconv.FormatInt(height, 10)})
+		}
+		delete(content, "block_height")
+	}
+
+	// Kind and relay lists moved to k and r tags
+	if raw, ok := content["kind_list"]; ok {
+		var kinds []int
+		if err := json.Unmarshal(raw, &kinds); err != nil {
+			return fmt.Errorf("invalid kind_list: %w", err)
+		}
+		for _, kind := range kinds {
+			addTagValue(event, "k", strconv.Itoa(kind))
+		}
+		delete(content, "kind_list")
+	}
+	if raw, ok := content["relay_list"]; ok {
+		var relays []string
+		if err := json.Unmarshal(raw, &relays); err != nil {
+			return fmt.Errorf("invalid relay_list: %w", err)
+		}
+		for _, relay := range relays {
+			addTagValue(event, "r", relay)
+		}
+		delete(content, "relay_list")
+	}
+
+	switch event.Kind {
+	case 38888:
+		// MATCH values are derived from the referenced events
+		delete(content, "bid")
+		delete(content, "ask")
+		delete(content, "duration")
+	case 38188:
+		for _, field := range []string{"billboard_count", "promotion_count", "attention_count", "match_count"} {
+			if _, ok := content[field]; !ok {
+				content[field] = json.RawMessage("0")
+			}
+		}
+	}
+
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	event.Content = string(data)
+
+	upgradeVersion1Tags(event)
+	return nil
+}
+
+// upgradeVersion1Tags namespaces plain d tags and coordinate identifiers and
+// drops the spec version label, which no longer describes the event.
+func upgradeVersion1Tags(event *nostr.Event) {
+	tags := event.Tags[:0]
+	for _, tag := range event.Tags {
+		if len(tag) >= 3 && tag[0] == "l" && tag[2] == core.SpecVersionLabelNamespace {
+			continue
+		}
+		if len(tag) >= 2 && tag[0] == "L" && tag[1] == core.SpecVersionLabelNamespace {
+			continue
+		}
+		if len(tag) >= 2 && tag[0] == "d" {
+			tag[1] = namespaceIdentifier(event.Kind, tag[1])
+		}
+		if len(tag) >= 2 && tag[0] == "a" {
+			if kind, pubkey, identifier, err := core.ParseCoordinate(tag[1]); err == nil {
+				tag[1] = strconv.Itoa(kind) + ":" + pubkey + ":" + namespaceIdentifier(kind, identifier)
+			}
+		}
+		tags = append(tags, tag)
+	}
+	event.Tags = tags
+}
+
+// namespaceIdentifier returns the d tag for a plain identifier of an ATTN kind,
+// org.attnprotocol:<event_type>:<identifier>. Identifiers that are already
+// namespaced, and identifiers of other kinds, are returned unchanged.
+func namespaceIdentifier(kind int, identifier string) string {
+	event_type, ok := eventTypeForKind(kind)
+	if !ok || identifier == "" || strings.HasPrefix(identifier, "org.attnprotocol:") {
+		return identifier
+	}
+	return "org.attnprotocol:" + event_type + ":" + identifier
+}
+
+// addTagValue appends [name, value] unless the event already has it.
+func addTagValue(event *nostr.Event, name, value string) {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == name && tag[1] == value {
+			return
+		}
+	}
+	event.Tags = append(event.Tags, nostr.Tag{name, value})
+}
+
+// DecodeContent upgrades the event to the current spec version and decodes its
+// content into the matching core type, returned by value: core.MarketplaceData,
+// core.BillboardData, core.PromotionData, core.AttentionData, core.MatchData,
+// core.BillboardConfirmationData, core.AttentionConfirmationData,
+// core.MarketplaceConfirmationData or core.AttentionPaymentConfirmationData.
+// It does not validate the event; call ValidateATTNEvent or a Registry for that.
+func DecodeContent(event *nostr.Event) (interface{}, error) {
+	upgraded, err := UpgradeEvent(event)
+	if err != nil {
+		return nil, err
+	}
+
+	switch upgraded.Kind {
+	case 38188:
+		return decodeAs[core.MarketplaceData](upgraded.Content)
+	case 38288:
+		return decodeAs[core.BillboardData](upgraded.Content)
+	case 38388:
+		return decodeAs[core.PromotionData](upgraded.Content)
+	case 38488:
+		return decodeAs[core.AttentionData](upgraded.Content)
+	case 38588:
+		return decodeAs[core.BillboardConfirmationData](upgraded.Content)
+	case 38688:
+		return decodeAs[core.AttentionConfirmationData](upgraded.Content)
+	case 38788:
+		return decodeAs[core.MarketplaceConfirmationData](upgraded.Content)
+	case 38888:
+		return decodeAs[core.MatchData](upgraded.Content)
+	case 38988:
+		return decodeAs[core.AttentionPaymentConfirmationData](upgraded.Content)
+	default:
+		return nil, fmt.Errorf("kind %d is not an ATTN Protocol kind", upgraded.Kind)
+	}
+}
+
+// decodeAs unmarshals content into a T.
+func decodeAs[T any](content string) (interface{}, error) {
+	var data T
+	if err := json.Unmarshal([]byte(content), &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
@@ -0,0 +1,318 @@
+package validation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Validator validates events of one kind.
+type Validator interface {
+	Validate(event *nostr.Event) ValidationResult
+}
+
+// ValidatorFunc adapts a function to the Validator interface.
+type ValidatorFunc func(event *nostr.Event) ValidationResult
+
+// Validate calls f(event).
+func (f ValidatorFunc) Validate(event *nostr.Event) ValidationResult {
+	return f(event)
+}
+
+// Middleware wraps a Validator with additional checks, for example local relay
+// policy such as a minimum bid. A middleware usually runs next first and only
+// applies its own rule to events next accepted.
+type Middleware func(next Validator) Validator
+
+// Chain wraps validator with middleware. The first middleware is the outermost,
+// so Chain(v, a, b) runs a, then b, then v.
+func Chain(validator Validator, middleware ...Middleware) Validator {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		validator = middleware[i](validator)
+	}
+	return validator
+}
+
+// officialTags are the official Nostr tags ATTN-01 allows on protocol events.
+// L and l are NIP-32 labels, used to declare the spec version.
+var officialTags = []string{"d", "t", "a", "e", "p", "r", "k", "u", "L", "l"}
+
+// allowedTags is a kind's permitted tag names.
+type allowedTags struct {
+	names map[string]bool
+	list  string // names joined for messages, in registration order
+}
+
+func newAllowedTags(names []string) *allowedTags {
+	allowed := &allowedTags{names: make(map[string]bool, len(names)), list: strings.Join(names, ", ")}
+	for _, name := range names {
+		allowed.names[name] = true
+	}
+	return allowed
+}
+
+// reject returns the failing result for a tag named name outside the allowed set.
+func (allowed *allowedTags) reject(event *nostr.Event, name string) ValidationResult {
+	if allowed.list == officialTagList {
+		return ValidationResult{
+			Valid:   false,
+			Code:    CodeNonStandardTag,
+			Message: fmt.Sprintf("Non-standard tag '%s' not allowed. Only official Nostr tags are permitted: %s", name, allowed.list),
+		}
+	}
+	return ValidationResult{
+		Valid:   false,
+		Code:    CodeNonStandardTag,
+		Message: fmt.Sprintf("Tag '%s' not allowed for kind %d. Permitted tags: %s", name, event.Kind, allowed.list),
+	}
+}
+
+// officialTagList is officialTags as it appears in messages.
+var officialTagList = strings.Join(officialTags, ", ")
+
+// indexedValidator is a built-in validator that reads the event's tags from an
+// index. The registry builds the index in the same pass as its allowed-tag check
+// and hands it over, so each event's tags are scanned once.
+type indexedValidator func(event *nostr.Event, tags tagIndex) ValidationResult
+
+// Validate indexes the event's tags and validates it.
+func (f indexedValidator) Validate(event *nostr.Event) ValidationResult {
+	return f(event, indexTags(event, nil))
+}
+
+// Registry maps event kinds to validators. Each kind may also restrict the tag
+// names its events may carry, and middleware added with Use wraps every kind.
+//
+// A kind can have a validator per spec version. Events that declare their version
+// with a label are checked by that version's validator; other events are checked
+// by the current version's validator and, if it rejects them, by the validator for
+// the version their content shape matches. See DetectSpecVersion.
+//
+// A Registry is safe for concurrent use; registration is expected at startup,
+// validation at any time after.
+type Registry struct {
+	mu           sync.RWMutex
+	validators   map[int]map[core.SpecVersion]Validator
+	allowed_tags map[int]*allowedTags
+	middleware   []Middleware
+	chained      map[int]map[core.SpecVersion]Validator // validators wrapped in middleware, rebuilt on change
+}
+
+// NewRegistry creates an empty Registry. Use NewDefaultRegistry for one that
+// validates the ATTN Protocol kinds.
+func NewRegistry() *Registry {
+	return &Registry{
+		validators:   make(map[int]map[core.SpecVersion]Validator),
+		allowed_tags: make(map[int]*allowedTags),
+		chained:      make(map[int]map[core.SpecVersion]Validator),
+	}
+}
+
+// NewDefaultRegistry creates a Registry with a validator for every ATTN Protocol
+// kind, each limited to the official Nostr tags. It validates exactly as
+// ValidateATTNEvent does, and can be extended with further kinds and middleware.
+// Use NewMultiVersionRegistry to also accept events from older spec versions.
+func NewDefaultRegistry() *Registry {
+	registry := NewRegistry()
+	defaults := map[int]indexedValidator{
+		38188: validateMarketplace,
+		38288: validateBillboard,
+		38388: validatePromotion,
+		38488: validateAttention,
+		38588: validateBillboardConfirmation,
+		38688: validateAttentionConfirmation,
+		38788: validateMarketplaceConfirmation,
+		38888: validateMatch,
+		38988: validateAttentionPaymentConfirmation,
+	}
+	for kind, validator := range defaults {
+		registry.Register(kind, validator)
+		registry.SetAllowedTags(kind, officialTags...)
+	}
+	return registry
+}
+
+// Register sets the validator for kind at the current spec version, replacing
+// any existing one. Middleware added with Use applies to it as well.
+func (r *Registry) Register(kind int, validator Validator) {
+	r.RegisterVersion(kind, core.CurrentSpecVersion, validator)
+}
+
+// RegisterVersion sets the validator for events of kind written for version,
+// replacing any existing one. Middleware added with Use applies to it as well.
+func (r *Registry) RegisterVersion(kind int, version core.SpecVersion, validator Validator) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.validators[kind] == nil {
+		r.validators[kind] = make(map[core.SpecVersion]Validator)
+		r.chained[kind] = make(map[core.SpecVersion]Validator)
+	}
+	r.validators[kind][version] = validator
+	r.chained[kind][version] = Chain(validator, r.middleware...)
+}
+
+// validator returns the validator registered for kind and version, without middleware.
+func (r *Registry) validator(kind int, version core.SpecVersion) (Validator, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	validator, ok := r.validators[kind][version]
+	return validator, ok
+}
+
+// SetAllowedTags restricts events of kind to the given tag names. Calling it
+// with no names removes the restriction.
+func (r *Registry) SetAllowedTags(kind int, names ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(names) == 0 {
+		delete(r.allowed_tags, kind)
+		return
+	}
+	r.allowed_tags[kind] = newAllowedTags(names)
+}
+
+// Use appends middleware that wraps the validator of every kind, including
+// kinds registered later. Middleware runs in the order it was added.
+func (r *Registry) Use(middleware ...Middleware) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.middleware = append(r.middleware, middleware...)
+	for kind, versions := range r.validators {
+		for version, validator := range versions {
+			r.chained[kind][version] = Chain(validator, r.middleware...)
+		}
+	}
+}
+
+// Has reports whether a validator is registered for kind, at any spec version.
+func (r *Registry) Has(kind int) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.validators[kind]
+	return ok
+}
+
+// Kinds returns the registered kinds in ascending order.
+func (r *Registry) Kinds() []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kinds := make([]int, 0, len(r.validators))
+	for kind := range r.validators {
+		kinds = append(kinds, kind)
+	}
+	sort.Ints(kinds)
+	return kinds
+}
+
+// SupportedVersions returns the spec versions registered for kind, oldest first.
+// A relay can advertise them for clients to pass to core.NegotiateSpecVersion.
+func (r *Registry) SupportedVersions(kind int) []core.SpecVersion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := make([]core.SpecVersion, 0, len(r.validators[kind]))
+	for version := range r.validators[kind] {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions
+}
+
+// Validate checks the event's tags against its kind's allowed set, then runs
+// the validator for the event's spec version wrapped in the registry's middleware.
+// Events of kinds without a validator fail with CodeUnknownKind, and events
+// labelled with a version the kind has no validator for fail with
+// CodeUnsupportedVersion. The result's Version is the version the event was
+// validated as.
+func (r *Registry) Validate(event *nostr.Event) ValidationResult {
+	return r.ValidateContext(context.Background(), event)
+}
+
+// ValidateContext is Validate with a context, whose span, if any, parents the
+// validation span when telemetry is on.
+func (r *Registry) ValidateContext(ctx context.Context, event *nostr.Event) ValidationResult {
+	if instrumentation := telemetry.Default(); instrumentation != nil {
+		return r.validateInstrumented(ctx, instrumentation, event)
+	}
+	return r.validate(event)
+}
+
+// validate implements Validate.
+func (r *Registry) validate(event *nostr.Event) ValidationResult {
+	r.mu.RLock()
+	versions, ok := r.chained[event.Kind]
+	allowed := r.allowed_tags[event.Kind]
+	r.mu.RUnlock()
+
+	// One pass over the tags checks them against the allowed set and indexes
+	// them for the built-in validators
+	tags := indexTags(event, allowed)
+	if name, disallowed := tags.disallowedTag(); disallowed {
+		return allowed.reject(event, name)
+	}
+	if !ok {
+		return ValidationResult{
+			Valid:   false,
+			Code:    CodeUnknownKind,
+			Message: "Not an ATTN Protocol event kind",
+		}
+	}
+
+	// A version label decides which validator applies
+	if label, labelled := tags.versionLabel(); labelled {
+		version := core.ParseSpecVersion(label)
+		validator, ok := versions[version]
+		if !ok {
+			return ValidationResult{
+				Valid:   false,
+				Code:    CodeUnsupportedVersion,
+				Message: fmt.Sprintf("Unsupported spec version '%s' for kind %d", label, event.Kind),
+			}
+		}
+		return withVersion(run(validator, event, tags), version)
+	}
+
+	// Unlabelled events are tried as the current version first, so current
+	// events never pay for shape detection
+	current, has_current := versions[core.CurrentSpecVersion]
+	var result ValidationResult
+	if has_current {
+		result = withVersion(run(current, event, tags), core.CurrentSpecVersion)
+		if result.Valid || len(versions) == 1 {
+			return result
+		}
+	}
+	if version := contentSpecVersion(event); version != core.CurrentSpecVersion {
+		if validator, ok := versions[version]; ok {
+			return withVersion(run(validator, event, tags), version)
+		}
+	}
+	if !has_current {
+		return ValidationResult{
+			Valid:   false,
+			Code:    CodeUnsupportedVersion,
+			Message: fmt.Sprintf("No validator for spec version %s of kind %d", core.CurrentSpecVersion, event.Kind),
+		}
+	}
+	return result
+}
+
+// run runs validator on event, handing built-in validators without middleware
+// the event's indexed tags.
+func run(validator Validator, event *nostr.Event, tags tagIndex) ValidationResult {
+	if indexed, ok := validator.(indexedValidator); ok {
+		return indexed(event, tags)
+	}
+	return validator.Validate(event)
+}
+
+// withVersion sets the spec version a result was produced for.
+func withVersion(result ValidationResult, version core.SpecVersion) ValidationResult {
+	result.Version = version
+	return result
+}
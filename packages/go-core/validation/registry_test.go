@@ -0,0 +1,146 @@
+package validation
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// minimumBid is a relay policy middleware: promotions must bid at least sats.
+func minimumBid(sats float64) Middleware {
+	return func(next Validator) Validator {
+		return ValidatorFunc(func(event *nostr.Event) ValidationResult {
+			result := next.Validate(event)
+			if !result.Valid || event.Kind != 38388 {
+				return result
+			}
+			var content struct {
+				Bid float64 `json:"bid"`
+			}
+			json.Unmarshal([]byte(event.Content), &content)
+			if content.Bid < sats {
+				return ValidationResult{Valid: false, Code: "bid_too_low", Message: "bid below relay minimum"}
+			}
+			return result
+		})
+	}
+}
+
+func TestNewDefaultRegistry_MatchesValidateATTNEvent(t *testing.T) {
+	registry := NewDefaultRegistry()
+
+	if got, want := registry.Kinds(), []int{38188, 38288, 38388, 38488, 38588, 38688, 38788, 38888, 38988}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Kinds() = %v, want %v", got, want)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(conformanceDir, "*.json"))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var file conformanceFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatal(err)
+		}
+		for _, vector := range file.Vectors {
+			if got, want := registry.Validate(&vector.Event), ValidateATTNEvent(&vector.Event); got != want {
+				t.Errorf("%s: registry %+v, ValidateATTNEvent %+v", vector.Name, got, want)
+			}
+		}
+	}
+}
+
+func TestRegistry_Use(t *testing.T) {
+	pubkey := generateTestPubkey()
+	event := createTestPromotionEvent(pubkey, 870500, pubkey, pubkey, pubkey) // bids 5000
+
+	registry := NewDefaultRegistry()
+	registry.Use(minimumBid(10000))
+
+	if result := registry.Validate(event); result.Valid || result.Code != "bid_too_low" {
+		t.Errorf("expected bid_too_low, got %+v", result)
+	}
+	if result := ValidateATTNEvent(event); !result.Valid {
+		t.Errorf("the package default must be unaffected, got %+v", result)
+	}
+
+	// Middleware also wraps kinds registered after Use
+	registry.Register(38388, ValidatorFunc(ValidatePromotionEvent))
+	if result := registry.Validate(event); result.Code != "bid_too_low" {
+		t.Errorf("expected middleware on re-registered kind, got %+v", result)
+	}
+
+	// Structural failures are reported before policy
+	event.Tags = event.Tags[1:] // drop d tag
+	if result := registry.Validate(event); result.Code != CodeMissingDTag {
+		t.Errorf("expected %s, got %+v", CodeMissingDTag, result)
+	}
+}
+
+func TestChain_Order(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Validator) Validator {
+			return ValidatorFunc(func(event *nostr.Event) ValidationResult {
+				calls = append(calls, name)
+				return next.Validate(event)
+			})
+		}
+	}
+	validator := Chain(ValidatorFunc(func(*nostr.Event) ValidationResult {
+		calls = append(calls, "validator")
+		return ValidationResult{Valid: true}
+	}), record("a"), record("b"))
+
+	validator.Validate(&nostr.Event{})
+	if want := []string{"a", "b", "validator"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestRegistry_CustomKind(t *testing.T) {
+	const experimental_kind = 39088
+
+	registry := NewDefaultRegistry()
+	registry.Register(experimental_kind, ValidatorFunc(func(event *nostr.Event) ValidationResult {
+		if event.Tags.GetD() == "" {
+			return ValidationResult{Valid: false, Code: CodeMissingDTag, Message: "missing d tag"}
+		}
+		return ValidationResult{Valid: true, Message: "valid experimental event"}
+	}))
+	registry.SetAllowedTags(experimental_kind, "d", "expiration")
+
+	if !registry.Has(experimental_kind) || ValidateATTNEvent(&nostr.Event{Kind: experimental_kind}).Code != CodeUnknownKind {
+		t.Fatal("custom kind must be registered only on its registry")
+	}
+
+	event := &nostr.Event{Kind: experimental_kind, Tags: nostr.Tags{{"d", "x"}, {"expiration", "1700000000"}}}
+	if result := registry.Validate(event); !result.Valid {
+		t.Errorf("expected valid, got %+v", result)
+	}
+
+	event.Tags = append(event.Tags, nostr.Tag{"t", "870500"})
+	result := registry.Validate(event)
+	if result.Valid || result.Code != CodeNonStandardTag || !strings.Contains(result.Message, "Permitted tags: d, expiration") {
+		t.Errorf("expected tag 't' to be rejected, got %+v", result)
+	}
+
+	// Removing the restriction allows any tag
+	registry.SetAllowedTags(experimental_kind)
+	if result := registry.Validate(event); !result.Valid {
+		t.Errorf("expected valid without tag restriction, got %+v", result)
+	}
+}
+
+func TestRegistry_UnknownKind(t *testing.T) {
+	result := NewRegistry().Validate(&nostr.Event{Kind: 38388})
+	if result.Valid || result.Code != CodeUnknownKind {
+		t.Errorf("expected %s from an empty registry, got %+v", CodeUnknownKind, result)
+	}
+}
@@ -0,0 +1,385 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+)
+
+// kindLayout describes what a kind's validator requires of an event, for JSON Schema export.
+// TestJSONSchema_MatchesValidators keeps each layout in step with its validator.
+type kindLayout struct {
+	title string
+
+	// Kinds of the required 'a' coordinates
+	coordinates []int
+
+	// Required NIP-51 list coordinates (30000:<pubkey>:<suffix>), by suffix
+	lists []string
+
+	// Optional NIP-51 lists that, when referenced, require a content field, by suffix
+	list_fields map[string]string
+
+	// Required e tag markers and minimum e and p tag counts
+	e_markers []string
+	e_count   int
+	p_count   int
+
+	// Required r, k and u tags; k_value and u require a non-empty value
+	r, k, k_value, u bool
+
+	// Required content fields, and the rules the validator applies to them
+	fields       []string
+	positive     []string
+	non_negative []string
+	arrays       []string
+	ordered      [][2]string // pairs where the first must be <= the second
+
+	// Optional payment proof fields, free-form unless they claim a structured format
+	proofs []string
+}
+
+// kindLayouts holds the layout of every ATTN Protocol kind.
+var kindLayouts = map[int]kindLayout{
+	38188: {
+		title:        "MARKETPLACE",
+		coordinates:  []int{38808},
+		p_count:      2,
+		r:            true,
+		k:            true,
+		fields:       marketplaceContentFields,
+		positive:     []string{"min_duration", "max_duration"},
+		non_negative: []string{"match_fee_sats", "confirmation_fee_sats"},
+		ordered:      [][2]string{{"min_duration", "max_duration"}},
+	},
+	38288: {
+		title:        "BILLBOARD",
+		coordinates:  []int{38188},
+		p_count:      2,
+		r:            true,
+		k:            true,
+		k_value:      true,
+		u:            true,
+		fields:       billboardContentFields,
+		non_negative: []string{"confirmation_fee_sats"},
+	},
+	38388: {
+		title:       "PROMOTION",
+		coordinates: []int{38188, 34236, 38288},
+		p_count:     3,
+		r:           true,
+		k:           true,
+		k_value:     true,
+		u:           true,
+		fields:      promotionContentFields,
+		positive:    []string{"bid", "duration"},
+		arrays:      []string{"escrow_id_list"},
+	},
+	38488: {
+		title:       "ATTENTION",
+		coordinates: []int{38188},
+		lists:       []string{"org.attnprotocol:promotion:blocked", "org.attnprotocol:promoter:blocked"},
+		list_fields: map[string]string{
+			"org.attnprotocol:marketplace:trusted": "trusted_marketplaces_id",
+			"org.attnprotocol:billboard:trusted":   "trusted_billboards_id",
+		},
+		p_count:  2,
+		r:        true,
+		k:        true,
+		fields:   attentionContentFields,
+		positive: []string{"ask", "min_duration", "max_duration"},
+		ordered:  [][2]string{{"min_duration", "max_duration"}},
+	},
+	38588: {
+		title:       "BILLBOARD_CONFIRMATION",
+		coordinates: []int{38188, 38288, 38388, 38488, 38888},
+		e_markers:   []string{"match"},
+		e_count:     5,
+		p_count:     4,
+		r:           true,
+		fields:      confirmationContentFields,
+	},
+	38688: {
+		title:       "ATTENTION_CONFIRMATION",
+		coordinates: []int{38188, 38288, 38388, 38488, 38888},
+		e_markers:   []string{"match"},
+		e_count:     5,
+		p_count:     4,
+		r:           true,
+		fields:      confirmationContentFields,
+	},
+	38788: {
+		title:       "MARKETPLACE_CONFIRMATION",
+		coordinates: []int{38188, 38288, 38388, 38488, 38888},
+		e_markers:   []string{"match", "billboard_confirmation", "attention_confirmation"},
+		e_count:     7,
+		p_count:     4,
+		r:           true,
+		fields:      marketplaceConfirmationContentFields,
+	},
+	38888: {
+		title:       "MATCH",
+		coordinates: []int{38188, 38288, 38388, 38488},
+		p_count:     4,
+		r:           true,
+		k:           true,
+		fields:      matchContentFields,
+	},
+	38988: {
+		title:       "ATTENTION_PAYMENT_CONFIRMATION",
+		coordinates: []int{38188, 38288, 38388, 38488, 38888},
+		e_markers:   []string{"marketplace_confirmation"},
+		p_count:     4,
+		r:           true,
+		fields:      paymentConfirmationContentFields,
+		positive:    []string{"sats_received"},
+		proofs:      []string{"payment_proof"},
+	},
+}
+
+// jsonSchemaDialect is the JSON Schema version the exported schemas use.
+const jsonSchemaDialect = "https://json-schema.org/draft/2020-12/schema"
+
+// anyValue matches any tag value, including ones containing line breaks.
+const anyValue = `[\s\S]`
+
+// structuredProofPattern matches payment proofs that claim a structured format,
+// and paymentProofPattern the well-formed ones, as payment.ParseProof accepts.
+const (
+	structuredProofPattern = "^(bolt11|zap):"
+	paymentProofPattern    = "^(bolt11:ln[a-z0-9]+:[0-9a-f]{64}|zap:[0-9a-f]{64})$"
+)
+
+// JSONSchema returns a JSON Schema (draft 2020-12) document for events of an
+// ATTN Protocol kind, for partners validating events in other languages.
+//
+// The document describes the event's kind and tag layout. Because an event's
+// content is a JSON string, its rules live in #/$defs/content: parse the content
+// and validate it against that definition, as contentSchema is only an annotation
+// in JSON Schema. Rules JSON Schema cannot express, such as min_duration <=
+// max_duration, are listed under the x-attn-rules keyword of the schema they
+// apply to.
+//
+// Where an event repeats a tag, the validators read the first one; the schema
+// checks them all.
+func JSONSchema(kind int) ([]byte, error) {
+	layout, ok := kindLayouts[kind]
+	if !ok {
+		return nil, fmt.Errorf("kind %d is not an ATTN Protocol kind", kind)
+	}
+	event_type, _ := eventTypeForKind(kind)
+
+	schema := map[string]interface{}{
+		"$schema":     jsonSchemaDialect,
+		"title":       fmt.Sprintf("ATTN-01 %s event (kind %d)", layout.title, kind),
+		"description": fmt.Sprintf("Spec version %s. Validate the parsed content against #/$defs/content.", core.CurrentSpecVersion),
+		"type":        "object",
+		"required":    []string{"kind", "tags", "content"},
+		"properties": map[string]interface{}{
+			"kind": map[string]interface{}{"const": kind},
+			"tags": map[string]interface{}{"$ref": "#/$defs/tags"},
+			"content": map[string]interface{}{
+				"type":             "string",
+				"contentMediaType": "application/json",
+				"contentSchema":    map[string]interface{}{"$ref": "#/$defs/content"},
+			},
+		},
+		"$defs": map[string]interface{}{
+			"tags":    layout.tagsSchema(event_type),
+			"content": layout.contentSchema(),
+		},
+	}
+
+	var rules []interface{}
+	for _, suffix := range sortedKeys(layout.list_fields) {
+		field := layout.list_fields[suffix]
+		rules = append(rules, map[string]interface{}{
+			"description":   fmt.Sprintf("content must include %s when an 'a' tag references the %s list", field, suffix),
+			"if_tag":        []interface{}{"a", "^30000:" + anyValue + "*" + regexp.QuoteMeta(suffix) + "$"},
+			"require_field": field,
+		})
+	}
+	if len(rules) > 0 {
+		schema["x-attn-rules"] = rules
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// tagsSchema returns the schema for the event's tags array.
+func (layout kindLayout) tagsSchema(event_type string) map[string]interface{} {
+	rules := []interface{}{
+		contains("d", nil, 1),
+		every("d", "", "^org\\.attnprotocol:"+regexp.QuoteMeta(event_type)+":"+anyValue+"+$"),
+		contains("t", nil, 1),
+		every("t", "", "^(0|[1-9][0-9]{0,17})$"),
+	}
+
+	for _, coordinate_kind := range layout.coordinates {
+		prefix := fmt.Sprintf("^%d:", coordinate_kind)
+		rules = append(rules, contains("a", map[string]interface{}{"pattern": prefix}, 1))
+		if coordinate_kind == 34236 {
+			// Video coordinates reference a non-protocol event and are not namespaced
+			rules = append(rules, map[string]interface{}{
+				"items": map[string]interface{}{
+					"if":   tag("a", map[string]interface{}{"pattern": prefix}),
+					"then": tag("a", map[string]interface{}{"not": map[string]interface{}{"pattern": "org\\.attnprotocol:"}}),
+				},
+			})
+			continue
+		}
+		rules = append(rules, every("a", prefix, coordinatePattern(coordinate_kind)))
+	}
+
+	for _, suffix := range layout.lists {
+		rules = append(rules, contains("a", map[string]interface{}{"pattern": "^30000:" + anyValue + "*" + regexp.QuoteMeta(suffix) + "$"}, 1))
+	}
+	for _, marker := range layout.e_markers {
+		rules = append(rules, map[string]interface{}{
+			"contains": map[string]interface{}{
+				"type":        "array",
+				"prefixItems": []interface{}{map[string]interface{}{"const": "e"}, true, true, map[string]interface{}{"const": marker}},
+				"minItems":    4,
+			},
+		})
+	}
+	if layout.e_count > 0 {
+		rules = append(rules, contains("e", nil, layout.e_count))
+	}
+	if layout.p_count > 0 {
+		rules = append(rules, contains("p", nil, layout.p_count))
+	}
+	if layout.r {
+		rules = append(rules, contains("r", nil, 1))
+	}
+	if layout.k_value {
+		rules = append(rules, contains("k", map[string]interface{}{"minLength": 1}, 1))
+	} else if layout.k {
+		rules = append(rules, contains("k", nil, 1))
+	}
+	if layout.u {
+		rules = append(rules, contains("u", map[string]interface{}{"minLength": 1}, 1))
+	}
+
+	// A spec version label must name the version these rules describe
+	rules = append(rules, map[string]interface{}{
+		"items": map[string]interface{}{
+			"if": map[string]interface{}{
+				"type":        "array",
+				"prefixItems": []interface{}{map[string]interface{}{"const": "l"}, true, map[string]interface{}{"const": core.SpecVersionLabelNamespace}},
+				"minItems":    3,
+			},
+			"then": map[string]interface{}{
+				"prefixItems": []interface{}{true, map[string]interface{}{"const": core.CurrentSpecVersion.String()}},
+			},
+		},
+	})
+
+	return map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string"},
+			"prefixItems": []interface{}{map[string]interface{}{"enum": officialTags}},
+		},
+		"allOf": rules,
+	}
+}
+
+// contentSchema returns the schema for the event's parsed content.
+func (layout kindLayout) contentSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	for _, field := range layout.positive {
+		properties[field] = map[string]interface{}{"type": "number", "exclusiveMinimum": 0}
+	}
+	for _, field := range layout.non_negative {
+		properties[field] = map[string]interface{}{"type": "number", "minimum": 0}
+	}
+	for _, field := range layout.arrays {
+		properties[field] = map[string]interface{}{"type": "array"}
+	}
+	for _, field := range layout.proofs {
+		properties[field] = map[string]interface{}{
+			"type": []string{"string", "null"},
+			"if":   map[string]interface{}{"pattern": structuredProofPattern},
+			"then": map[string]interface{}{"pattern": paymentProofPattern},
+		}
+	}
+
+	schema := map[string]interface{}{
+		"type":     "object",
+		"required": layout.fields,
+	}
+	if len(properties) > 0 {
+		schema["properties"] = properties
+	}
+
+	var rules []interface{}
+	for _, pair := range layout.ordered {
+		rules = append(rules, map[string]interface{}{
+			"description": fmt.Sprintf("%s must be <= %s", pair[0], pair[1]),
+			"lte":         []string{pair[0], pair[1]},
+		})
+	}
+	if len(rules) > 0 {
+		schema["x-attn-rules"] = rules
+	}
+	return schema
+}
+
+// coordinatePattern returns the pattern a valid 'a' coordinate of kind matches.
+func coordinatePattern(kind int) string {
+	if kind == 38808 {
+		return "^38808:[^:]+:org\\.cityprotocol:block:" + anyValue + "*$"
+	}
+	event_type, _ := eventTypeForKind(kind)
+	return fmt.Sprintf("^%d:[^:]+:org\\.attnprotocol:%s:%s+$", kind, regexp.QuoteMeta(event_type), anyValue)
+}
+
+// tag returns a schema matching [name, <value>, ...] tags.
+func tag(name string, value map[string]interface{}) map[string]interface{} {
+	if value == nil {
+		value = map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"type":        "array",
+		"prefixItems": []interface{}{map[string]interface{}{"const": name}, value},
+		"minItems":    2,
+	}
+}
+
+// contains returns a schema requiring at least min name tags whose value matches value.
+func contains(name string, value map[string]interface{}, min int) map[string]interface{} {
+	schema := map[string]interface{}{"contains": tag(name, value)}
+	if min > 1 {
+		schema["minContains"] = min
+	}
+	return schema
+}
+
+// every returns a schema requiring every name tag whose value matches prefix to match pattern.
+func every(name, prefix, pattern string) map[string]interface{} {
+	var match map[string]interface{}
+	if prefix != "" {
+		match = map[string]interface{}{"pattern": prefix}
+	}
+	return map[string]interface{}{
+		"items": map[string]interface{}{
+			"if":   tag(name, match),
+			"then": tag(name, map[string]interface{}{"pattern": pattern}),
+		},
+	}
+}
+
+// sortedKeys returns the keys of m in ascending order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,375 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// update rewrites the exported schemas: go test ./validation -run TestJSONSchema_Files -update
+var update = flag.Bool("update", false, "rewrite the JSON Schema files in /conformance/schema")
+
+// schemaDir holds the exported JSON Schema documents, one per kind.
+const schemaDir = "../../../conformance/schema"
+
+func TestJSONSchema_Files(t *testing.T) {
+	for kind := range ATTNProtocolKinds {
+		event_type, _ := eventTypeForKind(kind)
+		path := filepath.Join(schemaDir, event_type+".schema.json")
+
+		schema, err := JSONSchema(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, '\n')
+
+		if *update {
+			if err := os.WriteFile(path, schema, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		existing, err := os.ReadFile(path)
+		if err != nil || !bytes.Equal(existing, schema) {
+			t.Errorf("%s is out of date; run go test ./validation -run TestJSONSchema_Files -update", path)
+		}
+	}
+}
+
+func TestJSONSchema_UnknownKind(t *testing.T) {
+	if _, err := JSONSchema(38808); err == nil {
+		t.Error("expected an error for a City Protocol kind")
+	}
+}
+
+// TestJSONSchema_MatchesValidators checks that every conformance vector, and
+// mutations of every valid vector, get the same verdict from the exported schema
+// as from ValidateATTNEvent.
+func TestJSONSchema_MatchesValidators(t *testing.T) {
+	schemas := make(map[int]map[string]interface{})
+	for kind := range ATTNProtocolKinds {
+		data, err := JSONSchema(kind)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schema map[string]interface{}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			t.Fatal(err)
+		}
+		schemas[kind] = schema
+	}
+
+	check := func(name string, event *nostr.Event) {
+		t.Helper()
+		want := ValidateATTNEvent(event)
+		schema, ok := schemas[event.Kind]
+		if got := ok && schemaAccepts(schema, event); got != want.Valid {
+			t.Errorf("%s: schema valid=%v, validator valid=%v (%s)", name, got, want.Valid, want.Message)
+		}
+	}
+
+	for _, vector := range loadConformanceVectors(t) {
+		check(vector.Name, &vector.Event)
+		if !vector.Expected.Valid {
+			continue
+		}
+		for name, event := range mutations(&vector.Event) {
+			check(vector.Name+"/"+name, event)
+		}
+	}
+}
+
+// loadConformanceVectors reads every vector in the conformance directory.
+func loadConformanceVectors(t *testing.T) []conformanceVector {
+	t.Helper()
+	paths, _ := filepath.Glob(filepath.Join(conformanceDir, "*.json"))
+	var vectors []conformanceVector
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var file conformanceFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			t.Fatal(err)
+		}
+		vectors = append(vectors, file.Vectors...)
+	}
+	return vectors
+}
+
+// mutations returns variants of a valid event: each tag removed, each content
+// field removed, each numeric field replaced by values on either side of
+// the validators' bounds, and each string field replaced by other types and
+// by well-formed and malformed payment proofs.
+func mutations(event *nostr.Event) map[string]*nostr.Event {
+	variants := make(map[string]*nostr.Event)
+	for i := range event.Tags {
+		variant := *event
+		variant.Tags = append(append(nostr.Tags{}, event.Tags[:i]...), event.Tags[i+1:]...)
+		variants["without-tag-"+strings.Join(event.Tags[i], ",")] = &variant
+	}
+
+	var content map[string]interface{}
+	json.Unmarshal([]byte(event.Content), &content)
+	with := func(name, key string, value interface{}, remove bool) {
+		changed := make(map[string]interface{}, len(content))
+		for k, v := range content {
+			changed[k] = v
+		}
+		if remove {
+			delete(changed, key)
+		} else {
+			changed[key] = value
+		}
+		data, _ := json.Marshal(changed)
+		variant := *event
+		variant.Content = string(data)
+		variants[name] = &variant
+	}
+	for key, value := range content {
+		with("without-"+key, key, nil, true)
+		if _, ok := value.(float64); ok {
+			for _, replacement := range []interface{}{0, -1, 0.5, 1e12, "1", nil} {
+				data, _ := json.Marshal(replacement)
+				with(key+"="+string(data), key, replacement, false)
+			}
+		}
+		if _, ok := value.([]interface{}); ok {
+			with(key+"=string", key, "x", false)
+		}
+		if _, ok := value.(string); ok {
+			for _, replacement := range []interface{}{"zap:" + strings.Repeat("ab", 32), "zap:ab", "bolt11:lnbc1x:" + strings.Repeat("0", 64), "bolt11:x", 1, nil} {
+				data, _ := json.Marshal(replacement)
+				with(key+"="+string(data), key, replacement, false)
+			}
+		}
+	}
+	return variants
+}
+
+// schemaAccepts validates an event against an exported schema, applying the
+// content definition to the parsed content and the x-attn-rules of both.
+func schemaAccepts(schema map[string]interface{}, event *nostr.Event) bool {
+	var document interface{}
+	data, _ := json.Marshal(event)
+	json.Unmarshal(data, &document)
+	if !evaluate(schema, schema, document) {
+		return false
+	}
+
+	var content interface{}
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil {
+		return false
+	}
+	content_schema := schema["$defs"].(map[string]interface{})["content"]
+	if !evaluate(schema, content_schema, content) {
+		return false
+	}
+	object := content.(map[string]interface{})
+
+	for _, rule := range rulesOf(content_schema) {
+		if pair, ok := rule["lte"].([]interface{}); ok {
+			a, _ := object[pair[0].(string)].(float64)
+			b, _ := object[pair[1].(string)].(float64)
+			if a > b {
+				return false
+			}
+		}
+	}
+	for _, rule := range rulesOf(schema) {
+		if if_tag, ok := rule["if_tag"].([]interface{}); ok {
+			pattern := regexp.MustCompile(if_tag[1].(string))
+			for _, tag := range event.Tags {
+				if len(tag) >= 2 && tag[0] == if_tag[0] && pattern.MatchString(tag[1]) {
+					if _, present := object[rule["require_field"].(string)]; !present {
+						return false
+					}
+				}
+			}
+		}
+	}
+	return true
+}
+
+// rulesOf returns a schema's x-attn-rules.
+func rulesOf(schema interface{}) []map[string]interface{} {
+	var rules []map[string]interface{}
+	list, _ := schema.(map[string]interface{})["x-attn-rules"].([]interface{})
+	for _, rule := range list {
+		rules = append(rules, rule.(map[string]interface{}))
+	}
+	return rules
+}
+
+// evaluate implements the subset of JSON Schema 2020-12 the exported schemas use.
+func evaluate(root, schema, value interface{}) bool {
+	switch s := schema.(type) {
+	case bool:
+		return s
+	case map[string]interface{}:
+		for keyword, argument := range s {
+			if !evaluateKeyword(root, s, keyword, argument, value) {
+				return false
+			}
+		}
+		return true
+	}
+	panic("invalid schema")
+}
+
+func evaluateKeyword(root interface{}, schema map[string]interface{}, keyword string, argument, value interface{}) bool {
+	switch keyword {
+	case "$ref":
+		name := strings.TrimPrefix(argument.(string), "#/$defs/")
+		return evaluate(root, root.(map[string]interface{})["$defs"].(map[string]interface{})[name], value)
+	case "type":
+		if types, ok := argument.([]interface{}); ok {
+			for _, option := range types {
+				if evaluateKeyword(root, schema, keyword, option, value) {
+					return true
+				}
+			}
+			return false
+		}
+		switch argument {
+		case "object":
+			_, ok := value.(map[string]interface{})
+			return ok
+		case "array":
+			_, ok := value.([]interface{})
+			return ok
+		case "string":
+			_, ok := value.(string)
+			return ok
+		case "number":
+			_, ok := value.(float64)
+			return ok
+		case "null":
+			return value == nil
+		}
+		panic("unsupported type " + argument.(string))
+	case "const":
+		return jsonEqual(argument, value)
+	case "enum":
+		for _, option := range argument.([]interface{}) {
+			if jsonEqual(option, value) {
+				return true
+			}
+		}
+		return false
+	case "required":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return true
+		}
+		for _, name := range argument.([]interface{}) {
+			if _, present := object[name.(string)]; !present {
+				return false
+			}
+		}
+		return true
+	case "properties":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return true
+		}
+		for name, property := range argument.(map[string]interface{}) {
+			if field, present := object[name]; present && !evaluate(root, property, field) {
+				return false
+			}
+		}
+		return true
+	case "prefixItems":
+		array, ok := value.([]interface{})
+		if !ok {
+			return true
+		}
+		for i, item := range argument.([]interface{}) {
+			if i < len(array) && !evaluate(root, item, array[i]) {
+				return false
+			}
+		}
+		return true
+	case "items":
+		array, ok := value.([]interface{})
+		if !ok {
+			return true
+		}
+		start := 0
+		if prefix, ok := schema["prefixItems"].([]interface{}); ok {
+			start = len(prefix)
+		}
+		for i := start; i < len(array); i++ {
+			if !evaluate(root, argument, array[i]) {
+				return false
+			}
+		}
+		return true
+	case "contains":
+		array, ok := value.([]interface{})
+		if !ok {
+			return true
+		}
+		minimum := 1.0
+		if m, ok := schema["minContains"].(float64); ok {
+			minimum = m
+		}
+		count := 0
+		for _, item := range array {
+			if evaluate(root, argument, item) {
+				count++
+			}
+		}
+		return float64(count) >= minimum
+	case "minItems":
+		array, ok := value.([]interface{})
+		return !ok || float64(len(array)) >= argument.(float64)
+	case "minLength":
+		text, ok := value.(string)
+		return !ok || float64(len([]rune(text))) >= argument.(float64)
+	case "pattern":
+		text, ok := value.(string)
+		return !ok || regexp.MustCompile(argument.(string)).MatchString(text)
+	case "minimum":
+		number, ok := value.(float64)
+		return !ok || number >= argument.(float64)
+	case "exclusiveMinimum":
+		number, ok := value.(float64)
+		return !ok || number > argument.(float64)
+	case "not":
+		return !evaluate(root, argument, value)
+	case "if":
+		if evaluate(root, argument, value) {
+			if then, ok := schema["then"]; ok {
+				return evaluate(root, then, value)
+			}
+		}
+		return true
+	case "allOf":
+		for _, sub := range argument.([]interface{}) {
+			if !evaluate(root, sub, value) {
+				return false
+			}
+		}
+		return true
+	case "$schema", "$defs", "title", "description", "minContains", "then",
+		"contentMediaType", "contentSchema", "x-attn-rules":
+		return true
+	}
+	panic("unsupported keyword " + keyword)
+}
+
+// jsonEqual compares two decoded JSON values.
+func jsonEqual(a, b interface{}) bool {
+	x, _ := json.Marshal(a)
+	y, _ := json.Marshal(b)
+	return bytes.Equal(x, y)
+}
@@ -0,0 +1,212 @@
+package validation
+
+import (
+	"strings"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// tagIndex holds everything the validators read from an event's tags,
+// collected in a single pass by indexTags. It lives on the caller's stack:
+// values are sub-strings of the event's tags, so building it does not allocate.
+type tagIndex struct {
+	// First value of the d, t, k and u tags; seen marks which were present
+	d, t, k, u string
+	seen       uint8
+
+	// Number of p, r, k and e tags that carry a value
+	p_count, r_count, k_count, e_count int
+
+	// First 'a' coordinate for each kind validators reference, by coordinateSlot
+	coordinates [coordinateSlotCount]string
+
+	// NIP-51 list coordinates and e tag markers present, as bit sets
+	lists     uint8
+	e_markers uint8
+
+	// Value of the first spec version label; seen marks it as present
+	version string
+
+	// Name of the first tag outside the allowed set; seen marks it as present
+	disallowed string
+}
+
+// Bits for tagIndex.seen.
+const (
+	seenD uint8 = 1 << iota
+	seenT
+	seenK
+	seenU
+	seenVersion
+	seenDisallowed
+)
+
+// Coordinate slots for tagIndex.coordinates, one per referenced kind.
+const (
+	slotMarketplace = iota // 38188
+	slotBillboard          // 38288
+	slotPromotion          // 38388
+	slotAttention          // 38488
+	slotMatch              // 38888
+	slotBlock              // 38808 (City Protocol)
+	slotVideo              // 34236
+	coordinateSlotCount
+)
+
+// Bits for tagIndex.lists: NIP-51 list coordinates (30000:<pubkey>:<suffix>).
+const (
+	listPromotionBlocked uint8 = 1 << iota
+	listPromoterBlocked
+	listMarketplaceTrusted
+	listBillboardTrusted
+)
+
+// Bits for tagIndex.e_markers: markers in the fourth position of e tags.
+const (
+	markerMatch uint8 = 1 << iota
+	markerBillboardConfirmation
+	markerAttentionConfirmation
+	markerMarketplaceConfirmation
+)
+
+// indexTags scans the event's tags once and returns the index the validators use.
+// When allowed is set, the same pass records the first tag outside it.
+func indexTags(event *nostr.Event, allowed *allowedTags) tagIndex {
+	var index tagIndex
+	for _, tag := range event.Tags {
+		if len(tag) == 0 {
+			continue
+		}
+		if allowed != nil && !allowed.names[tag[0]] {
+			index.setFirst(&index.disallowed, seenDisallowed, tag[0])
+			continue
+		}
+		if len(tag) < 2 {
+			continue
+		}
+		value := tag[1]
+
+		switch tag[0] {
+		case "d":
+			index.setFirst(&index.d, seenD, value)
+		case "t":
+			index.setFirst(&index.t, seenT, value)
+		case "k":
+			index.setFirst(&index.k, seenK, value)
+			index.k_count++
+		case "u":
+			index.setFirst(&index.u, seenU, value)
+		case "p":
+			index.p_count++
+		case "r":
+			index.r_count++
+		case "e":
+			index.e_count++
+			if len(tag) >= 4 {
+				index.e_markers |= eMarkerBit(tag[3])
+			}
+		case "a":
+			index.addCoordinate(value)
+		case "l":
+			if len(tag) >= 3 && tag[2] == core.SpecVersionLabelNamespace {
+				index.setFirst(&index.version, seenVersion, value)
+			}
+		}
+	}
+	return index
+}
+
+// setFirst records the value of the first tag with a given name.
+func (index *tagIndex) setFirst(field *string, bit uint8, value string) {
+	if index.seen&bit == 0 {
+		*field = value
+		index.seen |= bit
+	}
+}
+
+// addCoordinate records an 'a' tag value: the first coordinate for each
+// referenced kind, and any NIP-51 list coordinate.
+func (index *tagIndex) addCoordinate(value string) {
+	if len(value) < 6 || value[5] != ':' {
+		return
+	}
+	slot := -1
+	switch value[:5] {
+	case "38188":
+		slot = slotMarketplace
+	case "38288":
+		slot = slotBillboard
+	case "38388":
+		slot = slotPromotion
+	case "38488":
+		slot = slotAttention
+	case "38888":
+		slot = slotMatch
+	case "38808":
+		slot = slotBlock
+	case "34236":
+		slot = slotVideo
+	case "30000":
+		index.lists |= listBit(value)
+	}
+	if slot >= 0 && index.coordinates[slot] == "" {
+		index.coordinates[slot] = value
+	}
+}
+
+// coordinate returns the first 'a' tag value in the given slot, or "" if there is none.
+func (index *tagIndex) coordinate(slot int) string {
+	return index.coordinates[slot]
+}
+
+// versionLabel returns the value of the event's spec version label, if any.
+func (index *tagIndex) versionLabel() (string, bool) {
+	return index.version, index.seen&seenVersion != 0
+}
+
+// disallowedTag returns the name of the first tag outside the allowed set
+// indexTags was given, if any.
+func (index *tagIndex) disallowedTag() (string, bool) {
+	return index.disallowed, index.seen&seenDisallowed != 0
+}
+
+// hasList reports whether an 'a' tag references the given NIP-51 list.
+func (index *tagIndex) hasList(list uint8) bool {
+	return index.lists&list != 0
+}
+
+// hasEMarker reports whether an e tag carries the given marker.
+func (index *tagIndex) hasEMarker(marker uint8) bool {
+	return index.e_markers&marker != 0
+}
+
+// listBit returns the tagIndex.lists bit for a 30000: list coordinate.
+func listBit(coordinate string) uint8 {
+	switch {
+	case strings.HasSuffix(coordinate, "org.attnprotocol:promotion:blocked"):
+		return listPromotionBlocked
+	case strings.HasSuffix(coordinate, "org.attnprotocol:promoter:blocked"):
+		return listPromoterBlocked
+	case strings.HasSuffix(coordinate, "org.attnprotocol:marketplace:trusted"):
+		return listMarketplaceTrusted
+	case strings.HasSuffix(coordinate, "org.attnprotocol:billboard:trusted"):
+		return listBillboardTrusted
+	}
+	return 0
+}
+
+// eMarkerBit returns the tagIndex.e_markers bit for an e tag marker.
+func eMarkerBit(marker string) uint8 {
+	switch marker {
+	case "match":
+		return markerMatch
+	case "billboard_confirmation":
+		return markerBillboardConfirmation
+	case "attention_confirmation":
+		return markerAttentionConfirmation
+	case "marketplace_confirmation":
+		return markerMarketplaceConfirmation
+	}
+	return 0
+}
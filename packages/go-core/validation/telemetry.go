@@ -0,0 +1,45 @@
+package validation
+
+import (
+	"context"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// validateInstrumented validates an event inside a span, and counts the result
+// by kind and code.
+func (r *Registry) validateInstrumented(ctx context.Context, instrumentation telemetry.Instrumentation, event *nostr.Event) ValidationResult {
+	_, span := instrumentation.StartSpan(ctx, telemetry.SpanValidate,
+		telemetry.String(telemetry.KeyEventID, event.ID),
+		telemetry.Int(telemetry.KeyEventKind, event.Kind))
+	defer span.End()
+
+	start := time.Now()
+	result := r.validate(event)
+	elapsed := time.Since(start).Seconds()
+
+	code := result.Code
+	if result.Valid {
+		code = "valid"
+	} else if code == "" {
+		code = "unknown"
+	}
+	kind := telemetry.Int(telemetry.KeyKind, event.Kind)
+	instrumentation.Add(telemetry.MetricValidations, 1, kind, telemetry.String(telemetry.KeyCode, code))
+	instrumentation.Observe(telemetry.MetricValidationDuration, elapsed, kind)
+
+	span.SetAttributes(telemetry.String(telemetry.KeyCode, code))
+	if !result.Valid {
+		span.RecordError(validationError(result))
+	}
+	return result
+}
+
+// validationError is a failed ValidationResult as an error, for spans.
+type validationError ValidationResult
+
+func (e validationError) Error() string {
+	return e.Code + ": " + e.Message
+}
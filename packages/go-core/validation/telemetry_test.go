@@ -0,0 +1,57 @@
+package validation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry"
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry/telemetrytest"
+)
+
+func TestValidateATTNEvent_Telemetry(t *testing.T) {
+	recorder := telemetrytest.Install(t)
+
+	valid := validVectors(t)["promotion"]
+	invalid := createTestPromotionEvent(generateTestPubkey(), 870500, generateTestPubkey(), generateTestPubkey(), generateTestPubkey())
+	invalid.Content = `{"duration":30000}`
+
+	ctx, parent := recorder.StartSpan(context.Background(), "handle")
+	ValidateATTNEventContext(ctx, valid)
+	ValidateATTNEventContext(ctx, valid)
+	result := ValidateATTNEvent(invalid)
+	parent.End()
+
+	kind := telemetry.Int(telemetry.KeyKind, 38388)
+	if got := recorder.Counter(telemetry.MetricValidations, kind, telemetry.String(telemetry.KeyCode, "valid")); got != 2 {
+		t.Errorf("expected 2 valid promotions counted, got %v", got)
+	}
+	if got := recorder.Counter(telemetry.MetricValidations, kind, telemetry.String(telemetry.KeyCode, result.Code)); got != 1 {
+		t.Errorf("expected 1 %s failure counted, got %v", result.Code, got)
+	}
+	if count, _ := recorder.Histogram(telemetry.MetricValidationDuration, kind); count != 3 {
+		t.Errorf("expected 3 timed validations, got %d", count)
+	}
+
+	spans := recorder.Spans(telemetry.SpanValidate)
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 validation spans, got %d", len(spans))
+	}
+	if spans[0].Parent == nil || spans[0].Parent.Name != "handle" || !spans[0].Ended {
+		t.Errorf("expected an ended span under the caller's span, got %+v", spans[0])
+	}
+	if code, _ := spans[2].Attribute(telemetry.KeyCode); code != result.Code || spans[2].Err == nil {
+		t.Errorf("expected the failure recorded on the span, got %+v", spans[2])
+	}
+}
+
+// Instrumentation that is off must not cost the valid path its zero allocations.
+func TestValidateATTNEventContext_ZeroAllocationsWhenOff(t *testing.T) {
+	event := validVectors(t)["match"]
+	ctx := context.Background()
+	allocs := testing.AllocsPerRun(100, func() {
+		ValidateATTNEventContext(ctx, event)
+	})
+	if allocs != 0 {
+		t.Errorf("%v allocations per event, want 0", allocs)
+	}
+}
@@ -129,7 +129,11 @@ func createTestMarketplaceEvent(pubkey string, block_height int) *nostr.Event {
 		"ref_marketplace_pubkey": "%s",
 		"ref_marketplace_id": "test-marketplace",
 		"ref_clock_pubkey": "%s",
-		"ref_block_id": "org.cityprotocol:block:%d:%s"
+		"ref_block_id": "org.cityprotocol:block:%d:%s",
+		"billboard_count": 0,
+		"promotion_count": 0,
+		"attention_count": 0,
+		"match_count": 0
 	}`, pubkey, pubkey, node_pubkey, block_height, block_hash)
 
 	event := createTestEvent(38188, pubkey, content)
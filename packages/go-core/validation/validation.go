@@ -4,19 +4,75 @@
 //
 // This package contains only ATTN Protocol-specific validation.
 // Block events (38808) and supporting Nostr kinds are validated by City Protocol.
+//
+// Validation is built for relays that check thousands of events per second: tags are
+// indexed in a single pass and content is scanned in place, so a valid event is
+// validated without heap allocations. Rejected events allocate only for their message.
 package validation
 
 import (
+	"context"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
 )
 
 // ValidationResult represents the result of event validation.
 // It indicates whether an event is valid and provides an error message if invalid.
+// Code classifies the failure and is empty for valid events. Version is the
+// spec version the event was validated as, when validated through a Registry.
 type ValidationResult struct {
 	Valid   bool
+	Code    string
 	Message string
+	Version core.SpecVersion
 }
 
+// Failure codes for ValidationResult.Code.
+// Messages are free text; codes are stable and shared with the TypeScript core
+// through the conformance vectors in /conformance.
+const (
+	// CodeUnknownKind means the event kind is not an ATTN Protocol kind.
+	CodeUnknownKind = "unknown_kind"
+
+	// CodeNonStandardTag means the event uses a tag outside d, t, a, e, p, r, k, u, L, l.
+	CodeNonStandardTag = "non_standard_tag"
+
+	// CodeMissingDTag means the d tag is missing.
+	CodeMissingDTag = "missing_d_tag"
+
+	// CodeInvalidDTag means the d tag does not follow org.attnprotocol:<event_type>:<identifier>.
+	CodeInvalidDTag = "invalid_d_tag"
+
+	// CodeMissingBlockHeight means the t tag (block height) is missing.
+	CodeMissingBlockHeight = "missing_block_height"
+
+	// CodeInvalidBlockHeight means the t tag is not a numeric block height.
+	CodeInvalidBlockHeight = "invalid_block_height"
+
+	// CodeMissingCoordinate means a required 'a' tag coordinate is missing.
+	CodeMissingCoordinate = "missing_coordinate"
+
+	// CodeInvalidCoordinate means an 'a' tag coordinate is malformed.
+	CodeInvalidCoordinate = "invalid_coordinate"
+
+	// CodeMissingTag means other required tags (e, p, r, k, u) are missing.
+	CodeMissingTag = "missing_tag"
+
+	// CodeInvalidJSON means the content is not valid JSON.
+	CodeInvalidJSON = "invalid_json"
+
+	// CodeMissingField means a required content field is missing.
+	CodeMissingField = "missing_field"
+
+	// CodeInvalidField means a content field has the wrong type or value.
+	CodeInvalidField = "invalid_field"
+
+	// CodeUnsupportedVersion means the event is labelled with a spec version
+	// the validator does not support.
+	CodeUnsupportedVersion = "unsupported_version"
+)
+
 // ATTNProtocolKinds contains all ATTN Protocol event kinds (38188-38988).
 // Note: Block events (38808) are City Protocol, not ATTN Protocol.
 var ATTNProtocolKinds = map[int]bool{
@@ -45,36 +101,15 @@ func IsATTNProtocolKind(kind int) bool {
 //
 // Returns a ValidationResult indicating if the event is valid and any error message.
 func ValidateATTNEvent(event *nostr.Event) ValidationResult {
-	// Validate that only official Nostr tags are used for ATTN Protocol events
-	if ATTNProtocolKinds[event.Kind] {
-		if tag_result := validateOfficialTagsOnly(event); !tag_result.Valid {
-			return tag_result
-		}
-	}
-
-	switch event.Kind {
-	case 38188:
-		return ValidateMarketplaceEvent(event)
-	case 38288:
-		return ValidateBillboardEvent(event)
-	case 38388:
-		return ValidatePromotionEvent(event)
-	case 38488:
-		return ValidateAttentionEvent(event)
-	case 38588:
-		return ValidateBillboardConfirmationEvent(event)
-	case 38688:
-		return ValidateAttentionConfirmationEvent(event)
-	case 38788:
-		return ValidateMarketplaceConfirmationEvent(event)
-	case 38888:
-		return ValidateMatchEvent(event)
-	case 38988:
-		return ValidateAttentionPaymentConfirmationEvent(event)
-	default:
-		return ValidationResult{
-			Valid:   false,
-			Message: "Not an ATTN Protocol event kind",
-		}
-	}
+	return defaultRegistry.Validate(event)
+}
+
+// ValidateATTNEventContext is ValidateATTNEvent with a context, whose span, if
+// any, parents the validation span when telemetry is on.
+func ValidateATTNEventContext(ctx context.Context, event *nostr.Event) ValidationResult {
+	return defaultRegistry.ValidateContext(ctx, event)
 }
+
+// defaultRegistry backs ValidateATTNEvent. It is never modified after creation;
+// callers that need custom kinds or policy build their own with NewDefaultRegistry.
+var defaultRegistry = NewDefaultRegistry()
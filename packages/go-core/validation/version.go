@@ -0,0 +1,81 @@
+package validation
+
+import (
+	"strings"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// specVersionLabel returns the value of the event's NIP-32 spec version label,
+// ["l", "<version>", core.SpecVersionLabelNamespace], if it has one.
+func specVersionLabel(event *nostr.Event) (string, bool) {
+	for _, tag := range event.Tags {
+		if len(tag) >= 3 && tag[0] == "l" && tag[2] == core.SpecVersionLabelNamespace {
+			return tag[1], true
+		}
+	}
+	return "", false
+}
+
+// DetectSpecVersion returns the spec version an event was written for.
+// A spec version label decides when present, and yields core.SpecVersionUnknown
+// if it names an unsupported version. Otherwise the content shape decides: content
+// with SpecVersion1 field names and no ref_* fields is SpecVersion1, and everything
+// else, including content that is not JSON, is treated as the current version.
+func DetectSpecVersion(event *nostr.Event) core.SpecVersion {
+	if value, ok := specVersionLabel(event); ok {
+		return core.ParseSpecVersion(value)
+	}
+	return contentSpecVersion(event)
+}
+
+// contentSpecVersion infers the spec version from the names of the content's fields.
+func contentSpecVersion(event *nostr.Event) core.SpecVersion {
+	legacy := legacyFields[event.Kind]
+	has_ref, has_legacy := false, false
+	scanContent(event.Content, func(key string, _ contentValue) {
+		if strings.HasPrefix(key, "ref_") {
+			has_ref = true
+		} else if legacy.isLegacy(key) {
+			has_legacy = true
+		}
+	})
+	if has_legacy && !has_ref {
+		return core.SpecVersion1
+	}
+	return core.CurrentSpecVersion
+}
+
+// UpgradeValidator returns a Validator for events written for an older spec
+// version: each event is upgraded with UpgradeEvent and the result is checked by
+// current, the validator for the current version. Failures name the version.
+func UpgradeValidator(from core.SpecVersion, current Validator) Validator {
+	return ValidatorFunc(func(event *nostr.Event) ValidationResult {
+		upgraded, err := upgradeEvent(event, from)
+		if err != nil {
+			return ValidationResult{Valid: false, Code: CodeInvalidJSON, Message: "spec version " + from.String() + ": " + err.Error()}
+		}
+		result := current.Validate(upgraded)
+		if !result.Valid {
+			result.Message = "spec version " + from.String() + ": " + result.Message
+		}
+		return result
+	})
+}
+
+// NewMultiVersionRegistry creates a default Registry that also accepts events
+// written for every older supported spec version, for relays and indexers that
+// ingest historical events. Older events are validated by upgrading them; see UpgradeEvent.
+func NewMultiVersionRegistry() *Registry {
+	registry := NewDefaultRegistry()
+	for _, kind := range registry.Kinds() {
+		current, _ := registry.validator(kind, core.CurrentSpecVersion)
+		for _, version := range core.SupportedSpecVersions() {
+			if version != core.CurrentSpecVersion {
+				registry.RegisterVersion(kind, version, UpgradeValidator(version, current))
+			}
+		}
+	}
+	return registry
+}
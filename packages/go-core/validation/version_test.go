@@ -0,0 +1,162 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// createTestVersion1PromotionEvent creates a PROMOTION event in the SpecVersion1 shape:
+// unprefixed reference fields, block height in content and plain identifiers.
+func createTestVersion1PromotionEvent(pubkey string) *nostr.Event {
+	content := fmt.Sprintf(`{
+		"duration": 30000,
+		"bid": 5000,
+		"event_id": "test-video-id",
+		"call_to_action": "Watch Now",
+		"call_to_action_url": "https://example.com/watch",
+		"escrow_id_list": ["strike_tx_abc123"],
+		"promotion_pubkey": "%s",
+		"promotion_id": "test-promotion",
+		"marketplace_pubkey": "%s",
+		"marketplace_id": "test-marketplace",
+		"billboard_pubkey": "%s",
+		"billboard_id": "test-billboard",
+		"block_height": 870500
+	}`, pubkey, pubkey, pubkey)
+
+	event := createTestEvent(38388, pubkey, content)
+	event.Tags = append(event.Tags,
+		nostr.Tag{"d", "test-promotion"},
+		nostr.Tag{"a", fmt.Sprintf("38188:%s:test-marketplace", pubkey)},
+		nostr.Tag{"a", fmt.Sprintf("38288:%s:test-billboard", pubkey)},
+		nostr.Tag{"a", fmt.Sprintf("34236:%s:test-video", pubkey)},
+		nostr.Tag{"p", pubkey},
+		nostr.Tag{"p", pubkey},
+		nostr.Tag{"p", pubkey},
+		nostr.Tag{"r", "wss://relay.nextblock.city"},
+		nostr.Tag{"k", "34236"},
+		nostr.Tag{"u", "https://example.com/promotion"},
+	)
+	return event
+}
+
+// withVersionLabel returns the event with a NIP-32 spec version label appended.
+func withVersionLabel(event *nostr.Event, value string) *nostr.Event {
+	event.Tags = append(event.Tags,
+		nostr.Tag{"L", core.SpecVersionLabelNamespace},
+		nostr.Tag{"l", value, core.SpecVersionLabelNamespace},
+	)
+	return event
+}
+
+func TestDetectSpecVersion(t *testing.T) {
+	pubkey := generateTestPubkey()
+
+	tests := []struct {
+		name     string
+		event    *nostr.Event
+		expected core.SpecVersion
+	}{
+		{"current shape", createTestPromotionEvent(pubkey, 870500, pubkey, pubkey, pubkey), core.SpecVersion2},
+		{"version 1 shape", createTestVersion1PromotionEvent(pubkey), core.SpecVersion1},
+		{"label overrides shape", withVersionLabel(createTestVersion1PromotionEvent(pubkey), "2"), core.SpecVersion2},
+		{"unsupported label", withVersionLabel(createTestPromotionEvent(pubkey, 870500, pubkey, pubkey, pubkey), "99"), core.SpecVersionUnknown},
+		{"content not JSON", createTestEvent(38388, pubkey, "not json"), core.CurrentSpecVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectSpecVersion(tt.event); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestUpgradeEvent_Version1(t *testing.T) {
+	pubkey := generateTestPubkey()
+	event := createTestVersion1PromotionEvent(pubkey)
+	original_content := event.Content
+
+	upgraded, err := UpgradeEvent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Content != original_content || event.Tags.GetD() != "test-promotion" {
+		t.Error("UpgradeEvent must not modify its argument")
+	}
+	if upgraded.ID != event.ID || upgraded.Sig != event.Sig {
+		t.Error("expected the original ID and signature to be kept")
+	}
+	if got := upgraded.Tags.GetD(); got != "org.attnprotocol:promotion:test-promotion" {
+		t.Errorf("expected a namespaced d tag, got %q", got)
+	}
+	if got := upgraded.Tags.Find("t"); got == nil || got[1] != "870500" {
+		t.Errorf("expected block height in the t tag, got %v", got)
+	}
+	if result := ValidatePromotionEvent(upgraded); !result.Valid {
+		t.Errorf("expected the upgraded event to be valid, got %+v", result)
+	}
+
+	data, err := DecodeContent(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	promotion, ok := data.(core.PromotionData)
+	if !ok {
+		t.Fatalf("expected core.PromotionData, got %T", data)
+	}
+	if promotion.RefPromotionID != "test-promotion" || promotion.RefMarketplacePubkey != pubkey || promotion.Bid != 5000 {
+		t.Errorf("unexpected decoded content %+v", promotion)
+	}
+}
+
+func TestUpgradeEvent_UnsupportedVersion(t *testing.T) {
+	pubkey := generateTestPubkey()
+	event := withVersionLabel(createTestPromotionEvent(pubkey, 870500, pubkey, pubkey, pubkey), "99")
+	if _, err := UpgradeEvent(event); !errors.Is(err, ErrUnsupportedSpecVersion) {
+		t.Errorf("expected ErrUnsupportedSpecVersion, got %v", err)
+	}
+}
+
+func TestNewMultiVersionRegistry(t *testing.T) {
+	pubkey := generateTestPubkey()
+	registry := NewMultiVersionRegistry()
+
+	if got, want := registry.SupportedVersions(38388), core.SupportedSpecVersions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("SupportedVersions() = %v, want %v", got, want)
+	}
+
+	current := registry.Validate(createTestPromotionEvent(pubkey, 870500, pubkey, pubkey, pubkey))
+	if !current.Valid || current.Version != core.SpecVersion2 {
+		t.Errorf("expected a valid version 2 event, got %+v", current)
+	}
+
+	legacy := createTestVersion1PromotionEvent(pubkey)
+	if result := registry.Validate(legacy); !result.Valid || result.Version != core.SpecVersion1 {
+		t.Errorf("expected a valid version 1 event, got %+v", result)
+	}
+	if result := registry.Validate(withVersionLabel(legacy, "1")); !result.Valid || result.Version != core.SpecVersion1 {
+		t.Errorf("expected a labelled version 1 event to be valid, got %+v", result)
+	}
+	if result := NewDefaultRegistry().Validate(createTestVersion1PromotionEvent(pubkey)); result.Valid {
+		t.Error("the default registry must only accept the current version")
+	}
+
+	// Version 1 events are still checked after the upgrade
+	invalid := createTestVersion1PromotionEvent(pubkey)
+	invalid.Content = `{"promotion_id": "test-promotion", "block_height": 870500}`
+	if result := registry.Validate(invalid); result.Valid || result.Version != core.SpecVersion1 || result.Code != CodeMissingField {
+		t.Errorf("expected missing_field for version 1, got %+v", result)
+	}
+
+	unsupported := withVersionLabel(createTestPromotionEvent(pubkey, 870500, pubkey, pubkey, pubkey), "99")
+	if result := registry.Validate(unsupported); result.Valid || result.Code != CodeUnsupportedVersion {
+		t.Errorf("expected %s, got %+v", CodeUnsupportedVersion, result)
+	}
+}
@@ -0,0 +1,75 @@
+package core
+
+import "strconv"
+
+// SpecVersion identifies a revision of the ATTN-01 event shapes.
+type SpecVersion int
+
+const (
+	// SpecVersionUnknown means the version could not be determined or is not supported.
+	SpecVersionUnknown SpecVersion = 0
+
+	// SpecVersion1 is ATTN-01 as published by SDK releases before 0.4.0, before the ref_* redesign:
+	//   - reference fields carry no ref_ prefix (match_id, marketplace_pubkey, ...)
+	//   - marketplaces reference a node (node_pubkey, block_id) rather than a City clock
+	//   - block height is stored in content (block_height) rather than a t tag
+	//   - MATCH content repeats bid, ask and duration from the referenced events
+	//   - MARKETPLACE and ATTENTION content carries kind_list and relay_list
+	//   - d tags are plain identifiers without the org.attnprotocol: namespace
+	SpecVersion1 SpecVersion = 1
+
+	// SpecVersion2 is the current ATTN-01: ref_* reference fields, block height in
+	// the t tag, namespaced d tags, and the content types in this package.
+	SpecVersion2 SpecVersion = 2
+
+	// CurrentSpecVersion is the version this package's types and builders produce.
+	CurrentSpecVersion = SpecVersion2
+)
+
+// SpecVersionLabelNamespace is the NIP-32 label namespace for declaring an event's
+// spec version: ["L", SpecVersionLabelNamespace] and ["l", "2", SpecVersionLabelNamespace].
+// Events without the label are versioned by their content shape.
+const SpecVersionLabelNamespace = "org.attnprotocol:version"
+
+// SupportedSpecVersions returns every spec version this package can read, oldest first.
+func SupportedSpecVersions() []SpecVersion {
+	return []SpecVersion{SpecVersion1, SpecVersion2}
+}
+
+// ParseSpecVersion parses a version label value such as "2".
+// It returns SpecVersionUnknown for anything that is not a supported version.
+func ParseSpecVersion(value string) SpecVersion {
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return SpecVersionUnknown
+	}
+	for _, version := range SupportedSpecVersions() {
+		if int(version) == number {
+			return version
+		}
+	}
+	return SpecVersionUnknown
+}
+
+// String returns the version as it appears in a version label, or "unknown".
+func (v SpecVersion) String() string {
+	if v == SpecVersionUnknown {
+		return "unknown"
+	}
+	return strconv.Itoa(int(v))
+}
+
+// NegotiateSpecVersion returns the newest version both sides support, for
+// example a client's versions against those a relay advertises.
+// It returns false if they have no version in common.
+func NegotiateSpecVersion(ours, theirs []SpecVersion) (SpecVersion, bool) {
+	best := SpecVersionUnknown
+	for _, a := range ours {
+		for _, b := range theirs {
+			if a == b && a > best {
+				best = a
+			}
+		}
+	}
+	return best, best != SpecVersionUnknown
+}
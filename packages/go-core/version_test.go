@@ -0,0 +1,35 @@
+package core
+
+import "testing"
+
+func TestParseSpecVersion(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected SpecVersion
+	}{
+		{"1", SpecVersion1},
+		{"2", SpecVersion2},
+		{"0", SpecVersionUnknown},
+		{"3", SpecVersionUnknown},
+		{"v2", SpecVersionUnknown},
+		{"", SpecVersionUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ParseSpecVersion(tt.value); got != tt.expected {
+			t.Errorf("ParseSpecVersion(%q) = %v, want %v", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestNegotiateSpecVersion(t *testing.T) {
+	if version, ok := NegotiateSpecVersion(SupportedSpecVersions(), []SpecVersion{SpecVersion1}); !ok || version != SpecVersion1 {
+		t.Errorf("expected version 1 with a v1-only peer, got %v %v", version, ok)
+	}
+	if version, ok := NegotiateSpecVersion(SupportedSpecVersions(), []SpecVersion{SpecVersion2, SpecVersion1, 7}); !ok || version != CurrentSpecVersion {
+		t.Errorf("expected the current version, got %v %v", version, ok)
+	}
+	if _, ok := NegotiateSpecVersion(SupportedSpecVersions(), []SpecVersion{7}); ok {
+		t.Error("expected no common version")
+	}
+}
@@ -0,0 +1,606 @@
+// Package billboard runs a billboard operator's side of a match.
+//
+// A Runtime tracks the MATCH events that name its billboard, resolves the
+// promotion each one pairs, and queues a Slot with the promoted content and
+// call to action. Slots play in block height order, shorter promotions first
+// within a block. Committing a slot publishes its BILLBOARD_CONFIRMATION; the
+// marketplace's MARKETPLACE_CONFIRMATION settles it, and a re-delivered MATCH
+// for a settled slot is not queued again. Matches whose promotion or attention
+// offer expired or was withdrawn are not queued, and a NIP-09 deletion request
+// withdrawing a queued promotion drops its slot.
+//
+// Example usage:
+//
+//	runtime, err := billboard.NewRuntime(billboard.Options{
+//	    PrivateKey:          private_key,
+//	    BillboardCoordinate: billboard_coordinate,
+//	    Pool:                pool,
+//	    RelayURLs:           []string{"wss://relay.example.com"},
+//	})
+//
+//	// events carries MATCH, MARKETPLACE_CONFIRMATION and deletion events
+//	// from a subscription to runtime.Filters()
+//	go runtime.Run(ctx, events)
+//
+//	slot, ok, err := runtime.Next(ctx) // commits the next slot
+package billboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrNoPool is returned when a runtime has no relay pool.
+	ErrNoPool = errors.New("runtime has no relay pool")
+
+	// ErrNoRelayURLs is returned when a runtime has no relay URLs for the r tags
+	// of its confirmations.
+	ErrNoRelayURLs = errors.New("runtime has no relay URLs")
+
+	// ErrInvalidBillboard is returned when the billboard coordinate is malformed
+	// or belongs to another pubkey.
+	ErrInvalidBillboard = errors.New("invalid billboard coordinate")
+
+	// ErrUnresolved is returned when an event a MATCH references is not found.
+	ErrUnresolved = errors.New("referenced event not found")
+
+	// ErrUnknownSlot is returned by Commit for a match that is not queued.
+	ErrUnknownSlot = errors.New("no queued slot for match")
+
+	// ErrOfferExpired is returned when a MATCH pairs an offer that expired by
+	// its block height.
+	ErrOfferExpired = errors.New("offer expired")
+
+	// ErrOfferWithdrawn is returned when a MATCH pairs an offer its author
+	// withdrew with a NIP-09 deletion request.
+	ErrOfferWithdrawn = errors.New("offer withdrawn")
+)
+
+// kindVideo is the kind of the promoted video content.
+const kindVideo = 34236
+
+// Pool queries and publishes events. *relay.Pool and *relay.Router implement it.
+type Pool interface {
+	Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+	Publish(ctx context.Context, event *nostr.Event) error
+}
+
+// Options holds configuration for a Runtime.
+type Options struct {
+	// PrivateKey is the hex-encoded private key of the billboard operator.
+	PrivateKey string
+
+	// BillboardCoordinate is the billboard coordinate (38288:pubkey:d_tag).
+	// Its pubkey must be the operator's.
+	BillboardCoordinate string
+
+	// Pool resolves referenced events and publishes confirmations.
+	Pool Pool
+
+	// RelayURLs are added as r tags to every confirmation.
+	RelayURLs []string
+
+	// OnError, if set, receives errors from events handled during Run, which
+	// otherwise continues with the next event.
+	OnError func(err error)
+
+	// Expiry decides when promotion and attention offers expire, measured at
+	// the match's block height. Settled matches are remembered, and MATCH
+	// events ignored, until the newest match is a promotion window past them
+	// (core.DefaultValidityBlocks if promotions never expire). Defaults to
+	// core.DefaultExpiryPolicy.
+	Expiry *core.ExpiryPolicy
+}
+
+// Slot is a matched promotion to be played on the billboard.
+type Slot struct {
+	// MatchCoordinate is the coordinate of the MATCH (38888:pubkey:d_tag).
+	MatchCoordinate string
+
+	// BlockHeight is the block the match was made for.
+	BlockHeight int64
+
+	// Duration is how long the promotion plays, in milliseconds.
+	Duration int64
+
+	// PromotionCoordinate is the promotion coordinate (38388:pubkey:d_tag).
+	PromotionCoordinate string
+
+	// VideoCoordinate is the promoted content (34236:pubkey:d_tag), and
+	// VideoEventID the content event ID from the promotion.
+	VideoCoordinate string
+	VideoEventID    string
+
+	// CallToAction and CallToActionURL are shown with the content.
+	CallToAction    string
+	CallToActionURL string
+
+	// Committed reports whether the slot's BILLBOARD_CONFIRMATION was published,
+	// and Confirmation is that event.
+	Committed    bool
+	Confirmation *nostr.Event
+}
+
+// Runtime turns matches for a billboard into a queue of slots.
+// It is safe for concurrent use.
+type Runtime struct {
+	options Options
+	pubkey  string
+
+	mu           sync.Mutex
+	block_height int64                 // of the newest match
+	slots        map[string]*slotState // match coordinate -> slot
+	settled      map[string]int64      // match coordinate -> block height it is forgotten at
+}
+
+// slotState is a Slot and what its BILLBOARD_CONFIRMATION references.
+type slotState struct {
+	slot      Slot
+	params    events.BillboardConfirmationParams
+	promotion *nostr.Event
+	forget_at int64 // block height from which a re-delivered MATCH is stale
+
+	// committing is set while the confirmation is being published, and
+	// closed once it is published or fails.
+	committing chan struct{}
+}
+
+// NewRuntime creates a runtime.
+func NewRuntime(options Options) (*Runtime, error) {
+	switch {
+	case options.Pool == nil:
+		return nil, ErrNoPool
+	case len(options.RelayURLs) == 0:
+		return nil, ErrNoRelayURLs
+	}
+
+	pubkey, err := nostr.GetPublicKey(options.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if kind, owner, _, _ := events.ParseCoordinate(options.BillboardCoordinate); kind != core.KindBillboard || owner != pubkey {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidBillboard, options.BillboardCoordinate)
+	}
+	if options.Expiry == nil {
+		options.Expiry = &core.DefaultExpiryPolicy
+	}
+	return &Runtime{options: options, pubkey: pubkey, slots: make(map[string]*slotState), settled: make(map[string]int64)}, nil
+}
+
+// Filter matches the MATCH and MARKETPLACE_CONFIRMATION events that reference the billboard.
+func (r *Runtime) Filter() nostr.Filter {
+	return nostr.Filter{
+		Kinds: []int{core.KindMatch, core.KindMarketplaceConfirmation},
+		Tags:  nostr.TagMap{"a": []string{r.options.BillboardCoordinate}},
+	}
+}
+
+// Filters returns Filter and a filter for the NIP-09 deletion requests that
+// withdraw PROMOTION events. Deletions are signed by promoters and do not
+// reference the billboard, so Filter alone never matches them. Deletions
+// without a k tag are still caught when a slot is committed.
+func (r *Runtime) Filters() []nostr.Filter {
+	return []nostr.Filter{
+		r.Filter(),
+		{Kinds: []int{core.KindDeletion}, Tags: nostr.TagMap{"k": []string{strconv.Itoa(core.KindPromotion)}}},
+	}
+}
+
+// Run handles events until the channel closes or ctx is done. Run returns nil
+// when the channel closes.
+func (r *Runtime) Run(ctx context.Context, events <-chan *nostr.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := r.HandleEvent(ctx, event); err != nil && r.options.OnError != nil {
+				r.options.OnError(err)
+			}
+		}
+	}
+}
+
+// HandleEvent queues a slot for a MATCH, settles one for a
+// MARKETPLACE_CONFIRMATION, or drops the uncommitted slots of a promotion a
+// NIP-09 deletion request withdraws. Events that do not reference the
+// billboard, or that are not signed by the referenced marketplace, are ignored.
+func (r *Runtime) HandleEvent(ctx context.Context, event *nostr.Event) error {
+	switch event.Kind {
+	case core.KindMatch:
+		return r.handleMatch(ctx, event)
+	case core.KindMarketplaceConfirmation:
+		r.handleMarketplaceConfirmation(event)
+	case core.KindDeletion:
+		r.handleDeletion(event)
+	}
+	return nil
+}
+
+// Queue returns the slots not yet committed, in play order: by block height,
+// then shorter promotions first.
+func (r *Runtime) Queue() []Slot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.queue()
+}
+
+// Slot returns the slot for a match. Settled slots are no longer tracked.
+func (r *Runtime) Slot(match_coordinate string) (Slot, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.slots[match_coordinate]
+	if !ok {
+		return Slot{}, false
+	}
+	return state.slot, true
+}
+
+// Next commits the first slot in the queue that no other caller is
+// committing, and returns it. Slots whose promotion turns out to be withdrawn
+// are dropped and skipped. ok is false when there is none.
+func (r *Runtime) Next(ctx context.Context) (slot Slot, ok bool, err error) {
+	for {
+		r.mu.Lock()
+		var state *slotState
+		for _, queued := range r.queue() {
+			if candidate := r.slots[queued.MatchCoordinate]; candidate.committing == nil {
+				state = candidate
+				break
+			}
+		}
+		if state == nil {
+			r.mu.Unlock()
+			return Slot{}, false, nil
+		}
+		state.committing = make(chan struct{})
+		r.mu.Unlock()
+
+		slot, err = r.commit(ctx, state)
+		if !errors.Is(err, ErrOfferWithdrawn) {
+			return slot, err == nil, err
+		}
+	}
+}
+
+// Commit publishes the BILLBOARD_CONFIRMATION for a queued slot and returns
+// the committed slot. Committing a slot twice publishes once; a caller that
+// finds the slot being committed waits for the outcome. If the promotion was
+// withdrawn, the slot is dropped and Commit returns ErrOfferWithdrawn.
+func (r *Runtime) Commit(ctx context.Context, match_coordinate string) (Slot, error) {
+	r.mu.Lock()
+	for {
+		state, ok := r.slots[match_coordinate]
+		switch {
+		case !ok:
+			r.mu.Unlock()
+			return Slot{}, fmt.Errorf("%w %s", ErrUnknownSlot, match_coordinate)
+		case state.slot.Committed:
+			slot := state.slot
+			r.mu.Unlock()
+			return slot, nil
+		case state.committing == nil:
+			state.committing = make(chan struct{})
+			r.mu.Unlock()
+			return r.commit(ctx, state)
+		}
+
+		committing := state.committing
+		r.mu.Unlock()
+		select {
+		case <-committing:
+		case <-ctx.Done():
+			return Slot{}, ctx.Err()
+		}
+		r.mu.Lock()
+	}
+}
+
+func (r *Runtime) queue() []Slot {
+	var queue []Slot
+	for _, state := range r.slots {
+		if !state.slot.Committed {
+			queue = append(queue, state.slot)
+		}
+	}
+	sort.Slice(queue, func(i, j int) bool {
+		a, b := queue[i], queue[j]
+		if a.BlockHeight != b.BlockHeight {
+			return a.BlockHeight < b.BlockHeight
+		}
+		if a.Duration != b.Duration {
+			return a.Duration < b.Duration
+		}
+		return a.MatchCoordinate < b.MatchCoordinate
+	})
+	return queue
+}
+
+// commit publishes a slot's BILLBOARD_CONFIRMATION without holding the lock,
+// unless the promotion has been withdrawn since the slot was queued. The
+// caller has set state.committing, which commit closes.
+func (r *Runtime) commit(ctx context.Context, state *slotState) (Slot, error) {
+	var confirmation *nostr.Event
+	withdrawn, err := r.withdrawn(ctx, state.promotion, state.slot.PromotionCoordinate)
+	if err == nil && withdrawn {
+		err = fmt.Errorf("%w: %q", ErrOfferWithdrawn, state.slot.PromotionCoordinate)
+	}
+	if err == nil {
+		confirmation, err = events.CreateBillboardConfirmation(r.options.PrivateKey, state.params)
+	}
+	if err == nil {
+		err = r.options.Pool.Publish(ctx, confirmation)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	close(state.committing)
+	state.committing = nil
+	if withdrawn {
+		delete(r.slots, state.slot.MatchCoordinate)
+	}
+	if err != nil {
+		return Slot{}, err
+	}
+	state.slot.Committed = true
+	state.slot.Confirmation = confirmation
+	return state.slot, nil
+}
+
+// handleMatch resolves the events a MATCH for the billboard references and
+// queues its slot. A MATCH already tracked or settled is ignored, as is one a
+// promotion window older than the newest match.
+func (r *Runtime) handleMatch(ctx context.Context, match *nostr.Event) error {
+	refs := make(map[int]string, 4)
+	for _, tag := range match.Tags {
+		if len(tag) >= 2 && tag[0] == "a" {
+			if kind, _, _, _ := events.ParseCoordinate(tag[1]); kind != 0 {
+				refs[kind] = tag[1]
+			}
+		}
+	}
+	if refs[core.KindBillboard] != r.options.BillboardCoordinate {
+		return nil
+	}
+	if _, marketplace_pubkey, _, _ := events.ParseCoordinate(refs[core.KindMarketplace]); marketplace_pubkey == "" || match.PubKey != marketplace_pubkey {
+		return nil
+	}
+	match_d_tag := match.Tags.GetD()
+	block_height, ok := core.EventBlockHeight(match)
+	if match_d_tag == "" || !ok {
+		return nil
+	}
+
+	match_coordinate := events.FormatCoordinate(core.KindMatch, match.PubKey, match_d_tag)
+	forget_at := block_height + r.window(refs[core.KindMarketplace])
+	r.mu.Lock()
+	if r.seen(match_coordinate, forget_at) {
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+
+	// Resolve the referenced events; the confirmation needs their IDs
+	resolved := make(map[int]*nostr.Event, 4)
+	for _, kind := range []int{core.KindPromotion, core.KindMarketplace, core.KindBillboard, core.KindAttention} {
+		event, err := r.resolve(ctx, refs[kind])
+		if err != nil {
+			return err
+		}
+		if event == nil {
+			return fmt.Errorf("%w: %q", ErrUnresolved, refs[kind])
+		}
+		resolved[kind] = event
+	}
+	promotion := resolved[core.KindPromotion]
+
+	// Skip offers that expired or were withdrawn
+	for _, kind := range []int{core.KindPromotion, core.KindAttention} {
+		if r.options.Expiry.IsExpired(resolved[kind], block_height) {
+			return fmt.Errorf("%w: %q", ErrOfferExpired, refs[kind])
+		}
+		withdrawn, err := r.withdrawn(ctx, resolved[kind], refs[kind])
+		if err != nil {
+			return err
+		}
+		if withdrawn {
+			return fmt.Errorf("%w: %q", ErrOfferWithdrawn, refs[kind])
+		}
+	}
+
+	var content core.PromotionData
+	if err := json.Unmarshal([]byte(promotion.Content), &content); err != nil {
+		return fmt.Errorf("promotion %s: %w", refs[core.KindPromotion], err)
+	}
+	var video_coordinate string
+	for _, tag := range promotion.Tags {
+		if len(tag) >= 2 && tag[0] == "a" && strings.HasPrefix(tag[1], strconv.Itoa(kindVideo)+":") {
+			video_coordinate = tag[1]
+			break
+		}
+	}
+
+	var match_content core.MatchData
+	json.Unmarshal([]byte(match.Content), &match_content)
+	if match_content.RefMatchID == "" {
+		match_content.RefMatchID = match_d_tag
+	}
+	_, attention_pubkey, _, _ := events.ParseCoordinate(refs[core.KindAttention])
+
+	state := &slotState{
+		slot: Slot{
+			MatchCoordinate:     match_coordinate,
+			BlockHeight:         block_height,
+			Duration:            content.Duration,
+			PromotionCoordinate: refs[core.KindPromotion],
+			VideoCoordinate:     video_coordinate,
+			VideoEventID:        content.EventID,
+			CallToAction:        content.CallToAction,
+			CallToActionURL:     content.CallToActionURL,
+		},
+		params: events.BillboardConfirmationParams{
+			ConfirmationID:        strings.TrimPrefix(match_d_tag, "org.attnprotocol:match:"),
+			BlockHeight:           block_height,
+			MatchID:               match_content.RefMatchID,
+			MarketplaceCoordinate: refs[core.KindMarketplace],
+			BillboardCoordinate:   refs[core.KindBillboard],
+			PromotionCoordinate:   refs[core.KindPromotion],
+			AttentionCoordinate:   refs[core.KindAttention],
+			MatchCoordinate:       match_coordinate,
+			MatchEventID:          match.ID,
+			MarketplaceEventID:    resolved[core.KindMarketplace].ID,
+			BillboardEventID:      resolved[core.KindBillboard].ID,
+			PromotionEventID:      promotion.ID,
+			AttentionEventID:      resolved[core.KindAttention].ID,
+			MarketplacePubkey:     match.PubKey,
+			BillboardPubkey:       r.pubkey,
+			PromotionPubkey:       promotion.PubKey,
+			AttentionPubkey:       attention_pubkey,
+			MarketplaceID:         match_content.RefMarketplaceID,
+			BillboardID:           match_content.RefBillboardID,
+			PromotionID:           match_content.RefPromotionID,
+			AttentionID:           match_content.RefAttentionID,
+			RelayURLs:             r.options.RelayURLs,
+		},
+		promotion: promotion,
+		forget_at: forget_at,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.seen(match_coordinate, forget_at) {
+		r.slots[match_coordinate] = state
+		r.advance(block_height)
+	}
+	return nil
+}
+
+// seen reports whether a match is queued, settled, or stale: forget_at is the
+// block height from which it is no longer remembered once settled. The caller
+// holds r.mu.
+func (r *Runtime) seen(match_coordinate string, forget_at int64) bool {
+	if _, ok := r.slots[match_coordinate]; ok {
+		return true
+	}
+	if _, ok := r.settled[match_coordinate]; ok {
+		return true
+	}
+	return forget_at <= r.block_height
+}
+
+// advance records the block height of a new match and forgets the settled
+// matches that are stale at it. The caller holds r.mu.
+func (r *Runtime) advance(block_height int64) {
+	if block_height <= r.block_height {
+		return
+	}
+	r.block_height = block_height
+	for match_coordinate, forget_at := range r.settled {
+		if forget_at <= block_height {
+			delete(r.settled, match_coordinate)
+		}
+	}
+}
+
+// window returns how many blocks a promotion in a marketplace stays valid,
+// or core.DefaultValidityBlocks if it never expires.
+func (r *Runtime) window(marketplace_coordinate string) int64 {
+	probe := &nostr.Event{Kind: core.KindPromotion, Tags: nostr.Tags{{"a", marketplace_coordinate}}}
+	if window := r.options.Expiry.Window(probe); window > 0 {
+		return window
+	}
+	return core.DefaultValidityBlocks
+}
+
+// handleMarketplaceConfirmation stops tracking the slot of a match the
+// marketplace has confirmed, and remembers the match as settled.
+func (r *Runtime) handleMarketplaceConfirmation(event *nostr.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		if state, ok := r.slots[tag[1]]; ok && state.params.MarketplacePubkey == event.PubKey {
+			delete(r.slots, tag[1])
+			r.settled[tag[1]] = state.forget_at
+			return
+		}
+	}
+}
+
+// handleDeletion drops the uncommitted slots of the promotions a deletion
+// request withdraws. Slots being committed are kept.
+func (r *Runtime) handleDeletion(deletion *nostr.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for match_coordinate, state := range r.slots {
+		if state.slot.Committed || state.committing != nil || state.params.PromotionPubkey != deletion.PubKey {
+			continue
+		}
+		for _, tag := range deletion.Tags {
+			if len(tag) >= 2 && ((tag[0] == "a" && tag[1] == state.slot.PromotionCoordinate) || (tag[0] == "e" && tag[1] == state.params.PromotionEventID)) {
+				delete(r.slots, match_coordinate)
+				break
+			}
+		}
+	}
+}
+
+// withdrawn reports whether the author of an offer has published a NIP-09
+// deletion request for it, by coordinate or by event ID.
+func (r *Runtime) withdrawn(ctx context.Context, offer *nostr.Event, coordinate string) (bool, error) {
+	for _, tags := range []nostr.TagMap{{"a": []string{coordinate}}, {"e": []string{offer.ID}}} {
+		found, err := r.options.Pool.Query(ctx, nostr.Filter{
+			Kinds:   []int{core.KindDeletion},
+			Authors: []string{offer.PubKey},
+			Tags:    tags,
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, deletion := range found {
+			if core.Withdraws(deletion, offer) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// resolve returns the newest event at a coordinate, or nil if none is found.
+func (r *Runtime) resolve(ctx context.Context, coordinate string) (*nostr.Event, error) {
+	kind, pubkey, d_tag, _ := events.ParseCoordinate(coordinate)
+	if kind == 0 {
+		return nil, nil
+	}
+	found, err := r.options.Pool.Query(ctx, nostr.Filter{
+		Kinds:   []int{kind},
+		Authors: []string{pubkey},
+		Tags:    nostr.TagMap{"d": []string{d_tag}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var newest *nostr.Event
+	for _, event := range found {
+		if newest == nil || event.CreatedAt > newest.CreatedAt {
+			newest = event
+		}
+	}
+	return newest, nil
+}
@@ -0,0 +1,324 @@
+package billboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/joinnextblock/attn-protocol/go-sdk/internal/markettest"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// market is the shared test marketplace, with billboard-specific helpers.
+type market struct {
+	*markettest.Market
+}
+
+func newMarket(t *testing.T, ctx context.Context) *market {
+	t.Helper()
+	return &market{markettest.New(t, ctx)}
+}
+
+// promote publishes a PROMOTION for the billboard and returns its coordinate.
+func (m *market) promote(t *testing.T, ctx context.Context, promotion_id string, duration int64) string {
+	t.Helper()
+	return markettest.Coordinate(m.Promote(t, ctx, promotion_id, 1000, duration))
+}
+
+func (m *market) newRuntime(t *testing.T) *Runtime {
+	t.Helper()
+	runtime, err := NewRuntime(Options{PrivateKey: m.Operator, BillboardCoordinate: m.BillboardCoordinate, Pool: m.Pool, RelayURLs: []string{m.Relay.URL()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runtime
+}
+
+func TestNewRuntime_Options(t *testing.T) {
+	key := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(key)
+	valid := Options{PrivateKey: key, BillboardCoordinate: "38288:" + pubkey + ":org.attnprotocol:billboard:bb", Pool: &relay.Pool{}, RelayURLs: []string{"wss://r"}}
+
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		want   error
+	}{
+		{"no pool", func(o *Options) { o.Pool = nil }, ErrNoPool},
+		{"no relay URLs", func(o *Options) { o.RelayURLs = nil }, ErrNoRelayURLs},
+		{"wrong kind", func(o *Options) { o.BillboardCoordinate = "38188:" + pubkey + ":x" }, ErrInvalidBillboard},
+		{"another operator", func(o *Options) { o.BillboardCoordinate = "38288:other:x" }, ErrInvalidBillboard},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := valid
+			tt.modify(&options)
+			if _, err := NewRuntime(options); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+	if _, err := NewRuntime(valid); err != nil {
+		t.Errorf("expected valid options, got %v", err)
+	}
+}
+
+func TestRuntime_QueueOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx)
+	runtime := m.newRuntime(t)
+
+	long := m.promote(t, ctx, "long", 60000)
+	short := m.promote(t, ctx, "short", 15000)
+	for _, match := range []*nostr.Event{
+		m.Match(t, m.Marketplace, "m-1", short, m.BillboardCoordinate, 870502),
+		m.Match(t, m.Marketplace, "m-2", long, m.BillboardCoordinate, 870501),
+		m.Match(t, m.Marketplace, "m-3", short, m.BillboardCoordinate, 870501),
+	} {
+		if err := runtime.HandleEvent(ctx, match); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	queue := runtime.Queue()
+	var order []string
+	for _, slot := range queue {
+		order = append(order, fmt.Sprintf("%d/%d", slot.BlockHeight, slot.Duration))
+	}
+	if fmt.Sprint(order) != "[870501/15000 870501/60000 870502/15000]" {
+		t.Fatalf("unexpected queue order %v", order)
+	}
+	head := queue[0]
+	if head.VideoCoordinate != "34236:author:short" {
+		t.Errorf("unexpected video coordinate %q", head.VideoCoordinate)
+	}
+	if head.VideoEventID != "video-short" || head.CallToAction != "Watch" || head.CallToActionURL != "https://example.com/short" {
+		t.Errorf("unexpected promoted content %+v", head)
+	}
+}
+
+func TestRuntime_CommitPublishesConfirmation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx)
+	runtime := m.newRuntime(t)
+	promotion := m.promote(t, ctx, "pr-1", 30000)
+	match := m.Match(t, m.Marketplace, "m-1", promotion, m.BillboardCoordinate, 870501)
+	runtime.HandleEvent(ctx, match)
+
+	slot, ok, err := runtime.Next(ctx)
+	if err != nil || !ok {
+		t.Fatalf("expected a slot, got %v %v", ok, err)
+	}
+	if !slot.Committed || slot.Confirmation == nil {
+		t.Fatalf("expected a committed slot, got %+v", slot)
+	}
+	if result := validation.ValidateATTNEvent(slot.Confirmation); !result.Valid {
+		t.Errorf("expected a valid BILLBOARD_CONFIRMATION, got %s", result.Message)
+	}
+	if got := slot.Confirmation.Tags.GetD(); got != "org.attnprotocol:billboard-confirmation:m-1" {
+		t.Errorf("unexpected d tag %q", got)
+	}
+	if stored, err := m.Relay.Store().GetByID(ctx, slot.Confirmation.ID); err != nil || stored == nil {
+		t.Errorf("expected the relay to hold the confirmation, got %v", err)
+	}
+
+	if len(runtime.Queue()) != 0 {
+		t.Error("expected a committed slot to leave the queue")
+	}
+	if _, ok, _ := runtime.Next(ctx); ok {
+		t.Error("expected an empty queue")
+	}
+	again, err := runtime.Commit(ctx, slot.MatchCoordinate)
+	if err != nil || again.Confirmation.ID != slot.Confirmation.ID {
+		t.Error("expected committing twice to publish once")
+	}
+	if _, err := runtime.Commit(ctx, "38888:x:y"); !errors.Is(err, ErrUnknownSlot) {
+		t.Errorf("expected ErrUnknownSlot, got %v", err)
+	}
+
+	// The marketplace's confirmation settles the slot; a forged one does not
+	settle := func(key string) *nostr.Event {
+		event := &nostr.Event{Kind: core.KindMarketplaceConfirmation, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"a", slot.MatchCoordinate}, {"a", m.BillboardCoordinate}}}
+		if err := event.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	runtime.HandleEvent(ctx, settle(nostr.GeneratePrivateKey()))
+	if _, ok := runtime.Slot(slot.MatchCoordinate); !ok {
+		t.Error("expected a forged confirmation to be ignored")
+	}
+	runtime.HandleEvent(ctx, settle(m.Marketplace))
+	if _, ok := runtime.Slot(slot.MatchCoordinate); ok {
+		t.Error("expected the marketplace confirmation to settle the slot")
+	}
+
+	// A re-delivered MATCH for a settled slot is not queued again, until it
+	// is a promotion window older than the newest match
+	runtime.HandleEvent(ctx, match)
+	if queue := runtime.Queue(); len(queue) != 0 {
+		t.Errorf("expected a settled match to be ignored, got %d slots", len(queue))
+	}
+	runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-2", promotion, m.BillboardCoordinate, 870501+core.DefaultValidityBlocks))
+	runtime.HandleEvent(ctx, match)
+	if queue := runtime.Queue(); len(queue) != 0 {
+		t.Errorf("expected a stale match to be ignored, got %d slots", len(queue))
+	}
+}
+
+// gatedPool holds the first Publish until release is closed.
+type gatedPool struct {
+	Pool
+	entered, release chan struct{}
+
+	mu        sync.Mutex
+	published int
+}
+
+func (p *gatedPool) Publish(ctx context.Context, event *nostr.Event) error {
+	p.mu.Lock()
+	p.published++
+	first := p.published == 1
+	p.mu.Unlock()
+	if first {
+		close(p.entered)
+		<-p.release
+	}
+	return p.Pool.Publish(ctx, event)
+}
+
+func TestRuntime_CommitsOutsideLock(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx)
+	pool := &gatedPool{Pool: m.Pool, entered: make(chan struct{}), release: make(chan struct{})}
+	runtime, err := NewRuntime(Options{PrivateKey: m.Operator, BillboardCoordinate: m.BillboardCoordinate, Pool: pool, RelayURLs: []string{m.Relay.URL()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	promotion := m.promote(t, ctx, "pr-1", 30000)
+	runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-1", promotion, m.BillboardCoordinate, 870501))
+	runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-2", promotion, m.BillboardCoordinate, 870502))
+	queue := runtime.Queue()
+	if len(queue) != 2 {
+		t.Fatalf("expected two slots, got %d", len(queue))
+	}
+
+	type result struct {
+		slot Slot
+		err  error
+	}
+	results := make(chan result, 2)
+	commit := func() {
+		slot, err := runtime.Commit(ctx, queue[0].MatchCoordinate)
+		results <- result{slot, err}
+	}
+	go commit()
+	<-pool.entered
+
+	// The first slot is being published: the runtime stays usable, a second
+	// Commit waits for it, and Next moves on to the next slot
+	if len(runtime.Queue()) != 2 {
+		t.Error("expected a slot being committed to stay queued")
+	}
+	go commit()
+	next, ok, err := runtime.Next(ctx)
+	if err != nil || !ok || next.MatchCoordinate != queue[1].MatchCoordinate {
+		t.Fatalf("expected Next to skip the slot being committed, got %v %v %v", next.MatchCoordinate, ok, err)
+	}
+
+	close(pool.release)
+	first, second := <-results, <-results
+	if first.err != nil || second.err != nil || first.slot.Confirmation.ID != second.slot.Confirmation.ID {
+		t.Fatalf("expected both commits to return one confirmation, got %v %v", first.err, second.err)
+	}
+	if pool.published != 2 {
+		t.Errorf("expected one confirmation per slot, got %d", pool.published)
+	}
+}
+
+func TestRuntime_IgnoresOtherMatches(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx)
+	runtime := m.newRuntime(t)
+	promotion := m.promote(t, ctx, "pr-1", 30000)
+
+	runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-1", promotion, "38288:other:org.attnprotocol:billboard:bb", 870501))
+	runtime.HandleEvent(ctx, m.Match(t, nostr.GeneratePrivateKey(), "m-2", promotion, m.BillboardCoordinate, 870501))
+	if queue := runtime.Queue(); len(queue) != 0 {
+		t.Errorf("expected other billboards' and forged matches to be ignored, got %d slots", len(queue))
+	}
+
+	missing := events.FormatCoordinate(core.KindPromotion, "nobody", events.FormatDTag("promotion", "missing"))
+	if err := runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-3", missing, m.BillboardCoordinate, 870501)); !errors.Is(err, ErrUnresolved) {
+		t.Errorf("expected ErrUnresolved, got %v", err)
+	}
+}
+
+func TestRuntime_SkipsExpiredAndWithdrawnOffers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx)
+	runtime := m.newRuntime(t)
+	expiring := m.promote(t, ctx, "pr-1", 30000)
+	withdrawn := m.promote(t, ctx, "pr-2", 30000)
+	queued := m.promote(t, ctx, "pr-3", 30000)
+
+	// The offers were published at block 870500 and expire after 144 blocks
+	if err := runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-1", expiring, m.BillboardCoordinate, 870644)); !errors.Is(err, ErrOfferExpired) {
+		t.Errorf("expected ErrOfferExpired, got %v", err)
+	}
+
+	withdrawal, err := events.CreatePromotionWithdrawal(m.Promoter, events.WithdrawalParams{ID: "pr-2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Pool.Publish(ctx, withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	if err := runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-2", withdrawn, m.BillboardCoordinate, 870501)); !errors.Is(err, ErrOfferWithdrawn) {
+		t.Errorf("expected ErrOfferWithdrawn, got %v", err)
+	}
+
+	// Withdrawing a queued promotion drops its slot
+	if err := runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-3", queued, m.BillboardCoordinate, 870501)); err != nil {
+		t.Fatal(err)
+	}
+	if queue := runtime.Queue(); len(queue) != 1 {
+		t.Fatalf("expected one slot, got %d", len(queue))
+	}
+	withdrawal, _ = events.CreatePromotionWithdrawal(m.Promoter, events.WithdrawalParams{ID: "pr-3"})
+	if !runtime.Filters()[1].Matches(withdrawal) {
+		t.Error("expected Filters to subscribe to the withdrawal")
+	}
+	runtime.HandleEvent(ctx, withdrawal)
+	if queue := runtime.Queue(); len(queue) != 0 {
+		t.Errorf("expected the withdrawn slot to be dropped, got %d slots", len(queue))
+	}
+
+	// A withdrawal the runtime never received is caught on commit
+	unseen := m.promote(t, ctx, "pr-4", 30000)
+	if err := runtime.HandleEvent(ctx, m.Match(t, m.Marketplace, "m-4", unseen, m.BillboardCoordinate, 870501)); err != nil {
+		t.Fatal(err)
+	}
+	withdrawal, _ = events.CreatePromotionWithdrawal(m.Promoter, events.WithdrawalParams{ID: "pr-4"})
+	if err := m.Pool.Publish(ctx, withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	if slot, ok, err := runtime.Next(ctx); ok || err != nil {
+		t.Errorf("expected the withdrawn slot to be skipped, got %+v, %v", slot, err)
+	}
+	if queue := runtime.Queue(); len(queue) != 0 {
+		t.Errorf("expected the withdrawn slot to be dropped, got %d slots", len(queue))
+	}
+}
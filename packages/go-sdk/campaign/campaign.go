@@ -0,0 +1,667 @@
+// Package campaign manages a promoter's campaign across blocks.
+//
+// A Campaign publishes one PROMOTION per target marketplace and billboard, and
+// re-publishes it at every block with a bid chosen by its BidStrategy. Each
+// target keeps its d tag, so every PROMOTION replaces the previous one.
+// Spend is paced by a per-block cap, and the campaign stops once confirmed
+// spend, the sats_received of ATTENTION_PAYMENT_CONFIRMATION events, reaches
+// the budget.
+//
+// Example usage:
+//
+//	promoter, err := campaign.NewCampaign(campaign.Options{
+//	    PrivateKey:  private_key,
+//	    CampaignID:  "spring-launch",
+//	    Budget:      100000,
+//	    BlockCap:    5000,
+//	    Targets:     []campaign.Target{{MarketplaceCoordinate: marketplace, BillboardCoordinate: billboard}},
+//	    Strategy:    campaign.EscalatingBid(1000, 250, 3000),
+//	    Promotion:   events.PromotionParams{Duration: 30000, EventID: video_event_id},
+//	    Publisher:   pool,
+//	    ClockPubkey: clock_pubkey,
+//	})
+//
+//	// events carries block, MATCH and payment confirmation events from a subscription
+//	err = promoter.Run(ctx, events)
+package campaign
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrInvalidBudget is returned when the budget is not positive.
+	ErrInvalidBudget = errors.New("campaign budget must be positive")
+
+	// ErrInvalidBlockCap is returned when the per-block spend cap is not positive.
+	ErrInvalidBlockCap = errors.New("per-block spend cap must be positive")
+
+	// ErrNoCampaignID is returned when a campaign has no ID.
+	ErrNoCampaignID = errors.New("campaign has no ID")
+
+	// ErrNoTargets is returned when a campaign has no target marketplaces.
+	ErrNoTargets = errors.New("campaign has no targets")
+
+	// ErrInvalidTarget is returned when a target's marketplace coordinate is malformed.
+	ErrInvalidTarget = errors.New("invalid target marketplace coordinate")
+
+	// ErrNoStrategy is returned when a campaign has no bid strategy.
+	ErrNoStrategy = errors.New("campaign has no bid strategy")
+
+	// ErrNoPublisher is returned when a campaign has no publisher.
+	ErrNoPublisher = errors.New("campaign has no publisher")
+)
+
+// DefaultConfirmationTimeout is how many blocks a match may stay unpaid before
+// its reservation is released, when Options.ConfirmationTimeout is zero.
+const DefaultConfirmationTimeout = 6
+
+// Publisher publishes events to relays. *relay.Pool and *relay.Outbox implement it.
+type Publisher interface {
+	Publish(ctx context.Context, event *nostr.Event) error
+}
+
+// Target is a marketplace and billboard the campaign promotes on.
+type Target struct {
+	// MarketplaceCoordinate is the marketplace coordinate (38188:pubkey:d_tag).
+	// Only MATCH events signed by this marketplace count against the campaign.
+	MarketplaceCoordinate string
+
+	// BillboardCoordinate is the billboard coordinate (38288:pubkey:d_tag).
+	BillboardCoordinate string
+}
+
+// Options holds configuration for a Campaign.
+type Options struct {
+	// PrivateKey is the hex-encoded private key PROMOTION events are signed with.
+	PrivateKey string
+
+	// CampaignID names the campaign. Target n publishes under the d tag
+	// org.attnprotocol:promotion:<CampaignID>-<n>.
+	CampaignID string
+
+	// Budget is the total sats the campaign may spend.
+	Budget int64
+
+	// BlockCap is the most the campaign commits to matches in a single block.
+	BlockCap int64
+
+	// Targets are the marketplaces and billboards to promote on.
+	Targets []Target
+
+	// Strategy chooses each PROMOTION's bid.
+	Strategy BidStrategy
+
+	// Promotion holds the fields every PROMOTION shares, such as Duration,
+	// EventID and CallToAction. Bid, BlockHeight, PromotionID and the
+	// coordinates are set by the campaign.
+	Promotion events.PromotionParams
+
+	// Publisher publishes PROMOTION events.
+	Publisher Publisher
+
+	// ClockPubkey is the City Protocol clock whose block events advance the
+	// campaign in HandleEvent and Run. Block events from other pubkeys are
+	// ignored, as are all block events when it is empty; OnBlock still works.
+	ClockPubkey string
+
+	// ConfirmationTimeout is how many blocks a match may stay unpaid before its
+	// reserved bid returns to the budget. Defaults to DefaultConfirmationTimeout.
+	ConfirmationTimeout int64
+
+	// OnError, if set, receives publish errors during Run, which otherwise
+	// continues with the next event.
+	OnError func(err error)
+}
+
+// Stats is a snapshot of a campaign's spend.
+type Stats struct {
+	// Budget is the campaign's total budget.
+	Budget int64
+
+	// Spent is the confirmed spend: the sum of sats_received.
+	Spent int64
+
+	// Reserved is the bids of matches not yet paid.
+	Reserved int64
+
+	// Remaining is Budget less Spent and Reserved.
+	Remaining int64
+
+	// BlockHeight is the latest block seen.
+	BlockHeight int64
+
+	// BlockCommitted is the sats committed to matches at BlockHeight.
+	BlockCommitted int64
+
+	// Matches and Confirmations count the MATCH and payment confirmation events accepted.
+	Matches       int
+	Confirmations int
+
+	// Exhausted reports whether confirmed spend has reached the budget.
+	Exhausted bool
+}
+
+// Campaign publishes and paces a promoter's PROMOTION events.
+// It is safe for concurrent use.
+type Campaign struct {
+	mu      sync.Mutex
+	options Options
+	pubkey  string
+
+	targets       []*targetState
+	by_coordinate map[string]*targetState     // promotion coordinate -> target
+	matches       map[string]*matchState      // ref_match_id -> match
+	pending       map[string][]pendingPayment // ref_match_id -> payments that arrived before the match
+	block_height  int64
+	committed     map[int64]int64 // block height -> sats committed to matches
+	spent         int64
+	reserved      int64
+	match_count   int
+	confirmations int
+	exhausted     bool
+	done          chan struct{}
+}
+
+// targetState tracks the PROMOTION published for one target. bid,
+// published_height and first_height are recorded when a PROMOTION is planned
+// and restored if it fails to publish.
+type targetState struct {
+	target             Target
+	marketplace_pubkey string
+	promotion_id       string
+	coordinate         string
+
+	bid               int64 // bid of the live PROMOTION, 0 when none is live
+	published_height  int64
+	first_height      int64
+	last_match_height int64
+	created_at        nostr.Timestamp
+	versions          []promotionVersion // PROMOTIONs planned, oldest first
+}
+
+// promotionVersion is one PROMOTION planned for a target, so a match is
+// reserved at the bid it was made against.
+type promotionVersion struct {
+	block_height int64
+	bid          int64
+	created_at   nostr.Timestamp
+}
+
+// publication is a PROMOTION planned under the lock and published outside it,
+// with the target state it replaced.
+type publication struct {
+	target           *targetState
+	event            *nostr.Event
+	bid              int64
+	published_height int64
+	first_height     int64
+}
+
+// matchState tracks a match against one of the campaign's promotions.
+type matchState struct {
+	target           *targetState
+	attention_pubkey string
+	block_height     int64
+	reserved         int64
+	received         int64
+	confirmed        bool
+}
+
+// pendingPayment is a payment confirmation held until its match arrives.
+type pendingPayment struct {
+	event        *nostr.Event
+	block_height int64 // block it arrived at
+}
+
+// NewCampaign creates a campaign. Nothing is published until the first block.
+func NewCampaign(options Options) (*Campaign, error) {
+	switch {
+	case options.CampaignID == "":
+		return nil, ErrNoCampaignID
+	case options.Budget <= 0:
+		return nil, ErrInvalidBudget
+	case options.BlockCap <= 0:
+		return nil, ErrInvalidBlockCap
+	case len(options.Targets) == 0:
+		return nil, ErrNoTargets
+	case options.Strategy == nil:
+		return nil, ErrNoStrategy
+	case options.Publisher == nil:
+		return nil, ErrNoPublisher
+	}
+	if options.ConfirmationTimeout <= 0 {
+		options.ConfirmationTimeout = DefaultConfirmationTimeout
+	}
+
+	pubkey, err := nostr.GetPublicKey(options.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign := &Campaign{
+		options:       options,
+		pubkey:        pubkey,
+		by_coordinate: make(map[string]*targetState),
+		matches:       make(map[string]*matchState),
+		pending:       make(map[string][]pendingPayment),
+		committed:     make(map[int64]int64),
+		done:          make(chan struct{}),
+	}
+	for i, target := range options.Targets {
+		marketplace_pubkey, ok := coordinatePubkey(target.MarketplaceCoordinate, core.KindMarketplace)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTarget, target.MarketplaceCoordinate)
+		}
+		promotion_id := fmt.Sprintf("%s-%d", options.CampaignID, i)
+		state := &targetState{
+			target:             target,
+			marketplace_pubkey: marketplace_pubkey,
+			promotion_id:       promotion_id,
+			coordinate:         events.FormatCoordinate(core.KindPromotion, pubkey, events.FormatDTag("promotion", promotion_id)),
+		}
+		campaign.targets = append(campaign.targets, state)
+		campaign.by_coordinate[state.coordinate] = state
+	}
+	return campaign, nil
+}
+
+// Coordinates returns the coordinates of the campaign's promotions, one per target.
+func (c *Campaign) Coordinates() []string {
+	coordinates := make([]string, len(c.targets))
+	for i, target := range c.targets {
+		coordinates[i] = target.coordinate
+	}
+	return coordinates
+}
+
+// Done is closed when confirmed spend reaches the budget.
+func (c *Campaign) Done() <-chan struct{} {
+	return c.done
+}
+
+// Stats returns a snapshot of the campaign's spend.
+func (c *Campaign) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return Stats{
+		Budget:         c.options.Budget,
+		Spent:          c.spent,
+		Reserved:       c.reserved,
+		Remaining:      c.options.Budget - c.spent - c.reserved,
+		BlockHeight:    c.block_height,
+		BlockCommitted: c.committed[c.block_height],
+		Matches:        c.match_count,
+		Confirmations:  c.confirmations,
+		Exhausted:      c.exhausted,
+	}
+}
+
+// Run handles events until the budget is exhausted, the channel closes or
+// ctx is done. events should carry the clock's block events and the MATCH and
+// ATTENTION_PAYMENT_CONFIRMATION events that reference the campaign's
+// coordinates; other events are ignored. Run returns nil when the budget is
+// exhausted or the channel closes.
+func (c *Campaign) Run(ctx context.Context, events <-chan *nostr.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.done:
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := c.HandleEvent(ctx, event); err != nil && c.options.OnError != nil {
+				c.options.OnError(err)
+			}
+		}
+	}
+}
+
+// HandleEvent applies a block, MATCH or ATTENTION_PAYMENT_CONFIRMATION event
+// and re-publishes promotions whose bid changed. Other events are ignored.
+// Only block events signed by Options.ClockPubkey count. The returned error
+// reports promotions that failed to publish.
+func (c *Campaign) HandleEvent(ctx context.Context, event *nostr.Event) error {
+	c.mu.Lock()
+	switch event.Kind {
+	case core.KindCityBlock:
+		block_height, ok := events.ParseBlock(event, c.options.ClockPubkey)
+		if !ok || block_height <= c.block_height {
+			c.mu.Unlock()
+			return nil
+		}
+		c.advance(block_height)
+	case core.KindMatch:
+		c.applyMatch(event)
+	case core.KindAttentionPaymentConfirmation:
+		c.applyPayment(event)
+	default:
+		c.mu.Unlock()
+		return nil
+	}
+	publications, err := c.plan()
+	c.mu.Unlock()
+	return errors.Join(err, c.publish(ctx, publications))
+}
+
+// OnBlock moves the campaign to a new block and publishes its promotions for it.
+// Blocks at or below the current height are ignored.
+func (c *Campaign) OnBlock(ctx context.Context, block_height int64) error {
+	c.mu.Lock()
+	if block_height <= c.block_height {
+		c.mu.Unlock()
+		return nil
+	}
+	c.advance(block_height)
+	publications, err := c.plan()
+	c.mu.Unlock()
+	return errors.Join(err, c.publish(ctx, publications))
+}
+
+// advance moves to a new block, releases reservations of matches that were
+// not paid in time, and forgets payments and PROMOTION versions too old to
+// matter.
+func (c *Campaign) advance(block_height int64) {
+	c.block_height = block_height
+	for _, match := range c.matches {
+		if !match.confirmed && match.reserved > 0 && block_height-match.block_height > c.options.ConfirmationTimeout {
+			c.reserved -= match.reserved
+			match.reserved = 0
+		}
+	}
+	cutoff := block_height - c.options.ConfirmationTimeout
+	for height := range c.committed {
+		if height < cutoff {
+			delete(c.committed, height)
+		}
+	}
+	for match_id, payments := range c.pending {
+		payments = slices.DeleteFunc(payments, func(payment pendingPayment) bool {
+			return payment.block_height < cutoff
+		})
+		if len(payments) == 0 {
+			delete(c.pending, match_id)
+		} else {
+			c.pending[match_id] = payments
+		}
+	}
+	// Matches before the cutoff are released on arrival, so only the newest
+	// versions at or before it are still needed
+	for _, target := range c.targets {
+		start := 0
+		for i, version := range target.versions {
+			if version.block_height <= cutoff && version.block_height > target.versions[start].block_height {
+				start = i
+			}
+		}
+		target.versions = target.versions[start:]
+	}
+}
+
+// applyMatch records a match against one of the campaign's promotions,
+// reserving the bid of the PROMOTION it was made against until the attention
+// owner confirms payment. Payments that arrived before the match are applied.
+func (c *Campaign) applyMatch(event *nostr.Event) {
+	target := c.referencedTarget(event)
+	if target == nil || event.PubKey != target.marketplace_pubkey {
+		return
+	}
+	var content core.MatchData
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil || content.RefMatchID == "" {
+		return
+	}
+	if _, seen := c.matches[content.RefMatchID]; seen {
+		return
+	}
+
+	block_height := c.block_height
+	if height, ok := core.EventBlockHeight(event); ok {
+		block_height = height
+	}
+
+	reserved := target.matchedBid(block_height)
+	c.matches[content.RefMatchID] = &matchState{
+		target:           target,
+		attention_pubkey: content.RefAttentionPubkey,
+		block_height:     block_height,
+		reserved:         reserved,
+	}
+	c.reserved += reserved
+	c.committed[block_height] += reserved
+	c.match_count++
+	if block_height > target.last_match_height {
+		target.last_match_height = block_height
+	}
+
+	payments := c.pending[content.RefMatchID]
+	delete(c.pending, content.RefMatchID)
+	slices.SortStableFunc(payments, func(a, b pendingPayment) int {
+		return cmp.Compare(a.event.CreatedAt, b.event.CreatedAt)
+	})
+	for _, payment := range payments {
+		c.applyPayment(payment.event)
+	}
+}
+
+// matchedBid returns the bid of the PROMOTION live at a match's block height:
+// the newest version planned at or before it. Versions re-planned within that
+// block are indistinguishable to the match, so the highest is reserved.
+func (t *targetState) matchedBid(block_height int64) int64 {
+	var bid int64
+	matched_height := int64(-1)
+	for i := len(t.versions) - 1; i >= 0; i-- {
+		version := t.versions[i]
+		if version.block_height > block_height {
+			continue
+		}
+		if matched_height >= 0 && version.block_height < matched_height {
+			break
+		}
+		matched_height = version.block_height
+		bid = max(bid, version.bid)
+	}
+	return bid
+}
+
+// applyPayment records the sats an attention owner confirmed receiving for a
+// match. A replacement confirmation for the same match replaces the amount.
+// A payment for a match not yet seen is held for ConfirmationTimeout blocks
+// and applied if the match arrives.
+func (c *Campaign) applyPayment(event *nostr.Event) {
+	var content core.AttentionPaymentConfirmationData
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil {
+		return
+	}
+	if content.RefMatchID == "" || content.SatsReceived < 0 {
+		return
+	}
+	match, ok := c.matches[content.RefMatchID]
+	if !ok {
+		c.pending[content.RefMatchID] = append(c.pending[content.RefMatchID], pendingPayment{event: event, block_height: c.block_height})
+		return
+	}
+	if match.attention_pubkey != "" && event.PubKey != match.attention_pubkey {
+		return
+	}
+
+	if match.confirmed {
+		c.spent += content.SatsReceived - match.received
+	} else {
+		c.reserved -= match.reserved
+		match.reserved = 0
+		c.spent += content.SatsReceived
+		match.confirmed = true
+		c.confirmations++
+	}
+	match.received = content.SatsReceived
+
+	if c.spent >= c.options.Budget && !c.exhausted {
+		c.exhausted = true
+		close(c.done)
+	}
+}
+
+// referencedTarget returns the campaign target whose promotion the event references.
+func (c *Campaign) referencedTarget(event *nostr.Event) *targetState {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "a" {
+			if target, ok := c.by_coordinate[tag[1]]; ok {
+				return target
+			}
+		}
+	}
+	return nil
+}
+
+// plan builds a PROMOTION for every target whose bid at the current block
+// differs from its live one, and records it as the target's live PROMOTION.
+// The caller holds the lock and publishes the result once it is released.
+//
+// Each live PROMOTION may be matched, so a target's bid is limited to what the
+// budget and the block's cap leave after reservations and the other targets'
+// live bids. A target that cannot bid is not re-published, and its previous
+// PROMOTION, for an earlier block, lapses.
+func (c *Campaign) plan() ([]publication, error) {
+	if c.exhausted || c.block_height == 0 {
+		return nil, nil
+	}
+
+	var publications []publication
+	var errs []error
+	for _, target := range c.targets {
+		var live int64
+		for _, other := range c.targets {
+			if other != target && other.published_height == c.block_height {
+				live += other.bid
+			}
+		}
+		available := min(
+			c.options.Budget-c.spent-c.reserved-live,
+			c.options.BlockCap-c.committed[c.block_height]-live,
+		)
+
+		since := target.first_height
+		if target.last_match_height > since {
+			since = target.last_match_height
+		}
+		blocks_since_match := int64(0)
+		if since > 0 {
+			blocks_since_match = c.block_height - since
+		}
+
+		bid := min(c.options.Strategy.Bid(BidState{
+			BlockHeight:      c.block_height,
+			Target:           target.target,
+			LastBid:          target.bid,
+			BlocksSinceMatch: blocks_since_match,
+			Available:        available,
+		}), available)
+		if bid <= 0 {
+			if target.published_height != c.block_height {
+				target.bid = 0
+			}
+			continue
+		}
+		if target.published_height == c.block_height && target.bid == bid {
+			continue
+		}
+
+		publication, err := c.planTarget(target, bid)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("promotion %s: %w", target.promotion_id, err))
+			continue
+		}
+		publications = append(publications, publication)
+	}
+	return publications, errors.Join(errs...)
+}
+
+// planTarget builds and signs a target's PROMOTION and records it as live.
+func (c *Campaign) planTarget(target *targetState, bid int64) (publication, error) {
+	params := c.options.Promotion
+	params.Bid = bid
+	params.BlockHeight = c.block_height
+	params.PromotionID = target.promotion_id
+	params.MarketplaceCoordinate = target.target.MarketplaceCoordinate
+	params.BillboardCoordinate = target.target.BillboardCoordinate
+	if params.PromotionPubkey == "" {
+		params.PromotionPubkey = c.pubkey
+	}
+
+	event, err := events.CreatePromotion(c.options.PrivateKey, params)
+	if err != nil {
+		return publication{}, err
+	}
+	// A replacement must be newer than the PROMOTION it replaces
+	if event.CreatedAt <= target.created_at {
+		event.CreatedAt = target.created_at + 1
+		if err := event.Sign(c.options.PrivateKey); err != nil {
+			return publication{}, err
+		}
+	}
+
+	planned := publication{
+		target:           target,
+		event:            event,
+		bid:              target.bid,
+		published_height: target.published_height,
+		first_height:     target.first_height,
+	}
+	target.bid = bid
+	target.published_height = c.block_height
+	target.created_at = event.CreatedAt
+	target.versions = append(target.versions, promotionVersion{block_height: c.block_height, bid: bid, created_at: event.CreatedAt})
+	if target.first_height == 0 {
+		target.first_height = c.block_height
+	}
+	return planned, nil
+}
+
+// publish publishes planned PROMOTIONs without holding the lock. A PROMOTION
+// that fails to publish is dropped from its target's versions, and the target
+// gets its previous state back, unless a newer PROMOTION was planned for it
+// meanwhile, so the next event retries it.
+func (c *Campaign) publish(ctx context.Context, publications []publication) error {
+	var errs []error
+	for _, planned := range publications {
+		err := c.options.Publisher.Publish(ctx, planned.event)
+		if err == nil {
+			continue
+		}
+		errs = append(errs, fmt.Errorf("promotion %s: %w", planned.target.promotion_id, err))
+
+		c.mu.Lock()
+		planned.target.versions = slices.DeleteFunc(planned.target.versions, func(version promotionVersion) bool {
+			return version.created_at == planned.event.CreatedAt
+		})
+		if planned.target.created_at == planned.event.CreatedAt {
+			planned.target.bid = planned.bid
+			planned.target.published_height = planned.published_height
+			planned.target.first_height = planned.first_height
+		}
+		c.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// coordinatePubkey returns the pubkey of a kind:pubkey:d_tag coordinate of the given kind.
+func coordinatePubkey(coordinate string, kind int) (string, bool) {
+	parsed_kind, pubkey, d_tag, err := events.ParseCoordinate(coordinate)
+	if err != nil || parsed_kind != kind || pubkey == "" || d_tag == "" {
+		return "", false
+	}
+	return pubkey, true
+}
@@ -0,0 +1,444 @@
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// recorder is a Publisher that keeps every event it is given.
+type recorder struct {
+	mu     sync.Mutex
+	events []*nostr.Event
+}
+
+func (r *recorder) Publish(_ context.Context, event *nostr.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recorder) published() []*nostr.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*nostr.Event(nil), r.events...)
+}
+
+// participants holds the keys of everyone a campaign deals with.
+type participants struct {
+	promoter, marketplace, attention string
+}
+
+func newParticipants() participants {
+	return participants{promoter: nostr.GeneratePrivateKey(), marketplace: nostr.GeneratePrivateKey(), attention: nostr.GeneratePrivateKey()}
+}
+
+func (p participants) target(n int) Target {
+	marketplace_pubkey, _ := nostr.GetPublicKey(p.marketplace)
+	return Target{
+		MarketplaceCoordinate: events.FormatCoordinate(core.KindMarketplace, marketplace_pubkey, events.FormatDTag("marketplace", "mk-1")),
+		BillboardCoordinate:   events.FormatCoordinate(core.KindBillboard, marketplace_pubkey, events.FormatDTag("billboard", fmt.Sprintf("bb-%d", n))),
+	}
+}
+
+func newTestCampaign(t *testing.T, p participants, publisher Publisher, options Options) *Campaign {
+	t.Helper()
+	options.PrivateKey = p.promoter
+	options.CampaignID = "spring"
+	options.Publisher = publisher
+	if options.Targets == nil {
+		options.Targets = []Target{p.target(0)}
+	}
+	if options.Strategy == nil {
+		options.Strategy = FixedBid(1000)
+	}
+	campaign, err := NewCampaign(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return campaign
+}
+
+// match builds a MATCH for a promotion, signed by the marketplace.
+func (p participants) match(t *testing.T, match_id string, promotion_coordinate string, block_height int64) *nostr.Event {
+	t.Helper()
+	attention_pubkey, _ := nostr.GetPublicKey(p.attention)
+	content, _ := json.Marshal(core.MatchData{RefMatchID: match_id, RefAttentionPubkey: attention_pubkey})
+	return sign(t, p.marketplace, &nostr.Event{
+		Kind:    core.KindMatch,
+		Tags:    nostr.Tags{{"d", events.FormatDTag("match", match_id)}, {"t", strconv.FormatInt(block_height, 10)}, {"a", promotion_coordinate}},
+		Content: string(content),
+	})
+}
+
+// payment builds an ATTENTION_PAYMENT_CONFIRMATION for a match, signed by key.
+func (p participants) payment(t *testing.T, key string, match_id string, sats int64) *nostr.Event {
+	t.Helper()
+	content, _ := json.Marshal(core.AttentionPaymentConfirmationData{RefMatchID: match_id, SatsReceived: sats})
+	return sign(t, key, &nostr.Event{Kind: core.KindAttentionPaymentConfirmation, Content: string(content)})
+}
+
+func sign(t *testing.T, key string, event *nostr.Event) *nostr.Event {
+	t.Helper()
+	event.CreatedAt = nostr.Now()
+	if err := event.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+func bidOf(t *testing.T, event *nostr.Event) int64 {
+	t.Helper()
+	var content core.PromotionData
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil {
+		t.Fatal(err)
+	}
+	return content.Bid
+}
+
+func TestNewCampaign_Options(t *testing.T) {
+	p := newParticipants()
+	valid := Options{PrivateKey: p.promoter, CampaignID: "c", Budget: 1, BlockCap: 1, Targets: []Target{p.target(0)}, Strategy: FixedBid(1), Publisher: &recorder{}}
+
+	tests := []struct {
+		name   string
+		modify func(*Options)
+	}{
+		{"no campaign ID", func(o *Options) { o.CampaignID = "" }},
+		{"zero budget", func(o *Options) { o.Budget = 0 }},
+		{"zero block cap", func(o *Options) { o.BlockCap = 0 }},
+		{"no targets", func(o *Options) { o.Targets = nil }},
+		{"bad target", func(o *Options) { o.Targets = []Target{{MarketplaceCoordinate: "38288:pk:x"}} }},
+		{"no strategy", func(o *Options) { o.Strategy = nil }},
+		{"no publisher", func(o *Options) { o.Publisher = nil }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := valid
+			tt.modify(&options)
+			if _, err := NewCampaign(options); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+	if _, err := NewCampaign(valid); err != nil {
+		t.Errorf("expected valid options, got %v", err)
+	}
+}
+
+func TestCampaign_RepublishesEachBlock(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	publisher := &recorder{}
+	campaign := newTestCampaign(t, p, publisher, Options{Budget: 10000, BlockCap: 5000})
+
+	if err := campaign.OnBlock(ctx, 870500); err != nil {
+		t.Fatal(err)
+	}
+	if err := campaign.OnBlock(ctx, 870501); err != nil {
+		t.Fatal(err)
+	}
+	campaign.OnBlock(ctx, 870501) // repeated block publishes nothing
+
+	published := publisher.published()
+	if len(published) != 2 {
+		t.Fatalf("expected one PROMOTION per block, got %d", len(published))
+	}
+	if published[0].Tags.GetD() != "org.attnprotocol:promotion:spring-0" || published[1].Tags.GetD() != published[0].Tags.GetD() {
+		t.Errorf("expected both PROMOTIONs under one d tag, got %q and %q", published[0].Tags.GetD(), published[1].Tags.GetD())
+	}
+	if published[1].CreatedAt <= published[0].CreatedAt {
+		t.Error("the replacement PROMOTION must be newer")
+	}
+	if got := published[1].Tags.Find("t"); got[1] != "870501" {
+		t.Errorf("expected block height 870501, got %v", got)
+	}
+	if ok, err := published[1].CheckSignature(); !ok || err != nil {
+		t.Errorf("expected a valid signature, got %v %v", ok, err)
+	}
+}
+
+func TestCampaign_BlockCapPacing(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	publisher := &recorder{}
+	campaign := newTestCampaign(t, p, publisher, Options{
+		Budget:   100000,
+		BlockCap: 5000,
+		Targets:  []Target{p.target(0), p.target(1)},
+		Strategy: FixedBid(3000),
+	})
+
+	campaign.OnBlock(ctx, 870500)
+	published := publisher.published()
+	if len(published) != 2 || bidOf(t, published[0]) != 3000 || bidOf(t, published[1]) != 2000 {
+		t.Fatalf("expected bids of 3000 and 2000 under a 5000 cap, got %d events", len(published))
+	}
+
+	// A match commits the first target's bid for the block, leaving the cap for nothing else
+	coordinates := campaign.Coordinates()
+	campaign.HandleEvent(ctx, p.match(t, "m-1", coordinates[0], 870500))
+	if stats := campaign.Stats(); stats.Reserved != 3000 || stats.BlockCommitted != 3000 {
+		t.Errorf("expected 3000 reserved and committed, got %+v", stats)
+	}
+
+	// The next block has a fresh cap
+	campaign.OnBlock(ctx, 870501)
+	published = publisher.published()[2:]
+	if len(published) != 2 || bidOf(t, published[0]) != 3000 || bidOf(t, published[1]) != 2000 {
+		t.Errorf("expected the cap to reset at the next block, got %d events", len(published))
+	}
+}
+
+func TestCampaign_SpendFromConfirmations(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	publisher := &recorder{}
+	campaign := newTestCampaign(t, p, publisher, Options{Budget: 2500, BlockCap: 2000, Strategy: FixedBid(2000)})
+	coordinate := campaign.Coordinates()[0]
+
+	campaign.OnBlock(ctx, 870500)
+	campaign.HandleEvent(ctx, p.match(t, "m-1", coordinate, 870500))
+	campaign.HandleEvent(ctx, p.payment(t, p.attention, "m-1", 1800))
+	if stats := campaign.Stats(); stats.Spent != 1800 || stats.Reserved != 0 || stats.Confirmations != 1 {
+		t.Fatalf("expected 1800 spent, got %+v", stats)
+	}
+
+	// Bids are limited by what is left of the budget
+	campaign.OnBlock(ctx, 870501)
+	last := publisher.published()[len(publisher.published())-1]
+	if bidOf(t, last) != 700 {
+		t.Errorf("expected a bid of the remaining 700, got %d", bidOf(t, last))
+	}
+
+	campaign.HandleEvent(ctx, p.match(t, "m-2", coordinate, 870501))
+	campaign.HandleEvent(ctx, p.payment(t, p.attention, "m-2", 700))
+	select {
+	case <-campaign.Done():
+	default:
+		t.Fatalf("expected the campaign to be exhausted, got %+v", campaign.Stats())
+	}
+
+	count := len(publisher.published())
+	campaign.OnBlock(ctx, 870502)
+	if len(publisher.published()) != count {
+		t.Error("an exhausted campaign must not publish")
+	}
+}
+
+func TestCampaign_IgnoresUntrustedEvents(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	campaign := newTestCampaign(t, p, &recorder{}, Options{Budget: 10000, BlockCap: 5000})
+	coordinate := campaign.Coordinates()[0]
+	campaign.OnBlock(ctx, 870500)
+
+	// A MATCH from a marketplace that is not a target
+	impostor := participants{promoter: p.promoter, marketplace: nostr.GeneratePrivateKey(), attention: p.attention}
+	campaign.HandleEvent(ctx, impostor.match(t, "m-1", coordinate, 870500))
+	if stats := campaign.Stats(); stats.Matches != 0 {
+		t.Errorf("expected the impostor's match to be ignored, got %+v", stats)
+	}
+
+	// A payment confirmation signed by someone other than the matched attention owner
+	campaign.HandleEvent(ctx, p.match(t, "m-2", coordinate, 870500))
+	campaign.HandleEvent(ctx, p.payment(t, nostr.GeneratePrivateKey(), "m-2", 1000))
+	campaign.HandleEvent(ctx, p.payment(t, p.attention, "m-unknown", 1000))
+	if stats := campaign.Stats(); stats.Matches != 1 || stats.Spent != 0 || stats.Reserved != 1000 {
+		t.Errorf("expected only the target's match to count, got %+v", stats)
+	}
+}
+
+func TestCampaign_ReservationTimeout(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	campaign := newTestCampaign(t, p, &recorder{}, Options{Budget: 10000, BlockCap: 5000, ConfirmationTimeout: 2})
+	campaign.OnBlock(ctx, 870500)
+	campaign.HandleEvent(ctx, p.match(t, "m-1", campaign.Coordinates()[0], 870500))
+
+	campaign.OnBlock(ctx, 870502)
+	if reserved := campaign.Stats().Reserved; reserved != 1000 {
+		t.Errorf("expected the reservation to be held for 2 blocks, got %d", reserved)
+	}
+	campaign.OnBlock(ctx, 870503)
+	if reserved := campaign.Stats().Reserved; reserved != 0 {
+		t.Errorf("expected the reservation to be released, got %d", reserved)
+	}
+
+	// A late payment still counts as spend
+	campaign.HandleEvent(ctx, p.payment(t, p.attention, "m-1", 900))
+	if stats := campaign.Stats(); stats.Spent != 900 || stats.Reserved != 0 {
+		t.Errorf("expected the late payment to be spent, got %+v", stats)
+	}
+}
+
+func TestCampaign_ReservesMatchedBid(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	campaign := newTestCampaign(t, p, &recorder{}, Options{Budget: 10000, BlockCap: 5000, Strategy: EscalatingBid(1000, 250, 3000)})
+	coordinate := campaign.Coordinates()[0]
+
+	// The match against block 870500's PROMOTION arrives after the bid rose
+	campaign.OnBlock(ctx, 870500)
+	campaign.OnBlock(ctx, 870501)
+	campaign.HandleEvent(ctx, p.match(t, "m-1", coordinate, 870500))
+	if reserved := campaign.Stats().Reserved; reserved != 1000 {
+		t.Errorf("expected the matched bid of 1000 to be reserved, got %d", reserved)
+	}
+	campaign.HandleEvent(ctx, p.match(t, "m-2", coordinate, 870501))
+	if reserved := campaign.Stats().Reserved; reserved != 2250 {
+		t.Errorf("expected 2250 reserved, got %d", reserved)
+	}
+}
+
+func TestCampaign_BuffersEarlyPayments(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	campaign := newTestCampaign(t, p, &recorder{}, Options{Budget: 10000, BlockCap: 5000, ConfirmationTimeout: 2})
+	coordinate := campaign.Coordinates()[0]
+	campaign.OnBlock(ctx, 870500)
+
+	// The payment confirmation overtakes its match
+	campaign.HandleEvent(ctx, p.payment(t, p.attention, "m-1", 900))
+	if stats := campaign.Stats(); stats.Spent != 0 || stats.Confirmations != 0 {
+		t.Fatalf("expected the payment to wait for its match, got %+v", stats)
+	}
+	campaign.HandleEvent(ctx, p.match(t, "m-1", coordinate, 870500))
+	if stats := campaign.Stats(); stats.Spent != 900 || stats.Reserved != 0 || stats.Confirmations != 1 {
+		t.Errorf("expected the buffered payment to be applied, got %+v", stats)
+	}
+
+	// Buffered payments are dropped after ConfirmationTimeout blocks
+	campaign.HandleEvent(ctx, p.payment(t, p.attention, "m-2", 500))
+	campaign.OnBlock(ctx, 870503)
+	campaign.HandleEvent(ctx, p.match(t, "m-2", coordinate, 870503))
+	if stats := campaign.Stats(); stats.Spent != 900 || stats.Reserved != 1000 {
+		t.Errorf("expected the stale payment to be dropped, got %+v", stats)
+	}
+}
+
+func TestEscalatingBid(t *testing.T) {
+	strategy := EscalatingBid(1000, 250, 1600)
+	for blocks, want := range map[int64]int64{0: 1000, 1: 1250, 2: 1500, 3: 1600, 10: 1600} {
+		if got := strategy.Bid(BidState{BlocksSinceMatch: blocks}); got != want {
+			t.Errorf("after %d blocks: got %d, want %d", blocks, got, want)
+		}
+	}
+}
+
+func TestCampaign_Run(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	pool, err := relay.NewPool([]string{mock.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	p := newParticipants()
+	clock := nostr.GeneratePrivateKey()
+	clock_pubkey, _ := nostr.GetPublicKey(clock)
+	campaign := newTestCampaign(t, p, pool, Options{Budget: 1000, BlockCap: 1000, ClockPubkey: clock_pubkey})
+	coordinate := campaign.Coordinates()[0]
+
+	block := func(key string, height int64) *nostr.Event {
+		return sign(t, key, &nostr.Event{Kind: core.KindCityBlock, Content: fmt.Sprintf(`{"block_height":%d}`, height)})
+	}
+	incoming := make(chan *nostr.Event, 8)
+	incoming <- block(clock, 870500)
+	incoming <- block(clock, 870501)
+	incoming <- block(nostr.GeneratePrivateKey(), 870900) // not the clock: ignored
+	incoming <- p.match(t, "m-1", coordinate, 870501)
+	incoming <- p.payment(t, p.attention, "m-1", 1000)
+	incoming <- block(clock, 870502)
+
+	if err := campaign.Run(ctx, incoming); err != nil {
+		t.Fatal(err)
+	}
+	if !campaign.Stats().Exhausted {
+		t.Fatal("expected Run to return once the budget is exhausted")
+	}
+
+	current, err := mock.Store().GetByCoordinate(ctx, coordinate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := current.Tags.Find("t"); got[1] != "870501" {
+		t.Errorf("expected the relay to hold the PROMOTION for block 870501, got %v", got)
+	}
+}
+
+// publisherFunc adapts a function to the Publisher interface.
+type publisherFunc func(ctx context.Context, event *nostr.Event) error
+
+func (f publisherFunc) Publish(ctx context.Context, event *nostr.Event) error {
+	return f(ctx, event)
+}
+
+func TestCampaign_PublishesOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	var campaign *Campaign
+	var seen Stats
+	campaign = newTestCampaign(t, p, publisherFunc(func(context.Context, *nostr.Event) error {
+		seen = campaign.Stats() // deadlocks if Publish runs under the lock
+		return nil
+	}), Options{Budget: 10000, BlockCap: 5000})
+
+	done := make(chan error, 1)
+	go func() { done <- campaign.OnBlock(ctx, 870500) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnBlock held the lock while publishing")
+	}
+	if seen.BlockHeight != 870500 {
+		t.Errorf("expected the publisher to see block 870500, got %d", seen.BlockHeight)
+	}
+}
+
+func TestCampaign_RetriesFailedPublish(t *testing.T) {
+	ctx := context.Background()
+	p := newParticipants()
+	published := &recorder{}
+	failing := true
+	campaign := newTestCampaign(t, p, publisherFunc(func(ctx context.Context, event *nostr.Event) error {
+		if failing {
+			return fmt.Errorf("relay unavailable")
+		}
+		return published.Publish(ctx, event)
+	}), Options{Budget: 10000, BlockCap: 5000})
+
+	if err := campaign.OnBlock(ctx, 870500); err == nil {
+		t.Fatal("expected the failed publish to be reported")
+	}
+
+	// The failed PROMOTION is not live, so the next event publishes it again
+	failing = false
+	if err := campaign.HandleEvent(ctx, p.payment(t, p.attention, "m-unknown", 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if got := published.published(); len(got) != 1 || bidOf(t, got[0]) != 1000 {
+		t.Fatalf("expected the PROMOTION to be re-published, got %d events", len(got))
+	}
+}
@@ -0,0 +1,55 @@
+package campaign
+
+// BidState is what a BidStrategy knows when choosing the bid for one target at a block.
+type BidState struct {
+	// BlockHeight is the block the PROMOTION is published for.
+	BlockHeight int64
+
+	// Target is the marketplace and billboard the PROMOTION is published to.
+	Target Target
+
+	// LastBid is the target's previous bid, or 0 before its first PROMOTION.
+	LastBid int64
+
+	// BlocksSinceMatch counts blocks published for the target since its last
+	// match, or since its first PROMOTION if it has never been matched.
+	BlocksSinceMatch int64
+
+	// Available is the most the campaign can commit to one match right now: the
+	// smaller of the unreserved budget and what is left of the block's spend cap.
+	Available int64
+}
+
+// BidStrategy chooses the bid for a target's next PROMOTION.
+// The campaign caps the returned bid at BidState.Available and skips the
+// target for the block when the bid is not positive.
+type BidStrategy interface {
+	Bid(state BidState) int64
+}
+
+// BidStrategyFunc adapts a function to the BidStrategy interface.
+type BidStrategyFunc func(state BidState) int64
+
+// Bid calls f(state).
+func (f BidStrategyFunc) Bid(state BidState) int64 {
+	return f(state)
+}
+
+// FixedBid bids the same amount at every block.
+func FixedBid(sats int64) BidStrategy {
+	return BidStrategyFunc(func(BidState) int64 {
+		return sats
+	})
+}
+
+// EscalatingBid starts at start sats and raises the bid by step for every block
+// a target goes unmatched, up to max. A match resets the target to start.
+func EscalatingBid(start, step, max int64) BidStrategy {
+	return BidStrategyFunc(func(state BidState) int64 {
+		bid := start + step*state.BlocksSinceMatch
+		if bid > max {
+			return max
+		}
+		return bid
+	})
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	core "github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+	"gopkg.in/yaml.v3"
+)
+
+// builder creates a signed event from a params struct.
+type builder struct {
+	params func() interface{}
+	build  func(private_key string, params interface{}) (*nostr.Event, error)
+}
+
+// builders lists the kinds the SDK can build.
+var builders = map[int]builder{
+	core.KindMarketplace: {
+		params: func() interface{} { return &events.MarketplaceParams{} },
+		build: func(private_key string, params interface{}) (*nostr.Event, error) {
+			return events.CreateMarketplace(private_key, *params.(*events.MarketplaceParams))
+		},
+	},
+	core.KindPromotion: {
+		params: func() interface{} { return &events.PromotionParams{} },
+		build: func(private_key string, params interface{}) (*nostr.Event, error) {
+			return events.CreatePromotion(private_key, *params.(*events.PromotionParams))
+		},
+	},
+	core.KindAttention: {
+		params: func() interface{} { return &events.AttentionParams{} },
+		build: func(private_key string, params interface{}) (*nostr.Event, error) {
+			return events.CreateAttention(private_key, *params.(*events.AttentionParams))
+		},
+	},
+	core.KindMatch: {
+		params: func() interface{} { return &events.MatchParams{} },
+		build: func(private_key string, params interface{}) (*nostr.Event, error) {
+			return events.CreateMatch(private_key, *params.(*events.MatchParams))
+		},
+	},
+}
+
+// runBuild builds and signs an event, printing it as a single JSON line.
+// Params come from a YAML/JSON file (-f) and per-field flags; flags win.
+func runBuild(c *cli, args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintf(c.stderr, "Usage: attn build <kind> [-f params.yaml] [-key key] [-<param> value...]\nKinds: %s\n", strings.Join(buildableKinds(), ", "))
+		return 2
+	}
+
+	kind, err := parseKind(args[0])
+	if err != nil {
+		c.errorf("build", "%v", err)
+		return 2
+	}
+	b, ok := builders[kind]
+	if !ok {
+		c.errorf("build", "kind %d cannot be built; supported kinds: %s", kind, strings.Join(buildableKinds(), ", "))
+		return 2
+	}
+
+	params := b.params()
+	flags := flag.NewFlagSet("build "+args[0], flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	params_file := flags.String("f", "", "YAML or JSON params file")
+	key := flags.String("key", "", "private key as hex or nsec (default $ATTN_PRIVATE_KEY)")
+
+	// Flags are applied after the params file so they override it
+	var overrides []func() error
+	for _, field := range paramFields(params) {
+		field := field
+		flags.Func(field.flag_name, field.usage, func(value string) error {
+			overrides = append(overrides, func() error { return field.set(value) })
+			return nil
+		})
+	}
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	if *params_file != "" {
+		if err := loadParamsFile(params, *params_file); err != nil {
+			c.errorf("build", "%v", err)
+			return 1
+		}
+	}
+	for _, override := range overrides {
+		if err := override(); err != nil {
+			c.errorf("build", "%v", err)
+			return 2
+		}
+	}
+
+	private_key, err := c.loadPrivateKey(*key)
+	if err != nil {
+		c.errorf("build", "%v", err)
+		return 1
+	}
+
+	event, err := b.build(private_key, params)
+	if err != nil {
+		c.errorf("build", "%v", err)
+		return 1
+	}
+
+	// Print the event even when it fails validation; the warning says why a relay would reject it
+	if result := validation.ValidateATTNEvent(event); !result.Valid {
+		fmt.Fprintf(c.stderr, "warning: built event does not pass validation: %s\n", result.Message)
+	}
+	if err := writeEvent(c.stdout, event); err != nil {
+		c.errorf("build", "%v", err)
+		return 1
+	}
+	return 0
+}
+
+// buildableKinds returns the names of the kinds runBuild supports.
+func buildableKinds() []string {
+	names := make([]string, 0, len(builders))
+	for kind := range builders {
+		names = append(names, kindName(kind))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// paramField is a settable field of a params struct.
+type paramField struct {
+	flag_name string
+	usage     string
+	value     reflect.Value
+	parse     func(value string) (interface{}, error) // set for interface-typed fields
+}
+
+// interfaceParam says how to set an interface-typed params field from a string.
+type interfaceParam struct {
+	flag_name string // replaces the field's kebab-case name when set
+	usage     string
+	parse     func(value string) (interface{}, error)
+}
+
+// interfaceParams lists the interface-typed params fields the CLI can set.
+// paramFields leaves out any other interface-typed field.
+var interfaceParams = map[reflect.Type]interfaceParam{
+	reflect.TypeOf((*events.IDStrategy)(nil)).Elem(): {
+		usage: "IDStrategy: content-hash, references or idempotency-key=<key>",
+		parse: parseIDStrategy,
+	},
+	reflect.TypeOf((*events.Clock)(nil)).Elem(): {
+		flag_name: "created-at",
+		usage:     "created_at as unix seconds (default now)",
+		parse:     parseCreatedAt,
+	},
+}
+
+// paramFields lists the settable fields of a params struct pointer.
+func paramFields(params interface{}) []paramField {
+	value := reflect.ValueOf(params).Elem()
+	fields := make([]paramField, 0, value.NumField())
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		param := paramField{
+			flag_name: kebabCase(field.Name),
+			usage:     fmt.Sprintf("%s (%s)", field.Name, field.Type),
+			value:     value.Field(i),
+		}
+		if field.Type.Kind() == reflect.Interface {
+			known, ok := interfaceParams[field.Type]
+			if !ok {
+				continue
+			}
+			param.usage, param.parse = known.usage, known.parse
+			if known.flag_name != "" {
+				param.flag_name = known.flag_name
+			}
+		}
+		fields = append(fields, param)
+	}
+	return fields
+}
+
+// parseIDStrategy maps an -id-strategy value to an events.IDStrategy.
+func parseIDStrategy(value string) (interface{}, error) {
+	name, key, has_key := strings.Cut(value, "=")
+	switch {
+	case name == "content-hash" && !has_key:
+		return events.ContentHash(), nil
+	case name == "references" && !has_key:
+		return events.References(), nil
+	case name == "idempotency-key" && key != "":
+		return events.IdempotencyKey(key), nil
+	}
+	return nil, fmt.Errorf("%q is not content-hash, references or idempotency-key=<key>", value)
+}
+
+// parseCreatedAt maps a -created-at unix time to a clock fixed at it.
+func parseCreatedAt(value string) (interface{}, error) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return nil, fmt.Errorf("%q is not a unix time in seconds", value)
+	}
+	return events.FixedClock(time.Unix(seconds, 0)), nil
+}
+
+// set parses value into the field. List fields append, so a flag can repeat.
+func (f paramField) set(value string) error {
+	if f.parse != nil {
+		parsed, err := f.parse(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", f.flag_name, err)
+		}
+		f.value.Set(reflect.ValueOf(parsed))
+		return nil
+	}
+	switch f.value.Kind() {
+	case reflect.String:
+		f.value.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %q is not an integer", f.flag_name, value)
+		}
+		f.value.SetInt(n)
+	case reflect.Slice:
+		element := reflect.New(f.value.Type().Elem()).Elem()
+		if err := (paramField{flag_name: f.flag_name, value: element}).set(value); err != nil {
+			return err
+		}
+		f.value.Set(reflect.Append(f.value, element))
+	default:
+		return fmt.Errorf("%s: unsupported field type %s", f.flag_name, f.value.Type())
+	}
+	return nil
+}
+
+// loadParamsFile reads YAML or JSON params into a params struct pointer.
+// Keys match field names in any case, with or without '_' or '-' separators,
+// so "marketplace_coordinate", "marketplace-coordinate" and
+// "MarketplaceCoordinate" are equivalent.
+func loadParamsFile(params interface{}, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so one decoder handles both
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	fields := make(map[string]paramField)
+	for _, field := range paramFields(params) {
+		fields[normalizeParamName(field.flag_name)] = field
+	}
+
+	for key, raw := range values {
+		field, ok := fields[normalizeParamName(key)]
+		if !ok {
+			return fmt.Errorf("%s: unknown param %q", path, key)
+		}
+		items, is_list := raw.([]interface{})
+		if !is_list {
+			items = []interface{}{raw}
+		}
+		for _, item := range items {
+			if err := field.set(fmt.Sprint(item)); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// normalizeParamName lowercases a name and drops '_' and '-' separators.
+func normalizeParamName(name string) string {
+	name = strings.ReplaceAll(name, "_", "")
+	name = strings.ReplaceAll(name, "-", "")
+	return strings.ToLower(name)
+}
+
+// kebabCase converts a Go field name to a flag name: CallToActionURL -> call-to-action-url.
+func kebabCase(name string) string {
+	runes := []rune(name)
+	var builder strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			previous_lower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			acronym_end := unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previous_lower || acronym_end {
+				builder.WriteRune('-')
+			}
+		}
+		builder.WriteRune(unicode.ToLower(r))
+	}
+	return builder.String()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runInspect pretty-prints events with their parsed content and coordinates.
+func runInspect(c *cli, args []string) int {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: attn inspect [file...]")
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	events, err := c.readEvents(flags.Args())
+	if err != nil {
+		c.errorf("inspect", "%v", err)
+		return 1
+	}
+
+	for i, event := range events {
+		if i > 0 {
+			fmt.Fprintln(c.stdout)
+		}
+		inspectEvent(c.stdout, event)
+	}
+	return 0
+}
+
+// inspectEvent writes a human-readable description of one event.
+func inspectEvent(w io.Writer, event *nostr.Event) {
+	kind := strconv.Itoa(event.Kind)
+	if name := kindName(event.Kind); name != "" {
+		kind += " (" + name + ")"
+	}
+
+	fmt.Fprintf(w, "Event       %s\n", event.ID)
+	fmt.Fprintf(w, "Kind        %s\n", kind)
+	fmt.Fprintf(w, "Pubkey      %s\n", event.PubKey)
+	fmt.Fprintf(w, "Created     %s (%d)\n", event.CreatedAt.Time().UTC().Format(time.RFC3339), event.CreatedAt)
+	if d_tag := event.Tags.GetD(); d_tag != "" || nostr.IsAddressableKind(event.Kind) {
+		fmt.Fprintf(w, "Coordinate  %d:%s:%s\n", event.Kind, event.PubKey, d_tag)
+	}
+
+	report := checkEvent(event, true)
+	status := "valid"
+	if !report.Valid {
+		status = "INVALID"
+	}
+	fmt.Fprintf(w, "Validation  %s: %s\n", status, report.Message)
+
+	fmt.Fprintln(w, "\nTags")
+	for _, tag := range event.Tags {
+		fmt.Fprintf(w, "  %s\n", strings.Join(tag, "  "))
+	}
+
+	if references := coordinateReferences(event); len(references) > 0 {
+		fmt.Fprintln(w, "\nReferences")
+		for _, reference := range references {
+			fmt.Fprintf(w, "  %s\n", reference)
+		}
+	}
+
+	fmt.Fprintln(w, "\nContent")
+	var pretty bytes.Buffer
+	if err := json.Indent(&pretty, []byte(event.Content), "  ", "  "); err == nil {
+		fmt.Fprintf(w, "  %s\n", pretty.String())
+	} else {
+		fmt.Fprintf(w, "  %s\n", event.Content)
+	}
+}
+
+// coordinateReferences describes each 'a' tag as kind name, pubkey and d tag.
+func coordinateReferences(event *nostr.Event) []string {
+	var references []string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		kind, pubkey, d_tag, err := events.ParseCoordinate(tag[1])
+		if err != nil {
+			references = append(references, fmt.Sprintf("%-30s  (malformed coordinate %q)", "?", tag[1]))
+			continue
+		}
+		name := strconv.Itoa(kind)
+		if kindName(kind) != "" {
+			name = kindName(kind)
+		}
+		references = append(references, fmt.Sprintf("%-30s  pubkey=%s d=%s", name, pubkey, d_tag))
+	}
+	return references
+}
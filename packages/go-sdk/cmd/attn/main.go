@@ -0,0 +1,227 @@
+// Command attn builds, validates, publishes, queries and inspects ATTN Protocol events.
+//
+// Usage:
+//
+//	attn validate [-skip-sig] [file...]      validate events from files or stdin
+//	attn build <kind> [-f params.yaml] [...]  build and sign an event
+//	attn publish -relay <url> [file...]       publish events to relays
+//	attn query -relay <url> [filter flags]    fetch events by filter
+//	attn inspect [file...]                    pretty-print events
+//
+// Input files and stdin may hold a single JSON event, a JSON array of events
+// or JSONL (one event per line). Private keys are read from -key or the
+// ATTN_PRIVATE_KEY environment variable, as hex or nsec.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	core "github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// cli holds the process streams so commands can be run from tests.
+type cli struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+}
+
+// command is a subcommand entry point. It returns the process exit code.
+type command func(c *cli, args []string) int
+
+var commands = map[string]command{
+	"validate": runValidate,
+	"build":    runBuild,
+	"publish":  runPublish,
+	"query":    runQuery,
+	"inspect":  runInspect,
+}
+
+func main() {
+	c := &cli{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr, getenv: os.Getenv}
+	os.Exit(c.run(os.Args[1:]))
+}
+
+// run dispatches to a subcommand.
+func (c *cli) run(args []string) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.usage()
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(c.stderr, "attn: unknown command %q\n\n", args[0])
+		c.usage()
+		return 2
+	}
+	return cmd(c, args[1:])
+}
+
+// usage prints the top-level help.
+func (c *cli) usage() {
+	fmt.Fprint(c.stderr, `Usage: attn <command> [flags]
+
+Commands:
+  validate   validate events from files or stdin and print results
+  build      build and sign an event of the given kind
+  publish    publish events to relays
+  query      fetch events from relays by filter
+  inspect    pretty-print events with parsed content and coordinates
+
+Run 'attn <command> -h' for command flags.
+`)
+}
+
+// errorf prints an error prefixed with the command name.
+func (c *cli) errorf(command string, format string, args ...interface{}) {
+	fmt.Fprintf(c.stderr, "attn %s: %s\n", command, fmt.Sprintf(format, args...))
+}
+
+// kindNames maps ATTN and City Protocol kinds to their names.
+var kindNames = map[int]string{
+	core.KindMarketplace:                  "marketplace",
+	core.KindBillboard:                    "billboard",
+	core.KindPromotion:                    "promotion",
+	core.KindAttention:                    "attention",
+	core.KindBillboardConfirmation:        "billboard-confirmation",
+	core.KindAttentionConfirmation:        "attention-confirmation",
+	core.KindMarketplaceConfirmation:      "marketplace-confirmation",
+	core.KindMatch:                        "match",
+	core.KindAttentionPaymentConfirmation: "attention-payment-confirmation",
+	core.KindCityBlock:                    "block",
+}
+
+// kindName returns the name for a kind, or "" for unknown kinds.
+func kindName(kind int) string {
+	return kindNames[kind]
+}
+
+// parseKind parses a kind given as a name ("promotion") or a number ("38388").
+func parseKind(value string) (int, error) {
+	if kind, err := strconv.Atoi(value); err == nil {
+		return kind, nil
+	}
+	name := strings.ToLower(strings.ReplaceAll(value, "_", "-"))
+	for kind, kind_name := range kindNames {
+		if kind_name == name {
+			return kind, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown kind %q", value)
+}
+
+// loadPrivateKey returns the hex private key from the flag value or ATTN_PRIVATE_KEY.
+func (c *cli) loadPrivateKey(flag_value string) (string, error) {
+	key := flag_value
+	if key == "" {
+		key = c.getenv("ATTN_PRIVATE_KEY")
+	}
+	if key == "" {
+		return "", fmt.Errorf("no private key: pass -key or set ATTN_PRIVATE_KEY")
+	}
+
+	if strings.HasPrefix(key, "nsec") {
+		prefix, value, err := nip19.Decode(key)
+		if err != nil || prefix != "nsec" {
+			return "", fmt.Errorf("invalid nsec private key")
+		}
+		return value.(string), nil
+	}
+	if !nostr.IsValid32ByteHex(key) {
+		return "", fmt.Errorf("private key must be 64 hex characters or nsec")
+	}
+	return key, nil
+}
+
+// readEvents reads events from the named files, or stdin when there are none.
+func (c *cli) readEvents(paths []string) ([]*nostr.Event, error) {
+	if len(paths) == 0 {
+		return decodeEvents(c.stdin, "stdin")
+	}
+
+	var events []*nostr.Event
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		file_events, err := decodeEvents(file, path)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, file_events...)
+	}
+	return events, nil
+}
+
+// decodeEvents decodes a JSON event, a JSON array of events or JSONL.
+func decodeEvents(reader io.Reader, source string) ([]*nostr.Event, error) {
+	data, err := io.ReadAll(bufio.NewReader(reader))
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	if data[0] == '[' {
+		var events []*nostr.Event
+		if err := json.Unmarshal(data, &events); err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		return events, nil
+	}
+
+	var events []*nostr.Event
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		event := &nostr.Event{}
+		if err := decoder.Decode(event); err != nil {
+			return nil, fmt.Errorf("%s: event %d: %w", source, len(events)+1, err)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// writeEvent writes an event as a single JSON line.
+func writeEvent(writer io.Writer, event *nostr.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(writer, string(data))
+	return err
+}
+
+// stringList is a repeatable flag. Comma-separated values are split.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
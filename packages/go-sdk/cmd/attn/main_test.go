@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runCLI runs the CLI with the given stdin and returns the exit code, stdout and stderr.
+func runCLI(t *testing.T, stdin string, env map[string]string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	c := &cli{
+		stdin:  strings.NewReader(stdin),
+		stdout: &stdout,
+		stderr: &stderr,
+		getenv: func(key string) string { return env[key] },
+	}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+// createSignedNote creates a signed kind 1 event.
+func createSignedNote(t *testing.T, content string) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: content, Tags: nostr.Tags{}}
+	if err := event.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	return event
+}
+
+// toJSONL encodes events one per line.
+func toJSONL(t *testing.T, events ...*nostr.Event) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	for _, event := range events {
+		if err := writeEvent(&buffer, event); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+	}
+	return buffer.String()
+}
+
+func TestBuild_WithParamsFileAndFlags(t *testing.T) {
+	params := filepath.Join(t.TempDir(), "attention.yaml")
+	err := os.WriteFile(params, []byte(`
+ask: 3000
+min_duration: 15000
+max-duration: 60000
+BlockHeight: 870500
+attention_id: org.attnprotocol:attention:from-file
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{"ATTN_PRIVATE_KEY": nostr.GeneratePrivateKey()}
+	code, stdout, stderr := runCLI(t, "", env, "build", "attention", "-f", params, "-ask", "4000")
+	if code != 0 {
+		t.Fatalf("build exited %d: %s", code, stderr)
+	}
+
+	events, err := decodeEvents(strings.NewReader(stdout), "stdout")
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one event on stdout, got %v: %q", err, stdout)
+	}
+	event := events[0]
+	if event.Kind != 38488 || event.Tags.GetD() != "org.attnprotocol:attention:from-file" {
+		t.Errorf("unexpected event: kind %d d %q", event.Kind, event.Tags.GetD())
+	}
+	if !strings.Contains(event.Content, `"ask":4000`) || !strings.Contains(event.Content, `"max_duration":60000`) {
+		t.Errorf("expected flag to override file and file values to apply, got %s", event.Content)
+	}
+	if ok, _ := event.CheckSignature(); !ok {
+		t.Error("expected built event to be signed")
+	}
+}
+
+func TestBuild_Errors(t *testing.T) {
+	if code, _, _ := runCLI(t, "", nil, "build", "billboard-confirmation"); code != 2 {
+		t.Errorf("expected exit 2 for a kind without a builder, got %d", code)
+	}
+	if code, _, stderr := runCLI(t, "", nil, "build", "promotion"); code != 1 || !strings.Contains(stderr, "ATTN_PRIVATE_KEY") {
+		t.Errorf("expected missing key error, got %d %q", code, stderr)
+	}
+	env := map[string]string{"ATTN_PRIVATE_KEY": nostr.GeneratePrivateKey()}
+	if code, _, _ := runCLI(t, "", env, "build", "promotion", "-bid", "lots"); code != 2 {
+		t.Errorf("expected exit 2 for a non-integer bid, got %d", code)
+	}
+	if code, _, _ := runCLI(t, "", env, "build", "promotion", "-id-strategy", "random"); code != 2 {
+		t.Errorf("expected exit 2 for an unknown ID strategy, got %d", code)
+	}
+}
+
+func TestBuild_IDStrategy(t *testing.T) {
+	env := map[string]string{"ATTN_PRIVATE_KEY": nostr.GeneratePrivateKey()}
+	d_tag := func(args ...string) string {
+		t.Helper()
+		code, stdout, stderr := runCLI(t, "", env, append([]string{"build", "promotion", "-block-height", "870500"}, args...)...)
+		if code != 0 {
+			t.Fatalf("build exited %d: %s", code, stderr)
+		}
+		events, err := decodeEvents(strings.NewReader(stdout), "stdout")
+		if err != nil || len(events) != 1 {
+			t.Fatalf("expected one event on stdout, got %v: %q", err, stdout)
+		}
+		return events[0].Tags.GetD()
+	}
+
+	keyed := d_tag("-bid", "1000", "-id-strategy", "idempotency-key=order-42")
+	if d_tag("-bid", "2000", "-id-strategy", "idempotency-key=order-42") != keyed {
+		t.Error("expected the same idempotency key to give the same d tag")
+	}
+	if d_tag("-bid", "1000", "-id-strategy", "content-hash") == keyed {
+		t.Error("expected content-hash to derive another d tag")
+	}
+	d_tag("-id-strategy", "references")
+}
+
+func TestBuild_CreatedAt(t *testing.T) {
+	env := map[string]string{"ATTN_PRIVATE_KEY": nostr.GeneratePrivateKey()}
+	code, stdout, stderr := runCLI(t, "", env, "build", "promotion", "-block-height", "870500", "-created-at", "1732104000")
+	if code != 0 {
+		t.Fatalf("build exited %d: %s", code, stderr)
+	}
+	events, err := decodeEvents(strings.NewReader(stdout), "stdout")
+	if err != nil || len(events) != 1 || events[0].CreatedAt != 1732104000 {
+		t.Fatalf("expected created_at 1732104000, got %v: %q", err, stdout)
+	}
+	if code, _, _ := runCLI(t, "", env, "build", "promotion", "-created-at", "yesterday"); code != 2 {
+		t.Errorf("expected exit 2 for a malformed created-at, got %d", code)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := createSignedNote(t, "hello")
+	tampered := createSignedNote(t, "hello")
+	tampered.Content = "changed"
+
+	code, stdout, _ := runCLI(t, toJSONL(t, valid, tampered), nil, "validate")
+	if code != 1 {
+		t.Errorf("expected exit 1 when an event is invalid, got %d", code)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "valid ") || !strings.HasPrefix(lines[1], "INVALID ") {
+		t.Errorf("unexpected output: %q", stdout)
+	}
+
+	// JSON arrays are accepted too, and -skip-sig ignores the tampered content
+	array := "[" + strings.ReplaceAll(strings.TrimSpace(toJSONL(t, valid, tampered)), "\n", ",") + "]"
+	if code, _, _ := runCLI(t, array, nil, "validate", "-skip-sig"); code != 0 {
+		t.Errorf("expected exit 0 with -skip-sig, got %d", code)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	event := &nostr.Event{
+		Kind:      38488,
+		CreatedAt: nostr.Now(),
+		Content:   `{"ask":3000}`,
+		Tags: nostr.Tags{
+			{"d", "org.attnprotocol:attention:a1"},
+			{"a", "38188:abc:org.attnprotocol:marketplace:m1"},
+		},
+	}
+	event.Sign(nostr.GeneratePrivateKey())
+
+	code, stdout, _ := runCLI(t, toJSONL(t, event), nil, "inspect")
+	if code != 0 {
+		t.Fatalf("inspect exited %d", code)
+	}
+	for _, want := range []string{
+		"38488 (attention)",
+		"Coordinate  38488:" + event.PubKey + ":org.attnprotocol:attention:a1",
+		"Validation  INVALID",
+		"marketplace",
+		`"ask": 3000`,
+	} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, stdout)
+		}
+	}
+}
+
+func TestPublishAndQuery(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+
+	note := createSignedNote(t, "hello")
+	code, stdout, stderr := runCLI(t, toJSONL(t, note), nil, "publish", "-relay", mock.URL())
+	if code != 0 || !strings.HasPrefix(stdout, "ok "+note.ID) {
+		t.Fatalf("publish exited %d: %q %q", code, stdout, stderr)
+	}
+
+	mock.RejectNext("blocked: not today")
+	code, stdout, _ = runCLI(t, toJSONL(t, createSignedNote(t, "again")), nil, "publish", "-relay", mock.URL())
+	if code != 1 || !strings.Contains(stdout, "blocked: not today") {
+		t.Errorf("expected relay rejection to be reported, got %d %q", code, stdout)
+	}
+
+	code, stdout, stderr = runCLI(t, "", nil, "query", "-relay", mock.URL(), "-kind", "1", "-author", note.PubKey)
+	if code != 0 {
+		t.Fatalf("query exited %d: %s", code, stderr)
+	}
+	events, err := decodeEvents(strings.NewReader(stdout), "stdout")
+	if err != nil || len(events) != 1 || events[0].ID != note.ID {
+		t.Errorf("expected the published note, got %v %q", err, stdout)
+	}
+}
+
+func TestPublish_SkipsInvalidEvents(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+
+	tampered := createSignedNote(t, "hello")
+	tampered.Content = "changed"
+	code, stdout, _ := runCLI(t, toJSONL(t, tampered), nil, "publish", "-relay", mock.URL())
+	if code != 1 || !strings.HasPrefix(stdout, "skipped ") {
+		t.Errorf("expected invalid event to be skipped, got %d %q", code, stdout)
+	}
+	if len(mock.Received()) != 0 {
+		t.Error("expected nothing to reach the relay")
+	}
+}
+
+func TestBuildFilter(t *testing.T) {
+	filter, err := buildFilter([]string{"promotion", "38488"}, nil, nil, []string{"x"}, []string{"t=870500", "t=870501"})
+	if err != nil {
+		t.Fatalf("buildFilter: %v", err)
+	}
+	if len(filter.Kinds) != 2 || filter.Kinds[0] != 38388 || filter.Kinds[1] != 38488 {
+		t.Errorf("unexpected kinds: %v", filter.Kinds)
+	}
+	if len(filter.Tags["t"]) != 2 || filter.Tags["d"][0] != "x" {
+		t.Errorf("unexpected tags: %v", filter.Tags)
+	}
+	if _, err := buildFilter(nil, nil, nil, nil, []string{"novalue"}); err == nil {
+		t.Error("expected error for tag filter without '='")
+	}
+}
+
+func TestKebabCase(t *testing.T) {
+	tests := map[string]string{
+		"Bid":                   "bid",
+		"CallToActionURL":       "call-to-action-url",
+		"EscrowIDList":          "escrow-id-list",
+		"MarketplaceCoordinate": "marketplace-coordinate",
+	}
+	for input, expected := range tests {
+		if got := kebabCase(input); got != expected {
+			t.Errorf("kebabCase(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+)
+
+// runPublish publishes events to every relay and prints one line per relay.
+// Exits 1 when an event is accepted by no relay.
+func runPublish(c *cli, args []string) int {
+	flags := flag.NewFlagSet("publish", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	var relays stringList
+	flags.Var(&relays, "relay", "relay URL (repeatable or comma-separated)")
+	timeout := flags.Duration("timeout", 10*time.Second, "timeout per event")
+	force := flags.Bool("force", false, "publish events that fail local validation")
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: attn publish -relay <url> [-timeout 10s] [-force] [file...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(relays) == 0 {
+		c.errorf("publish", "at least one -relay is required")
+		return 2
+	}
+
+	events, err := c.readEvents(flags.Args())
+	if err != nil {
+		c.errorf("publish", "%v", err)
+		return 1
+	}
+
+	exit_code := 0
+	for _, event := range events {
+		// Catch locally what the relay would reject, unless asked not to
+		if report := checkEvent(event, true); !report.Valid && !*force {
+			fmt.Fprintf(c.stdout, "skipped %s: %s (use -force to publish anyway)\n", event.ID, report.Message)
+			exit_code = 1
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		results, err := relay.PublishToMultiple(ctx, event, relays)
+		cancel()
+		if err != nil {
+			exit_code = 1
+		}
+		if results == nil {
+			c.errorf("publish", "%v", err)
+			continue
+		}
+
+		for _, result := range results.Results {
+			if result.Success {
+				fmt.Fprintf(c.stdout, "ok %s %s\n", event.ID, result.RelayURL)
+			} else {
+				fmt.Fprintf(c.stdout, "rejected %s %s: %v\n", event.ID, result.RelayURL, result.Error)
+			}
+		}
+	}
+	return exit_code
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// runQuery fetches events matching a filter and prints them as JSONL, newest first.
+func runQuery(c *cli, args []string) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	var relays, kinds, authors, ids, d_tags, tags stringList
+	flags.Var(&relays, "relay", "relay URL (repeatable or comma-separated)")
+	flags.Var(&kinds, "kind", "event kind as name or number (repeatable)")
+	flags.Var(&authors, "author", "author pubkey (repeatable)")
+	flags.Var(&ids, "id", "event ID (repeatable)")
+	flags.Var(&d_tags, "d", "d tag value (repeatable)")
+	flags.Var(&tags, "tag", "tag filter as name=value, e.g. t=870500 (repeatable)")
+	since := flags.Int64("since", 0, "only events created at or after this unix time")
+	until := flags.Int64("until", 0, "only events created at or before this unix time")
+	limit := flags.Int("limit", 100, "maximum events per relay")
+	timeout := flags.Duration("timeout", 10*time.Second, "query timeout")
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: attn query -relay <url> [-kind promotion] [-author pubkey] [-tag t=870500] [...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if len(relays) == 0 {
+		c.errorf("query", "at least one -relay is required")
+		return 2
+	}
+
+	filter, err := buildFilter(kinds, authors, ids, d_tags, tags)
+	if err != nil {
+		c.errorf("query", "%v", err)
+		return 2
+	}
+	if *since > 0 {
+		timestamp := nostr.Timestamp(*since)
+		filter.Since = &timestamp
+	}
+	if *until > 0 {
+		timestamp := nostr.Timestamp(*until)
+		filter.Until = &timestamp
+	}
+	filter.Limit = *limit
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	pool, err := relay.NewPool(relays)
+	if err != nil {
+		c.errorf("query", "%v", err)
+		return 1
+	}
+	defer pool.Close()
+
+	if err := pool.Connect(ctx); err != nil {
+		c.errorf("query", "%v", err)
+		return 1
+	}
+	if connected := pool.ConnectedCount(); connected < len(relays) {
+		fmt.Fprintf(c.stderr, "warning: connected to %d of %d relays\n", connected, len(relays))
+	}
+
+	events, err := pool.Query(ctx, filter)
+	if err != nil {
+		c.errorf("query", "%v", err)
+		return 1
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt > events[j].CreatedAt
+	})
+	for _, event := range events {
+		if err := writeEvent(c.stdout, event); err != nil {
+			c.errorf("query", "%v", err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// buildFilter builds a filter from the repeatable query flags.
+func buildFilter(kinds, authors, ids, d_tags, tags []string) (nostr.Filter, error) {
+	filter := nostr.Filter{
+		Authors: authors,
+		IDs:     ids,
+	}
+
+	for _, value := range kinds {
+		kind, err := parseKind(value)
+		if err != nil {
+			return filter, err
+		}
+		filter.Kinds = append(filter.Kinds, kind)
+	}
+
+	tag_map := nostr.TagMap{}
+	if len(d_tags) > 0 {
+		tag_map["d"] = d_tags
+	}
+	for _, tag := range tags {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok || name == "" {
+			return filter, fmt.Errorf("tag filter %q must be name=value", tag)
+		}
+		tag_map[name] = append(tag_map[name], value)
+	}
+	if len(tag_map) > 0 {
+		filter.Tags = tag_map
+	}
+	return filter, nil
+}
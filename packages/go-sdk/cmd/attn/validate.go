@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// validationReport is the result of checking one event.
+type validationReport struct {
+	ID      string `json:"id"`
+	Kind    int    `json:"kind"`
+	Valid   bool   `json:"valid"`
+	Message string `json:"message"`
+}
+
+// runValidate validates events and prints one result per event.
+// Exits 1 when any event is invalid.
+func runValidate(c *cli, args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	skip_sig := flags.Bool("skip-sig", false, "do not check event IDs and signatures")
+	as_json := flags.Bool("json", false, "print results as JSONL")
+	flags.Usage = func() {
+		fmt.Fprintln(c.stderr, "Usage: attn validate [-skip-sig] [-json] [file...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	events, err := c.readEvents(flags.Args())
+	if err != nil {
+		c.errorf("validate", "%v", err)
+		return 1
+	}
+
+	exit_code := 0
+	for _, event := range events {
+		report := checkEvent(event, !*skip_sig)
+		if !report.Valid {
+			exit_code = 1
+		}
+
+		if *as_json {
+			data, _ := json.Marshal(report)
+			fmt.Fprintln(c.stdout, string(data))
+			continue
+		}
+		status := "valid"
+		if !report.Valid {
+			status = "INVALID"
+		}
+		fmt.Fprintf(c.stdout, "%s %s kind=%d: %s\n", status, report.ID, report.Kind, report.Message)
+	}
+	return exit_code
+}
+
+// checkEvent verifies an event's ID and signature, when check_sig is set,
+// and runs ATTN Protocol validation on ATTN kinds.
+func checkEvent(event *nostr.Event, check_sig bool) validationReport {
+	report := validationReport{ID: event.ID, Kind: event.Kind}
+
+	if check_sig {
+		if !event.CheckID() {
+			report.Message = "event id does not match its content"
+			return report
+		}
+		if ok, _ := event.CheckSignature(); !ok {
+			report.Message = "bad signature"
+			return report
+		}
+	}
+
+	if !validation.IsATTNProtocolKind(event.Kind) {
+		report.Valid = true
+		report.Message = "Not an ATTN Protocol event kind, skipped"
+		return report
+	}
+
+	result := validation.ValidateATTNEvent(event)
+	report.Valid = result.Valid
+	report.Message = result.Message
+	return report
+}
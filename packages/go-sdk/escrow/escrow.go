@@ -0,0 +1,281 @@
+// Package escrow tracks the funds backing PROMOTION bids.
+//
+// A PROMOTION names the escrows that fund it in escrow_id_list. A Backend
+// holds escrowed sats, each escrow belonging to the pubkey that deposited it,
+// and only PROMOTION events signed by that pubkey may draw on it. A Tracker
+// reserves a promotion's bid across its escrows when the PROMOTION is
+// published, releases the reservation when the owner of the attention it was
+// matched with publishes an ATTENTION_PAYMENT_CONFIRMATION for it, and refunds
+// it when the promotion expires unmatched or the payment is late. Middleware
+// plugs into a validation.Registry to reject PROMOTION events whose escrows
+// cannot cover their bid.
+//
+// Example usage:
+//
+//	backend := escrow.NewMemoryBackend()
+//	err := backend.Deposit("escrow-1", promoter_pubkey, 50000)
+//
+//	registry := validation.NewDefaultRegistry()
+//	registry.Use(escrow.Middleware(backend))
+//
+//	tracker, err := escrow.NewTracker(escrow.Options{Backend: backend, ClockPubkey: clock_pubkey})
+//	// events carries the clock's block events, and PROMOTION, MATCH and payment confirmation events
+//	err = tracker.Run(ctx, events)
+package escrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrInsufficientFunds is returned when escrows cannot cover a reservation.
+	ErrInsufficientFunds = errors.New("escrow funds do not cover the amount")
+
+	// ErrAlreadyReserved is returned when a promotion already holds a reservation.
+	ErrAlreadyReserved = errors.New("promotion already has a reservation")
+
+	// ErrNoReservation is returned when a promotion holds no reservation.
+	ErrNoReservation = errors.New("promotion has no reservation")
+
+	// ErrInvalidAmount is returned when a reservation amount is not positive.
+	ErrInvalidAmount = errors.New("reservation amount must be positive")
+
+	// ErrNotEscrowOwner is returned when an escrow belongs to another pubkey.
+	ErrNotEscrowOwner = errors.New("escrow belongs to another pubkey")
+)
+
+// State is the state of a reservation.
+type State string
+
+const (
+	// StateReserved means the funds are held for the promotion.
+	StateReserved State = "reserved"
+
+	// StateReleased means the funds were paid out for a confirmed payment.
+	StateReleased State = "released"
+
+	// StateRefunded means the funds returned to their escrows.
+	StateRefunded State = "refunded"
+)
+
+// Hold is the part of a reservation drawn from one escrow.
+type Hold struct {
+	EscrowID string
+	Amount   int64
+}
+
+// Reservation is the funds held for one promotion.
+type Reservation struct {
+	// PromotionCoordinate is the promotion coordinate (38388:pubkey:d_tag).
+	PromotionCoordinate string
+
+	// Amount is the total held, the sum of Holds.
+	Amount int64
+	Holds  []Hold
+
+	State State
+}
+
+// Backend holds escrowed funds. Implementations must be safe for concurrent use.
+type Backend interface {
+	// Available returns the sats of an escrow not held by any reservation.
+	// An unknown escrow has none available.
+	Available(ctx context.Context, escrow_id string) (int64, error)
+
+	// Owner returns the pubkey an escrow belongs to, or "" for an unknown escrow.
+	Owner(ctx context.Context, escrow_id string) (string, error)
+
+	// Reserve holds amount sats for a promotion signed by owner, drawing on
+	// escrow_ids in order. Holding nothing, it returns ErrNotEscrowOwner when
+	// an escrow belongs to another pubkey and ErrInsufficientFunds when the
+	// escrows cannot cover amount. It returns ErrAlreadyReserved when the
+	// promotion already holds a reservation.
+	Reserve(ctx context.Context, owner string, promotion_coordinate string, escrow_ids []string, amount int64) (Reservation, error)
+
+	// Release pays out a promotion's reservation, removing the funds from its escrows.
+	Release(ctx context.Context, promotion_coordinate string) (Reservation, error)
+
+	// Refund returns a promotion's reservation to its escrows.
+	Refund(ctx context.Context, promotion_coordinate string) (Reservation, error)
+
+	// Reservation returns a promotion's latest reservation, in any state, or
+	// ErrNoReservation.
+	Reservation(ctx context.Context, promotion_coordinate string) (Reservation, error)
+}
+
+// Covers returns the sats available to owner across escrow_ids, counting each
+// escrow once. It returns ErrNotEscrowOwner when an escrow belongs to another
+// pubkey.
+func Covers(ctx context.Context, backend Backend, owner string, escrow_ids []string) (int64, error) {
+	seen := make(map[string]bool, len(escrow_ids))
+	var total int64
+	for _, escrow_id := range escrow_ids {
+		if seen[escrow_id] {
+			continue
+		}
+		seen[escrow_id] = true
+		escrow_owner, err := backend.Owner(ctx, escrow_id)
+		if err != nil {
+			return 0, err
+		}
+		if escrow_owner != "" && escrow_owner != owner {
+			return 0, fmt.Errorf("%w: %s", ErrNotEscrowOwner, escrow_id)
+		}
+		available, err := backend.Available(ctx, escrow_id)
+		if err != nil {
+			return 0, err
+		}
+		total += available
+	}
+	return total, nil
+}
+
+// MemoryBackend is an in-memory Backend, for tests and single-process deployments.
+type MemoryBackend struct {
+	mu           sync.Mutex
+	owners       map[string]string // escrow ID -> pubkey of the depositor
+	balances     map[string]int64  // escrow ID -> sats deposited and not released
+	held         map[string]int64  // escrow ID -> sats held by reservations
+	reservations map[string]*Reservation
+}
+
+// NewMemoryBackend creates an empty in-memory backend. Fund escrows with Deposit.
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		owners:       make(map[string]string),
+		balances:     make(map[string]int64),
+		held:         make(map[string]int64),
+		reservations: make(map[string]*Reservation),
+	}
+}
+
+// Deposit adds sats to an escrow, creating it for owner if needed. It returns
+// ErrNotEscrowOwner when the escrow belongs to another pubkey.
+func (b *MemoryBackend) Deposit(escrow_id string, owner string, amount int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, ok := b.owners[escrow_id]; ok && existing != owner {
+		return fmt.Errorf("%w: %s", ErrNotEscrowOwner, escrow_id)
+	}
+	b.owners[escrow_id] = owner
+	b.balances[escrow_id] += amount
+	return nil
+}
+
+// Balance returns the sats in an escrow, including those held by reservations.
+func (b *MemoryBackend) Balance(escrow_id string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.balances[escrow_id]
+}
+
+// Available implements Backend.
+func (b *MemoryBackend) Available(_ context.Context, escrow_id string) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.balances[escrow_id] - b.held[escrow_id], nil
+}
+
+// Owner implements Backend.
+func (b *MemoryBackend) Owner(_ context.Context, escrow_id string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.owners[escrow_id], nil
+}
+
+// Reserve implements Backend.
+func (b *MemoryBackend) Reserve(_ context.Context, owner string, promotion_coordinate string, escrow_ids []string, amount int64) (Reservation, error) {
+	if amount <= 0 {
+		return Reservation{}, ErrInvalidAmount
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if existing, ok := b.reservations[promotion_coordinate]; ok && existing.State == StateReserved {
+		return Reservation{}, ErrAlreadyReserved
+	}
+	for _, escrow_id := range escrow_ids {
+		if escrow_owner, ok := b.owners[escrow_id]; ok && escrow_owner != owner {
+			return Reservation{}, fmt.Errorf("%w: %s", ErrNotEscrowOwner, escrow_id)
+		}
+	}
+
+	reservation := &Reservation{PromotionCoordinate: promotion_coordinate, State: StateReserved}
+	remaining := amount
+	for _, escrow_id := range escrow_ids {
+		if remaining == 0 {
+			break
+		}
+		// A repeated ID has nothing left after its first hold
+		available := b.balances[escrow_id] - b.held[escrow_id]
+		for _, hold := range reservation.Holds {
+			if hold.EscrowID == escrow_id {
+				available -= hold.Amount
+			}
+		}
+		if available <= 0 {
+			continue
+		}
+		take := min(available, remaining)
+		reservation.Holds = append(reservation.Holds, Hold{EscrowID: escrow_id, Amount: take})
+		remaining -= take
+	}
+	if remaining > 0 {
+		return Reservation{}, fmt.Errorf("%w: %d of %d sats available", ErrInsufficientFunds, amount-remaining, amount)
+	}
+
+	for _, hold := range reservation.Holds {
+		b.held[hold.EscrowID] += hold.Amount
+	}
+	reservation.Amount = amount
+	b.reservations[promotion_coordinate] = reservation
+	return copyReservation(reservation), nil
+}
+
+// Release implements Backend.
+func (b *MemoryBackend) Release(_ context.Context, promotion_coordinate string) (Reservation, error) {
+	return b.settle(promotion_coordinate, StateReleased)
+}
+
+// Refund implements Backend.
+func (b *MemoryBackend) Refund(_ context.Context, promotion_coordinate string) (Reservation, error) {
+	return b.settle(promotion_coordinate, StateRefunded)
+}
+
+// settle ends a promotion's reservation. Released funds leave their escrows;
+// refunded funds become available again.
+func (b *MemoryBackend) settle(promotion_coordinate string, state State) (Reservation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reservation, ok := b.reservations[promotion_coordinate]
+	if !ok || reservation.State != StateReserved {
+		return Reservation{}, ErrNoReservation
+	}
+	for _, hold := range reservation.Holds {
+		b.held[hold.EscrowID] -= hold.Amount
+		if state == StateReleased {
+			b.balances[hold.EscrowID] -= hold.Amount
+		}
+	}
+	reservation.State = state
+	return copyReservation(reservation), nil
+}
+
+// Reservation implements Backend.
+func (b *MemoryBackend) Reservation(_ context.Context, promotion_coordinate string) (Reservation, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	reservation, ok := b.reservations[promotion_coordinate]
+	if !ok {
+		return Reservation{}, ErrNoReservation
+	}
+	return copyReservation(reservation), nil
+}
+
+func copyReservation(reservation *Reservation) Reservation {
+	copied := *reservation
+	copied.Holds = append([]Hold(nil), reservation.Holds...)
+	return copied
+}
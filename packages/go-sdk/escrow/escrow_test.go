@@ -0,0 +1,148 @@
+package escrow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMemoryBackend_Reserve(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	backend.Deposit("e-1", "pr", 300)
+	backend.Deposit("e-2", "pr", 500)
+
+	reservation, err := backend.Reserve(ctx, "pr", "pr-1", []string{"e-1", "e-1", "e-2"}, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reservation.Holds) != 2 || reservation.Holds[0] != (Hold{"e-1", 300}) || reservation.Holds[1] != (Hold{"e-2", 300}) {
+		t.Errorf("unexpected holds %+v", reservation.Holds)
+	}
+	if available, _ := Covers(ctx, backend, "pr", []string{"e-1", "e-2", "e-2"}); available != 200 {
+		t.Errorf("expected 200 available, got %d", available)
+	}
+
+	if _, err := backend.Reserve(ctx, "pr", "pr-1", []string{"e-2"}, 100); err != ErrAlreadyReserved {
+		t.Errorf("expected ErrAlreadyReserved, got %v", err)
+	}
+	if _, err := backend.Reserve(ctx, "pr", "pr-2", []string{"e-2"}, 0); err != ErrInvalidAmount {
+		t.Errorf("expected ErrInvalidAmount, got %v", err)
+	}
+	if _, err := backend.Reserve(ctx, "pr", "pr-2", []string{"e-1", "e-2", "unknown"}, 201); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+	// A failed reservation holds nothing
+	if available, _ := backend.Available(ctx, "e-2"); available != 200 {
+		t.Errorf("expected 200 available after a failed reservation, got %d", available)
+	}
+
+	// Only the depositor may reserve an escrow
+	backend.Deposit("e-3", "other", 1000)
+	if err := backend.Deposit("e-3", "pr", 1000); !errors.Is(err, ErrNotEscrowOwner) {
+		t.Errorf("expected a deposit to another owner's escrow to fail, got %v", err)
+	}
+	if _, err := backend.Reserve(ctx, "pr", "pr-3", []string{"e-2", "e-3"}, 100); !errors.Is(err, ErrNotEscrowOwner) {
+		t.Errorf("expected ErrNotEscrowOwner, got %v", err)
+	}
+	if available, _ := backend.Available(ctx, "e-2"); available != 200 {
+		t.Errorf("expected a rejected reservation to hold nothing, got %d available", available)
+	}
+	if owner, _ := backend.Owner(ctx, "e-3"); owner != "other" {
+		t.Errorf("expected e-3 to belong to other, got %q", owner)
+	}
+}
+
+func TestMemoryBackend_Settle(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	backend.Deposit("e-1", "pr", 1000)
+
+	backend.Reserve(ctx, "pr", "pr-1", []string{"e-1"}, 400)
+	backend.Reserve(ctx, "pr", "pr-2", []string{"e-1"}, 300)
+
+	if reservation, err := backend.Release(ctx, "pr-1"); err != nil || reservation.State != StateReleased {
+		t.Fatalf("release: %+v, %v", reservation, err)
+	}
+	if reservation, err := backend.Refund(ctx, "pr-2"); err != nil || reservation.State != StateRefunded {
+		t.Fatalf("refund: %+v, %v", reservation, err)
+	}
+	if balance := backend.Balance("e-1"); balance != 600 {
+		t.Errorf("expected the released sats to leave the escrow, got balance %d", balance)
+	}
+	if available, _ := backend.Available(ctx, "e-1"); available != 600 {
+		t.Errorf("expected the refunded sats to be available, got %d", available)
+	}
+
+	if _, err := backend.Release(ctx, "pr-1"); err != ErrNoReservation {
+		t.Errorf("expected a settled reservation to be gone, got %v", err)
+	}
+	if _, err := backend.Refund(ctx, "pr-3"); err != ErrNoReservation {
+		t.Errorf("expected ErrNoReservation, got %v", err)
+	}
+	if reservation, err := backend.Reservation(ctx, "pr-2"); err != nil || reservation.State != StateRefunded {
+		t.Errorf("expected the refunded reservation to be kept, got %+v, %v", reservation, err)
+	}
+
+	// A settled promotion may reserve again
+	if _, err := backend.Reserve(ctx, "pr", "pr-2", []string{"e-1"}, 300); err != nil {
+		t.Errorf("expected a refunded promotion to reserve again, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend()
+	backend.Deposit("e-1", "pr", 3000)
+	backend.Deposit("e-2", "pr", 2000)
+
+	accept := validation.ValidatorFunc(func(*nostr.Event) validation.ValidationResult {
+		return validation.ValidationResult{Valid: true}
+	})
+	validator := validation.Chain(accept, Middleware(backend))
+
+	promotion := func(bid int64, escrow_ids ...string) *nostr.Event {
+		content, _ := json.Marshal(core.PromotionData{Bid: bid, EscrowIDList: escrow_ids})
+		return &nostr.Event{Kind: core.KindPromotion, PubKey: "pr", Tags: nostr.Tags{{"d", "org.attnprotocol:promotion:p-1"}}, Content: string(content)}
+	}
+
+	if result := validator.Validate(promotion(5000, "e-1", "e-2")); !result.Valid {
+		t.Errorf("expected covered promotion to pass, got %+v", result)
+	}
+	if result := validator.Validate(promotion(5001, "e-1", "e-2", "e-1")); result.Valid || result.Code != CodeInsufficientEscrow {
+		t.Errorf("expected %s, got %+v", CodeInsufficientEscrow, result)
+	}
+	if result := validator.Validate(promotion(1)); result.Valid || result.Code != CodeInsufficientEscrow {
+		t.Errorf("expected a promotion without escrows to fail, got %+v", result)
+	}
+
+	// Escrows deposited by someone else do not cover the promotion
+	backend.Deposit("e-3", "other", 10000)
+	if result := validator.Validate(promotion(100, "e-1", "e-3")); result.Valid || result.Code != CodeEscrowNotOwned {
+		t.Errorf("expected %s, got %+v", CodeEscrowNotOwned, result)
+	}
+
+	// The promotion's own reservation counts towards its bid
+	if _, err := backend.Reserve(ctx, "pr", "38388:pr:org.attnprotocol:promotion:p-1", []string{"e-1"}, 3000); err != nil {
+		t.Fatal(err)
+	}
+	if result := validator.Validate(promotion(5000, "e-1", "e-2")); !result.Valid {
+		t.Errorf("expected a re-published promotion to pass, got %+v", result)
+	}
+
+	if result := validator.Validate(&nostr.Event{Kind: core.KindAttention, Content: "{}"}); !result.Valid {
+		t.Errorf("expected other kinds to pass, got %+v", result)
+	}
+
+	reject := validation.ValidatorFunc(func(*nostr.Event) validation.ValidationResult {
+		return validation.ValidationResult{Valid: false, Code: validation.CodeInvalidField}
+	})
+	if result := validation.Chain(reject, Middleware(backend)).Validate(promotion(1)); result.Code != validation.CodeInvalidField {
+		t.Errorf("expected the wrapped result, got %+v", result)
+	}
+}
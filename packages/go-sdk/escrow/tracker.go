@@ -0,0 +1,291 @@
+package escrow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrNoBackend is returned when a tracker has no escrow backend.
+var ErrNoBackend = errors.New("escrow tracker has no backend")
+
+// DefaultPaymentTimeout is how many blocks a matched promotion may stay unpaid
+// before its reservation is refunded, when Options.PaymentTimeout is zero.
+const DefaultPaymentTimeout = 6
+
+// Options holds configuration for a Tracker.
+type Options struct {
+	// Backend holds the escrowed funds.
+	Backend Backend
+
+	// Expiry decides when an unmatched promotion's reservation is refunded:
+	// once its offer expires. A re-published PROMOTION restarts the window.
+	// Defaults to core.DefaultExpiryPolicy.
+	Expiry *core.ExpiryPolicy
+
+	// PaymentTimeout is how many blocks after its match a promotion may stay
+	// unpaid before its reservation is refunded. Defaults to
+	// DefaultPaymentTimeout.
+	PaymentTimeout int64
+
+	// ClockPubkey is the City Protocol clock whose block events HandleEvent
+	// and Run apply. Block events from other pubkeys are ignored, as are all
+	// block events when it is empty; OnBlock still works.
+	ClockPubkey string
+
+	// OnError, if set, receives errors during Run, which otherwise continues
+	// with the next event.
+	OnError func(err error)
+}
+
+// Tracker reserves, releases and refunds escrow for PROMOTION events as the
+// market progresses. It is safe for concurrent use.
+type Tracker struct {
+	options Options
+
+	mu           sync.Mutex
+	block_height int64
+	promotions   map[string]*promotionState // promotion coordinate -> state
+}
+
+// promotionState tracks a promotion holding a reservation.
+type promotionState struct {
+	created_at  nostr.Timestamp // of the newest PROMOTION version seen
+	expires_at  int64           // 0 if the promotion never expires
+	bid         int64
+	escrow_ids  []string
+	marketplace string // marketplace coordinate the promotion names
+	matched     bool
+	matched_at  int64  // block height of the match
+	attention   string // attention coordinate it was matched with
+}
+
+// NewTracker creates an escrow tracker.
+func NewTracker(options Options) (*Tracker, error) {
+	if options.Backend == nil {
+		return nil, ErrNoBackend
+	}
+	if options.Expiry == nil {
+		options.Expiry = &core.DefaultExpiryPolicy
+	}
+	if options.PaymentTimeout <= 0 {
+		options.PaymentTimeout = DefaultPaymentTimeout
+	}
+	return &Tracker{options: options, promotions: make(map[string]*promotionState)}, nil
+}
+
+// Run handles events until the channel closes or ctx is done. events should
+// carry City Protocol block events and PROMOTION, MATCH and
+// ATTENTION_PAYMENT_CONFIRMATION events; other events are ignored. Run returns
+// nil when the channel closes.
+func (t *Tracker) Run(ctx context.Context, events <-chan *nostr.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := t.HandleEvent(ctx, event); err != nil && t.options.OnError != nil {
+				t.options.OnError(err)
+			}
+		}
+	}
+}
+
+// HandleEvent applies a block, PROMOTION, MATCH or ATTENTION_PAYMENT_CONFIRMATION
+// event. Only block events signed by Options.ClockPubkey count. Other events
+// are ignored.
+func (t *Tracker) HandleEvent(ctx context.Context, event *nostr.Event) error {
+	switch event.Kind {
+	case core.KindCityBlock:
+		block_height, ok := events.ParseBlock(event, t.options.ClockPubkey)
+		if !ok {
+			return nil
+		}
+		return t.OnBlock(ctx, block_height)
+	case core.KindPromotion:
+		return t.handlePromotion(ctx, event)
+	case core.KindMatch:
+		t.handleMatch(event)
+	case core.KindAttentionPaymentConfirmation:
+		return t.handlePayment(ctx, event)
+	}
+	return nil
+}
+
+// OnBlock refunds the reservations of promotions that expired unmatched, and
+// of matched promotions not paid within Options.PaymentTimeout blocks.
+// Blocks at or below the current height are ignored.
+func (t *Tracker) OnBlock(ctx context.Context, block_height int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if block_height <= t.block_height {
+		return nil
+	}
+	t.block_height = block_height
+
+	var errs []error
+	for coordinate, state := range t.promotions {
+		if state.matched {
+			if block_height-state.matched_at <= t.options.PaymentTimeout {
+				continue
+			}
+		} else if state.expires_at == 0 || block_height < state.expires_at {
+			continue
+		}
+		if _, err := t.options.Backend.Refund(ctx, coordinate); err != nil && !errors.Is(err, ErrNoReservation) {
+			errs = append(errs, fmt.Errorf("refund %s: %w", coordinate, err))
+			continue
+		}
+		delete(t.promotions, coordinate)
+	}
+	return errors.Join(errs...)
+}
+
+// Reserved returns the coordinates of the promotions holding a reservation.
+func (t *Tracker) Reserved() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	coordinates := make([]string, 0, len(t.promotions))
+	for coordinate := range t.promotions {
+		coordinates = append(coordinates, coordinate)
+	}
+	return coordinates
+}
+
+// handlePromotion reserves a new promotion's bid. A re-published promotion
+// that is not yet matched keeps its reservation if the bid is unchanged, and
+// is reserved again for a new bid; if the new bid cannot be reserved, the old
+// one is put back. Versions no newer than the last one seen, promotions that
+// already expired, and promotions without a valid block height or a
+// marketplace are ignored.
+func (t *Tracker) handlePromotion(ctx context.Context, event *nostr.Event) error {
+	var content core.PromotionData
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil || content.Bid <= 0 {
+		return nil
+	}
+	if _, ok := core.EventBlockHeight(event); !ok {
+		return nil
+	}
+	marketplace := references(event)[core.KindMarketplace]
+	if marketplace == "" {
+		return nil
+	}
+	expires_at, _ := t.options.Expiry.ExpiresAt(event)
+	coordinate := events.FormatCoordinate(core.KindPromotion, event.PubKey, event.Tags.GetD())
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if expires_at != 0 && t.block_height >= expires_at {
+		return nil
+	}
+	state, ok := t.promotions[coordinate]
+	if !ok {
+		if _, err := t.options.Backend.Reserve(ctx, event.PubKey, coordinate, content.EscrowIDList, content.Bid); err != nil {
+			return fmt.Errorf("reserve %s: %w", coordinate, err)
+		}
+		t.promotions[coordinate] = &promotionState{
+			created_at:  event.CreatedAt,
+			expires_at:  expires_at,
+			bid:         content.Bid,
+			escrow_ids:  content.EscrowIDList,
+			marketplace: marketplace,
+		}
+		return nil
+	}
+
+	if state.matched || event.CreatedAt <= state.created_at {
+		return nil
+	}
+	state.created_at = event.CreatedAt
+	state.expires_at = max(state.expires_at, expires_at)
+	state.marketplace = marketplace
+	if state.bid == content.Bid {
+		return nil
+	}
+
+	if _, err := t.options.Backend.Refund(ctx, coordinate); err != nil && !errors.Is(err, ErrNoReservation) {
+		return fmt.Errorf("refund %s: %w", coordinate, err)
+	}
+	if _, err := t.options.Backend.Reserve(ctx, event.PubKey, coordinate, content.EscrowIDList, content.Bid); err != nil {
+		err = fmt.Errorf("reserve %s: %w", coordinate, err)
+		// Keep the promotion funded at its previous bid
+		if _, restore_err := t.options.Backend.Reserve(ctx, event.PubKey, coordinate, state.escrow_ids, state.bid); restore_err != nil {
+			delete(t.promotions, coordinate)
+			return errors.Join(err, fmt.Errorf("restore %s: %w", coordinate, restore_err))
+		}
+		return err
+	}
+	state.bid = content.Bid
+	state.escrow_ids = content.EscrowIDList
+	return nil
+}
+
+// handleMatch keeps a matched promotion's reservation until it is paid, and
+// records the attention it was matched with. Only the first match signed by
+// the marketplace the promotion names counts.
+func (t *Tracker) handleMatch(event *nostr.Event) {
+	refs := references(event)
+	marketplace, attention := refs[core.KindMarketplace], refs[core.KindAttention]
+	if _, pubkey, _, _ := events.ParseCoordinate(marketplace); pubkey == "" || pubkey != event.PubKey || attention == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state, ok := t.promotions[refs[core.KindPromotion]]
+	if !ok || state.matched || state.marketplace != marketplace {
+		return
+	}
+	state.matched = true
+	state.matched_at = t.block_height
+	if height, ok := core.EventBlockHeight(event); ok && height > state.matched_at {
+		state.matched_at = height
+	}
+	state.attention = attention
+}
+
+// handlePayment releases a matched promotion's reservation once the owner of
+// the attention it was matched with confirms payment.
+func (t *Tracker) handlePayment(ctx context.Context, event *nostr.Event) error {
+	refs := references(event)
+	attention := refs[core.KindAttention]
+	if _, pubkey, _, _ := events.ParseCoordinate(attention); pubkey == "" || pubkey != event.PubKey {
+		return nil
+	}
+	coordinate := refs[core.KindPromotion]
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, ok := t.promotions[coordinate]; !ok || !state.matched || state.attention != attention {
+		return nil
+	}
+	if _, err := t.options.Backend.Release(ctx, coordinate); err != nil && !errors.Is(err, ErrNoReservation) {
+		return fmt.Errorf("release %s: %w", coordinate, err)
+	}
+	delete(t.promotions, coordinate)
+	return nil
+}
+
+// references returns an event's 'a' coordinates by kind.
+func references(event *nostr.Event) map[int]string {
+	refs := make(map[int]string, 5)
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		if kind, _, _, err := events.ParseCoordinate(tag[1]); err == nil {
+			if _, seen := refs[kind]; !seen {
+				refs[kind] = tag[1]
+			}
+		}
+	}
+	return refs
+}
@@ -0,0 +1,265 @@
+package escrow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	marketplacePubkey = "mk"
+	promoterPubkey    = "pr"
+	attentionPubkey   = "at"
+	clockPubkey       = "city"
+)
+
+var (
+	marketplace = events.FormatCoordinate(core.KindMarketplace, marketplacePubkey, "org.attnprotocol:marketplace:mk-1")
+	attention   = events.FormatCoordinate(core.KindAttention, attentionPubkey, "org.attnprotocol:attention:at-1")
+)
+
+// created_at orders the test events by when they were built.
+var created_at nostr.Timestamp
+
+func event(kind int, pubkey, d_tag string, block_height int64, tags nostr.Tags, content interface{}) *nostr.Event {
+	data, _ := json.Marshal(content)
+	created_at++
+	return &nostr.Event{
+		Kind:      kind,
+		PubKey:    pubkey,
+		CreatedAt: created_at,
+		Tags:      append(nostr.Tags{{"d", d_tag}, {"t", strconv.FormatInt(block_height, 10)}}, tags...),
+		Content:   string(data),
+	}
+}
+
+func promotionEvent(id string, bid, block_height int64) (*nostr.Event, string) {
+	d_tag := events.FormatDTag("promotion", id)
+	promotion := event(core.KindPromotion, promoterPubkey, d_tag, block_height, nostr.Tags{{"a", marketplace}}, core.PromotionData{Bid: bid, EscrowIDList: []string{"e-1"}})
+	return promotion, events.FormatCoordinate(core.KindPromotion, promoterPubkey, d_tag)
+}
+
+func matchEvent(id, author, promotion string) (*nostr.Event, string) {
+	return matchIn(id, author, marketplace, promotion)
+}
+
+// matchIn builds a MATCH of promotion with attention in the given marketplace.
+func matchIn(id, author, marketplace, promotion string) (*nostr.Event, string) {
+	d_tag := events.FormatDTag("match", id)
+	match := event(core.KindMatch, author, d_tag, 870500, nostr.Tags{{"a", marketplace}, {"a", promotion}, {"a", attention}}, core.MatchData{})
+	return match, events.FormatCoordinate(core.KindMatch, author, d_tag)
+}
+
+func paymentEvent(id, author, promotion, match string) *nostr.Event {
+	return paymentFor(id, author, attention, promotion, match)
+}
+
+// paymentFor builds a payment confirmation for the given attention coordinate.
+func paymentFor(id, author, attention, promotion, match string) *nostr.Event {
+	return event(core.KindAttentionPaymentConfirmation, author, events.FormatDTag("attention-payment-confirmation", id), 870500,
+		nostr.Tags{{"a", marketplace}, {"a", promotion}, {"a", attention}, {"a", match}}, core.AttentionPaymentConfirmationData{SatsReceived: 3000})
+}
+
+func newTracker(t *testing.T, deposit int64) (*Tracker, *MemoryBackend) {
+	t.Helper()
+	backend := NewMemoryBackend()
+	backend.Deposit("e-1", promoterPubkey, deposit)
+	tracker, err := NewTracker(Options{Backend: backend, Expiry: &core.ExpiryPolicy{Blocks: 2}, ClockPubkey: clockPubkey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracker, backend
+}
+
+func TestTracker_Release(t *testing.T) {
+	ctx := context.Background()
+	tracker, backend := newTracker(t, 10000)
+
+	promotion, coordinate := promotionEvent("p-1", 5000, 870500)
+	if err := tracker.HandleEvent(ctx, promotion); err != nil {
+		t.Fatal(err)
+	}
+	if available, _ := backend.Available(ctx, "e-1"); available != 5000 {
+		t.Fatalf("expected the bid to be reserved, got %d available", available)
+	}
+
+	// A match signed by someone other than the marketplace is ignored
+	forged, _ := matchEvent("m-0", promoterPubkey, coordinate)
+	tracker.HandleEvent(ctx, forged)
+
+	// So is a match by a marketplace the promotion does not name, and a
+	// payment for a promotion that was never matched
+	elsewhere := events.FormatCoordinate(core.KindMarketplace, "other", "org.attnprotocol:marketplace:mk-2")
+	unnamed, unnamed_coordinate := matchIn("m-2", "other", elsewhere, coordinate)
+	tracker.HandleEvent(ctx, unnamed)
+	tracker.HandleEvent(ctx, paymentEvent("pay-2", attentionPubkey, coordinate, unnamed_coordinate))
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved {
+		t.Fatalf("expected an unmatched promotion to stay reserved, got %s", reservation.State)
+	}
+	if err := tracker.OnBlock(ctx, 870503); err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateRefunded {
+		t.Fatalf("expected a match in another marketplace not to count, got %s", reservation.State)
+	}
+
+	promotion, coordinate = promotionEvent("p-1", 5000, 870504)
+	if err := tracker.HandleEvent(ctx, promotion); err != nil {
+		t.Fatal(err)
+	}
+	match, match_coordinate := matchEvent("m-1", marketplacePubkey, coordinate)
+	tracker.HandleEvent(ctx, match)
+
+	// A payment for attention the promotion was not matched with is ignored
+	stranger := events.FormatCoordinate(core.KindAttention, "st", "org.attnprotocol:attention:at-2")
+	tracker.HandleEvent(ctx, paymentFor("pay-3", "st", stranger, coordinate, match_coordinate))
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved {
+		t.Fatalf("expected a payment for other attention to be ignored, got %s", reservation.State)
+	}
+
+	// Matched promotions keep their reservation past expiry
+	if err := tracker.OnBlock(ctx, 870509); err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved {
+		t.Fatalf("expected the matched promotion to stay reserved, got %s", reservation.State)
+	}
+
+	// Only the attention owner's confirmation releases it
+	tracker.HandleEvent(ctx, paymentEvent("pay-0", promoterPubkey, coordinate, match_coordinate))
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved {
+		t.Fatalf("expected a payment by another author to be ignored, got %s", reservation.State)
+	}
+	if err := tracker.HandleEvent(ctx, paymentEvent("pay-1", attentionPubkey, coordinate, match_coordinate)); err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReleased {
+		t.Errorf("expected the reservation to be released, got %s", reservation.State)
+	}
+	if balance := backend.Balance("e-1"); balance != 5000 {
+		t.Errorf("expected the released bid to leave the escrow, got balance %d", balance)
+	}
+	if len(tracker.Reserved()) != 0 {
+		t.Errorf("expected no tracked promotions, got %v", tracker.Reserved())
+	}
+}
+
+func TestTracker_Refund(t *testing.T) {
+	ctx := context.Background()
+	tracker, backend := newTracker(t, 10000)
+
+	promotion, coordinate := promotionEvent("p-1", 5000, 870500)
+	tracker.HandleEvent(ctx, promotion)
+
+	// Re-publishing with the same bid restarts the expiry
+	republished, _ := promotionEvent("p-1", 5000, 870501)
+	tracker.HandleEvent(ctx, republished)
+	tracker.OnBlock(ctx, 870502)
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved {
+		t.Fatalf("expected the re-published promotion to stay reserved, got %s", reservation.State)
+	}
+
+	// Blocks carried as events are handled too, but only the clock's
+	impostor := event(core.KindCityBlock, "impostor", "org.cityprotocol:block:870503", 870503, nil, map[string]int64{"block_height": 870503})
+	tracker.HandleEvent(ctx, impostor)
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved {
+		t.Fatalf("expected a block from another pubkey to be ignored, got %s", reservation.State)
+	}
+	block := event(core.KindCityBlock, clockPubkey, "org.cityprotocol:block:870503", 870503, nil, map[string]int64{"block_height": 870503})
+	if err := tracker.HandleEvent(ctx, block); err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateRefunded {
+		t.Fatalf("expected the unmatched promotion to be refunded, got %s", reservation.State)
+	}
+	if available, _ := backend.Available(ctx, "e-1"); available != 10000 {
+		t.Errorf("expected the refund to free the escrow, got %d available", available)
+	}
+
+	// Promotions whose t tag is not a canonical block height are not reserved
+	unheighted, _ := promotionEvent("p-2", 5000, 870504)
+	unheighted.Tags[1] = nostr.Tag{"t", "0870504"}
+	tracker.HandleEvent(ctx, unheighted)
+	if len(tracker.Reserved()) != 0 {
+		t.Errorf("expected a promotion without a valid block height to be ignored, got %v", tracker.Reserved())
+	}
+}
+
+func TestTracker_BidChange(t *testing.T) {
+	ctx := context.Background()
+	tracker, backend := newTracker(t, 6000)
+
+	promotion, coordinate := promotionEvent("p-1", 5000, 870500)
+	tracker.HandleEvent(ctx, promotion)
+	raised, _ := promotionEvent("p-1", 6000, 870500)
+	if err := tracker.HandleEvent(ctx, raised); err != nil {
+		t.Fatal(err)
+	}
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.Amount != 6000 {
+		t.Errorf("expected the new bid to be reserved, got %d", reservation.Amount)
+	}
+
+	// An older version is ignored
+	tracker.HandleEvent(ctx, promotion)
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.Amount != 6000 {
+		t.Errorf("expected an older version to be ignored, got %d reserved", reservation.Amount)
+	}
+
+	// A bid the escrow cannot cover keeps the previous reservation
+	unfunded, _ := promotionEvent("p-1", 7000, 870500)
+	if err := tracker.HandleEvent(ctx, unfunded); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved || reservation.Amount != 6000 {
+		t.Errorf("expected the previous bid to stay reserved, got %+v", reservation)
+	}
+
+	other, _ := promotionEvent("p-2", 1, 870500)
+	if err := tracker.HandleEvent(ctx, other); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+	if len(tracker.Reserved()) != 1 {
+		t.Errorf("expected only the funded promotion to be tracked, got %v", tracker.Reserved())
+	}
+}
+
+func TestTracker_PaymentTimeout(t *testing.T) {
+	ctx := context.Background()
+	tracker, backend := newTracker(t, 10000)
+	tracker.OnBlock(ctx, 870500)
+
+	promotion, coordinate := promotionEvent("p-1", 5000, 870500)
+	tracker.HandleEvent(ctx, promotion)
+	match, _ := matchEvent("m-1", marketplacePubkey, coordinate)
+	tracker.HandleEvent(ctx, match)
+
+	tracker.OnBlock(ctx, 870500+DefaultPaymentTimeout)
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateReserved {
+		t.Fatalf("expected the match to wait for payment, got %s", reservation.State)
+	}
+	tracker.OnBlock(ctx, 870501+DefaultPaymentTimeout)
+	if reservation, _ := backend.Reservation(ctx, coordinate); reservation.State != StateRefunded {
+		t.Errorf("expected an unpaid match to be refunded, got %s", reservation.State)
+	}
+	if len(tracker.Reserved()) != 0 {
+		t.Errorf("expected no tracked promotions, got %v", tracker.Reserved())
+	}
+
+	// Promotions that already expired are not reserved again
+	tracker.HandleEvent(ctx, promotion)
+	if len(tracker.Reserved()) != 0 {
+		t.Errorf("expected an expired promotion to be ignored, got %v", tracker.Reserved())
+	}
+}
+
+func TestNewTracker_NoBackend(t *testing.T) {
+	if _, err := NewTracker(Options{}); err != ErrNoBackend {
+		t.Errorf("expected ErrNoBackend, got %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package escrow
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Failure codes Middleware adds to validation.ValidationResult.Code.
+const (
+	// CodeInsufficientEscrow means a PROMOTION's escrows cannot cover its bid.
+	CodeInsufficientEscrow = "insufficient_escrow"
+
+	// CodeEscrowNotOwned means a PROMOTION names an escrow that belongs to
+	// another pubkey.
+	CodeEscrowNotOwned = "escrow_not_owned"
+
+	// CodeEscrowUnavailable means the escrow backend could not be queried.
+	CodeEscrowUnavailable = "escrow_unavailable"
+)
+
+// Middleware returns validation middleware that rejects PROMOTION events whose
+// escrow_id_list cannot cover their bid, or names an escrow that belongs to a
+// pubkey other than the PROMOTION's signer. Funds already reserved for the same
+// promotion count towards it, so a re-published PROMOTION is not rejected for
+// its own reservation. Other kinds, and events the wrapped validator rejects,
+// pass through unchanged.
+func Middleware(backend Backend) validation.Middleware {
+	return func(next validation.Validator) validation.Validator {
+		return validation.ValidatorFunc(func(event *nostr.Event) validation.ValidationResult {
+			result := next.Validate(event)
+			if !result.Valid || event.Kind != core.KindPromotion {
+				return result
+			}
+			var content core.PromotionData
+			if err := json.Unmarshal([]byte(event.Content), &content); err != nil {
+				return result
+			}
+
+			ctx := context.Background()
+			available, err := Covers(ctx, backend, event.PubKey, content.EscrowIDList)
+			if errors.Is(err, ErrNotEscrowOwner) {
+				return validation.ValidationResult{Valid: false, Code: CodeEscrowNotOwned, Message: err.Error()}
+			}
+			if err != nil {
+				return validation.ValidationResult{Valid: false, Code: CodeEscrowUnavailable, Message: fmt.Sprintf("escrow backend: %s", err.Error())}
+			}
+			coordinate := events.FormatCoordinate(core.KindPromotion, event.PubKey, event.Tags.GetD())
+			if reservation, err := backend.Reservation(ctx, coordinate); err == nil && reservation.State == StateReserved {
+				available += reservation.Amount
+			}
+			if available < content.Bid {
+				return validation.ValidationResult{Valid: false, Code: CodeInsufficientEscrow, Message: fmt.Sprintf("escrow_id_list covers %d of the %d sat bid", available, content.Bid)}
+			}
+			return result
+		})
+	}
+}
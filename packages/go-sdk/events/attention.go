@@ -3,7 +3,6 @@ package events
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
@@ -39,10 +38,17 @@ type AttentionParams struct {
 	BlockHeight int64
 
 	// AttentionID is the unique attention ID for the d-tag.
+	// Plain IDs are namespaced as org.attnprotocol:attention:<id>.
 	AttentionID string
 
+	// IDStrategy derives the ID when it is empty. Defaults to ContentHash.
+	IDStrategy IDStrategy
+
 	// AttentionPubkey is the attention provider's pubkey.
 	AttentionPubkey string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
 }
 
 // CreateAttention creates an ATTENTION event (kind 38488).
@@ -68,13 +74,6 @@ func CreateAttention(private_key string, params AttentionParams) (*nostr.Event,
 	// Build tags
 	tags := nostr.Tags{}
 
-	// Add d-tag
-	d_tag := params.AttentionID
-	if d_tag == "" {
-		d_tag = fmt.Sprintf("org.attnprotocol:attention:%d", time.Now().UnixNano())
-	}
-	tags = append(tags, nostr.Tag{"d", d_tag})
-
 	// Add block height tag
 	tags = append(tags, nostr.Tag{"t", fmt.Sprintf("%d", params.BlockHeight)})
 
@@ -89,10 +88,14 @@ func CreateAttention(private_key string, params AttentionParams) (*nostr.Event,
 		return nil, err
 	}
 
+	// Add d-tag, derived from the rest of the event when no ID is given
+	d_tag := dTag("attention", params.AttentionID, params.IDStrategy, ContentHash(), IDSource{Kind: core.KindAttention, Pubkey: pk, Tags: tags, Content: string(content_json)})
+	tags = append(nostr.Tags{{"d", d_tag}}, tags...)
+
 	// Create event
 	event := &nostr.Event{
 		PubKey:    pk,
-		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		CreatedAt: timestamp(params.Clock),
 		Kind:      core.KindAttention,
 		Tags:      tags,
 		Content:   string(content_json),
@@ -0,0 +1,70 @@
+package events
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// BatchOptions holds configuration for BuildBatch.
+type BatchOptions struct {
+	// Workers is how many events are built and signed at once. Defaults to
+	// runtime.GOMAXPROCS(0).
+	Workers int
+}
+
+// BuildResult is the outcome of building one event of a batch.
+type BuildResult struct {
+	// Index is the position of the event's params in the batch.
+	Index int
+
+	Event *nostr.Event
+	Err   error
+}
+
+// BuildBatch builds and signs one event per params with builder, across a
+// pool of workers, and returns the results in the order of params. A failed
+// build does not stop the others. Params not yet built when ctx is done fail
+// with ctx.Err().
+//
+//	results := events.BuildBatch(ctx, private_key, events.CreateMatch, match_params, events.BatchOptions{})
+func BuildBatch[P any](ctx context.Context, private_key string, builder func(private_key string, params P) (*nostr.Event, error), params []P, options BatchOptions) []BuildResult {
+	workers := options.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(params))
+
+	results := make([]BuildResult, len(params))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				event, err := builder(private_key, params[i])
+				results[i] = BuildResult{Index: i, Event: event, Err: err}
+			}
+		}()
+	}
+
+	next := 0
+feed:
+	for ; next < len(params); next++ {
+		select {
+		case indexes <- next:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	for i := next; i < len(params); i++ {
+		results[i] = BuildResult{Index: i, Err: ctx.Err()}
+	}
+	return results
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// batchSizes are the batch sizes benchmarked.
+var batchSizes = []int{10, 100, 1000, 10000}
+
+// matchBatch returns n MATCH params, one per block.
+func matchBatch(n int) []MatchParams {
+	params := make([]MatchParams, n)
+	for i := range params {
+		params[i] = MatchParams{
+			MatchID:               fmt.Sprintf("m-%d", i),
+			BlockHeight:           870000 + int64(i),
+			MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:mk-1",
+			BillboardCoordinate:   "38288:pk:org.attnprotocol:billboard:bb-1",
+			PromotionCoordinate:   fmt.Sprintf("38388:pk:org.attnprotocol:promotion:pr-%d", i),
+			AttentionCoordinate:   fmt.Sprintf("38488:pk:org.attnprotocol:attention:at-%d", i),
+			Clock:                 snapshotClock,
+		}
+	}
+	return params
+}
+
+func TestBuildBatch(t *testing.T) {
+	params := matchBatch(50)
+	results := BuildBatch(context.Background(), snapshotKey, CreateMatch, params, BatchOptions{Workers: 4})
+	if len(results) != len(params) {
+		t.Fatalf("expected %d results, got %d", len(params), len(results))
+	}
+	for i, result := range results {
+		if result.Err != nil || result.Index != i {
+			t.Fatalf("result %d: %+v", i, result)
+		}
+		if d_tag := result.Event.Tags.GetD(); d_tag != FormatDTag("match", params[i].MatchID) {
+			t.Errorf("result %d out of order: d tag %s", i, d_tag)
+		}
+		if ok, _ := result.Event.CheckSignature(); !ok {
+			t.Errorf("result %d: invalid signature", i)
+		}
+	}
+
+	// One failure does not stop the others
+	failing := func(private_key string, params MatchParams) (*nostr.Event, error) {
+		if params.MatchID == "m-3" {
+			return nil, errors.New("boom")
+		}
+		return CreateMatch(private_key, params)
+	}
+	results = BuildBatch(context.Background(), snapshotKey, failing, matchBatch(10), BatchOptions{})
+	for i, result := range results {
+		if (result.Err != nil) != (i == 3) {
+			t.Errorf("result %d: unexpected error %v", i, result.Err)
+		}
+	}
+
+	// A cancelled context fails what is left
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, result := range BuildBatch(ctx, snapshotKey, CreateMatch, matchBatch(10), BatchOptions{Workers: 1}) {
+		if result.Err != nil && !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", result.Err)
+		}
+	}
+}
+
+func BenchmarkBuildBatch(b *testing.B) {
+	for _, size := range batchSizes {
+		params := matchBatch(size)
+		b.Run(fmt.Sprintf("events=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				BuildBatch(context.Background(), snapshotKey, CreateMatch, params, BatchOptions{})
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
+
+// BenchmarkBuildSequential is the one-at-a-time baseline for BenchmarkBuildBatch.
+func BenchmarkBuildSequential(b *testing.B) {
+	for _, size := range batchSizes {
+		params := matchBatch(size)
+		b.Run(fmt.Sprintf("events=%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				for _, p := range params {
+					if _, err := CreateMatch(snapshotKey, p); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
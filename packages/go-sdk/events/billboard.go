@@ -0,0 +1,134 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// BillboardParams holds parameters for creating a billboard event.
+type BillboardParams struct {
+	// Name is the billboard display name.
+	Name string
+
+	// Description is the billboard description.
+	Description string
+
+	// ConfirmationFeeSats is the fee per confirmation in satoshis.
+	ConfirmationFeeSats int64
+
+	// BillboardID is the unique billboard ID for the d-tag.
+	// Plain IDs are namespaced as org.attnprotocol:billboard:<id>.
+	BillboardID string
+
+	// IDStrategy derives the ID when it is empty. Defaults to ContentHash.
+	IDStrategy IDStrategy
+
+	// BlockHeight is the Bitcoin block height.
+	BlockHeight int64
+
+	// MarketplaceCoordinate is the marketplace coordinate (38188:pubkey:id).
+	MarketplaceCoordinate string
+
+	// Reference pubkeys
+	BillboardPubkey   string
+	MarketplacePubkey string
+
+	// MarketplaceID is the ID of the marketplace the billboard joins.
+	MarketplaceID string
+
+	// Kind is the content kind the billboard plays, added as the k tag.
+	Kind int
+
+	// URL is where the billboard is shown, added as the u tag.
+	URL string
+
+	// RelayURLs are added as r tags.
+	RelayURLs []string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
+}
+
+// CreateBillboard creates a BILLBOARD event (kind 38288).
+func CreateBillboard(private_key string, params BillboardParams) (*nostr.Event, error) {
+	// Build content; confirmation_fee_sats is required even when it is zero
+	content := struct {
+		core.BillboardData
+		ConfirmationFeeSats int64 `json:"confirmation_fee_sats"`
+	}{
+		BillboardData: core.BillboardData{
+			Name:                 params.Name,
+			Description:          params.Description,
+			RefBillboardPubkey:   params.BillboardPubkey,
+			RefBillboardID:       params.BillboardID,
+			RefMarketplacePubkey: params.MarketplacePubkey,
+			RefMarketplaceID:     params.MarketplaceID,
+		},
+		ConfirmationFeeSats: params.ConfirmationFeeSats,
+	}
+
+	content_json, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build tags
+	tags := nostr.Tags{}
+
+	// Add block height tag
+	tags = append(tags, nostr.Tag{"t", fmt.Sprintf("%d", params.BlockHeight)})
+
+	// Add marketplace coordinate
+	if params.MarketplaceCoordinate != "" {
+		tags = append(tags, nostr.Tag{"a", params.MarketplaceCoordinate})
+	}
+
+	// Add pubkey tags
+	for _, pubkey := range []string{params.BillboardPubkey, params.MarketplacePubkey} {
+		if pubkey != "" {
+			tags = append(tags, nostr.Tag{"p", pubkey})
+		}
+	}
+
+	// Add relay tags
+	for _, url := range params.RelayURLs {
+		tags = append(tags, nostr.Tag{"r", url})
+	}
+
+	// Add content kind and URL tags
+	if params.Kind != 0 {
+		tags = append(tags, nostr.Tag{"k", fmt.Sprintf("%d", params.Kind)})
+	}
+	if params.URL != "" {
+		tags = append(tags, nostr.Tag{"u", params.URL})
+	}
+
+	// Get public key
+	pk, err := nostr.GetPublicKey(private_key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add d-tag, derived from the rest of the event when no ID is given
+	d_tag := dTag("billboard", params.BillboardID, params.IDStrategy, ContentHash(), IDSource{Kind: core.KindBillboard, Pubkey: pk, Tags: tags, Content: string(content_json)})
+	tags = append(nostr.Tags{{"d", d_tag}}, tags...)
+
+	// Create event
+	event := &nostr.Event{
+		PubKey:    pk,
+		CreatedAt: timestamp(params.Clock),
+		Kind:      core.KindBillboard,
+		Tags:      tags,
+		Content:   string(content_json),
+	}
+
+	// Sign event
+	if err := event.Sign(private_key); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
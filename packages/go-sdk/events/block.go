@@ -0,0 +1,25 @@
+package events
+
+import (
+	"encoding/json"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ParseBlock returns the block height a City Protocol block event announces.
+// Only block events signed by clock_pubkey count: it reports false for other
+// kinds, for blocks from any other pubkey, for an empty clock_pubkey, and for
+// content without a positive block_height.
+func ParseBlock(event *nostr.Event, clock_pubkey string) (int64, bool) {
+	if event.Kind != core.KindCityBlock || clock_pubkey == "" || event.PubKey != clock_pubkey {
+		return 0, false
+	}
+	var content struct {
+		BlockHeight int64 `json:"block_height"`
+	}
+	if err := json.Unmarshal([]byte(event.Content), &content); err != nil || content.BlockHeight <= 0 {
+		return 0, false
+	}
+	return content.BlockHeight, true
+}
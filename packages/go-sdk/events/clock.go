@@ -0,0 +1,40 @@
+package events
+
+import (
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Clock tells builders the time for CreatedAt. Set a fixed clock in the params
+// to build reproducible events, with the same IDs on every run.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+// Now calls f().
+func (f ClockFunc) Now() time.Time {
+	return f()
+}
+
+// SystemClock reads the system time. Builders use it when the params carry no Clock.
+var SystemClock Clock = ClockFunc(time.Now)
+
+// FixedClock always returns t.
+func FixedClock(t time.Time) Clock {
+	return ClockFunc(func() time.Time {
+		return t
+	})
+}
+
+// timestamp returns the clock's time, or the system time for a nil clock, as a
+// Nostr timestamp.
+func timestamp(clock Clock) nostr.Timestamp {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return nostr.Timestamp(clock.Now().Unix())
+}
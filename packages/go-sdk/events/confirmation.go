@@ -0,0 +1,430 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ConfirmationParams holds parameters for creating a billboard or attention
+// confirmation event. Both reference the same events.
+type ConfirmationParams struct {
+	// ConfirmationID is the unique confirmation ID for the d-tag.
+	// Plain IDs are namespaced as org.attnprotocol:billboard-confirmation:<id>
+	// or org.attnprotocol:attention-confirmation:<id>.
+	ConfirmationID string
+
+	// IDStrategy derives the ID when it is empty. Defaults to References.
+	IDStrategy IDStrategy
+
+	// BlockHeight is the Bitcoin block height.
+	BlockHeight int64
+
+	// MatchID is the d tag of the confirmed MATCH.
+	MatchID string
+
+	// Coordinates of the events the confirmation references.
+	MarketplaceCoordinate string
+	BillboardCoordinate   string
+	PromotionCoordinate   string
+	AttentionCoordinate   string
+	MatchCoordinate       string
+
+	// Reference event IDs. The match event is tagged with the "match" marker.
+	MatchEventID       string
+	MarketplaceEventID string
+	BillboardEventID   string
+	PromotionEventID   string
+	AttentionEventID   string
+
+	// Reference pubkeys
+	MarketplacePubkey string
+	BillboardPubkey   string
+	PromotionPubkey   string
+	AttentionPubkey   string
+
+	// Reference IDs
+	MarketplaceID string
+	BillboardID   string
+	PromotionID   string
+	AttentionID   string
+
+	// RelayURLs are added as r tags.
+	RelayURLs []string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
+}
+
+// BillboardConfirmationParams holds parameters for creating a billboard confirmation event.
+type BillboardConfirmationParams = ConfirmationParams
+
+// AttentionConfirmationParams holds parameters for creating an attention confirmation event.
+type AttentionConfirmationParams = ConfirmationParams
+
+// CreateBillboardConfirmation creates a BILLBOARD_CONFIRMATION event (kind 38588).
+func CreateBillboardConfirmation(private_key string, params BillboardConfirmationParams) (*nostr.Event, error) {
+	return createConfirmation(private_key, core.KindBillboardConfirmation, "billboard-confirmation", params)
+}
+
+// CreateAttentionConfirmation creates an ATTENTION_CONFIRMATION event (kind 38688).
+func CreateAttentionConfirmation(private_key string, params AttentionConfirmationParams) (*nostr.Event, error) {
+	return createConfirmation(private_key, core.KindAttentionConfirmation, "attention-confirmation", params)
+}
+
+// createConfirmation builds and signs a billboard or attention confirmation.
+// Their content fields are the same.
+func createConfirmation(private_key string, kind int, event_type string, params ConfirmationParams) (*nostr.Event, error) {
+	// Build content (only ref_* fields per ATTN-01)
+	content := core.AttentionConfirmationData{
+		RefMatchEventID:      params.MatchEventID,
+		RefMatchID:           params.MatchID,
+		RefMarketplacePubkey: params.MarketplacePubkey,
+		RefBillboardPubkey:   params.BillboardPubkey,
+		RefPromotionPubkey:   params.PromotionPubkey,
+		RefAttentionPubkey:   params.AttentionPubkey,
+		RefMarketplaceID:     params.MarketplaceID,
+		RefBillboardID:       params.BillboardID,
+		RefPromotionID:       params.PromotionID,
+		RefAttentionID:       params.AttentionID,
+	}
+
+	content_json, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build tags
+	tags := nostr.Tags{}
+
+	// Add block height tag
+	tags = append(tags, nostr.Tag{"t", fmt.Sprintf("%d", params.BlockHeight)})
+
+	// Add event reference tags
+	if params.MatchEventID != "" {
+		tags = append(tags, nostr.Tag{"e", params.MatchEventID, "", "match"})
+	}
+	for _, event_id := range []string{params.MarketplaceEventID, params.BillboardEventID, params.PromotionEventID, params.AttentionEventID} {
+		if event_id != "" {
+			tags = append(tags, nostr.Tag{"e", event_id})
+		}
+	}
+
+	// Add coordinate tags
+	for _, coordinate := range []string{params.MarketplaceCoordinate, params.BillboardCoordinate, params.PromotionCoordinate, params.AttentionCoordinate, params.MatchCoordinate} {
+		if coordinate != "" {
+			tags = append(tags, nostr.Tag{"a", coordinate})
+		}
+	}
+
+	// Add pubkey tags
+	for _, pubkey := range []string{params.MarketplacePubkey, params.BillboardPubkey, params.PromotionPubkey, params.AttentionPubkey} {
+		if pubkey != "" {
+			tags = append(tags, nostr.Tag{"p", pubkey})
+		}
+	}
+
+	// Add relay tags
+	for _, url := range params.RelayURLs {
+		tags = append(tags, nostr.Tag{"r", url})
+	}
+
+	// Get public key
+	pk, err := nostr.GetPublicKey(private_key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add d-tag, derived from the rest of the event when no ID is given
+	d_tag := dTag(event_type, params.ConfirmationID, params.IDStrategy, References(), IDSource{Kind: kind, Pubkey: pk, Tags: tags, Content: string(content_json)})
+	tags = append(nostr.Tags{{"d", d_tag}}, tags...)
+
+	// Create event
+	event := &nostr.Event{
+		PubKey:    pk,
+		CreatedAt: timestamp(params.Clock),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   string(content_json),
+	}
+
+	// Sign event
+	if err := event.Sign(private_key); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// MarketplaceConfirmationParams holds parameters for creating a marketplace
+// confirmation event.
+type MarketplaceConfirmationParams struct {
+	// ConfirmationID is the unique confirmation ID for the d-tag.
+	// Plain IDs are namespaced as org.attnprotocol:marketplace-confirmation:<id>.
+	ConfirmationID string
+
+	// IDStrategy derives the ID when it is empty. Defaults to References.
+	IDStrategy IDStrategy
+
+	// BlockHeight is the Bitcoin block height.
+	BlockHeight int64
+
+	// MatchID is the d tag of the confirmed MATCH.
+	MatchID string
+
+	// Coordinates of the events the confirmation references.
+	MarketplaceCoordinate string
+	BillboardCoordinate   string
+	PromotionCoordinate   string
+	AttentionCoordinate   string
+	MatchCoordinate       string
+
+	// Reference event IDs. The match and the billboard and attention
+	// confirmations are tagged with their markers.
+	MatchEventID                 string
+	BillboardConfirmationEventID string
+	AttentionConfirmationEventID string
+	MarketplaceEventID           string
+	BillboardEventID             string
+	PromotionEventID             string
+	AttentionEventID             string
+
+	// Reference pubkeys
+	MarketplacePubkey string
+	BillboardPubkey   string
+	PromotionPubkey   string
+	AttentionPubkey   string
+
+	// Reference IDs
+	MarketplaceID string
+	BillboardID   string
+	PromotionID   string
+	AttentionID   string
+
+	// RelayURLs are added as r tags.
+	RelayURLs []string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
+}
+
+// CreateMarketplaceConfirmation creates a MARKETPLACE_CONFIRMATION event (kind 38788).
+func CreateMarketplaceConfirmation(private_key string, params MarketplaceConfirmationParams) (*nostr.Event, error) {
+	// Build content (only ref_* fields per ATTN-01)
+	content := core.MarketplaceConfirmationData{
+		RefMatchEventID:                 params.MatchEventID,
+		RefMatchID:                      params.MatchID,
+		RefBillboardConfirmationEventID: params.BillboardConfirmationEventID,
+		RefAttentionConfirmationEventID: params.AttentionConfirmationEventID,
+		RefMarketplacePubkey:            params.MarketplacePubkey,
+		RefBillboardPubkey:              params.BillboardPubkey,
+		RefPromotionPubkey:              params.PromotionPubkey,
+		RefAttentionPubkey:              params.AttentionPubkey,
+		RefMarketplaceID:                params.MarketplaceID,
+		RefBillboardID:                  params.BillboardID,
+		RefPromotionID:                  params.PromotionID,
+		RefAttentionID:                  params.AttentionID,
+	}
+
+	// Add event reference tags, the marked ones first
+	tags := nostr.Tags{}
+	for _, reference := range []struct{ event_id, marker string }{
+		{params.MatchEventID, "match"},
+		{params.BillboardConfirmationEventID, "billboard_confirmation"},
+		{params.AttentionConfirmationEventID, "attention_confirmation"},
+	} {
+		if reference.event_id != "" {
+			tags = append(tags, nostr.Tag{"e", reference.event_id, "", reference.marker})
+		}
+	}
+	for _, event_id := range []string{params.MarketplaceEventID, params.BillboardEventID, params.PromotionEventID, params.AttentionEventID} {
+		if event_id != "" {
+			tags = append(tags, nostr.Tag{"e", event_id})
+		}
+	}
+
+	return createSettlement(private_key, core.KindMarketplaceConfirmation, "marketplace-confirmation", settlementParams{
+		confirmation_id: params.ConfirmationID,
+		id_strategy:     params.IDStrategy,
+		block_height:    params.BlockHeight,
+		event_tags:      tags,
+		coordinates:     []string{params.MarketplaceCoordinate, params.BillboardCoordinate, params.PromotionCoordinate, params.AttentionCoordinate, params.MatchCoordinate},
+		pubkeys:         []string{params.MarketplacePubkey, params.BillboardPubkey, params.PromotionPubkey, params.AttentionPubkey},
+		relay_urls:      params.RelayURLs,
+		clock:           params.Clock,
+	}, content)
+}
+
+// AttentionPaymentConfirmationParams holds parameters for creating an
+// attention payment confirmation event.
+type AttentionPaymentConfirmationParams struct {
+	// ConfirmationID is the unique confirmation ID for the d-tag. Plain IDs
+	// are namespaced as org.attnprotocol:attention-payment-confirmation:<id>.
+	ConfirmationID string
+
+	// IDStrategy derives the ID when it is empty. Defaults to References.
+	IDStrategy IDStrategy
+
+	// BlockHeight is the Bitcoin block height.
+	BlockHeight int64
+
+	// SatsReceived is the payment the attention owner received, in satoshis.
+	SatsReceived int64
+
+	// PaymentProof optionally proves the payment, for example
+	// bolt11:<invoice>:<preimage> or zap:<zap_receipt_event_id>.
+	PaymentProof string
+
+	// MatchID is the d tag of the paid MATCH.
+	MatchID string
+
+	// Coordinates of the events the confirmation references.
+	MarketplaceCoordinate string
+	BillboardCoordinate   string
+	PromotionCoordinate   string
+	AttentionCoordinate   string
+	MatchCoordinate       string
+
+	// Reference event IDs. The marketplace confirmation is tagged with the
+	// "marketplace_confirmation" marker.
+	MarketplaceConfirmationEventID string
+	MatchEventID                   string
+	MarketplaceEventID             string
+	BillboardEventID               string
+	PromotionEventID               string
+	AttentionEventID               string
+
+	// Reference pubkeys
+	MarketplacePubkey string
+	BillboardPubkey   string
+	PromotionPubkey   string
+	AttentionPubkey   string
+
+	// Reference IDs
+	MarketplaceID string
+	BillboardID   string
+	PromotionID   string
+	AttentionID   string
+
+	// RelayURLs are added as r tags.
+	RelayURLs []string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
+}
+
+// CreateAttentionPaymentConfirmation creates an ATTENTION_PAYMENT_CONFIRMATION event (kind 38988).
+func CreateAttentionPaymentConfirmation(private_key string, params AttentionPaymentConfirmationParams) (*nostr.Event, error) {
+	// Build content (sats_received, payment_proof and ref_* fields per ATTN-01)
+	content := core.AttentionPaymentConfirmationData{
+		SatsReceived:                      params.SatsReceived,
+		PaymentProof:                      params.PaymentProof,
+		RefMatchEventID:                   params.MatchEventID,
+		RefMatchID:                        params.MatchID,
+		RefMarketplaceConfirmationEventID: params.MarketplaceConfirmationEventID,
+		RefMarketplacePubkey:              params.MarketplacePubkey,
+		RefBillboardPubkey:                params.BillboardPubkey,
+		RefPromotionPubkey:                params.PromotionPubkey,
+		RefAttentionPubkey:                params.AttentionPubkey,
+		RefMarketplaceID:                  params.MarketplaceID,
+		RefBillboardID:                    params.BillboardID,
+		RefPromotionID:                    params.PromotionID,
+		RefAttentionID:                    params.AttentionID,
+	}
+
+	// Add event reference tags, the marked one first
+	tags := nostr.Tags{}
+	if params.MarketplaceConfirmationEventID != "" {
+		tags = append(tags, nostr.Tag{"e", params.MarketplaceConfirmationEventID, "", "marketplace_confirmation"})
+	}
+	for _, event_id := range []string{params.MatchEventID, params.MarketplaceEventID, params.BillboardEventID, params.PromotionEventID, params.AttentionEventID} {
+		if event_id != "" {
+			tags = append(tags, nostr.Tag{"e", event_id})
+		}
+	}
+
+	return createSettlement(private_key, core.KindAttentionPaymentConfirmation, "attention-payment-confirmation", settlementParams{
+		confirmation_id: params.ConfirmationID,
+		id_strategy:     params.IDStrategy,
+		block_height:    params.BlockHeight,
+		event_tags:      tags,
+		coordinates:     []string{params.MarketplaceCoordinate, params.BillboardCoordinate, params.PromotionCoordinate, params.AttentionCoordinate, params.MatchCoordinate},
+		pubkeys:         []string{params.MarketplacePubkey, params.BillboardPubkey, params.PromotionPubkey, params.AttentionPubkey},
+		relay_urls:      params.RelayURLs,
+		clock:           params.Clock,
+	}, content)
+}
+
+// settlementParams are the parts of a marketplace or payment confirmation
+// that createSettlement turns into tags.
+type settlementParams struct {
+	confirmation_id string
+	id_strategy     IDStrategy
+	block_height    int64
+	event_tags      nostr.Tags
+	coordinates     []string
+	pubkeys         []string
+	relay_urls      []string
+	clock           Clock
+}
+
+// createSettlement builds and signs a marketplace or payment confirmation.
+// Both tag the block height, the referenced events, coordinates, pubkeys and
+// relays in the same order.
+func createSettlement(private_key string, kind int, event_type string, params settlementParams, content interface{}) (*nostr.Event, error) {
+	content_json, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add block height tag, then the event reference tags
+	tags := nostr.Tags{{"t", fmt.Sprintf("%d", params.block_height)}}
+	tags = append(tags, params.event_tags...)
+
+	// Add coordinate tags
+	for _, coordinate := range params.coordinates {
+		if coordinate != "" {
+			tags = append(tags, nostr.Tag{"a", coordinate})
+		}
+	}
+
+	// Add pubkey tags
+	for _, pubkey := range params.pubkeys {
+		if pubkey != "" {
+			tags = append(tags, nostr.Tag{"p", pubkey})
+		}
+	}
+
+	// Add relay tags
+	for _, url := range params.relay_urls {
+		tags = append(tags, nostr.Tag{"r", url})
+	}
+
+	// Get public key
+	pk, err := nostr.GetPublicKey(private_key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Add d-tag, derived from the rest of the event when no ID is given
+	d_tag := dTag(event_type, params.confirmation_id, params.id_strategy, References(), IDSource{Kind: kind, Pubkey: pk, Tags: tags, Content: string(content_json)})
+	tags = append(nostr.Tags{{"d", d_tag}}, tags...)
+
+	// Create event
+	event := &nostr.Event{
+		PubKey:    pk,
+		CreatedAt: timestamp(params.clock),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   string(content_json),
+	}
+
+	// Sign event
+	if err := event.Sign(private_key); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
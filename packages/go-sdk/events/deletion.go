@@ -0,0 +1,130 @@
+package events
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrNothingToDelete is returned when a deletion request names no events.
+var ErrNothingToDelete = errors.New("deletion request names no events")
+
+// DeletionParams holds parameters for creating a NIP-09 deletion request.
+type DeletionParams struct {
+	// EventIDs are the IDs of the events to delete, added as e tags.
+	EventIDs []string
+
+	// Coordinates of the addressable events to delete (kind:pubkey:d_tag),
+	// added as a tags. Relays delete every version up to the request.
+	Coordinates []string
+
+	// Kinds of the events to delete, added as k tags. Coordinate kinds are
+	// added automatically.
+	Kinds []int
+
+	// Reason is the content of the request.
+	Reason string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
+}
+
+// WithdrawalParams holds parameters for withdrawing a PROMOTION or ATTENTION offer.
+type WithdrawalParams struct {
+	// ID is the promotion or attention ID of the offer's d-tag. Plain IDs are
+	// namespaced as org.attnprotocol:promotion:<id> or org.attnprotocol:attention:<id>.
+	ID string
+
+	// EventID is the ID of the published offer event, if known.
+	EventID string
+
+	// Reason is the content of the deletion request.
+	Reason string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
+}
+
+// CreateDeletion creates a NIP-09 deletion request (kind 5).
+func CreateDeletion(private_key string, params DeletionParams) (*nostr.Event, error) {
+	if len(params.EventIDs) == 0 && len(params.Coordinates) == 0 {
+		return nil, ErrNothingToDelete
+	}
+
+	// Build tags
+	tags := nostr.Tags{}
+	for _, event_id := range params.EventIDs {
+		tags = append(tags, nostr.Tag{"e", event_id})
+	}
+	kinds := make([]string, 0, len(params.Kinds)+len(params.Coordinates))
+	for _, kind := range params.Kinds {
+		kinds = append(kinds, strconv.Itoa(kind))
+	}
+	for _, coordinate := range params.Coordinates {
+		tags = append(tags, nostr.Tag{"a", coordinate})
+		kinds = append(kinds, strings.SplitN(coordinate, ":", 2)[0])
+	}
+
+	// Add one k tag per kind
+	seen := make(map[string]bool, len(kinds))
+	for _, kind := range kinds {
+		if !seen[kind] {
+			seen[kind] = true
+			tags = append(tags, nostr.Tag{"k", kind})
+		}
+	}
+
+	// Get public key
+	pk, err := nostr.GetPublicKey(private_key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create event
+	event := &nostr.Event{
+		PubKey:    pk,
+		CreatedAt: timestamp(params.Clock),
+		Kind:      core.KindDeletion,
+		Tags:      tags,
+		Content:   params.Reason,
+	}
+
+	// Sign event
+	if err := event.Sign(private_key); err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+// CreatePromotionWithdrawal creates a deletion request that withdraws one of
+// the signer's PROMOTION events (kind 38388).
+func CreatePromotionWithdrawal(private_key string, params WithdrawalParams) (*nostr.Event, error) {
+	return createWithdrawal(private_key, core.KindPromotion, "promotion", params)
+}
+
+// CreateAttentionWithdrawal creates a deletion request that withdraws one of
+// the signer's ATTENTION events (kind 38488).
+func CreateAttentionWithdrawal(private_key string, params WithdrawalParams) (*nostr.Event, error) {
+	return createWithdrawal(private_key, core.KindAttention, "attention", params)
+}
+
+// createWithdrawal builds a deletion request for the signer's offer at the
+// given kind and d-tag.
+func createWithdrawal(private_key string, kind int, event_type string, params WithdrawalParams) (*nostr.Event, error) {
+	deletion := DeletionParams{Kinds: []int{kind}, Reason: params.Reason, Clock: params.Clock}
+	if params.ID != "" {
+		pk, err := nostr.GetPublicKey(private_key)
+		if err != nil {
+			return nil, err
+		}
+		deletion.Coordinates = []string{FormatCoordinate(kind, pk, FormatDTag(event_type, params.ID))}
+	}
+	if params.EventID != "" {
+		deletion.EventIDs = []string{params.EventID}
+	}
+	return CreateDeletion(private_key, deletion)
+}
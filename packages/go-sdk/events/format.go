@@ -0,0 +1,32 @@
+package events
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+)
+
+// dTagPrefix is the ATTN Protocol namespace for d tags.
+const dTagPrefix = "org.attnprotocol:"
+
+// FormatDTag formats a d tag as org.attnprotocol:<event_type>:<identifier>.
+// Identifiers that already carry the org.attnprotocol: prefix are returned as-is.
+func FormatDTag(event_type string, identifier string) string {
+	if strings.HasPrefix(identifier, dTagPrefix) {
+		return identifier
+	}
+	return dTagPrefix + event_type + ":" + identifier
+}
+
+// FormatCoordinate formats an 'a' tag coordinate as kind:pubkey:d_tag.
+func FormatCoordinate(kind int, pubkey string, d_tag string) string {
+	return fmt.Sprintf("%d:%s:%s", kind, pubkey, d_tag)
+}
+
+// ParseCoordinate splits an 'a' tag coordinate into the kind, pubkey and d tag
+// FormatCoordinate joins. The d tag may itself contain colons. A malformed
+// coordinate yields kind 0 and an error.
+func ParseCoordinate(coordinate string) (kind int, pubkey string, d_tag string, err error) {
+	return core.ParseCoordinate(coordinate)
+}
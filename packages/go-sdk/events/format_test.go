@@ -0,0 +1,243 @@
+package events
+
+import (
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestFormatDTag(t *testing.T) {
+	if got := FormatDTag("promotion", "p1"); got != "org.attnprotocol:promotion:p1" {
+		t.Errorf("expected namespaced d tag, got %q", got)
+	}
+	if got := FormatDTag("promotion", "org.attnprotocol:promotion:p1"); got != "org.attnprotocol:promotion:p1" {
+		t.Errorf("expected prefixed identifier to be kept, got %q", got)
+	}
+}
+
+// matchWithCoordinates returns a MATCH event whose 'a' tags are the given coordinates
+// and whose other tags and content satisfy validation.
+func matchWithCoordinates(pubkey string, coordinates ...string) *nostr.Event {
+	tags := nostr.Tags{
+		{"d", FormatDTag("match", "m1")},
+		{"t", "870500"},
+	}
+	for _, coordinate := range coordinates {
+		tags = append(tags, nostr.Tag{"a", coordinate})
+	}
+	tags = append(tags,
+		nostr.Tag{"p", pubkey}, nostr.Tag{"p", pubkey}, nostr.Tag{"p", pubkey}, nostr.Tag{"p", pubkey},
+		nostr.Tag{"r", "wss://relay.example.com"},
+		nostr.Tag{"k", "34236"},
+	)
+	return &nostr.Event{
+		Kind:   core.KindMatch,
+		PubKey: pubkey,
+		Tags:   tags,
+		Content: `{"ref_match_id":"m1","ref_promotion_id":"p","ref_attention_id":"a","ref_billboard_id":"b","ref_marketplace_id":"m",` +
+			`"ref_marketplace_pubkey":"x","ref_promotion_pubkey":"x","ref_attention_pubkey":"x","ref_billboard_pubkey":"x"}`,
+	}
+}
+
+// Property: a coordinate built with FormatDTag and FormatCoordinate from any
+// non-empty identifier passes validation.
+func TestFormatCoordinate_AlwaysValidates(t *testing.T) {
+	pubkey := strings.Repeat("ab", 32)
+
+	property := func(marketplace_id, billboard_id, promotion_id, attention_id string) bool {
+		for _, id := range []string{marketplace_id, billboard_id, promotion_id, attention_id} {
+			if id == "" || strings.HasPrefix(id, "org.attnprotocol:") {
+				return true
+			}
+		}
+
+		event := matchWithCoordinates(pubkey,
+			FormatCoordinate(core.KindMarketplace, pubkey, FormatDTag("marketplace", marketplace_id)),
+			FormatCoordinate(core.KindBillboard, pubkey, FormatDTag("billboard", billboard_id)),
+			FormatCoordinate(core.KindPromotion, pubkey, FormatDTag("promotion", promotion_id)),
+			FormatCoordinate(core.KindAttention, pubkey, FormatDTag("attention", attention_id)),
+		)
+		result := validation.ValidateATTNEvent(event)
+		if !result.Valid {
+			t.Logf("ids %q %q %q %q: %s", marketplace_id, billboard_id, promotion_id, attention_id, result.Message)
+		}
+		return result.Valid
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+// Property: ParseCoordinate recovers what FormatCoordinate joined, whatever the d tag.
+func TestParseCoordinate_RoundTrip(t *testing.T) {
+	pubkey := strings.Repeat("ab", 32)
+
+	property := func(kind uint16, d_tag string) bool {
+		parsed_kind, parsed_pubkey, parsed_d_tag, err := ParseCoordinate(FormatCoordinate(int(kind), pubkey, d_tag))
+		return err == nil && parsed_kind == int(kind) && parsed_pubkey == pubkey && parsed_d_tag == d_tag
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseBlock_OnlyTrustedClock(t *testing.T) {
+	clock := strings.Repeat("ab", 32)
+	block := func(pubkey string, content string) *nostr.Event {
+		return &nostr.Event{Kind: core.KindCityBlock, PubKey: pubkey, Content: content}
+	}
+
+	if height, ok := ParseBlock(block(clock, `{"block_height":870500}`), clock); !ok || height != 870500 {
+		t.Errorf("expected the clock's block 870500, got %d, %v", height, ok)
+	}
+	for name, event := range map[string]*nostr.Event{
+		"other pubkey": block(strings.Repeat("cd", 32), `{"block_height":870500}`),
+		"no height":    block(clock, `{}`),
+		"bad content":  block(clock, `not json`),
+		"other kind":   {Kind: core.KindMatch, PubKey: clock, Content: `{"block_height":870500}`},
+	} {
+		if _, ok := ParseBlock(event, clock); ok {
+			t.Errorf("%s: expected the event to be ignored", name)
+		}
+	}
+	if _, ok := ParseBlock(block(clock, `{"block_height":870500}`), ""); ok {
+		t.Error("expected blocks to be ignored without a clock pubkey")
+	}
+}
+
+// Property: builders namespace plain IDs, so the d tag of a built event always
+// passes validation's d tag rules.
+func TestBuilders_DTagAlwaysNamespaced(t *testing.T) {
+	private_key := nostr.GeneratePrivateKey()
+
+	property := func(id string) bool {
+		if id == "" || strings.HasPrefix(id, "org.attnprotocol:") {
+			return true
+		}
+
+		event, err := CreatePromotion(private_key, PromotionParams{PromotionID: id, BlockHeight: 870500})
+		if err != nil {
+			t.Logf("CreatePromotion(%q): %v", id, err)
+			return false
+		}
+		coordinate := FormatCoordinate(event.Kind, event.PubKey, event.Tags.GetD())
+
+		// Reference the built promotion from an otherwise valid MATCH
+		pubkey := strings.Repeat("ab", 32)
+		match := matchWithCoordinates(pubkey,
+			FormatCoordinate(core.KindMarketplace, pubkey, FormatDTag("marketplace", "m")),
+			FormatCoordinate(core.KindBillboard, pubkey, FormatDTag("billboard", "b")),
+			coordinate,
+			FormatCoordinate(core.KindAttention, pubkey, FormatDTag("attention", "a")),
+		)
+		result := validation.ValidateATTNEvent(match)
+		if !result.Valid {
+			t.Logf("id %q: %s", id, result.Message)
+		}
+		return result.Valid
+	}
+
+	if err := quick.Check(property, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCreatePromotionWithdrawal(t *testing.T) {
+	private_key := nostr.GeneratePrivateKey()
+	promotion, err := CreatePromotion(private_key, PromotionParams{PromotionID: "p1", BlockHeight: 870500})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deletion, err := CreatePromotionWithdrawal(private_key, WithdrawalParams{ID: "p1", EventID: promotion.ID, Reason: "campaign ended"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deletion.Kind != core.KindDeletion || deletion.Content != "campaign ended" {
+		t.Errorf("unexpected deletion request %+v", deletion)
+	}
+	if kinds := deletion.Tags.GetAll([]string{"k"}); len(kinds) != 1 || kinds[0][1] != "38388" {
+		t.Errorf("expected one k tag for the promotion kind, got %v", kinds)
+	}
+	if !core.Withdraws(deletion, promotion) {
+		t.Error("expected the deletion request to withdraw the promotion")
+	}
+
+	// Withdrawing by ID alone still names the coordinate
+	deletion, _ = CreateAttentionWithdrawal(private_key, WithdrawalParams{ID: "a1"})
+	if a_tag := deletion.Tags.Find("a"); a_tag == nil || a_tag[1] != FormatCoordinate(core.KindAttention, deletion.PubKey, "org.attnprotocol:attention:a1") {
+		t.Errorf("expected the attention coordinate, got %v", deletion.Tags)
+	}
+	if _, err := CreateDeletion(private_key, DeletionParams{Kinds: []int{core.KindPromotion}}); err != ErrNothingToDelete {
+		t.Errorf("expected ErrNothingToDelete, got %v", err)
+	}
+}
+
+func TestIDStrategies(t *testing.T) {
+	private_key := nostr.GeneratePrivateKey()
+	params := PromotionParams{Bid: 1000, Duration: 30000, BlockHeight: 870500, MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:m"}
+	d_tag := func(event *nostr.Event, err error) string {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return event.Tags.GetD()
+	}
+
+	// A retry with the same params replaces the first event
+	first := d_tag(CreatePromotion(private_key, params))
+	if retry := d_tag(CreatePromotion(private_key, params)); retry != first {
+		t.Errorf("expected a retry to keep d tag %q, got %q", first, retry)
+	}
+	if !strings.HasPrefix(first, "org.attnprotocol:promotion:") {
+		t.Errorf("expected a namespaced d tag, got %q", first)
+	}
+	raised := params
+	raised.Bid = 2000
+	if other := d_tag(CreatePromotion(private_key, raised)); other == first {
+		t.Error("expected different content to get a different d tag")
+	}
+	if other := d_tag(CreatePromotion(nostr.GeneratePrivateKey(), params)); other == first {
+		t.Error("expected another signer to get a different d tag")
+	}
+
+	// An idempotency key names the event whatever its content
+	params.IDStrategy, raised.IDStrategy = IdempotencyKey("order-42"), IdempotencyKey("order-42")
+	if d_tag(CreatePromotion(private_key, params)) != d_tag(CreatePromotion(private_key, raised)) {
+		t.Error("expected the same idempotency key to give the same d tag")
+	}
+
+	// A MATCH is named by the offers it pairs and its block
+	match := MatchParams{
+		BlockHeight:           870501,
+		MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:m",
+		BillboardCoordinate:   "38288:pk:org.attnprotocol:billboard:b",
+		PromotionCoordinate:   "38388:pk:org.attnprotocol:promotion:p",
+		AttentionCoordinate:   "38488:pk:org.attnprotocol:attention:a",
+	}
+	paired := d_tag(CreateMatch(private_key, match))
+	swapped := match
+	swapped.MarketplacePubkey = "pk"
+	swapped.PromotionID = "p"
+	if d_tag(CreateMatch(private_key, swapped)) != paired {
+		t.Error("expected a match of the same offers to keep its d tag")
+	}
+	match.BlockHeight = 870502
+	if d_tag(CreateMatch(private_key, match)) == paired {
+		t.Error("expected a match at another block to get a new d tag")
+	}
+
+	// A confirmation is named by the match it confirms
+	confirmation := ConfirmationParams{BlockHeight: 870501, MatchCoordinate: "38888:pk:org.attnprotocol:match:m"}
+	confirmed := d_tag(CreateAttentionConfirmation(private_key, confirmation))
+	confirmation.RelayURLs = []string{"wss://relay.example.com"}
+	if d_tag(CreateAttentionConfirmation(private_key, confirmation)) != confirmed {
+		t.Error("expected a confirmation of the same match to keep its d tag")
+	}
+}
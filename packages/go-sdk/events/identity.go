@@ -0,0 +1,97 @@
+package events
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// IDSource is what an IDStrategy knows about the event it names: everything
+// but the d tag.
+type IDSource struct {
+	Kind    int
+	Pubkey  string
+	Tags    nostr.Tags
+	Content string
+}
+
+// IDStrategy derives the identifier of an event's d tag when its params carry
+// no ID. A strategy must return the same identifier for the same source, so a
+// retried publish replaces the first event rather than adding a second.
+type IDStrategy interface {
+	ID(source IDSource) string
+}
+
+// IDStrategyFunc adapts a function to the IDStrategy interface.
+type IDStrategyFunc func(source IDSource) string
+
+// ID calls f(source).
+func (f IDStrategyFunc) ID(source IDSource) string {
+	return f(source)
+}
+
+// ContentHash derives the ID from a hash of the event's kind, pubkey, tags and
+// content. Building the same params twice yields the same d tag; changing any
+// of them yields a new one. It is the default for PROMOTION, ATTENTION and
+// MARKETPLACE events.
+func ContentHash() IDStrategy {
+	return IDStrategyFunc(func(source IDSource) string {
+		return hashID(source.Kind, source.Pubkey, source.Tags, source.Content)
+	})
+}
+
+// IdempotencyKey derives the ID from a caller-supplied key, scoped to the
+// event's kind and pubkey. Every event built with the same key replaces the
+// last, whatever its content.
+func IdempotencyKey(key string) IDStrategy {
+	return IDStrategyFunc(func(source IDSource) string {
+		return hashID(source.Kind, source.Pubkey, "idempotency", key)
+	})
+}
+
+// References derives the ID from the coordinates the event references in its
+// a tags and its block height, in any order. Two MATCH events pairing the same
+// offers at the same block share a d tag, as do two confirmations of one
+// match by the same signer. It is the default for MATCH and confirmation events.
+func References() IDStrategy {
+	return IDStrategyFunc(func(source IDSource) string {
+		var coordinates []string
+		var block_height string
+		for _, tag := range source.Tags {
+			if len(tag) < 2 {
+				continue
+			}
+			switch tag[0] {
+			case "a":
+				coordinates = append(coordinates, tag[1])
+			case "t":
+				block_height = tag[1]
+			}
+		}
+		sort.Strings(coordinates)
+		return hashID(source.Kind, source.Pubkey, block_height, coordinates)
+	})
+}
+
+// hashID returns the first 16 bytes of the SHA-256 of values encoded as a JSON
+// array, in hex.
+func hashID(values ...interface{}) string {
+	data, _ := json.Marshal(values)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// dTag returns the namespaced d tag for id. An empty id is derived by strategy,
+// or by fallback when strategy is nil, from the rest of the event.
+func dTag(event_type, id string, strategy, fallback IDStrategy, source IDSource) string {
+	if id != "" {
+		return FormatDTag(event_type, id)
+	}
+	if strategy == nil {
+		strategy = fallback
+	}
+	return FormatDTag(event_type, strategy.ID(source))
+}
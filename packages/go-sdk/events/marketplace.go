@@ -3,7 +3,6 @@ package events
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
@@ -33,8 +32,12 @@ type MarketplaceParams struct {
 	ConfirmationFeeSats int64
 
 	// MarketplaceID is the unique marketplace ID for the d-tag.
+	// Plain IDs are namespaced as org.attnprotocol:marketplace:<id>.
 	MarketplaceID string
 
+	// IDStrategy derives the ID when it is empty. Defaults to ContentHash.
+	IDStrategy IDStrategy
+
 	// MarketplacePubkey is the marketplace's pubkey.
 	MarketplacePubkey string
 
@@ -64,6 +67,9 @@ type MarketplaceParams struct {
 	PromotionCount int64
 	AttentionCount int64
 	MatchCount     int64
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
 }
 
 // CreateMarketplace creates a MARKETPLACE event (kind 38188).
@@ -95,13 +101,6 @@ func CreateMarketplace(private_key string, params MarketplaceParams) (*nostr.Eve
 	// Build tags
 	tags := nostr.Tags{}
 
-	// Add d-tag
-	d_tag := params.MarketplaceID
-	if d_tag == "" {
-		d_tag = fmt.Sprintf("org.attnprotocol:marketplace:%d", time.Now().UnixNano())
-	}
-	tags = append(tags, nostr.Tag{"d", d_tag})
-
 	// Add block height tag
 	tags = append(tags, nostr.Tag{"t", fmt.Sprintf("%d", params.BlockHeight)})
 
@@ -126,10 +125,14 @@ func CreateMarketplace(private_key string, params MarketplaceParams) (*nostr.Eve
 		return nil, err
 	}
 
+	// Add d-tag, derived from the rest of the event when no ID is given
+	d_tag := dTag("marketplace", params.MarketplaceID, params.IDStrategy, ContentHash(), IDSource{Kind: core.KindMarketplace, Pubkey: pk, Tags: tags, Content: string(content_json)})
+	tags = append(nostr.Tags{{"d", d_tag}}, tags...)
+
 	// Create event
 	event := &nostr.Event{
 		PubKey:    pk,
-		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		CreatedAt: timestamp(params.Clock),
 		Kind:      core.KindMarketplace,
 		Tags:      tags,
 		Content:   string(content_json),
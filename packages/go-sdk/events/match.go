@@ -3,7 +3,6 @@ package events
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
@@ -12,8 +11,12 @@ import (
 // MatchParams holds parameters for creating a match event.
 type MatchParams struct {
 	// MatchID is the unique match ID for the d-tag.
+	// Plain IDs are namespaced as org.attnprotocol:match:<id>.
 	MatchID string
 
+	// IDStrategy derives the ID when it is empty. Defaults to References.
+	IDStrategy IDStrategy
+
 	// BlockHeight is the Bitcoin block height.
 	BlockHeight int64
 
@@ -40,6 +43,9 @@ type MatchParams struct {
 	BillboardID   string
 	PromotionID   string
 	AttentionID   string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
 }
 
 // CreateMatch creates a MATCH event (kind 38888).
@@ -65,13 +71,6 @@ func CreateMatch(private_key string, params MatchParams) (*nostr.Event, error) {
 	// Build tags
 	tags := nostr.Tags{}
 
-	// Add d-tag
-	d_tag := params.MatchID
-	if d_tag == "" {
-		d_tag = fmt.Sprintf("org.attnprotocol:match:%d", time.Now().UnixNano())
-	}
-	tags = append(tags, nostr.Tag{"d", d_tag})
-
 	// Add block height tag
 	tags = append(tags, nostr.Tag{"t", fmt.Sprintf("%d", params.BlockHeight)})
 
@@ -109,10 +108,14 @@ func CreateMatch(private_key string, params MatchParams) (*nostr.Event, error) {
 		return nil, err
 	}
 
+	// Add d-tag, derived from the rest of the event when no ID is given
+	d_tag := dTag("match", params.MatchID, params.IDStrategy, References(), IDSource{Kind: core.KindMatch, Pubkey: pk, Tags: tags, Content: string(content_json)})
+	tags = append(nostr.Tags{{"d", d_tag}}, tags...)
+
 	// Create event
 	event := &nostr.Event{
 		PubKey:    pk,
-		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		CreatedAt: timestamp(params.Clock),
 		Kind:      core.KindMatch,
 		Tags:      tags,
 		Content:   string(content_json),
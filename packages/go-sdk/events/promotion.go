@@ -3,7 +3,7 @@ package events
 import (
 	"encoding/json"
 	"fmt"
-	"time"
+	"strings"
 
 	"github.com/joinnextblock/attn-protocol/go-core"
 	"github.com/nbd-wtf/go-nostr"
@@ -35,14 +35,25 @@ type PromotionParams struct {
 	// BillboardCoordinate is the billboard coordinate (38288:pubkey:id).
 	BillboardCoordinate string
 
+	// VideoCoordinate is the coordinate of the promoted content (34236:pubkey:d_tag).
+	// Its kind is also added as the k tag.
+	VideoCoordinate string
+
 	// BlockHeight is the Bitcoin block height.
 	BlockHeight int64
 
 	// PromotionID is the unique promotion ID for the d-tag.
+	// Plain IDs are namespaced as org.attnprotocol:promotion:<id>.
 	PromotionID string
 
+	// IDStrategy derives the ID when it is empty. Defaults to ContentHash.
+	IDStrategy IDStrategy
+
 	// PromotionPubkey is the promoter's pubkey.
 	PromotionPubkey string
+
+	// Clock sets CreatedAt. Defaults to SystemClock.
+	Clock Clock
 }
 
 // CreatePromotion creates a PROMOTION event (kind 38388).
@@ -67,13 +78,6 @@ func CreatePromotion(private_key string, params PromotionParams) (*nostr.Event,
 	// Build tags
 	tags := nostr.Tags{}
 
-	// Add d-tag
-	d_tag := params.PromotionID
-	if d_tag == "" {
-		d_tag = fmt.Sprintf("org.attnprotocol:promotion:%d", time.Now().UnixNano())
-	}
-	tags = append(tags, nostr.Tag{"d", d_tag})
-
 	// Add block height tag
 	tags = append(tags, nostr.Tag{"t", fmt.Sprintf("%d", params.BlockHeight)})
 
@@ -87,16 +91,26 @@ func CreatePromotion(private_key string, params PromotionParams) (*nostr.Event,
 		tags = append(tags, nostr.Tag{"a", params.BillboardCoordinate})
 	}
 
+	// Add promoted content coordinate and kind
+	if params.VideoCoordinate != "" {
+		tags = append(tags, nostr.Tag{"a", params.VideoCoordinate})
+		tags = append(tags, nostr.Tag{"k", strings.SplitN(params.VideoCoordinate, ":", 2)[0]})
+	}
+
 	// Get public key
 	pk, err := nostr.GetPublicKey(private_key)
 	if err != nil {
 		return nil, err
 	}
 
+	// Add d-tag, derived from the rest of the event when no ID is given
+	d_tag := dTag("promotion", params.PromotionID, params.IDStrategy, ContentHash(), IDSource{Kind: core.KindPromotion, Pubkey: pk, Tags: tags, Content: string(content_json)})
+	tags = append(nostr.Tags{{"d", d_tag}}, tags...)
+
 	// Create event
 	event := &nostr.Event{
 		PubKey:    pk,
-		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		CreatedAt: timestamp(params.Clock),
 		Kind:      core.KindPromotion,
 		Tags:      tags,
 		Content:   string(content_json),
@@ -0,0 +1,146 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// update rewrites the snapshots: go test ./events -run TestBuilders_Snapshots -update
+var update = flag.Bool("update", false, "rewrite the event snapshots in testdata/snapshots")
+
+// snapshotKey signs every snapshot event.
+var snapshotKey = strings.Repeat("01", 32)
+
+// snapshotClock is the time every snapshot event is created at.
+var snapshotClock = FixedClock(time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC))
+
+// snapshotBuilders builds one event of every kind with fixed params.
+var snapshotBuilders = map[string]func() (*nostr.Event, error){
+	"marketplace": func() (*nostr.Event, error) {
+		return CreateMarketplace(snapshotKey, MarketplaceParams{
+			Name: "Snapshot Market", MinDuration: 15000, MaxDuration: 60000, MatchFeeSats: 100, ConfirmationFeeSats: 50,
+			MarketplaceID: "mk-1", BlockHeight: 870500, KindList: []int{34236}, RelayList: []string{"wss://relay.example.com"},
+			Clock: snapshotClock,
+		})
+	},
+	"billboard": func() (*nostr.Event, error) {
+		return CreateBillboard(snapshotKey, BillboardParams{
+			Name: "Snapshot Billboard", ConfirmationFeeSats: 50, BillboardID: "bb-1", BlockHeight: 870500,
+			MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:mk-1", BillboardPubkey: "pk", MarketplacePubkey: "pk", MarketplaceID: "mk-1",
+			Kind: 34236, URL: "https://billboard.example.com", RelayURLs: []string{"wss://relay.example.com"}, Clock: snapshotClock,
+		})
+	},
+	"promotion": func() (*nostr.Event, error) {
+		return CreatePromotion(snapshotKey, PromotionParams{
+			Duration: 30000, Bid: 5000, EventID: strings.Repeat("ab", 32), CallToAction: "Watch", CallToActionURL: "https://example.com",
+			EscrowIDList: []string{"escrow-1"}, BlockHeight: 870500,
+			MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:mk-1", BillboardCoordinate: "38288:pk:org.attnprotocol:billboard:bb-1",
+			VideoCoordinate: "34236:author:video-1", Clock: snapshotClock,
+		})
+	},
+	"attention": func() (*nostr.Event, error) {
+		return CreateAttention(snapshotKey, AttentionParams{
+			Ask: 3000, MinDuration: 15000, MaxDuration: 60000, MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:mk-1",
+			BlockHeight: 870500, AttentionID: "at-1", Clock: snapshotClock,
+		})
+	},
+	"match": func() (*nostr.Event, error) {
+		return CreateMatch(snapshotKey, MatchParams{
+			BlockHeight:           870501,
+			MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:mk-1", BillboardCoordinate: "38288:pk:org.attnprotocol:billboard:bb-1",
+			PromotionCoordinate: "38388:pk:org.attnprotocol:promotion:pr-1", AttentionCoordinate: "38488:pk:org.attnprotocol:attention:at-1",
+			MarketplacePubkey: "pk", BillboardPubkey: "pk", PromotionPubkey: "pk", AttentionPubkey: "pk",
+			Clock: snapshotClock,
+		})
+	},
+	"billboard-confirmation": func() (*nostr.Event, error) {
+		return CreateBillboardConfirmation(snapshotKey, snapshotConfirmation())
+	},
+	"attention-confirmation": func() (*nostr.Event, error) {
+		return CreateAttentionConfirmation(snapshotKey, snapshotConfirmation())
+	},
+	"marketplace-confirmation": func() (*nostr.Event, error) {
+		confirmation := snapshotConfirmation()
+		return CreateMarketplaceConfirmation(snapshotKey, MarketplaceConfirmationParams{
+			BlockHeight: confirmation.BlockHeight, MatchID: confirmation.MatchID,
+			MarketplaceCoordinate: confirmation.MarketplaceCoordinate, BillboardCoordinate: confirmation.BillboardCoordinate,
+			PromotionCoordinate: confirmation.PromotionCoordinate, AttentionCoordinate: confirmation.AttentionCoordinate,
+			MatchCoordinate: confirmation.MatchCoordinate, MatchEventID: confirmation.MatchEventID,
+			BillboardConfirmationEventID: strings.Repeat("ef", 32), AttentionConfirmationEventID: strings.Repeat("12", 32),
+			MarketplaceEventID: strings.Repeat("34", 32), BillboardEventID: strings.Repeat("56", 32),
+			PromotionEventID: strings.Repeat("78", 32), AttentionEventID: strings.Repeat("9a", 32),
+			MarketplacePubkey: "pk", BillboardPubkey: "pk", PromotionPubkey: "pk", AttentionPubkey: "pk",
+			MarketplaceID: "mk-1", BillboardID: "bb-1", PromotionID: "pr-1", AttentionID: "at-1",
+			RelayURLs: confirmation.RelayURLs, Clock: snapshotClock,
+		})
+	},
+	"attention-payment-confirmation": func() (*nostr.Event, error) {
+		confirmation := snapshotConfirmation()
+		return CreateAttentionPaymentConfirmation(snapshotKey, AttentionPaymentConfirmationParams{
+			BlockHeight: confirmation.BlockHeight, SatsReceived: 3000, PaymentProof: "zap:" + strings.Repeat("bc", 32), MatchID: confirmation.MatchID,
+			MarketplaceCoordinate: confirmation.MarketplaceCoordinate, BillboardCoordinate: confirmation.BillboardCoordinate,
+			PromotionCoordinate: confirmation.PromotionCoordinate, AttentionCoordinate: confirmation.AttentionCoordinate,
+			MatchCoordinate: confirmation.MatchCoordinate, MarketplaceConfirmationEventID: strings.Repeat("de", 32), MatchEventID: confirmation.MatchEventID,
+			MarketplacePubkey: "pk", BillboardPubkey: "pk", PromotionPubkey: "pk", AttentionPubkey: "pk",
+			MarketplaceID: "mk-1", BillboardID: "bb-1", PromotionID: "pr-1", AttentionID: "at-1",
+			RelayURLs: confirmation.RelayURLs, Clock: snapshotClock,
+		})
+	},
+	"promotion-withdrawal": func() (*nostr.Event, error) {
+		return CreatePromotionWithdrawal(snapshotKey, WithdrawalParams{ID: "pr-1", Reason: "campaign ended", Clock: snapshotClock})
+	},
+}
+
+func snapshotConfirmation() ConfirmationParams {
+	return ConfirmationParams{
+		BlockHeight: 870501, MatchID: "org.attnprotocol:match:m-1",
+		MarketplaceCoordinate: "38188:pk:org.attnprotocol:marketplace:mk-1", BillboardCoordinate: "38288:pk:org.attnprotocol:billboard:bb-1",
+		PromotionCoordinate: "38388:pk:org.attnprotocol:promotion:pr-1", AttentionCoordinate: "38488:pk:org.attnprotocol:attention:at-1",
+		MatchCoordinate: "38888:pk:org.attnprotocol:match:m-1", MatchEventID: strings.Repeat("cd", 32),
+		RelayURLs: []string{"wss://relay.example.com"}, Clock: snapshotClock,
+	}
+}
+
+// TestBuilders_Snapshots checks that every builder, given a fixed key, clock
+// and params, builds exactly the event in testdata/snapshots. The signature is
+// checked rather than compared.
+func TestBuilders_Snapshots(t *testing.T) {
+	for name, build := range snapshotBuilders {
+		t.Run(name, func(t *testing.T) {
+			event, err := build()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok, err := event.CheckSignature(); !ok {
+				t.Fatalf("invalid signature: %v", err)
+			}
+			unsigned := *event
+			unsigned.Sig = ""
+			got, err := json.MarshalIndent(unsigned, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", "snapshots", name+".json")
+			if *update {
+				if err := os.WriteFile(path, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(path)
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("%s is out of date; run go test ./events -run TestBuilders_Snapshots -update\ngot:\n%s", path, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package markettest publishes a small ATTN marketplace to an in-process relay,
+// for tests of the packages that act on marketplace events.
+//
+// Example usage:
+//
+//	m := markettest.New(t, ctx)
+//	promotion := m.Promote(t, ctx, "pr-1", 1000, 30000)
+//	match := m.Match(t, m.Marketplace, "m-1", markettest.Coordinate(promotion), m.BillboardCoordinate, 870501)
+package markettest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// BlockHeight is the block the market's events are published at.
+const BlockHeight = 870500
+
+// Market is a marketplace, a billboard and an attention offer published to a
+// local relay, and the private keys of the parties that signed them.
+type Market struct {
+	Relay *relaytest.Relay
+	Pool  *relay.Pool
+
+	// Private keys of the marketplace, the billboard operator, the promoter
+	// and the attention provider
+	Marketplace, Operator, Promoter, Provider string
+
+	MarketplaceCoordinate, BillboardCoordinate, AttentionCoordinate string
+	Attention                                                       *nostr.Event
+}
+
+// New starts a local relay, connects a pool to it and publishes the
+// marketplace mk-1, the billboard bb-1 and the attention at-1. Both are
+// closed when the test ends.
+func New(t testing.TB, ctx context.Context) *Market {
+	t.Helper()
+	mock := relaytest.NewRelay(relaytest.Options{})
+	t.Cleanup(mock.Close)
+	pool, err := relay.NewPool([]string{mock.URL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Connect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	m := &Market{
+		Relay: mock, Pool: pool,
+		Marketplace: nostr.GeneratePrivateKey(), Operator: nostr.GeneratePrivateKey(),
+		Promoter: nostr.GeneratePrivateKey(), Provider: nostr.GeneratePrivateKey(),
+	}
+	m.MarketplaceCoordinate = events.FormatCoordinate(core.KindMarketplace, Pubkey(m.Marketplace), events.FormatDTag("marketplace", "mk-1"))
+	m.BillboardCoordinate = events.FormatCoordinate(core.KindBillboard, Pubkey(m.Operator), events.FormatDTag("billboard", "bb-1"))
+	m.AttentionCoordinate = events.FormatCoordinate(core.KindAttention, Pubkey(m.Provider), events.FormatDTag("attention", "at-1"))
+
+	marketplace, err := events.CreateMarketplace(m.Marketplace, events.MarketplaceParams{Name: "Market", MarketplaceID: "mk-1", BlockHeight: BlockHeight})
+	if err != nil {
+		t.Fatal(err)
+	}
+	billboard := &nostr.Event{Kind: core.KindBillboard, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"d", events.FormatDTag("billboard", "bb-1")}}, Content: "{}"}
+	if err := billboard.Sign(m.Operator); err != nil {
+		t.Fatal(err)
+	}
+	m.Attention, err = events.CreateAttention(m.Provider, events.AttentionParams{
+		Ask: 500, MinDuration: 15000, MaxDuration: 60000, AttentionID: "at-1", BlockHeight: BlockHeight, AttentionPubkey: Pubkey(m.Provider),
+		MarketplaceCoordinate: m.MarketplaceCoordinate,
+		BlockedPromotionsID:   core.NIP51BlockedPromotions, BlockedPromotersID: core.NIP51BlockedPromoters,
+		TrustedMarketplacesID: core.NIP51TrustedMarketplaces, TrustedBillboardsID: core.NIP51TrustedBillboards,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, event := range []*nostr.Event{marketplace, billboard, m.Attention} {
+		if err := pool.Publish(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return m
+}
+
+// Promote publishes a PROMOTION of the video 34236:author:<promotion_id> on
+// the market's billboard and returns it.
+func (m *Market) Promote(t testing.TB, ctx context.Context, promotion_id string, bid, duration int64) *nostr.Event {
+	t.Helper()
+	promotion, err := events.CreatePromotion(m.Promoter, events.PromotionParams{
+		Bid: bid, Duration: duration, EventID: "video-" + promotion_id, CallToAction: "Watch", CallToActionURL: "https://example.com/" + promotion_id,
+		PromotionID: promotion_id, BlockHeight: BlockHeight, PromotionPubkey: Pubkey(m.Promoter),
+		MarketplaceCoordinate: m.MarketplaceCoordinate, BillboardCoordinate: m.BillboardCoordinate,
+		VideoCoordinate: "34236:author:" + promotion_id,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Pool.Publish(ctx, promotion); err != nil {
+		t.Fatal(err)
+	}
+	return promotion
+}
+
+// Match builds a MATCH signed by key that pairs a promotion on a billboard
+// with the market's attention at block_height.
+func (m *Market) Match(t testing.TB, key, match_id, promotion_coordinate, billboard_coordinate string, block_height int64) *nostr.Event {
+	t.Helper()
+	_, _, promotion_d_tag, _ := events.ParseCoordinate(promotion_coordinate)
+	match, err := events.CreateMatch(key, events.MatchParams{
+		MatchID: match_id, BlockHeight: block_height,
+		MarketplaceCoordinate: m.MarketplaceCoordinate, BillboardCoordinate: billboard_coordinate,
+		PromotionCoordinate: promotion_coordinate, AttentionCoordinate: m.AttentionCoordinate,
+		MarketplacePubkey: Pubkey(m.Marketplace), BillboardPubkey: Pubkey(m.Operator),
+		PromotionPubkey: Pubkey(m.Promoter), AttentionPubkey: Pubkey(m.Provider),
+		MarketplaceID: "mk-1", BillboardID: "bb-1", AttentionID: "at-1",
+		PromotionID: strings.TrimPrefix(promotion_d_tag, "org.attnprotocol:promotion:"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return match
+}
+
+// Coordinate returns the coordinate of an addressable event.
+func Coordinate(event *nostr.Event) string {
+	return events.FormatCoordinate(event.Kind, event.PubKey, event.Tags.GetD())
+}
+
+// Pubkey returns the public key of a private key.
+func Pubkey(private_key string) string {
+	pubkey, _ := nostr.GetPublicKey(private_key)
+	return pubkey
+}
@@ -0,0 +1,364 @@
+// Package ledger derives who owes whom for confirmed matches.
+//
+// A match is confirmed once its marketplace publishes a MARKETPLACE_CONFIRMATION.
+// Settle prices it from the referenced MARKETPLACE, BILLBOARD, PROMOTION and
+// ATTENTION events as ATTN-01 describes: the promoter pays the attention owner
+// the ask, the billboard its confirmation_fee_sats, and the marketplace its
+// match_fee_sats and confirmation_fee_sats. Each payment is one double-entry
+// Entry debiting the promoter and crediting the payee. The attention owner's
+// ATTENTION_PAYMENT_CONFIRMATION events are reconciled against the ask, so
+// under- and over-payments are flagged.
+//
+// Example usage:
+//
+//	book, err := ledger.Build(ctx, event_store, marketplace_coordinate)
+//	for _, settlement := range book.Discrepancies() {
+//	    log.Printf("%s: %s by %d sats", settlement.MatchCoordinate, settlement.Status, settlement.Discrepancy)
+//	}
+//	statement := book.Statement(billboard_pubkey)
+//	err = statement.WriteCSV(os.Stdout)
+package ledger
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrNotMarketplaceConfirmation is returned when Resolve is given another kind.
+	ErrNotMarketplaceConfirmation = errors.New("not a MARKETPLACE_CONFIRMATION event")
+
+	// ErrInvalidConfirmation is returned for a marketplace confirmation missing a
+	// coordinate, or not signed by the marketplace it references.
+	ErrInvalidConfirmation = errors.New("invalid marketplace confirmation")
+
+	// ErrUnresolved is returned when a referenced event is not found.
+	ErrUnresolved = errors.New("referenced event not found")
+)
+
+// Querier answers filter queries against indexed events. store.Store and
+// *relay.Pool implement it.
+type Querier interface {
+	Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+// EntryType names what an entry pays for.
+type EntryType string
+
+const (
+	// EntryAttentionPayout pays the attention owner the ask.
+	EntryAttentionPayout EntryType = "attention_payout"
+
+	// EntryBillboardConfirmationFee pays the billboard its confirmation_fee_sats.
+	EntryBillboardConfirmationFee EntryType = "billboard_confirmation_fee"
+
+	// EntryMarketplaceMatchFee pays the marketplace its match_fee_sats.
+	EntryMarketplaceMatchFee EntryType = "marketplace_match_fee"
+
+	// EntryMarketplaceConfirmationFee pays the marketplace its confirmation_fee_sats.
+	EntryMarketplaceConfirmationFee EntryType = "marketplace_confirmation_fee"
+)
+
+// Entry is one double-entry posting: Amount sats move from Debit to Credit.
+type Entry struct {
+	MatchCoordinate string
+	BlockHeight     int64
+	Type            EntryType
+
+	// Debit is the pubkey charged and Credit the pubkey paid.
+	Debit  string
+	Credit string
+
+	Amount int64
+}
+
+// PaymentStatus is the outcome of reconciling a match's payment confirmations.
+type PaymentStatus string
+
+const (
+	// PaymentUnconfirmed means the attention owner has not confirmed a payment.
+	PaymentUnconfirmed PaymentStatus = "unconfirmed"
+
+	// PaymentSettled means sats_received equals the ask.
+	PaymentSettled PaymentStatus = "settled"
+
+	// PaymentUnderpaid means sats_received is below the ask.
+	PaymentUnderpaid PaymentStatus = "underpaid"
+
+	// PaymentOverpaid means sats_received is above the ask.
+	PaymentOverpaid PaymentStatus = "overpaid"
+)
+
+// Match is a confirmed match with the events it references, as Resolve finds them.
+type Match struct {
+	Confirmation *nostr.Event // MARKETPLACE_CONFIRMATION
+	Match        *nostr.Event
+	Marketplace  *nostr.Event
+	Billboard    *nostr.Event
+	Promotion    *nostr.Event
+	Attention    *nostr.Event
+
+	// Payments are the attention owner's ATTENTION_PAYMENT_CONFIRMATION events
+	// for the match, if any.
+	Payments []*nostr.Event
+}
+
+// Settlement is the breakdown of one confirmed match.
+type Settlement struct {
+	MatchCoordinate string
+	BlockHeight     int64
+
+	MarketplacePubkey string
+	BillboardPubkey   string
+	PromotionPubkey   string
+	AttentionPubkey   string
+
+	// Bid and Ask are the PROMOTION bid and ATTENTION ask.
+	Bid int64
+	Ask int64
+
+	// The fees of the MARKETPLACE and BILLBOARD events.
+	MatchFee                   int64
+	MarketplaceConfirmationFee int64
+	BillboardConfirmationFee   int64
+
+	// Price is what the promoter is charged: the ask plus every fee. The part
+	// of the bid above it is not charged. BidShortfall is how far the bid falls
+	// below the price, or 0 when it covers it.
+	Price        int64
+	BidShortfall int64
+
+	// Entries are the postings, one per non-zero payment.
+	Entries []Entry
+
+	// SatsReceived sums the sats_received of the payment confirmations, and
+	// Discrepancy is SatsReceived minus the ask once a payment is confirmed.
+	SatsReceived int64
+	Status       PaymentStatus
+	Discrepancy  int64
+}
+
+// Resolve finds the events a MARKETPLACE_CONFIRMATION references, using the
+// newest version of each, and the attention owner's payment confirmations.
+func Resolve(ctx context.Context, querier Querier, confirmation *nostr.Event) (Match, error) {
+	if confirmation.Kind != core.KindMarketplaceConfirmation {
+		return Match{}, ErrNotMarketplaceConfirmation
+	}
+	refs := make(map[int]string, 5)
+	for _, tag := range confirmation.Tags {
+		if len(tag) >= 2 && tag[0] == "a" {
+			if kind, _, _, _ := events.ParseCoordinate(tag[1]); kind != 0 {
+				refs[kind] = tag[1]
+			}
+		}
+	}
+	for _, kind := range []int{core.KindMarketplace, core.KindBillboard, core.KindPromotion, core.KindAttention, core.KindMatch} {
+		if refs[kind] == "" {
+			return Match{}, fmt.Errorf("%w: missing kind %d coordinate", ErrInvalidConfirmation, kind)
+		}
+	}
+	if _, marketplace_pubkey, _, _ := events.ParseCoordinate(refs[core.KindMarketplace]); confirmation.PubKey != marketplace_pubkey {
+		return Match{}, fmt.Errorf("%w: not signed by the marketplace", ErrInvalidConfirmation)
+	}
+
+	match := Match{Confirmation: confirmation}
+	for _, ref := range []struct {
+		kind   int
+		target **nostr.Event
+	}{
+		{core.KindMatch, &match.Match},
+		{core.KindMarketplace, &match.Marketplace},
+		{core.KindBillboard, &match.Billboard},
+		{core.KindPromotion, &match.Promotion},
+		{core.KindAttention, &match.Attention},
+	} {
+		event, err := resolve(ctx, querier, refs[ref.kind])
+		if err != nil {
+			return Match{}, err
+		}
+		if event == nil {
+			return Match{}, fmt.Errorf("%w: %q", ErrUnresolved, refs[ref.kind])
+		}
+		*ref.target = event
+	}
+
+	// Only the attention owner attests to what it received
+	payments, err := querier.Query(ctx, nostr.Filter{
+		Kinds:   []int{core.KindAttentionPaymentConfirmation},
+		Authors: []string{match.Attention.PubKey},
+		Tags:    nostr.TagMap{"a": []string{refs[core.KindMatch]}},
+	})
+	if err != nil {
+		return Match{}, err
+	}
+	match.Payments = newestByDTag(payments)
+	return match, nil
+}
+
+// Settle prices a resolved match and reconciles its payment confirmations.
+func Settle(match Match) (Settlement, error) {
+	var marketplace core.MarketplaceData
+	var billboard core.BillboardData
+	var promotion core.PromotionData
+	var attention core.AttentionData
+	for _, decode := range []struct {
+		event  *nostr.Event
+		target interface{}
+	}{
+		{match.Marketplace, &marketplace},
+		{match.Billboard, &billboard},
+		{match.Promotion, &promotion},
+		{match.Attention, &attention},
+	} {
+		if err := json.Unmarshal([]byte(decode.event.Content), decode.target); err != nil {
+			return Settlement{}, fmt.Errorf("kind %d content: %w", decode.event.Kind, err)
+		}
+	}
+
+	settlement := Settlement{
+		MatchCoordinate:            events.FormatCoordinate(core.KindMatch, match.Match.PubKey, match.Match.Tags.GetD()),
+		MarketplacePubkey:          match.Marketplace.PubKey,
+		BillboardPubkey:            match.Billboard.PubKey,
+		PromotionPubkey:            match.Promotion.PubKey,
+		AttentionPubkey:            match.Attention.PubKey,
+		Bid:                        promotion.Bid,
+		Ask:                        attention.Ask,
+		MatchFee:                   marketplace.MatchFeeSats,
+		MarketplaceConfirmationFee: marketplace.ConfirmationFeeSats,
+		BillboardConfirmationFee:   billboard.ConfirmationFeeSats,
+		Status:                     PaymentUnconfirmed,
+	}
+	settlement.BlockHeight, _ = core.EventBlockHeight(match.Match)
+	settlement.Price = settlement.Ask + settlement.MatchFee + settlement.MarketplaceConfirmationFee + settlement.BillboardConfirmationFee
+	if settlement.Bid < settlement.Price {
+		settlement.BidShortfall = settlement.Price - settlement.Bid
+	}
+
+	post := func(entry_type EntryType, credit string, amount int64) {
+		if amount <= 0 {
+			return
+		}
+		settlement.Entries = append(settlement.Entries, Entry{
+			MatchCoordinate: settlement.MatchCoordinate,
+			BlockHeight:     settlement.BlockHeight,
+			Type:            entry_type,
+			Debit:           settlement.PromotionPubkey,
+			Credit:          credit,
+			Amount:          amount,
+		})
+	}
+	post(EntryAttentionPayout, settlement.AttentionPubkey, settlement.Ask)
+	post(EntryBillboardConfirmationFee, settlement.BillboardPubkey, settlement.BillboardConfirmationFee)
+	post(EntryMarketplaceMatchFee, settlement.MarketplacePubkey, settlement.MatchFee)
+	post(EntryMarketplaceConfirmationFee, settlement.MarketplacePubkey, settlement.MarketplaceConfirmationFee)
+
+	if len(match.Payments) > 0 {
+		for _, payment := range match.Payments {
+			var content core.AttentionPaymentConfirmationData
+			if err := json.Unmarshal([]byte(payment.Content), &content); err != nil {
+				return Settlement{}, fmt.Errorf("payment confirmation %s: %w", payment.ID, err)
+			}
+			settlement.SatsReceived += content.SatsReceived
+		}
+		settlement.Discrepancy = settlement.SatsReceived - settlement.Ask
+		switch {
+		case settlement.Discrepancy < 0:
+			settlement.Status = PaymentUnderpaid
+		case settlement.Discrepancy > 0:
+			settlement.Status = PaymentOverpaid
+		default:
+			settlement.Status = PaymentSettled
+		}
+	}
+	return settlement, nil
+}
+
+// Build settles every match a marketplace has confirmed. Matches whose events
+// cannot be resolved or decoded are listed in the ledger's Unresolved field
+// instead of failing the build; query errors fail it.
+func Build(ctx context.Context, querier Querier, marketplace_coordinate string) (*Ledger, error) {
+	_, marketplace_pubkey, _, _ := events.ParseCoordinate(marketplace_coordinate)
+	confirmations, err := querier.Query(ctx, nostr.Filter{
+		Kinds:   []int{core.KindMarketplaceConfirmation},
+		Authors: []string{marketplace_pubkey},
+		Tags:    nostr.TagMap{"a": []string{marketplace_coordinate}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &Ledger{}
+	seen := make(map[string]bool, len(confirmations))
+	for _, confirmation := range confirmations {
+		match, err := Resolve(ctx, querier, confirmation)
+		if err != nil && !errors.Is(err, ErrUnresolved) && !errors.Is(err, ErrInvalidConfirmation) {
+			return nil, err
+		}
+		var settlement Settlement
+		if err == nil {
+			settlement, err = Settle(match)
+		}
+		if err != nil {
+			ledger.Unresolved = append(ledger.Unresolved, Unresolved{ConfirmationID: confirmation.ID, Err: err})
+			continue
+		}
+
+		// A match is settled once, however often it was confirmed
+		if !seen[settlement.MatchCoordinate] {
+			seen[settlement.MatchCoordinate] = true
+			ledger.Add(settlement)
+		}
+	}
+	return ledger, nil
+}
+
+// resolve returns the newest event at a coordinate, or nil if none is found.
+func resolve(ctx context.Context, querier Querier, coordinate string) (*nostr.Event, error) {
+	kind, pubkey, d_tag, _ := events.ParseCoordinate(coordinate)
+	if kind == 0 {
+		return nil, nil
+	}
+	found, err := querier.Query(ctx, nostr.Filter{
+		Kinds:   []int{kind},
+		Authors: []string{pubkey},
+		Tags:    nostr.TagMap{"d": []string{d_tag}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var newest *nostr.Event
+	for _, event := range found {
+		if newest == nil || event.CreatedAt > newest.CreatedAt {
+			newest = event
+		}
+	}
+	return newest, nil
+}
+
+// newestByDTag keeps the newest event of each d tag, so a replaced payment
+// confirmation is not counted twice when querier is a relay.
+func newestByDTag(found []*nostr.Event) []*nostr.Event {
+	newest := make(map[string]*nostr.Event, len(found))
+	var order []string
+	for _, event := range found {
+		d_tag := event.Tags.GetD()
+		current, ok := newest[d_tag]
+		if !ok {
+			order = append(order, d_tag)
+		}
+		if !ok || event.CreatedAt > current.CreatedAt {
+			newest[d_tag] = event
+		}
+	}
+	kept := make([]*nostr.Event, 0, len(order))
+	for _, d_tag := range order {
+		kept = append(kept, newest[d_tag])
+	}
+	return kept
+}
@@ -0,0 +1,254 @@
+package ledger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// party is a keypair taking one role in a market.
+type party struct {
+	private_key string
+	pubkey      string
+}
+
+func newParty() party {
+	private_key := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(private_key)
+	return party{private_key, pubkey}
+}
+
+// market indexes the events of one marketplace into a store.
+type market struct {
+	t           *testing.T
+	store       store.Store
+	marketplace party
+	billboard   party
+	promoter    party
+	attention   party
+}
+
+func newMarket(t *testing.T) *market {
+	m := &market{
+		t:           t,
+		store:       store.NewMemoryStore(store.MemoryOptions{}),
+		marketplace: newParty(),
+		billboard:   newParty(),
+		promoter:    newParty(),
+		attention:   newParty(),
+	}
+	t.Cleanup(func() { m.store.Close() })
+	return m
+}
+
+// publish signs and saves an event, returning its coordinate.
+func (m *market) publish(author party, kind int, event_type, id string, tags nostr.Tags, content interface{}) string {
+	m.t.Helper()
+	data, _ := json.Marshal(content)
+	d_tag := events.FormatDTag(event_type, id)
+	event := &nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Tags:      append(nostr.Tags{{"d", d_tag}, {"t", "870500"}}, tags...),
+		Content:   string(data),
+	}
+	if err := event.Sign(author.private_key); err != nil {
+		m.t.Fatal(err)
+	}
+	if _, err := m.store.Save(context.Background(), event); err != nil {
+		m.t.Fatal(err)
+	}
+	return events.FormatCoordinate(kind, author.pubkey, d_tag)
+}
+
+func (m *market) marketplaceCoordinate() string {
+	return events.FormatCoordinate(core.KindMarketplace, m.marketplace.pubkey, events.FormatDTag("marketplace", "mk-1"))
+}
+
+// setup publishes the marketplace, billboard and attention offer.
+func (m *market) setup(match_fee, marketplace_confirmation_fee, billboard_confirmation_fee, ask int64) (billboard, attention string) {
+	m.publish(m.marketplace, core.KindMarketplace, "marketplace", "mk-1", nil, core.MarketplaceData{MatchFeeSats: match_fee, ConfirmationFeeSats: marketplace_confirmation_fee})
+	billboard = m.publish(m.billboard, core.KindBillboard, "billboard", "bb-1", nostr.Tags{{"a", m.marketplaceCoordinate()}}, core.BillboardData{ConfirmationFeeSats: billboard_confirmation_fee})
+	attention = m.publish(m.attention, core.KindAttention, "attention", "at-1", nostr.Tags{{"a", m.marketplaceCoordinate()}}, core.AttentionData{Ask: ask})
+	return billboard, attention
+}
+
+// confirm publishes a promotion, its match and the marketplace confirmation,
+// returning the match coordinate.
+func (m *market) confirm(id string, bid int64, billboard, attention string) string {
+	promotion := m.publish(m.promoter, core.KindPromotion, "promotion", id, nostr.Tags{{"a", m.marketplaceCoordinate()}}, core.PromotionData{Bid: bid})
+	refs := nostr.Tags{{"a", m.marketplaceCoordinate()}, {"a", billboard}, {"a", promotion}, {"a", attention}}
+	match := m.publish(m.marketplace, core.KindMatch, "match", id, refs, core.MatchData{})
+	m.publish(m.marketplace, core.KindMarketplaceConfirmation, "marketplace-confirmation", id, append(refs, nostr.Tag{"a", match}), core.MarketplaceConfirmationData{})
+	return match
+}
+
+// pay publishes a payment confirmation for a match.
+func (m *market) pay(author party, id, match string, sats int64) {
+	m.publish(author, core.KindAttentionPaymentConfirmation, "attention-payment-confirmation", id, nostr.Tags{{"a", m.marketplaceCoordinate()}, {"a", match}}, core.AttentionPaymentConfirmationData{SatsReceived: sats})
+}
+
+func TestBuild(t *testing.T) {
+	m := newMarket(t)
+	billboard, attention := m.setup(100, 50, 25, 3000)
+
+	settled := m.confirm("pr-1", 5000, billboard, attention)
+	m.pay(m.attention, "pay-1", settled, 3000)
+	underpaid := m.confirm("pr-2", 5000, billboard, attention)
+	m.pay(m.attention, "pay-2", underpaid, 2000)
+	m.pay(m.attention, "pay-3", underpaid, 500)
+	m.pay(m.promoter, "pay-4", underpaid, 500) // not the attention owner; ignored
+	overpaid := m.confirm("pr-3", 5000, billboard, attention)
+	m.pay(m.attention, "pay-5", overpaid, 3100)
+	unconfirmed := m.confirm("pr-4", 5000, billboard, attention)
+
+	// A confirmation whose promotion was never published
+	m.publish(m.marketplace, core.KindMarketplaceConfirmation, "marketplace-confirmation", "orphan", nostr.Tags{
+		{"a", m.marketplaceCoordinate()}, {"a", billboard}, {"a", attention},
+		{"a", events.FormatCoordinate(core.KindPromotion, m.promoter.pubkey, "org.attnprotocol:promotion:missing")},
+		{"a", events.FormatCoordinate(core.KindMatch, m.marketplace.pubkey, "org.attnprotocol:match:missing")},
+	}, core.MarketplaceConfirmationData{})
+
+	book, err := Build(context.Background(), m.store, m.marketplaceCoordinate())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Settlements) != 4 {
+		t.Fatalf("expected 4 settlements, got %d", len(book.Settlements))
+	}
+	if len(book.Unresolved) != 1 || !errors.Is(book.Unresolved[0].Err, ErrUnresolved) {
+		t.Errorf("expected the orphan confirmation to be unresolved, got %+v", book.Unresolved)
+	}
+
+	by_match := make(map[string]Settlement)
+	for _, settlement := range book.Settlements {
+		by_match[settlement.MatchCoordinate] = settlement
+	}
+	want := map[string]struct {
+		status      PaymentStatus
+		received    int64
+		discrepancy int64
+	}{
+		settled:     {PaymentSettled, 3000, 0},
+		underpaid:   {PaymentUnderpaid, 2500, -500},
+		overpaid:    {PaymentOverpaid, 3100, 100},
+		unconfirmed: {PaymentUnconfirmed, 0, 0},
+	}
+	for match, w := range want {
+		got := by_match[match]
+		if got.Status != w.status || got.SatsReceived != w.received || got.Discrepancy != w.discrepancy {
+			t.Errorf("%s: got %s, %d received, discrepancy %d; want %+v", match, got.Status, got.SatsReceived, got.Discrepancy, w)
+		}
+		if got.Price != 3175 || got.BidShortfall != 0 || len(got.Entries) != 4 || got.BlockHeight != 870500 {
+			t.Errorf("%s: unexpected pricing %+v", match, got)
+		}
+	}
+	if flagged := book.Discrepancies(); len(flagged) != 2 {
+		t.Errorf("expected the under- and overpaid matches to be flagged, got %d", len(flagged))
+	}
+}
+
+func TestStatements(t *testing.T) {
+	m := newMarket(t)
+	billboard, attention := m.setup(100, 50, 25, 3000)
+	first := m.confirm("pr-1", 5000, billboard, attention)
+	m.pay(m.attention, "pay-1", first, 3000)
+	m.confirm("pr-2", 5000, billboard, attention)
+
+	book, err := Build(context.Background(), m.store, m.marketplaceCoordinate())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every entry debits one account and credits another
+	var total int64
+	statements := book.Statements()
+	if len(statements) != 4 {
+		t.Fatalf("expected a statement per party, got %d", len(statements))
+	}
+	for _, statement := range statements {
+		total += statement.Net
+	}
+	if total != 0 {
+		t.Errorf("expected the ledger to balance, got %d", total)
+	}
+
+	want := map[string]int64{
+		m.promoter.pubkey:    -2 * 3175,
+		m.attention.pubkey:   2 * 3000,
+		m.billboard.pubkey:   2 * 25,
+		m.marketplace.pubkey: 2 * 150,
+	}
+	for pubkey, net := range want {
+		if got := book.Statement(pubkey).Net; got != net {
+			t.Errorf("%s: expected net %d, got %d", pubkey[:8], net, got)
+		}
+	}
+
+	owner := book.Statement(m.attention.pubkey)
+	if owner.SatsReceived != 3000 || owner.Outstanding != 3000 {
+		t.Errorf("expected one payout outstanding, got %d received, %d outstanding", owner.SatsReceived, owner.Outstanding)
+	}
+
+	var out bytes.Buffer
+	if err := book.Statement(m.billboard.pubkey).WriteCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+	rows := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(rows) != 3 || rows[0] != "match_coordinate,block_height,type,counterparty,amount" {
+		t.Fatalf("unexpected CSV:\n%s", out.String())
+	}
+	if !strings.HasSuffix(rows[1], fmt.Sprintf(",870500,billboard_confirmation_fee,%s,25", m.promoter.pubkey)) {
+		t.Errorf("unexpected CSV row %s", rows[1])
+	}
+}
+
+func TestSettle_BidShortfall(t *testing.T) {
+	event := func(pubkey string, content interface{}) *nostr.Event {
+		data, _ := json.Marshal(content)
+		return &nostr.Event{PubKey: pubkey, Content: string(data), Tags: nostr.Tags{{"d", "org.attnprotocol:match:m-1"}}}
+	}
+	settlement, err := Settle(Match{
+		Match:       event("mk", core.MatchData{}),
+		Marketplace: event("mk", core.MarketplaceData{MatchFeeSats: 100}),
+		Billboard:   event("bb", core.BillboardData{}),
+		Promotion:   event("pr", core.PromotionData{Bid: 1000}),
+		Attention:   event("at", core.AttentionData{Ask: 950}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settlement.Price != 1050 || settlement.BidShortfall != 50 {
+		t.Errorf("expected a 50 sat shortfall, got price %d, shortfall %d", settlement.Price, settlement.BidShortfall)
+	}
+	// Zero fees post no entry
+	if len(settlement.Entries) != 2 {
+		t.Errorf("expected 2 entries, got %+v", settlement.Entries)
+	}
+}
+
+func TestResolve_Invalid(t *testing.T) {
+	m := newMarket(t)
+	ctx := context.Background()
+	if _, err := Resolve(ctx, m.store, &nostr.Event{Kind: core.KindMatch}); err != ErrNotMarketplaceConfirmation {
+		t.Errorf("expected ErrNotMarketplaceConfirmation, got %v", err)
+	}
+
+	billboard, attention := m.setup(0, 0, 0, 1000)
+	m.confirm("pr-1", 1000, billboard, attention)
+	confirmations, _ := m.store.Query(ctx, nostr.Filter{Kinds: []int{core.KindMarketplaceConfirmation}})
+	forged := *confirmations[0]
+	forged.PubKey = m.promoter.pubkey
+	if _, err := Resolve(ctx, m.store, &forged); !errors.Is(err, ErrInvalidConfirmation) {
+		t.Errorf("expected a confirmation by another author to fail, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package ledger
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// Unresolved is a marketplace confirmation Build could not settle.
+type Unresolved struct {
+	ConfirmationID string
+	Err            error
+}
+
+// Ledger holds the settlements of confirmed matches.
+type Ledger struct {
+	Settlements []Settlement
+	Unresolved  []Unresolved
+}
+
+// Add records a settlement.
+func (l *Ledger) Add(settlement Settlement) {
+	l.Settlements = append(l.Settlements, settlement)
+}
+
+// Entries returns every posting, in settlement order.
+func (l *Ledger) Entries() []Entry {
+	var entries []Entry
+	for _, settlement := range l.Settlements {
+		entries = append(entries, settlement.Entries...)
+	}
+	return entries
+}
+
+// Discrepancies returns the settlements whose payment confirmations do not
+// add up to the ask.
+func (l *Ledger) Discrepancies() []Settlement {
+	var flagged []Settlement
+	for _, settlement := range l.Settlements {
+		if settlement.Status == PaymentUnderpaid || settlement.Status == PaymentOverpaid {
+			flagged = append(flagged, settlement)
+		}
+	}
+	return flagged
+}
+
+// Line is one entry as it appears on a pubkey's statement.
+type Line struct {
+	MatchCoordinate string    `json:"match_coordinate"`
+	BlockHeight     int64     `json:"block_height"`
+	Type            EntryType `json:"type"`
+	Counterparty    string    `json:"counterparty"`
+
+	// Amount is positive for credits and negative for debits.
+	Amount int64 `json:"amount"`
+}
+
+// Statement is a pubkey's account across the ledger.
+type Statement struct {
+	Pubkey string `json:"pubkey"`
+	Lines  []Line `json:"lines"`
+
+	// Credits and Debits sum the positive and negative lines; Net is their difference.
+	Credits int64 `json:"credits"`
+	Debits  int64 `json:"debits"`
+	Net     int64 `json:"net"`
+
+	// SatsReceived sums the sats_received the pubkey confirmed as an attention
+	// owner. Outstanding is its attention payouts less SatsReceived, and is
+	// negative when it was overpaid.
+	SatsReceived int64 `json:"sats_received"`
+	Outstanding  int64 `json:"outstanding"`
+}
+
+// Statement returns a pubkey's statement. Lines are in settlement order.
+func (l *Ledger) Statement(pubkey string) Statement {
+	statement := Statement{Pubkey: pubkey}
+	var payouts int64
+	for _, settlement := range l.Settlements {
+		for _, entry := range settlement.Entries {
+			line := Line{MatchCoordinate: entry.MatchCoordinate, BlockHeight: entry.BlockHeight, Type: entry.Type}
+			switch pubkey {
+			case entry.Credit:
+				line.Counterparty, line.Amount = entry.Debit, entry.Amount
+				statement.Credits += entry.Amount
+				if entry.Type == EntryAttentionPayout {
+					payouts += entry.Amount
+				}
+			case entry.Debit:
+				line.Counterparty, line.Amount = entry.Credit, -entry.Amount
+				statement.Debits += entry.Amount
+			default:
+				continue
+			}
+			statement.Lines = append(statement.Lines, line)
+		}
+		if settlement.AttentionPubkey == pubkey {
+			statement.SatsReceived += settlement.SatsReceived
+		}
+	}
+	statement.Net = statement.Credits - statement.Debits
+	statement.Outstanding = payouts - statement.SatsReceived
+	return statement
+}
+
+// Statements returns the statement of every pubkey in the ledger, ordered by pubkey.
+func (l *Ledger) Statements() []Statement {
+	seen := make(map[string]bool)
+	var pubkeys []string
+	for _, entry := range l.Entries() {
+		for _, pubkey := range []string{entry.Debit, entry.Credit} {
+			if !seen[pubkey] {
+				seen[pubkey] = true
+				pubkeys = append(pubkeys, pubkey)
+			}
+		}
+	}
+	sort.Strings(pubkeys)
+
+	statements := make([]Statement, 0, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		statements = append(statements, l.Statement(pubkey))
+	}
+	return statements
+}
+
+// WriteCSV writes the statement's lines as CSV with a header row.
+func (s Statement) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"match_coordinate", "block_height", "type", "counterparty", "amount"})
+	for _, line := range s.Lines {
+		writer.Write([]string{
+			line.MatchCoordinate,
+			strconv.FormatInt(line.BlockHeight, 10),
+			string(line.Type),
+			line.Counterparty,
+			strconv.FormatInt(line.Amount, 10),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,503 @@
+// Package provider runs an attention provider's side of a match.
+//
+// An Agent watches MATCH events that tag the provider's pubkey, resolves the
+// promotion each one references and checks it against the provider's Policy:
+// the ask, the duration bounds, and the NIP-51 block and trust lists. Offers
+// that expired by the match's block height, or that their author withdrew with
+// a NIP-09 deletion request, are skipped. Matches that pass get an
+// ATTENTION_CONFIRMATION; the rest are withheld. Every decision is logged with
+// its reason. Confirmed matches are remembered until newer confirmed matches
+// are an expiry window past them; older matches are withheld as stale.
+//
+// Example usage:
+//
+//	policy, err := provider.LoadPolicy(ctx, pool, attention_event)
+//
+//	agent, err := provider.NewAgent(provider.Options{
+//	    PrivateKey: private_key,
+//	    Policy:     policy,
+//	    Pool:       pool,
+//	    RelayURLs:  []string{"wss://relay.example.com"},
+//	})
+//
+//	// Subscribe to agent.Filter() on the pool and handle matches until ctx is done
+//	err = agent.Subscribe(ctx)
+//
+// When the pool cannot subscribe, pass MATCH events from your own subscription
+// to agent.Run instead.
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrNoPool is returned when an agent has no relay pool.
+	ErrNoPool = errors.New("agent has no relay pool")
+
+	// ErrNoRelayURLs is returned when an agent has no relay URLs for the r tags
+	// of its confirmations.
+	ErrNoRelayURLs = errors.New("agent has no relay URLs")
+
+	// ErrNoSubscriber is returned by Subscribe when the agent's pool cannot
+	// open subscriptions.
+	ErrNoSubscriber = errors.New("agent pool cannot subscribe")
+)
+
+// Pool queries and publishes events. *relay.Pool and *relay.Router implement it.
+type Pool interface {
+	Querier
+	Publish(ctx context.Context, event *nostr.Event) error
+}
+
+// Subscriber opens live subscriptions. *relay.Pool implements it; a Pool that
+// also implements Subscriber lets the agent subscribe itself.
+type Subscriber interface {
+	Subscribe(ctx context.Context, filter nostr.Filter) (<-chan *nostr.Event, error)
+}
+
+// Reason explains a Decision.
+type Reason string
+
+const (
+	// ReasonConfirmed: the promotion passed every check and was confirmed.
+	ReasonConfirmed Reason = "confirmed"
+
+	// ReasonAlreadyConfirmed: the match was confirmed before.
+	ReasonAlreadyConfirmed Reason = "already_confirmed"
+
+	// ReasonNotAddressed: the MATCH does not name the provider's attention.
+	ReasonNotAddressed Reason = "not_addressed"
+
+	// ReasonInvalidMatch: the MATCH is malformed or not signed by its marketplace.
+	ReasonInvalidMatch Reason = "invalid_match"
+
+	// ReasonUnresolved: a referenced event could not be found on the relays.
+	ReasonUnresolved Reason = "unresolved"
+
+	// ReasonBlockedPromotion: the promotion is on the blocked promotions list.
+	ReasonBlockedPromotion Reason = "blocked_promotion"
+
+	// ReasonBlockedPromoter: the promoter is on the blocked promoters list.
+	ReasonBlockedPromoter Reason = "blocked_promoter"
+
+	// ReasonUntrustedMarketplace: the marketplace is not on the trusted marketplaces list.
+	ReasonUntrustedMarketplace Reason = "untrusted_marketplace"
+
+	// ReasonUntrustedBillboard: the billboard is not on the trusted billboards list.
+	ReasonUntrustedBillboard Reason = "untrusted_billboard"
+
+	// ReasonBelowAsk: the promotion bids less than the ask.
+	ReasonBelowAsk Reason = "below_ask"
+
+	// ReasonDurationOutOfBounds: the promotion duration is outside the provider's bounds.
+	ReasonDurationOutOfBounds Reason = "duration_out_of_bounds"
+
+	// ReasonExpiredOffer: the promotion or attention offer expired before the
+	// match's block height.
+	ReasonExpiredOffer Reason = "expired_offer"
+
+	// ReasonWithdrawnOffer: the promotion or attention offer was withdrawn with
+	// a NIP-09 deletion request.
+	ReasonWithdrawnOffer Reason = "withdrawn_offer"
+
+	// ReasonStaleMatch: the match's block height is an expiry window or more
+	// behind the newest confirmed match.
+	ReasonStaleMatch Reason = "stale_match"
+
+	// ReasonError: resolving or publishing failed; HandleMatch returns the error.
+	ReasonError Reason = "error"
+)
+
+// Decision is the outcome of a MATCH.
+type Decision struct {
+	// MatchCoordinate is the coordinate of the MATCH (38888:pubkey:d_tag).
+	MatchCoordinate string
+
+	// Confirmed reports whether an ATTENTION_CONFIRMATION was published.
+	Confirmed bool
+
+	// Reason explains the decision, and Detail adds specifics such as the bid
+	// and the ask.
+	Reason Reason
+	Detail string
+
+	// Confirmation is the published ATTENTION_CONFIRMATION, if any.
+	Confirmation *nostr.Event
+}
+
+// Options holds configuration for an Agent.
+type Options struct {
+	// PrivateKey is the hex-encoded private key of the attention provider.
+	PrivateKey string
+
+	// Policy decides which matches are confirmed.
+	Policy Policy
+
+	// Pool resolves referenced events and publishes confirmations.
+	Pool Pool
+
+	// RelayURLs are added as r tags to every confirmation.
+	RelayURLs []string
+
+	// Logger receives one record per decision. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	// Expiry decides when promotion and attention offers expire, measured at
+	// the match's block height. Defaults to core.DefaultExpiryPolicy.
+	Expiry *core.ExpiryPolicy
+}
+
+// Agent confirms matches on behalf of an attention provider.
+// It is safe for concurrent use.
+type Agent struct {
+	options Options
+	pubkey  string
+
+	mu           sync.Mutex
+	confirmed    map[string]int64 // match coordinate -> block height it is forgotten at
+	block_height int64            // block height of the newest confirmed match
+}
+
+// NewAgent creates an agent.
+func NewAgent(options Options) (*Agent, error) {
+	switch {
+	case options.Pool == nil:
+		return nil, ErrNoPool
+	case len(options.RelayURLs) == 0:
+		return nil, ErrNoRelayURLs
+	}
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+	if options.Expiry == nil {
+		options.Expiry = &core.DefaultExpiryPolicy
+	}
+
+	pubkey, err := nostr.GetPublicKey(options.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Agent{options: options, pubkey: pubkey, confirmed: make(map[string]int64)}, nil
+}
+
+// Filter matches the MATCH events that tag the provider's pubkey.
+func (a *Agent) Filter() nostr.Filter {
+	return nostr.Filter{
+		Kinds: []int{core.KindMatch},
+		Tags:  nostr.TagMap{"p": []string{a.pubkey}},
+	}
+}
+
+// Subscribe opens a subscription to Filter() on the agent's pool and handles
+// the MATCH events it delivers, as Run does, until ctx is done or the
+// subscription ends. It returns ErrNoSubscriber when the pool does not
+// implement Subscriber.
+func (a *Agent) Subscribe(ctx context.Context) error {
+	subscriber, ok := a.options.Pool.(Subscriber)
+	if !ok {
+		return ErrNoSubscriber
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	events, err := subscriber.Subscribe(ctx, a.Filter())
+	if err != nil {
+		return err
+	}
+	return a.Run(ctx, events)
+}
+
+// Run handles MATCH events until the channel closes or ctx is done. Other
+// kinds are ignored. Errors are logged with their decision and Run continues
+// with the next event. Run returns nil when the channel closes.
+func (a *Agent) Run(ctx context.Context, events <-chan *nostr.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if event.Kind == core.KindMatch {
+				a.HandleMatch(ctx, event)
+			}
+		}
+	}
+}
+
+// HandleMatch decides whether to confirm a MATCH, publishes the
+// ATTENTION_CONFIRMATION when it does, and logs the decision.
+// The returned error reports failed queries and publishes.
+func (a *Agent) HandleMatch(ctx context.Context, match *nostr.Event) (Decision, error) {
+	decision, err := a.decide(ctx, match)
+	if err != nil {
+		decision.Reason = ReasonError
+		decision.Detail = err.Error()
+	}
+
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelError
+	}
+	a.options.Logger.Log(ctx, level, "attention confirmation decision",
+		"match", decision.MatchCoordinate,
+		"confirmed", decision.Confirmed,
+		"reason", string(decision.Reason),
+		"detail", decision.Detail,
+	)
+	return decision, err
+}
+
+// matchRefs holds the coordinates a MATCH references.
+type matchRefs struct {
+	marketplace, billboard, promotion, attention string
+}
+
+// decide runs the checks in order, stopping at the first that fails.
+func (a *Agent) decide(ctx context.Context, match *nostr.Event) (Decision, error) {
+	match_d_tag := match.Tags.GetD()
+	decision := Decision{MatchCoordinate: events.FormatCoordinate(core.KindMatch, match.PubKey, match_d_tag)}
+	withhold := func(reason Reason, detail string) (Decision, error) {
+		decision.Reason = reason
+		decision.Detail = detail
+		return decision, nil
+	}
+
+	var refs matchRefs
+	for _, tag := range match.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		switch kind, _, _, _ := events.ParseCoordinate(tag[1]); kind {
+		case core.KindMarketplace:
+			refs.marketplace = tag[1]
+		case core.KindBillboard:
+			refs.billboard = tag[1]
+		case core.KindPromotion:
+			refs.promotion = tag[1]
+		case core.KindAttention:
+			refs.attention = tag[1]
+		}
+	}
+
+	if _, attention_pubkey, _, _ := events.ParseCoordinate(refs.attention); attention_pubkey != a.pubkey {
+		return withhold(ReasonNotAddressed, "attention coordinate "+refs.attention)
+	}
+	if match_d_tag == "" || refs.marketplace == "" || refs.billboard == "" || refs.promotion == "" {
+		return withhold(ReasonInvalidMatch, "missing d tag or coordinate")
+	}
+	if _, marketplace_pubkey, _, _ := events.ParseCoordinate(refs.marketplace); match.PubKey != marketplace_pubkey {
+		return withhold(ReasonInvalidMatch, "not signed by the marketplace")
+	}
+	if match.Tags.Find("t") == nil {
+		return withhold(ReasonInvalidMatch, "missing block height")
+	}
+	block_height, ok := core.EventBlockHeight(match)
+	if !ok {
+		return withhold(ReasonInvalidMatch, "invalid block height")
+	}
+
+	// Reserve the match so concurrent deliveries of it publish one confirmation;
+	// the reservation is released unless this call publishes it. Matches whose
+	// entry would already be pruned are stale, so redeliveries stay withheld
+	forget_at := block_height + a.window(refs.marketplace)
+	a.mu.Lock()
+	newest := a.block_height
+	stale := forget_at <= newest
+	_, already := a.confirmed[decision.MatchCoordinate]
+	if !stale && !already {
+		a.confirmed[decision.MatchCoordinate] = forget_at
+	}
+	a.mu.Unlock()
+	switch {
+	case stale:
+		return withhold(ReasonStaleMatch, fmt.Sprintf("block %d, newest confirmed match at block %d", block_height, newest))
+	case already:
+		return withhold(ReasonAlreadyConfirmed, "")
+	}
+	defer func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if !decision.Confirmed {
+			delete(a.confirmed, decision.MatchCoordinate)
+			return
+		}
+		a.advance(block_height)
+	}()
+
+	// Resolve the referenced events; the confirmation needs their IDs
+	resolved := make(map[string]*nostr.Event, 4)
+	for _, coordinate := range []string{refs.promotion, refs.marketplace, refs.billboard, refs.attention} {
+		event, err := a.resolve(ctx, coordinate)
+		if err != nil {
+			return decision, err
+		}
+		if event == nil {
+			return withhold(ReasonUnresolved, coordinate)
+		}
+		resolved[coordinate] = event
+	}
+	promotion := resolved[refs.promotion]
+
+	// Skip offers that expired or were withdrawn
+	for _, coordinate := range []string{refs.promotion, refs.attention} {
+		offer := resolved[coordinate]
+		if a.options.Expiry.IsExpired(offer, block_height) {
+			expires_at, _ := a.options.Expiry.ExpiresAt(offer)
+			return withhold(ReasonExpiredOffer, fmt.Sprintf("%s expired at block %d", coordinate, expires_at))
+		}
+		withdrawn, err := a.withdrawn(ctx, offer, coordinate)
+		if err != nil {
+			return decision, err
+		}
+		if withdrawn {
+			return withhold(ReasonWithdrawnOffer, coordinate)
+		}
+	}
+
+	var content core.PromotionData
+	if err := json.Unmarshal([]byte(promotion.Content), &content); err != nil {
+		return withhold(ReasonInvalidMatch, "promotion content is not valid JSON")
+	}
+
+	policy := a.options.Policy
+	_, billboard_pubkey, _, _ := events.ParseCoordinate(refs.billboard)
+	switch {
+	case policy.BlockedPromotions.Contains(refs.promotion, promotion.ID, ""):
+		return withhold(ReasonBlockedPromotion, refs.promotion)
+	case policy.BlockedPromoters.Contains("", "", promotion.PubKey):
+		return withhold(ReasonBlockedPromoter, promotion.PubKey)
+	case !policy.TrustedMarketplaces.Contains(refs.marketplace, "", match.PubKey):
+		return withhold(ReasonUntrustedMarketplace, refs.marketplace)
+	case !policy.TrustedBillboards.Contains(refs.billboard, "", billboard_pubkey):
+		return withhold(ReasonUntrustedBillboard, refs.billboard)
+	case content.Bid < policy.Ask:
+		return withhold(ReasonBelowAsk, fmt.Sprintf("bid %d < ask %d", content.Bid, policy.Ask))
+	case content.Duration < policy.MinDuration || content.Duration > policy.MaxDuration:
+		return withhold(ReasonDurationOutOfBounds, fmt.Sprintf("duration %d outside [%d, %d]", content.Duration, policy.MinDuration, policy.MaxDuration))
+	}
+
+	var match_content core.MatchData
+	json.Unmarshal([]byte(match.Content), &match_content)
+	if match_content.RefMatchID == "" {
+		match_content.RefMatchID = match_d_tag
+	}
+
+	confirmation, err := events.CreateAttentionConfirmation(a.options.PrivateKey, events.AttentionConfirmationParams{
+		ConfirmationID:        strings.TrimPrefix(match_d_tag, "org.attnprotocol:match:"),
+		BlockHeight:           block_height,
+		MatchID:               match_content.RefMatchID,
+		MarketplaceCoordinate: refs.marketplace,
+		BillboardCoordinate:   refs.billboard,
+		PromotionCoordinate:   refs.promotion,
+		AttentionCoordinate:   refs.attention,
+		MatchCoordinate:       decision.MatchCoordinate,
+		MatchEventID:          match.ID,
+		MarketplaceEventID:    resolved[refs.marketplace].ID,
+		BillboardEventID:      resolved[refs.billboard].ID,
+		PromotionEventID:      promotion.ID,
+		AttentionEventID:      resolved[refs.attention].ID,
+		MarketplacePubkey:     match.PubKey,
+		BillboardPubkey:       billboard_pubkey,
+		PromotionPubkey:       promotion.PubKey,
+		AttentionPubkey:       a.pubkey,
+		MarketplaceID:         match_content.RefMarketplaceID,
+		BillboardID:           match_content.RefBillboardID,
+		PromotionID:           match_content.RefPromotionID,
+		AttentionID:           match_content.RefAttentionID,
+		RelayURLs:             a.options.RelayURLs,
+	})
+	if err != nil {
+		return decision, err
+	}
+	if err := a.options.Pool.Publish(ctx, confirmation); err != nil {
+		return decision, err
+	}
+
+	decision.Confirmed = true
+	decision.Reason = ReasonConfirmed
+	decision.Detail = fmt.Sprintf("bid %d, duration %d", content.Bid, content.Duration)
+	decision.Confirmation = confirmation
+	return decision, nil
+}
+
+// advance moves the agent to the block height of a confirmed match and forgets
+// the matches an expiry window behind it. The caller holds a.mu.
+func (a *Agent) advance(block_height int64) {
+	if block_height <= a.block_height {
+		return
+	}
+	a.block_height = block_height
+	for coordinate, forget_at := range a.confirmed {
+		if forget_at <= block_height {
+			delete(a.confirmed, coordinate)
+		}
+	}
+}
+
+// window returns how long a confirmed match at a marketplace is remembered:
+// the longer of the promotion and attention expiry windows, or
+// core.DefaultValidityBlocks when offers there never expire.
+func (a *Agent) window(marketplace_coordinate string) int64 {
+	var window int64
+	for _, kind := range []int{core.KindPromotion, core.KindAttention} {
+		probe := &nostr.Event{Kind: kind, Tags: nostr.Tags{{"a", marketplace_coordinate}}}
+		window = max(window, a.options.Expiry.Window(probe))
+	}
+	if window <= 0 {
+		return core.DefaultValidityBlocks
+	}
+	return window
+}
+
+// resolve returns the newest event at a coordinate, or nil if none is found.
+func (a *Agent) resolve(ctx context.Context, coordinate string) (*nostr.Event, error) {
+	kind, pubkey, d_tag, _ := events.ParseCoordinate(coordinate)
+	found, err := a.options.Pool.Query(ctx, nostr.Filter{
+		Kinds:   []int{kind},
+		Authors: []string{pubkey},
+		Tags:    nostr.TagMap{"d": []string{d_tag}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var newest *nostr.Event
+	for _, event := range found {
+		if newest == nil || event.CreatedAt > newest.CreatedAt {
+			newest = event
+		}
+	}
+	return newest, nil
+}
+
+// withdrawn reports whether the author of an offer has published a NIP-09
+// deletion request for it, by coordinate or by event ID.
+func (a *Agent) withdrawn(ctx context.Context, offer *nostr.Event, coordinate string) (bool, error) {
+	for _, tags := range []nostr.TagMap{{"a": []string{coordinate}}, {"e": []string{offer.ID}}} {
+		found, err := a.options.Pool.Query(ctx, nostr.Filter{
+			Kinds:   []int{core.KindDeletion},
+			Authors: []string{offer.PubKey},
+			Tags:    tags,
+		})
+		if err != nil {
+			return false, err
+		}
+		for _, deletion := range found {
+			if core.Withdraws(deletion, offer) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,391 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/joinnextblock/attn-protocol/go-sdk/internal/markettest"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// market is the shared test marketplace with a promotion on its billboard and
+// a MATCH pairing it with the attention.
+type market struct {
+	*markettest.Market
+
+	promotion_coordinate string
+	promotion, match     *nostr.Event
+}
+
+func newMarket(t *testing.T, ctx context.Context, bid, duration int64) *market {
+	t.Helper()
+	m := &market{Market: markettest.New(t, ctx)}
+	m.promotion = m.Promote(t, ctx, "pr-1", bid, duration)
+	m.promotion_coordinate = markettest.Coordinate(m.promotion)
+	m.match = m.newMatch(t, m.Marketplace, "m-1")
+	return m
+}
+
+// newMatch builds a MATCH pairing the market's promotion and attention, signed by key.
+func (m *market) newMatch(t *testing.T, key, match_id string) *nostr.Event {
+	t.Helper()
+	return m.Match(t, key, match_id, m.promotion_coordinate, m.BillboardCoordinate, 870501)
+}
+
+// trusting returns a policy that accepts the market's promotion.
+func (m *market) trusting() Policy {
+	return Policy{
+		Ask:                 500,
+		MinDuration:         15000,
+		MaxDuration:         60000,
+		TrustedMarketplaces: List{Coordinates: map[string]bool{m.MarketplaceCoordinate: true}},
+		TrustedBillboards:   List{Pubkeys: map[string]bool{markettest.Pubkey(m.Operator): true}},
+	}
+}
+
+func (m *market) newAgent(t *testing.T, policy Policy, logs *bytes.Buffer) *Agent {
+	t.Helper()
+	options := Options{PrivateKey: m.Provider, Policy: policy, Pool: m.Pool, RelayURLs: []string{m.Relay.URL()}}
+	if logs != nil {
+		options.Logger = slog.New(slog.NewJSONHandler(logs, nil))
+	}
+	agent, err := NewAgent(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return agent
+}
+
+func (m *market) confirmations(t *testing.T, ctx context.Context) []*nostr.Event {
+	t.Helper()
+	found, err := m.Relay.Store().Query(ctx, nostr.Filter{Kinds: []int{core.KindAttentionConfirmation}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestNewAgent_Options(t *testing.T) {
+	if _, err := NewAgent(Options{PrivateKey: nostr.GeneratePrivateKey(), RelayURLs: []string{"wss://r"}}); err != ErrNoPool {
+		t.Errorf("expected ErrNoPool, got %v", err)
+	}
+	if _, err := NewAgent(Options{PrivateKey: nostr.GeneratePrivateKey(), Pool: &relay.Pool{}}); err != ErrNoRelayURLs {
+		t.Errorf("expected ErrNoRelayURLs, got %v", err)
+	}
+}
+
+func TestAgent_ConfirmsMatch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx, 1000, 30000)
+	agent := m.newAgent(t, m.trusting(), nil)
+
+	decision, err := agent.HandleMatch(ctx, m.match)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decision.Confirmed || decision.Reason != ReasonConfirmed {
+		t.Fatalf("expected a confirmation, got %+v", decision)
+	}
+	if result := validation.ValidateATTNEvent(decision.Confirmation); !result.Valid {
+		t.Errorf("expected a valid ATTENTION_CONFIRMATION, got %s", result.Message)
+	}
+	if got := decision.Confirmation.Tags.GetD(); got != "org.attnprotocol:attention-confirmation:m-1" {
+		t.Errorf("unexpected d tag %q", got)
+	}
+	var content core.AttentionConfirmationData
+	json.Unmarshal([]byte(decision.Confirmation.Content), &content)
+	if content.RefMatchEventID != m.match.ID || content.RefPromotionPubkey != m.promotion.PubKey {
+		t.Errorf("unexpected content %+v", content)
+	}
+
+	if found := m.confirmations(t, ctx); len(found) != 1 {
+		t.Fatalf("expected the relay to hold one confirmation, got %d", len(found))
+	}
+	if decision, _ := agent.HandleMatch(ctx, m.match); decision.Confirmed || decision.Reason != ReasonAlreadyConfirmed {
+		t.Errorf("expected a repeated match to be skipped, got %+v", decision)
+	}
+}
+
+func TestAgent_ConfirmsConcurrentDeliveriesOnce(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx, 1000, 30000)
+	agent := m.newAgent(t, m.trusting(), nil)
+
+	// The same MATCH arriving from several relays at once is confirmed once
+	var wg sync.WaitGroup
+	confirmed := make(chan bool, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err := agent.HandleMatch(ctx, m.match)
+			if err != nil {
+				t.Error(err)
+			}
+			confirmed <- decision.Confirmed
+		}()
+	}
+	wg.Wait()
+	close(confirmed)
+	count := 0
+	for ok := range confirmed {
+		if ok {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected one delivery to confirm, got %d", count)
+	}
+	if found := m.confirmations(t, ctx); len(found) != 1 {
+		t.Errorf("expected the relay to hold one confirmation, got %d", len(found))
+	}
+}
+
+func TestAgent_ForgetsConfirmedMatchesPastTheWindow(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Offers never expire, so matches are remembered for DefaultValidityBlocks
+	m := newMarket(t, ctx, 1000, 30000)
+	agent, err := NewAgent(Options{PrivateKey: m.Provider, Policy: m.trusting(), Pool: m.Pool, RelayURLs: []string{m.Relay.URL()}, Expiry: &core.ExpiryPolicy{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision, _ := agent.HandleMatch(ctx, m.match); !decision.Confirmed {
+		t.Fatalf("expected a confirmation, got %+v", decision)
+	}
+
+	later := m.Match(t, m.Marketplace, "m-2", m.promotion_coordinate, m.BillboardCoordinate, 870501+core.DefaultValidityBlocks)
+	if decision, _ := agent.HandleMatch(ctx, later); !decision.Confirmed {
+		t.Fatalf("expected a confirmation, got %+v", decision)
+	}
+	if len(agent.confirmed) != 1 {
+		t.Errorf("expected the older match to be forgotten, got %v", agent.confirmed)
+	}
+
+	// A forgotten match is stale rather than confirmed again
+	if decision, _ := agent.HandleMatch(ctx, m.match); decision.Confirmed || decision.Reason != ReasonStaleMatch {
+		t.Errorf("expected %s, got %+v", ReasonStaleMatch, decision)
+	}
+	if found := m.confirmations(t, ctx); len(found) != 2 {
+		t.Errorf("expected the relay to hold two confirmations, got %d", len(found))
+	}
+}
+
+func TestAgent_WithholdsByPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		name     string
+		bid      int64
+		duration int64
+		modify   func(m *market, p *Policy)
+		want     Reason
+	}{
+		{"below ask", 499, 30000, nil, ReasonBelowAsk},
+		{"too short", 1000, 10000, nil, ReasonDurationOutOfBounds},
+		{"too long", 1000, 90000, nil, ReasonDurationOutOfBounds},
+		{"blocked promotion", 1000, 30000, func(m *market, p *Policy) {
+			p.BlockedPromotions = List{EventIDs: map[string]bool{m.promotion.ID: true}}
+		}, ReasonBlockedPromotion},
+		{"blocked promoter", 1000, 30000, func(m *market, p *Policy) {
+			p.BlockedPromoters = List{Pubkeys: map[string]bool{m.promotion.PubKey: true}}
+		}, ReasonBlockedPromoter},
+		{"no trusted marketplaces", 1000, 30000, func(m *market, p *Policy) {
+			p.TrustedMarketplaces = List{}
+		}, ReasonUntrustedMarketplace},
+		{"untrusted billboard", 1000, 30000, func(m *market, p *Policy) {
+			p.TrustedBillboards = List{Coordinates: map[string]bool{"38288:other:org.attnprotocol:billboard:x": true}}
+		}, ReasonUntrustedBillboard},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newMarket(t, ctx, tt.bid, tt.duration)
+			policy := m.trusting()
+			if tt.modify != nil {
+				tt.modify(m, &policy)
+			}
+			decision, err := m.newAgent(t, policy, nil).HandleMatch(ctx, m.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Confirmed || decision.Reason != tt.want {
+				t.Errorf("expected %s, got %+v", tt.want, decision)
+			}
+			if found := m.confirmations(t, ctx); len(found) != 0 {
+				t.Errorf("expected nothing published, got %d confirmations", len(found))
+			}
+		})
+	}
+}
+
+func TestAgent_SkipsExpiredAndWithdrawnOffers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// The match is at block 870501, one block after the offers
+	m := newMarket(t, ctx, 1000, 30000)
+	agent, err := NewAgent(Options{PrivateKey: m.Provider, Policy: m.trusting(), Pool: m.Pool, RelayURLs: []string{m.Relay.URL()}, Expiry: &core.ExpiryPolicy{Blocks: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision, _ := agent.HandleMatch(ctx, m.match); decision.Reason != ReasonExpiredOffer {
+		t.Errorf("expected %s, got %+v", ReasonExpiredOffer, decision)
+	}
+	// A withheld match is not reserved, so it is checked again on redelivery
+	if decision, _ := agent.HandleMatch(ctx, m.match); decision.Reason != ReasonExpiredOffer {
+		t.Errorf("expected %s on redelivery, got %+v", ReasonExpiredOffer, decision)
+	}
+
+	// The promoter withdraws the promotion
+	withdrawal, err := events.CreatePromotionWithdrawal(m.Promoter, events.WithdrawalParams{ID: "pr-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Pool.Publish(ctx, withdrawal); err != nil {
+		t.Fatal(err)
+	}
+	decision, err := m.newAgent(t, m.trusting(), nil).HandleMatch(ctx, m.match)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Confirmed || decision.Reason != ReasonWithdrawnOffer || decision.Detail != m.promotion_coordinate {
+		t.Errorf("expected %s, got %+v", ReasonWithdrawnOffer, decision)
+	}
+	if found := m.confirmations(t, ctx); len(found) != 0 {
+		t.Errorf("expected nothing published, got %d confirmations", len(found))
+	}
+}
+
+func TestAgent_RejectsUnaddressedMatches(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx, 1000, 30000)
+
+	// Signed by someone other than the marketplace
+	if decision, _ := m.newAgent(t, m.trusting(), nil).HandleMatch(ctx, m.newMatch(t, nostr.GeneratePrivateKey(), "m-2")); decision.Reason != ReasonInvalidMatch {
+		t.Errorf("expected %s, got %+v", ReasonInvalidMatch, decision)
+	}
+
+	// Another provider's agent sees the same match
+	other := &market{Market: &markettest.Market{Relay: m.Relay, Pool: m.Pool, Provider: nostr.GeneratePrivateKey()}}
+	if decision, _ := other.newAgent(t, m.trusting(), nil).HandleMatch(ctx, m.match); decision.Reason != ReasonNotAddressed {
+		t.Errorf("expected %s, got %+v", ReasonNotAddressed, decision)
+	}
+}
+
+func TestAgent_RunLogsDecisions(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx, 1000, 30000)
+	policy := m.trusting()
+	policy.Ask = 2000
+
+	var logs bytes.Buffer
+	agent := m.newAgent(t, policy, &logs)
+	incoming := make(chan *nostr.Event, 1)
+	incoming <- m.match
+	close(incoming)
+	if err := agent.Run(ctx, incoming); err != nil {
+		t.Fatal(err)
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON log record, got %q", logs.String())
+	}
+	if record["reason"] != string(ReasonBelowAsk) || record["confirmed"] != false || !strings.Contains(record["detail"].(string), "ask 2000") {
+		t.Errorf("unexpected log record %v", record)
+	}
+}
+
+func TestAgent_Subscribe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx, 1000, 30000)
+	agent := m.newAgent(t, m.trusting(), nil)
+
+	subscribed, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- agent.Subscribe(subscribed) }()
+
+	if err := m.Pool.Publish(ctx, m.match); err != nil {
+		t.Fatal(err)
+	}
+	for len(m.confirmations(t, ctx)) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("expected the subscribed agent to confirm the match")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	stop()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// A pool that cannot subscribe is reported
+	options := Options{PrivateKey: m.Provider, Policy: m.trusting(), Pool: struct{ Pool }{m.Pool}, RelayURLs: []string{m.Relay.URL()}}
+	plain, err := NewAgent(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.Subscribe(ctx); err != ErrNoSubscriber {
+		t.Errorf("expected ErrNoSubscriber, got %v", err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m := newMarket(t, ctx, 1000, 30000)
+	marketplace_pubkey, _ := nostr.GetPublicKey(m.Marketplace)
+
+	list := func(d_tag string, tags ...nostr.Tag) {
+		event := &nostr.Event{Kind: nostr.KindCategorizedPeopleList, CreatedAt: nostr.Now(), Tags: append(nostr.Tags{{"d", d_tag}}, tags...)}
+		if err := event.Sign(m.Provider); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Pool.Publish(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list(core.NIP51BlockedPromoters, nostr.Tag{"p", "spammer"})
+	list(core.NIP51TrustedMarketplaces, nostr.Tag{"p", marketplace_pubkey})
+
+	policy, err := LoadPolicy(ctx, m.Pool, m.Attention)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Ask != 500 || policy.MinDuration != 15000 || policy.MaxDuration != 60000 {
+		t.Errorf("unexpected bounds %+v", policy)
+	}
+	if !policy.BlockedPromoters.Contains("", "", "spammer") || !policy.TrustedMarketplaces.Contains("", "", marketplace_pubkey) {
+		t.Error("expected the published lists to be loaded")
+	}
+	if policy.TrustedBillboards.Contains(m.BillboardCoordinate, "", marketplace_pubkey) {
+		t.Error("expected a missing trust list to trust no one")
+	}
+
+	// Without a trusted billboards list the agent withholds
+	if decision, _ := m.newAgent(t, policy, nil).HandleMatch(ctx, m.match); decision.Reason != ReasonUntrustedBillboard {
+		t.Errorf("expected %s, got %+v", ReasonUntrustedBillboard, decision)
+	}
+
+	if _, err := LoadPolicy(ctx, m.Pool, m.promotion); err != ErrNotAttentionEvent {
+		t.Errorf("expected ErrNotAttentionEvent, got %v", err)
+	}
+}
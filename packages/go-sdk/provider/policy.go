@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrNotAttentionEvent is returned by LoadPolicy when given an event that is not an ATTENTION event.
+var ErrNotAttentionEvent = errors.New("not an ATTENTION event")
+
+// Querier queries events from relays. *relay.Pool implements it.
+type Querier interface {
+	Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+// List is a NIP-51 list (kind 30000) of coordinates, pubkeys and event IDs.
+// The zero List is empty.
+type List struct {
+	Coordinates map[string]bool
+	Pubkeys     map[string]bool
+	EventIDs    map[string]bool
+}
+
+// ParseList reads the a, p and e tags of a NIP-51 list event.
+func ParseList(event *nostr.Event) List {
+	list := List{
+		Coordinates: make(map[string]bool),
+		Pubkeys:     make(map[string]bool),
+		EventIDs:    make(map[string]bool),
+	}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "a":
+			list.Coordinates[tag[1]] = true
+		case "p":
+			list.Pubkeys[tag[1]] = true
+		case "e":
+			list.EventIDs[tag[1]] = true
+		}
+	}
+	return list
+}
+
+// Contains reports whether the list names the event with the given coordinate,
+// ID or author. Empty arguments never match.
+func (l List) Contains(coordinate, event_id, pubkey string) bool {
+	return (coordinate != "" && l.Coordinates[coordinate]) ||
+		(event_id != "" && l.EventIDs[event_id]) ||
+		(pubkey != "" && l.Pubkeys[pubkey])
+}
+
+// Policy decides which matches an attention provider confirms.
+type Policy struct {
+	// Ask is the least a promotion may bid, in sats.
+	Ask int64
+
+	// MinDuration and MaxDuration bound the promotion duration in milliseconds.
+	MinDuration int64
+	MaxDuration int64
+
+	// BlockedPromotions and BlockedPromoters withhold confirmations for the
+	// promotions and promoters they name.
+	BlockedPromotions List
+	BlockedPromoters  List
+
+	// TrustedMarketplaces and TrustedBillboards are the only marketplaces and
+	// billboards confirmations are published for. Per the NIP-51 trust list
+	// semantics an empty or missing list trusts no one.
+	TrustedMarketplaces List
+	TrustedBillboards   List
+}
+
+// LoadPolicy builds a Policy from an ATTENTION event: the ask and duration
+// bounds from its content, and the lists its *_id fields name, fetched from
+// kind 30000 events by the same author. Lists that are not found are empty.
+func LoadPolicy(ctx context.Context, querier Querier, attention *nostr.Event) (Policy, error) {
+	if attention.Kind != core.KindAttention {
+		return Policy{}, ErrNotAttentionEvent
+	}
+	var content core.AttentionData
+	if err := json.Unmarshal([]byte(attention.Content), &content); err != nil {
+		return Policy{}, err
+	}
+	policy := Policy{
+		Ask:         content.Ask,
+		MinDuration: content.MinDuration,
+		MaxDuration: content.MaxDuration,
+	}
+
+	lists := map[string]*List{
+		content.BlockedPromotionsID:   &policy.BlockedPromotions,
+		content.BlockedPromotersID:    &policy.BlockedPromoters,
+		content.TrustedMarketplacesID: &policy.TrustedMarketplaces,
+		content.TrustedBillboardsID:   &policy.TrustedBillboards,
+	}
+	delete(lists, "")
+	if len(lists) == 0 {
+		return policy, nil
+	}
+
+	d_tags := make([]string, 0, len(lists))
+	for d_tag := range lists {
+		d_tags = append(d_tags, d_tag)
+	}
+	found, err := querier.Query(ctx, nostr.Filter{
+		Kinds:   []int{nostr.KindCategorizedPeopleList},
+		Authors: []string{attention.PubKey},
+		Tags:    nostr.TagMap{"d": d_tags},
+	})
+	if err != nil {
+		return Policy{}, err
+	}
+
+	// Keep the newest version of each list
+	newest := make(map[string]*nostr.Event)
+	for _, event := range found {
+		d_tag := event.Tags.GetD()
+		if current, ok := newest[d_tag]; !ok || event.CreatedAt > current.CreatedAt {
+			newest[d_tag] = event
+		}
+	}
+	for d_tag, event := range newest {
+		if list, ok := lists[d_tag]; ok {
+			*list = ParseList(event)
+		}
+	}
+	return policy, nil
+}
@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// DefaultBatchConcurrency is how many events a batch has in flight per relay,
+// when PublishBatchOptions.Concurrency is zero.
+const DefaultBatchConcurrency = 32
+
+// PublishBatchOptions holds configuration for Pool.PublishBatch.
+type PublishBatchOptions struct {
+	// Concurrency is how many events are awaiting an OK from each relay at
+	// once. Defaults to DefaultBatchConcurrency.
+	Concurrency int
+
+	// Timeout bounds each event's wait for an OK, if set.
+	Timeout time.Duration
+}
+
+// PublishBatch publishes events to every connected relay over the pool's
+// existing connections, pipelining up to Concurrency events per relay. It
+// returns one PublishResults per event, in the order of events; an event
+// failed on every relay has a SuccessCount of zero.
+func (p *Pool) PublishBatch(ctx context.Context, events []*nostr.Event, options PublishBatchOptions) ([]PublishResults, error) {
+	if len(p.relays) == 0 {
+		return nil, ErrNoRelays
+	}
+	concurrency := options.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	results := make([]PublishResults, len(events))
+	for i, event := range events {
+		results[i] = PublishResults{EventID: event.ID, Results: make([]PublishResult, len(p.relays))}
+	}
+
+	// Each relay works through the batch on its own workers, so a slow relay
+	// does not hold back the others.
+	var wg sync.WaitGroup
+	for r, relay := range p.relays {
+		indexes := make(chan int)
+		for w := 0; w < min(concurrency, len(events)); w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range indexes {
+					results[i].Results[r] = publishBatched(ctx, relay, events[i], options.Timeout)
+				}
+			}()
+		}
+		go func() {
+			defer close(indexes)
+			for i := range events {
+				indexes <- i
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range results {
+		for _, result := range results[i].Results {
+			if result.Success {
+				results[i].SuccessCount++
+			} else {
+				results[i].FailureCount++
+			}
+		}
+	}
+	return results, nil
+}
+
+// publishBatched publishes one event of a batch to one relay.
+func publishBatched(ctx context.Context, relay *nostr.Relay, event *nostr.Event, timeout time.Duration) PublishResult {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	err := ctx.Err()
+	if err == nil {
+		err = publishAndConfirm(ctx, relay, event)
+	}
+	return PublishResult{RelayURL: relay.URL, Success: err == nil, Error: err}
+}
@@ -0,0 +1,171 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// connectPool connects a pool to the given relays.
+func connectPool(tb testing.TB, ctx context.Context, relays ...*relaytest.Relay) *Pool {
+	tb.Helper()
+	urls := make([]string, len(relays))
+	for i, relay := range relays {
+		urls[i] = relay.URL()
+	}
+	pool, err := NewPool(urls)
+	if err != nil {
+		tb.Fatalf("NewPool: %v", err)
+	}
+	if err := pool.Connect(ctx); err != nil {
+		tb.Fatalf("Connect: %v", err)
+	}
+	return pool
+}
+
+// signedBatch returns n events signed by one key.
+func signedBatch(tb testing.TB, n int) []*nostr.Event {
+	tb.Helper()
+	private_key := nostr.GeneratePrivateKey()
+	batch := make([]*nostr.Event, n)
+	for i := range batch {
+		batch[i] = &nostr.Event{Kind: 30078, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"d", fmt.Sprintf("batch-%d", i)}}, Content: "{}"}
+		if err := batch[i].Sign(private_key); err != nil {
+			tb.Fatalf("sign event: %v", err)
+		}
+	}
+	return batch
+}
+
+// benchmarkBatch returns n events with IDs but placeholder signatures, for a
+// relay that skips verification.
+func benchmarkBatch(n int) []*nostr.Event {
+	pubkey := strings.Repeat("ab", 32)
+	batch := make([]*nostr.Event, n)
+	for i := range batch {
+		batch[i] = &nostr.Event{PubKey: pubkey, Kind: 30078, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"d", fmt.Sprintf("batch-%d", i)}}, Content: "{}"}
+		batch[i].ID = batch[i].GetID()
+		batch[i].Sig = strings.Repeat("00", 64)
+	}
+	return batch
+}
+
+func TestPool_PublishBatch(t *testing.T) {
+	relay_a := relaytest.NewRelay(relaytest.Options{})
+	defer relay_a.Close()
+	relay_b := relaytest.NewRelay(relaytest.Options{})
+	defer relay_b.Close()
+
+	batch := signedBatch(t, 40)
+	relay_b.SetRejectFunc(func(event *nostr.Event) (bool, string) {
+		return event.ID == batch[7].ID, "blocked: not this one"
+	})
+
+	ctx := testContext(t)
+	pool := connectPool(t, ctx, relay_a, relay_b)
+	defer pool.Close()
+
+	results, err := pool.PublishBatch(ctx, batch, PublishBatchOptions{Concurrency: 4})
+	if err != nil {
+		t.Fatalf("PublishBatch: %v", err)
+	}
+	if len(results) != len(batch) {
+		t.Fatalf("expected %d results, got %d", len(batch), len(results))
+	}
+	for i, result := range results {
+		want_failures := 0
+		if i == 7 {
+			want_failures = 1
+		}
+		if result.EventID != batch[i].ID || result.SuccessCount != 2-want_failures || result.FailureCount != want_failures {
+			t.Errorf("result %d: %+v", i, result)
+		}
+	}
+	if results[7].Results[1].RelayURL != relay_b.URL() || results[7].Results[1].Error == nil {
+		t.Errorf("expected relay b's rejection of event 7, got %+v", results[7].Results[1])
+	}
+	if len(relay_a.Received()) != len(batch) || pool.ConnectedCount() != 2 {
+		t.Errorf("expected every event over the existing connections")
+	}
+}
+
+func TestPool_PublishBatch_Cancelled(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	pool := connectPool(t, testContext(t), mock)
+	defer pool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := pool.PublishBatch(ctx, signedBatch(t, 5), PublishBatchOptions{})
+	if err != nil {
+		t.Fatalf("PublishBatch: %v", err)
+	}
+	for i, result := range results {
+		if result.SuccessCount != 0 {
+			t.Errorf("result %d: expected failure after cancellation, got %+v", i, result)
+		}
+	}
+}
+
+func BenchmarkPool_PublishBatch(b *testing.B) {
+	// The relay skips signature checks so the client side is measured
+	mock := relaytest.NewRelay(relaytest.Options{SkipVerification: true})
+	defer mock.Close()
+	ctx := context.Background()
+	pool := connectPool(b, ctx, mock)
+	defer pool.Close()
+
+	for _, size := range []int{10, 100, 1000, 10000} {
+		b.Run(fmt.Sprintf("events=%d", size), func(b *testing.B) {
+			batches := make([][]*nostr.Event, b.N)
+			for i := range batches {
+				batches[i] = benchmarkBatch(size)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				results, err := pool.PublishBatch(ctx, batches[i], PublishBatchOptions{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if results[0].SuccessCount != 1 {
+					b.Fatalf("publish failed: %+v", results[0].Results)
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
+
+// BenchmarkPool_PublishSequential is the one-at-a-time baseline for
+// BenchmarkPool_PublishBatch.
+func BenchmarkPool_PublishSequential(b *testing.B) {
+	// The relay skips signature checks so the client side is measured
+	mock := relaytest.NewRelay(relaytest.Options{SkipVerification: true})
+	defer mock.Close()
+	ctx := context.Background()
+	pool := connectPool(b, ctx, mock)
+	defer pool.Close()
+
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("events=%d", size), func(b *testing.B) {
+			batches := make([][]*nostr.Event, b.N)
+			for i := range batches {
+				batches[i] = benchmarkBatch(size)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, event := range batches[i] {
+					if err := pool.Publish(ctx, event); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
@@ -0,0 +1,446 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrNoOutboxStore is returned when an outbox has no store.
+	ErrNoOutboxStore = errors.New("outbox has no store")
+
+	// ErrNotInOutbox is returned for an event ID the outbox does not hold.
+	ErrNotInOutbox = errors.New("event not in outbox")
+
+	// ErrUnsigned is returned when an unsigned event is given to the outbox.
+	ErrUnsigned = errors.New("event is not signed")
+
+	// errDelivering is returned by deliver for an event another caller is delivering.
+	errDelivering = errors.New("event is being delivered")
+)
+
+// Outbox defaults, used when OutboxOptions leaves them zero.
+const (
+	DefaultMinBackoff     = time.Second
+	DefaultMaxBackoff     = 5 * time.Minute
+	DefaultAttemptTimeout = 10 * time.Second
+)
+
+// DeliveryState is the state of an event's delivery to one relay.
+type DeliveryState string
+
+const (
+	// DeliveryPending means the relay has not yet acknowledged the event and
+	// the outbox will try again.
+	DeliveryPending DeliveryState = "pending"
+
+	// DeliveryAcknowledged means the relay accepted the event, or already had it.
+	DeliveryAcknowledged DeliveryState = "acknowledged"
+
+	// DeliveryRejected means the relay refused the event for a reason retrying
+	// cannot fix: blocked, invalid, pow, restricted or auth-required.
+	DeliveryRejected DeliveryState = "rejected"
+)
+
+// Delivery is the progress of an event to one relay.
+type Delivery struct {
+	RelayURL string        `json:"relay_url"`
+	State    DeliveryState `json:"state"`
+	Attempts int           `json:"attempts"`
+
+	// LastError is the error of the last failed attempt.
+	LastError string `json:"last_error,omitempty"`
+
+	// NextAttempt is when a pending delivery is next tried.
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// OutboxEntry is a signed event and its delivery to each target relay.
+type OutboxEntry struct {
+	Event      *nostr.Event `json:"event"`
+	Deliveries []Delivery   `json:"deliveries"`
+	EnqueuedAt time.Time    `json:"enqueued_at"`
+}
+
+// Done reports whether every delivery is settled, acknowledged or rejected.
+func (e OutboxEntry) Done() bool {
+	for _, delivery := range e.Deliveries {
+		if delivery.State == DeliveryPending {
+			return false
+		}
+	}
+	return true
+}
+
+// Acknowledged counts the relays that acknowledged the event.
+func (e OutboxEntry) Acknowledged() int {
+	count := 0
+	for _, delivery := range e.Deliveries {
+		if delivery.State == DeliveryAcknowledged {
+			count++
+		}
+	}
+	return count
+}
+
+// OutboxStore persists outbox entries. Implementations must be safe for
+// concurrent use. FileOutboxStore keeps them in a file, and the store/sqlite
+// package provides one backed by SQLite.
+type OutboxStore interface {
+	// Save inserts or replaces the entry for its event ID. It must not return
+	// before the entry is durable.
+	Save(ctx context.Context, entry OutboxEntry) error
+
+	// Get returns the entry for an event ID, or ErrNotInOutbox.
+	Get(ctx context.Context, event_id string) (OutboxEntry, error)
+
+	// Pending returns the entries with a pending delivery, oldest first.
+	Pending(ctx context.Context) ([]OutboxEntry, error)
+
+	// Prune deletes the entries enqueued before the given time whose
+	// deliveries are all settled, and returns how many it deleted.
+	Prune(ctx context.Context, before time.Time) (int, error)
+}
+
+// OutboxOptions holds configuration for an Outbox.
+type OutboxOptions struct {
+	// Store persists events and their delivery status.
+	Store OutboxStore
+
+	// RelayURLs are the relays events are delivered to when Enqueue names none.
+	RelayURLs []string
+
+	// Router, if set, adds the routes of events enqueued without relay URLs
+	// to RelayURLs.
+	Router *Router
+
+	// MinBackoff and MaxBackoff bound the wait before retrying a relay. The wait
+	// doubles after every failed attempt. Default to DefaultMinBackoff and
+	// DefaultMaxBackoff.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// AttemptTimeout bounds each attempt. Defaults to DefaultAttemptTimeout.
+	AttemptTimeout time.Duration
+
+	// Retention, if set, is how long settled entries are kept after they were
+	// enqueued. Run prunes older ones from the store; without it they are kept.
+	Retention time.Duration
+
+	// PublishFunc delivers an event to one relay and returns its OK error.
+	// Defaults to PublishToRelay over a new connection.
+	PublishFunc func(ctx context.Context, event *nostr.Event, relay_url string) error
+
+	// OnError, if set, receives store errors during Run, which otherwise
+	// continues.
+	OnError func(err error)
+}
+
+// Outbox persists signed events before publishing them, and retries each
+// relay with backoff until it acknowledges the event or rejects it for good.
+// Events survive restarts: a new Outbox on the same store resumes delivery.
+// It is safe for concurrent use.
+type Outbox struct {
+	options OutboxOptions
+	now     func() time.Time
+	wake    chan struct{}
+
+	mu         sync.Mutex      // serialises loading and saving entries
+	delivering map[string]bool // event IDs with attempts in progress
+}
+
+// NewOutbox creates an outbox.
+func NewOutbox(options OutboxOptions) (*Outbox, error) {
+	if options.Store == nil {
+		return nil, ErrNoOutboxStore
+	}
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+	if options.MaxBackoff < options.MinBackoff {
+		options.MaxBackoff = max(DefaultMaxBackoff, options.MinBackoff)
+	}
+	if options.AttemptTimeout <= 0 {
+		options.AttemptTimeout = DefaultAttemptTimeout
+	}
+	if options.PublishFunc == nil {
+		options.PublishFunc = func(ctx context.Context, event *nostr.Event, relay_url string) error {
+			_, err := PublishToRelay(ctx, event, relay_url)
+			return err
+		}
+	}
+	return &Outbox{options: options, now: time.Now, wake: make(chan struct{}, 1), delivering: make(map[string]bool)}, nil
+}
+
+// Enqueue persists a signed event for delivery to relay_urls, or to
+// OutboxOptions.RelayURLs and the Router's routes when none are given, and
+// returns its entry. It does
+// not publish; Run, Flush or Publish do. Enqueueing an event again adds any new
+// relays and leaves existing deliveries as they are.
+func (o *Outbox) Enqueue(ctx context.Context, event *nostr.Event, relay_urls ...string) (OutboxEntry, error) {
+	if event.ID == "" || event.Sig == "" {
+		return OutboxEntry{}, ErrUnsigned
+	}
+	if len(relay_urls) == 0 {
+		relay_urls = o.options.RelayURLs
+		if o.options.Router != nil {
+			routes, err := o.options.Router.Routes(ctx, event)
+			if err != nil && len(relay_urls) == 0 {
+				return OutboxEntry{}, err
+			}
+			relay_urls = normalizeURLs(append(append([]string(nil), relay_urls...), routes...))
+		}
+	}
+	if len(relay_urls) == 0 {
+		return OutboxEntry{}, ErrNoRelays
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	now := o.now()
+	entry, err := o.options.Store.Get(ctx, event.ID)
+	if errors.Is(err, ErrNotInOutbox) {
+		entry, err = OutboxEntry{Event: event, EnqueuedAt: now}, nil
+	}
+	if err != nil {
+		return OutboxEntry{}, err
+	}
+
+	added := false
+	for _, url := range relay_urls {
+		if !hasDelivery(entry, url) {
+			entry.Deliveries = append(entry.Deliveries, Delivery{RelayURL: url, State: DeliveryPending, NextAttempt: now, UpdatedAt: now})
+			added = true
+		}
+	}
+	if !added && len(entry.Deliveries) > 0 {
+		return entry, nil
+	}
+	if err := o.options.Store.Save(ctx, entry); err != nil {
+		return OutboxEntry{}, err
+	}
+
+	o.notify()
+	return entry, nil
+}
+
+// Publish enqueues an event and attempts its pending deliveries at once. The
+// outbox keeps retrying relays that fail, so Publish returns nil once the
+// event is persisted, unless every relay rejected it, when it returns
+// ErrPublishFailed. Outbox can stand in for a Pool as a publisher.
+func (o *Outbox) Publish(ctx context.Context, event *nostr.Event) error {
+	if _, err := o.Enqueue(ctx, event); err != nil {
+		return err
+	}
+
+	entry, err := o.deliver(ctx, event.ID, true)
+	if errors.Is(err, errDelivering) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if entry.Done() && entry.Acknowledged() == 0 {
+		return ErrPublishFailed
+	}
+	return nil
+}
+
+// Status returns an event's entry, with the delivery status of each relay.
+func (o *Outbox) Status(ctx context.Context, event_id string) (OutboxEntry, error) {
+	return o.options.Store.Get(ctx, event_id)
+}
+
+// Flush attempts every pending delivery that is due, and returns the first
+// time a delivery is due again, or the zero time when none is pending.
+// Events another caller is delivering are left to it.
+func (o *Outbox) Flush(ctx context.Context) (time.Time, error) {
+	pending, err := o.options.Store.Pending(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var next time.Time
+	var errs []error
+	for _, entry := range pending {
+		entry, err := o.deliver(ctx, entry.Event.ID, false)
+		if errors.Is(err, errDelivering) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, delivery := range entry.Deliveries {
+			if delivery.State == DeliveryPending && (next.IsZero() || delivery.NextAttempt.Before(next)) {
+				next = delivery.NextAttempt
+			}
+		}
+	}
+	return next, errors.Join(errs...)
+}
+
+// Run delivers pending events until ctx is done, starting with those left
+// from before a restart, and returns ctx.Err(). With a Retention it also
+// prunes settled entries.
+func (o *Outbox) Run(ctx context.Context) error {
+	for {
+		next, err := o.Flush(ctx)
+		if err == nil && o.options.Retention > 0 {
+			_, err = o.options.Store.Prune(ctx, o.now().Add(-o.options.Retention))
+		}
+		if err != nil && ctx.Err() == nil && o.options.OnError != nil {
+			o.options.OnError(err)
+		}
+
+		wait := o.options.MaxBackoff
+		if !next.IsZero() {
+			wait = min(max(next.Sub(o.now()), 0), o.options.MaxBackoff)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// deliver attempts the pending deliveries of an event's entry, concurrently,
+// and saves the outcome. Deliveries not yet due are skipped unless all is set.
+// o.mu is held only to load and save the entry, not during attempts, and an
+// event another caller is delivering returns errDelivering.
+func (o *Outbox) deliver(ctx context.Context, event_id string, all bool) (OutboxEntry, error) {
+	o.mu.Lock()
+	if o.delivering[event_id] {
+		o.mu.Unlock()
+		return OutboxEntry{}, errDelivering
+	}
+	entry, err := o.options.Store.Get(ctx, event_id)
+	if err != nil {
+		o.mu.Unlock()
+		return OutboxEntry{}, err
+	}
+	now := o.now()
+	var due []int
+	for i, delivery := range entry.Deliveries {
+		if delivery.State == DeliveryPending && (all || !delivery.NextAttempt.After(now)) {
+			due = append(due, i)
+		}
+	}
+	if len(due) == 0 {
+		o.mu.Unlock()
+		return entry, nil
+	}
+	o.delivering[event_id] = true
+	o.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, i := range due {
+		delivery := &entry.Deliveries[i]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempt_ctx, cancel := context.WithTimeout(ctx, o.options.AttemptTimeout)
+			defer cancel()
+			o.settle(delivery, o.options.PublishFunc(attempt_ctx, entry.Event, delivery.RelayURL), now)
+		}()
+	}
+	wg.Wait()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.delivering, event_id)
+
+	// Enqueue may have added relays meanwhile: apply the outcomes to the stored entry
+	if stored, err := o.options.Store.Get(ctx, event_id); err == nil {
+		for _, i := range due {
+			for j := range stored.Deliveries {
+				if stored.Deliveries[j].RelayURL == entry.Deliveries[i].RelayURL {
+					stored.Deliveries[j] = entry.Deliveries[i]
+				}
+			}
+		}
+		entry = stored
+	}
+	if err := o.options.Store.Save(ctx, entry); err != nil {
+		return entry, fmt.Errorf("outbox: save %s: %w", event_id, err)
+	}
+	o.notify()
+	return entry, nil
+}
+
+// notify wakes Run to recompute when deliveries are next due.
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// settle records the outcome of one attempt.
+func (o *Outbox) settle(delivery *Delivery, err error, now time.Time) {
+	delivery.Attempts++
+	delivery.UpdatedAt = now
+	delivery.State = classify(err)
+	delivery.LastError = ""
+	delivery.NextAttempt = time.Time{}
+	if err != nil {
+		delivery.LastError = err.Error()
+	}
+	if delivery.State == DeliveryPending {
+		delivery.NextAttempt = now.Add(o.backoff(delivery.Attempts))
+	}
+}
+
+// backoff returns the wait after the given number of failed attempts.
+func (o *Outbox) backoff(attempts int) time.Duration {
+	wait := o.options.MinBackoff
+	for i := 1; i < attempts && wait < o.options.MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, o.options.MaxBackoff)
+}
+
+// permanentRejections are the NIP-01 OK message prefixes that retrying the
+// same event cannot fix.
+var permanentRejections = []string{"blocked:", "invalid:", "pow:", "restricted:", "auth-required:"}
+
+// classify maps a publish error to a delivery state.
+func classify(err error) DeliveryState {
+	if err == nil {
+		return DeliveryAcknowledged
+	}
+	message, ok := okMessage(err)
+	if !ok {
+		return DeliveryPending
+	}
+	if strings.HasPrefix(message, "duplicate:") {
+		return DeliveryAcknowledged
+	}
+	for _, prefix := range permanentRejections {
+		if strings.HasPrefix(message, prefix) {
+			return DeliveryRejected
+		}
+	}
+	return DeliveryPending
+}
+
+func hasDelivery(entry OutboxEntry, relay_url string) bool {
+	for _, delivery := range entry.Deliveries {
+		if delivery.RelayURL == relay_url {
+			return true
+		}
+	}
+	return false
+}
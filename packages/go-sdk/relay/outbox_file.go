@@ -0,0 +1,189 @@
+package relay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileOutboxStore is an OutboxStore that appends each saved entry to a file
+// of JSON lines and syncs it before returning. Opening the file replays it,
+// keeping the last line per event, and rewrites it without superseded lines.
+// Prune rewrites it without the pruned entries.
+type FileOutboxStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]OutboxEntry
+}
+
+// NewFileOutboxStore opens or creates the outbox file at path. A line cut
+// short by a crash is ignored.
+func NewFileOutboxStore(path string) (*FileOutboxStore, error) {
+	s := &FileOutboxStore{path: path, entries: make(map[string]OutboxEntry)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Save implements OutboxStore.
+func (s *FileOutboxStore) Save(ctx context.Context, entry OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.entries[entry.Event.ID] = entry
+	return nil
+}
+
+// Get implements OutboxStore.
+func (s *FileOutboxStore) Get(ctx context.Context, event_id string) (OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[event_id]
+	if !ok {
+		return OutboxEntry{}, ErrNotInOutbox
+	}
+	return copyEntry(entry), nil
+}
+
+// Pending implements OutboxStore.
+func (s *FileOutboxStore) Pending(ctx context.Context) ([]OutboxEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pending []OutboxEntry
+	for _, entry := range s.entries {
+		if !entry.Done() {
+			pending = append(pending, copyEntry(entry))
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].EnqueuedAt.Before(pending[j].EnqueuedAt)
+	})
+	return pending, nil
+}
+
+// Prune implements OutboxStore.
+func (s *FileOutboxStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return 0, os.ErrClosed
+	}
+	pruned := 0
+	for event_id, entry := range s.entries {
+		if entry.Done() && entry.EnqueuedAt.Before(before) {
+			delete(s.entries, event_id)
+			pruned++
+		}
+	}
+	if pruned == 0 {
+		return 0, nil
+	}
+	return pruned, s.compact()
+}
+
+// Close closes the file.
+func (s *FileOutboxStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// load replays the file into entries.
+func (s *FileOutboxStore) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry OutboxEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Event == nil {
+			continue
+		}
+		s.entries[entry.Event.ID] = entry
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the file with one line per entry, replacing it atomically,
+// and opens it for appending in place of the file open before.
+func (s *FileOutboxStore) compact() error {
+	tmp_path := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmp_path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range s.entries {
+		if err := encoder.Encode(entry); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp_path, s.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	return nil
+}
+
+// copyEntry copies an entry's deliveries so callers cannot change the stored entry.
+func copyEntry(entry OutboxEntry) OutboxEntry {
+	entry.Deliveries = append([]Delivery(nil), entry.Deliveries...)
+	return entry
+}
@@ -0,0 +1,313 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// newTestOutbox creates an outbox on a file store in a temporary directory,
+// with a clock the test advances by hand.
+func newTestOutbox(t *testing.T, path string, relay_urls ...string) (*Outbox, *time.Time) {
+	t.Helper()
+	outbox_store, err := NewFileOutboxStore(path)
+	if err != nil {
+		t.Fatalf("NewFileOutboxStore: %v", err)
+	}
+	t.Cleanup(func() { outbox_store.Close() })
+
+	outbox, err := NewOutbox(OutboxOptions{Store: outbox_store, RelayURLs: relay_urls, MinBackoff: time.Second, MaxBackoff: 4 * time.Second})
+	if err != nil {
+		t.Fatalf("NewOutbox: %v", err)
+	}
+	now := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	outbox.now = func() time.Time { return now }
+	return outbox, &now
+}
+
+func TestOutbox_RetriesUntilAcknowledged(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	mock.SetRefuseConnections(true)
+
+	ctx := testContext(t)
+	outbox, now := newTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"), mock.URL())
+	event := createSignedEvent(t, 30078, "test")
+
+	// A relay that is down leaves the event queued, not lost
+	if err := outbox.Publish(ctx, event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	entry, err := outbox.Status(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	delivery := entry.Deliveries[0]
+	if delivery.State != DeliveryPending || delivery.Attempts != 1 || !delivery.NextAttempt.Equal(now.Add(time.Second)) {
+		t.Fatalf("expected a pending delivery retried after 1s, got %+v", delivery)
+	}
+
+	// Not yet due
+	if _, err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if entry, _ := outbox.Status(ctx, event.ID); entry.Deliveries[0].Attempts != 1 {
+		t.Errorf("expected no attempt before the backoff elapses, got %d", entry.Deliveries[0].Attempts)
+	}
+
+	// Backoff doubles up to MaxBackoff
+	for _, want := range []time.Duration{2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		*now = now.Add(time.Hour)
+		if _, err := outbox.Flush(ctx); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		entry, _ := outbox.Status(ctx, event.ID)
+		if got := entry.Deliveries[0].NextAttempt.Sub(*now); got != want {
+			t.Errorf("expected backoff %v, got %v", want, got)
+		}
+	}
+
+	mock.SetRefuseConnections(false)
+	*now = now.Add(time.Hour)
+	next, err := outbox.Flush(ctx)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	entry, _ = outbox.Status(ctx, event.ID)
+	if !entry.Done() || entry.Deliveries[0].State != DeliveryAcknowledged || entry.Deliveries[0].Attempts != 5 {
+		t.Errorf("expected the event acknowledged on the fifth attempt, got %+v", entry.Deliveries[0])
+	}
+	if !next.IsZero() {
+		t.Errorf("expected nothing left pending, got next attempt %v", next)
+	}
+	if _, err := mock.Store().GetByID(ctx, event.ID); err != nil {
+		t.Errorf("expected relay to store the event: %v", err)
+	}
+}
+
+func TestOutbox_PermanentRejection(t *testing.T) {
+	blocking := relaytest.NewRelay(relaytest.Options{})
+	defer blocking.Close()
+	limiting := relaytest.NewRelay(relaytest.Options{})
+	defer limiting.Close()
+	blocking.RejectNext("blocked: pubkey not allowed")
+	limiting.RejectNext("rate-limited: slow down")
+
+	ctx := testContext(t)
+	outbox, now := newTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"), blocking.URL(), limiting.URL())
+	event := createSignedEvent(t, 30078, "test")
+	if err := outbox.Publish(ctx, event); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	*now = now.Add(time.Minute)
+	if _, err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	entry, _ := outbox.Status(ctx, event.ID)
+	if entry.Deliveries[0].State != DeliveryRejected || entry.Deliveries[0].Attempts != 1 {
+		t.Errorf("expected blocked: to reject without retrying, got %+v", entry.Deliveries[0])
+	}
+	if entry.Deliveries[1].State != DeliveryAcknowledged || entry.Deliveries[1].Attempts != 2 {
+		t.Errorf("expected rate-limited: to be retried, got %+v", entry.Deliveries[1])
+	}
+	if len(blocking.Received()) != 1 {
+		t.Errorf("expected one attempt at the blocking relay, got %d", len(blocking.Received()))
+	}
+}
+
+func TestOutbox_AllRejected(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	mock.RejectNext("invalid: bad tags")
+
+	outbox, _ := newTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"), mock.URL())
+	if err := outbox.Publish(testContext(t), createSignedEvent(t, 30078, "test")); !errors.Is(err, ErrPublishFailed) {
+		t.Errorf("expected ErrPublishFailed when every relay rejects the event, got %v", err)
+	}
+}
+
+func TestOutbox_ResumesAfterRestart(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+
+	ctx := testContext(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	outbox, _ := newTestOutbox(t, path, mock.URL())
+	event := createSignedEvent(t, 30078, "test")
+
+	// Persist the event, then crash before publishing, mid-way through a write
+	if _, err := outbox.Enqueue(ctx, event); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	outbox.options.Store.(*FileOutboxStore).Close()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"event":{"id":"`)
+	file.Close()
+
+	restarted, _ := newTestOutbox(t, path, mock.URL())
+	if _, err := restarted.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	entry, err := restarted.Status(ctx, event.ID)
+	if err != nil || entry.Deliveries[0].State != DeliveryAcknowledged {
+		t.Errorf("expected the restarted outbox to deliver the event, got %+v, %v", entry, err)
+	}
+	if _, err := restarted.Status(ctx, "unknown"); !errors.Is(err, ErrNotInOutbox) {
+		t.Errorf("expected ErrNotInOutbox, got %v", err)
+	}
+}
+
+func TestOutbox_EnqueueAddsRelays(t *testing.T) {
+	ctx := testContext(t)
+	outbox, _ := newTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"), "wss://a.example.com")
+	event := createSignedEvent(t, 30078, "test")
+
+	if _, err := outbox.Enqueue(ctx, event); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	entry, err := outbox.Enqueue(ctx, event, "wss://a.example.com", "wss://b.example.com")
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if len(entry.Deliveries) != 2 || entry.Deliveries[1].RelayURL != "wss://b.example.com" {
+		t.Errorf("expected a delivery per relay, got %+v", entry.Deliveries)
+	}
+
+	unsigned := *event
+	unsigned.Sig = ""
+	if _, err := outbox.Enqueue(ctx, &unsigned); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("expected ErrUnsigned, got %v", err)
+	}
+}
+
+func TestOutbox_DeliversOutsideLock(t *testing.T) {
+	ctx := testContext(t)
+	outbox, _ := newTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"), "wss://relay.example.com")
+	slow, fast := createSignedEvent(t, 30078, "slow"), createSignedEvent(t, 30078, "fast")
+	entered, release := make(chan struct{}), make(chan struct{})
+	outbox.options.PublishFunc = func(ctx context.Context, event *nostr.Event, relay_url string) error {
+		if event.ID == slow.ID {
+			close(entered)
+			<-release
+		}
+		return nil
+	}
+
+	published := make(chan error, 1)
+	go func() { published <- outbox.Publish(ctx, slow) }()
+	<-entered
+
+	// While the slow event is being delivered, others are enqueued and
+	// delivered, and the slow one is not attempted twice
+	if err := outbox.Publish(ctx, fast); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if entry, _ := outbox.Status(ctx, fast.ID); !entry.Done() {
+		t.Errorf("expected the fast event delivered, got %+v", entry.Deliveries)
+	}
+	if _, err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if err := outbox.Publish(ctx, slow); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	close(release)
+	if err := <-published; err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	entry, _ := outbox.Status(ctx, slow.ID)
+	if !entry.Done() || entry.Deliveries[0].Attempts != 1 {
+		t.Errorf("expected one attempt at the slow event, got %+v", entry.Deliveries[0])
+	}
+}
+
+func TestOutbox_Prune(t *testing.T) {
+	ctx := testContext(t)
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	outbox, now := newTestOutbox(t, path, "wss://relay.example.com")
+	outbox.options.PublishFunc = func(context.Context, *nostr.Event, string) error { return nil }
+	settled, pending := createSignedEvent(t, 30078, "settled"), createSignedEvent(t, 30078, "pending")
+	if err := outbox.Publish(ctx, settled); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if _, err := outbox.Enqueue(ctx, pending); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	outbox_store := outbox.options.Store.(*FileOutboxStore)
+	if pruned, err := outbox_store.Prune(ctx, *now); err != nil || pruned != 0 {
+		t.Fatalf("expected nothing enqueued before now to be pruned, got %d, %v", pruned, err)
+	}
+	pruned, err := outbox_store.Prune(ctx, now.Add(time.Hour))
+	if err != nil || pruned != 1 {
+		t.Fatalf("expected the settled entry to be pruned, got %d, %v", pruned, err)
+	}
+	if _, err := outbox.Status(ctx, settled.ID); !errors.Is(err, ErrNotInOutbox) {
+		t.Errorf("expected the settled entry gone, got %v", err)
+	}
+
+	// The file no longer holds it, and stays writable
+	if _, err := outbox.Enqueue(ctx, pending, "wss://other.example.com"); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	outbox_store.Close()
+	reopened, _ := newTestOutbox(t, path)
+	if _, err := reopened.Status(ctx, settled.ID); !errors.Is(err, ErrNotInOutbox) {
+		t.Errorf("expected the pruned entry gone after reopening, got %v", err)
+	}
+	if entry, err := reopened.Status(ctx, pending.ID); err != nil || len(entry.Deliveries) != 2 {
+		t.Errorf("expected the pending entry kept, got %+v, %v", entry, err)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err  error
+		want DeliveryState
+	}{
+		{nil, DeliveryAcknowledged},
+		{errors.New("msg: duplicate: already have it"), DeliveryAcknowledged},
+		{errors.New("msg: blocked: pubkey not allowed"), DeliveryRejected},
+		{errors.New("msg: invalid: bad signature"), DeliveryRejected},
+		{errors.New("msg: auth-required: sign in"), DeliveryRejected},
+		{errors.New("msg: rate-limited: slow down"), DeliveryPending},
+		{errors.New("msg: error: database busy"), DeliveryPending},
+		{ErrConnectionLost, DeliveryPending},
+		{errors.New("invalid: not an OK message"), DeliveryPending},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.err); got != tt.want {
+			t.Errorf("classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestOutbox_Router(t *testing.T) {
+	ctx := testContext(t)
+	outbox, _ := newTestOutbox(t, filepath.Join(t.TempDir(), "outbox.jsonl"), "wss://default.example.com")
+	outbox.options.Router = NewRouter(RouterOptions{})
+
+	event := createSignedEvent(t, 30078, "test")
+	event.Tags = append(event.Tags, nostr.Tag{"r", "wss://own.example.com"})
+	if err := event.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := outbox.Enqueue(ctx, event)
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	if len(entry.Deliveries) != 2 || entry.Deliveries[1].RelayURL != "wss://own.example.com" {
+		t.Errorf("expected deliveries to the default relay and the routed one, got %+v", entry.Deliveries)
+	}
+}
@@ -3,7 +3,9 @@ package relay
 import (
 	"context"
 	"errors"
+	"sync"
 
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -16,6 +18,9 @@ var (
 
 	// ErrConnectionFailed is returned when relay connection fails.
 	ErrConnectionFailed = errors.New("failed to connect to relay")
+
+	// ErrConnectionLost is returned when a relay drops the connection before acknowledging an event.
+	ErrConnectionLost = errors.New("relay connection lost before OK")
 )
 
 // PublishResult represents the result of publishing an event to a relay.
@@ -37,6 +42,7 @@ type PublishResults struct {
 func PublishToRelay(ctx context.Context, event *nostr.Event, relay_url string) (*PublishResult, error) {
 	relay, err := nostr.RelayConnect(ctx, relay_url)
 	if err != nil {
+		observeConnectFailure(relay_url)
 		return &PublishResult{
 			RelayURL: relay_url,
 			Success:  false,
@@ -45,7 +51,7 @@ func PublishToRelay(ctx context.Context, event *nostr.Event, relay_url string) (
 	}
 	defer relay.Close()
 
-	err = relay.Publish(ctx, *event)
+	err = publishAndConfirm(ctx, relay, event)
 	if err != nil {
 		return &PublishResult{
 			RelayURL: relay_url,
@@ -61,6 +67,43 @@ func PublishToRelay(ctx context.Context, event *nostr.Event, relay_url string) (
 	}, nil
 }
 
+// publishAndConfirm publishes an event and waits for the relay's OK.
+func publishAndConfirm(ctx context.Context, relay *nostr.Relay, event *nostr.Event) error {
+	if instrumentation := telemetry.Default(); instrumentation != nil {
+		return publishInstrumented(ctx, instrumentation, relay, event)
+	}
+	return confirmPublish(ctx, relay, event)
+}
+
+// confirmPublish implements publishAndConfirm.
+// go-nostr's Publish returns nil both when the relay acknowledges the event
+// and when the connection ends before an OK arrives. A connection that has
+// ended by the time Publish returns may have sent its OK first, so the relay
+// is asked over a new connection whether it stored the event, and
+// ErrConnectionLost is returned only when it did not.
+func confirmPublish(ctx context.Context, relay *nostr.Relay, event *nostr.Event) error {
+	if err := relay.Publish(ctx, *event); err != nil {
+		return err
+	}
+	if relay.Context().Err() == nil || stored(ctx, relay.URL, event.ID) {
+		return nil
+	}
+	return ErrConnectionLost
+}
+
+// stored reports whether a relay holds an event, connecting to it anew.
+func stored(ctx context.Context, relay_url string, event_id string) bool {
+	relay, err := nostr.RelayConnect(ctx, relay_url)
+	if err != nil {
+		observeConnectFailure(relay_url)
+		return false
+	}
+	defer relay.Close()
+
+	found, err := queryRelay(ctx, relay, nostr.Filter{IDs: []string{event_id}})
+	return err == nil && len(found) > 0
+}
+
 // PublishToMultiple publishes an event to multiple relays.
 func PublishToMultiple(ctx context.Context, event *nostr.Event, relay_urls []string) (*PublishResults, error) {
 	if len(relay_urls) == 0 {
@@ -114,6 +157,7 @@ func (p *Pool) Connect(ctx context.Context) error {
 		relay, err := nostr.RelayConnect(ctx, url)
 		if err != nil {
 			// Continue trying other relays
+			observeConnectFailure(url)
 			continue
 		}
 		p.relays = append(p.relays, relay)
@@ -143,7 +187,7 @@ func (p *Pool) Publish(ctx context.Context, event *nostr.Event) error {
 
 	var success bool
 	for _, relay := range p.relays {
-		if err := relay.Publish(ctx, *event); err == nil {
+		if err := publishAndConfirm(ctx, relay, event); err == nil {
 			success = true
 		}
 	}
@@ -165,7 +209,7 @@ func (p *Pool) Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event,
 	seen := make(map[string]bool)
 
 	for _, relay := range p.relays {
-		relay_events, err := relay.QuerySync(ctx, filter)
+		relay_events, err := queryRelay(ctx, relay, filter)
 		if err != nil {
 			continue
 		}
@@ -180,6 +224,55 @@ func (p *Pool) Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event,
 	return events, nil
 }
 
+// Subscribe subscribes to filter on all connected relays and merges the
+// events they deliver into one channel. Events are not deduplicated across
+// relays. The channel closes once ctx is done or every relay has ended its
+// subscription. Relays that fail to subscribe are skipped; the first error is
+// returned only when none subscribes.
+func (p *Pool) Subscribe(ctx context.Context, filter nostr.Filter) (<-chan *nostr.Event, error) {
+	if len(p.relays) == 0 {
+		return nil, ErrNoRelays
+	}
+
+	var subscriptions []*nostr.Subscription
+	var first_err error
+	for _, relay := range p.relays {
+		subscription, err := relay.Subscribe(ctx, nostr.Filters{filter})
+		if err != nil {
+			if first_err == nil {
+				first_err = err
+			}
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if len(subscriptions) == 0 {
+		return nil, first_err
+	}
+
+	events := make(chan *nostr.Event)
+	var wg sync.WaitGroup
+	for _, subscription := range subscriptions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer subscription.Unsub()
+			for event := range subscription.Events {
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(events)
+	}()
+	return events, nil
+}
+
 // ConnectedCount returns the number of connected relays.
 func (p *Pool) ConnectedCount() int {
 	return len(p.relays)
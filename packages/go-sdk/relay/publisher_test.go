@@ -0,0 +1,291 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// createSignedEvent creates a signed test event of the given kind.
+func createSignedEvent(t *testing.T, kind int, d_tag string) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"d", d_tag}},
+		Content:   "{}",
+	}
+	if err := event.Sign(nostr.GeneratePrivateKey()); err != nil {
+		t.Fatalf("sign event: %v", err)
+	}
+	return event
+}
+
+// testContext returns a context that is cancelled when the test ends or after a short timeout.
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestPublishToRelay_Success(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+
+	event := createSignedEvent(t, 30078, "test")
+	result, err := PublishToRelay(testContext(t), event, mock.URL())
+	if err != nil {
+		t.Fatalf("PublishToRelay: %v", err)
+	}
+	if !result.Success || result.RelayURL != mock.URL() {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	stored, err := mock.Store().GetByID(context.Background(), event.ID)
+	if err != nil || stored.ID != event.ID {
+		t.Errorf("expected relay to store the event, got %v", err)
+	}
+}
+
+func TestPublishToRelay_Rejected(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	mock.RejectNext("blocked: pubkey not allowed")
+
+	result, err := PublishToRelay(testContext(t), createSignedEvent(t, 30078, "test"), mock.URL())
+	if err == nil {
+		t.Fatal("expected error for OK false")
+	}
+	if result.Success {
+		t.Error("expected unsuccessful result")
+	}
+	if !strings.Contains(err.Error(), "blocked: pubkey not allowed") {
+		t.Errorf("expected relay reason in error, got %v", err)
+	}
+}
+
+func TestPublishToRelay_InvalidATTNEvent(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{ValidateATTN: true})
+	defer mock.Close()
+
+	// A promotion with only a d tag fails ATTN validation
+	_, err := PublishToRelay(testContext(t), createSignedEvent(t, 38388, "org.attnprotocol:promotion:p1"), mock.URL())
+	if err == nil || !strings.Contains(err.Error(), "invalid:") {
+		t.Errorf("expected invalid: rejection, got %v", err)
+	}
+}
+
+func TestPublishToRelay_Disconnect(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	mock.DisconnectOnNextEvent(1)
+
+	result, err := PublishToRelay(testContext(t), createSignedEvent(t, 30078, "test"), mock.URL())
+	if !errors.Is(err, ErrConnectionLost) || result.Success {
+		t.Errorf("expected ErrConnectionLost when the relay drops the connection, got %v", err)
+	}
+	if len(mock.Received()) != 1 {
+		t.Errorf("expected relay to have received the event before disconnecting")
+	}
+}
+
+func TestPublishToRelay_DisconnectAfterOK(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	mock.DisconnectAfterNextOK(10)
+
+	// The relay acknowledges and stores each event before dropping the connection
+	for i := 0; i < 10; i++ {
+		result, err := PublishToRelay(testContext(t), createSignedEvent(t, 30078, fmt.Sprintf("test-%d", i)), mock.URL())
+		if err != nil || !result.Success {
+			t.Errorf("expected an acknowledged event to succeed, got %v", err)
+		}
+	}
+}
+
+func TestPublishToRelay_Timeout(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{Latency: 500 * time.Millisecond})
+	defer mock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := PublishToRelay(ctx, createSignedEvent(t, 30078, "test"), mock.URL()); err == nil {
+		t.Error("expected publish to fail when the relay is slower than the context deadline")
+	}
+}
+
+func TestPublishToMultiple(t *testing.T) {
+	healthy := relaytest.NewRelay(relaytest.Options{})
+	defer healthy.Close()
+	rejecting := relaytest.NewRelay(relaytest.Options{})
+	defer rejecting.Close()
+	rejecting.SetRejectFunc(func(event *nostr.Event) (bool, string) {
+		return true, "restricted: read-only relay"
+	})
+	down := relaytest.NewRelay(relaytest.Options{})
+	down.Close()
+
+	event := createSignedEvent(t, 30078, "test")
+	results, err := PublishToMultiple(testContext(t), event, []string{healthy.URL(), rejecting.URL(), down.URL()})
+	if err != nil {
+		t.Fatalf("expected success when one relay accepts, got %v", err)
+	}
+	if results.EventID != event.ID {
+		t.Errorf("expected event ID %s, got %s", event.ID, results.EventID)
+	}
+	if results.SuccessCount != 1 || results.FailureCount != 2 {
+		t.Errorf("expected 1 success and 2 failures, got %d and %d", results.SuccessCount, results.FailureCount)
+	}
+	if len(results.Results) != 3 || !results.Results[0].Success || results.Results[1].Success || results.Results[2].Success {
+		t.Errorf("unexpected per-relay results: %+v", results.Results)
+	}
+}
+
+func TestPublishToMultiple_AllFail(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	mock.RejectNext("error: disk full")
+
+	results, err := PublishToMultiple(testContext(t), createSignedEvent(t, 30078, "test"), []string{mock.URL()})
+	if !errors.Is(err, ErrPublishFailed) {
+		t.Errorf("expected ErrPublishFailed, got %v", err)
+	}
+	if results == nil || results.FailureCount != 1 {
+		t.Errorf("expected per-relay results alongside the error")
+	}
+}
+
+func TestPublishToMultiple_NoRelays(t *testing.T) {
+	if _, err := PublishToMultiple(testContext(t), createSignedEvent(t, 30078, "test"), nil); !errors.Is(err, ErrNoRelays) {
+		t.Errorf("expected ErrNoRelays, got %v", err)
+	}
+}
+
+func TestPool_PublishAndQuery(t *testing.T) {
+	relay_a := relaytest.NewRelay(relaytest.Options{})
+	defer relay_a.Close()
+	relay_b := relaytest.NewRelay(relaytest.Options{})
+	defer relay_b.Close()
+
+	shared := createSignedEvent(t, 30078, "shared")
+	only_b := createSignedEvent(t, 30078, "only-b")
+	if err := relay_b.Seed(only_b); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+
+	pool, err := NewPool([]string{relay_a.URL(), relay_b.URL()})
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	defer pool.Close()
+
+	ctx := testContext(t)
+	if err := pool.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if pool.ConnectedCount() != 2 {
+		t.Errorf("expected 2 connected relays, got %d", pool.ConnectedCount())
+	}
+
+	if err := pool.Publish(ctx, shared); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	events, err := pool.Query(ctx, nostr.Filter{Kinds: []int{30078}})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(events) != 2 {
+		t.Errorf("expected 2 deduplicated events, got %d", len(events))
+	}
+}
+
+func TestPool_Subscribe(t *testing.T) {
+	relay_a := relaytest.NewRelay(relaytest.Options{})
+	defer relay_a.Close()
+	relay_b := relaytest.NewRelay(relaytest.Options{})
+	defer relay_b.Close()
+
+	stored := createSignedEvent(t, 30078, "stored")
+	if err := relay_b.Seed(stored); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+
+	pool, err := NewPool([]string{relay_a.URL(), relay_b.URL()})
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	defer pool.Close()
+
+	ctx := testContext(t)
+	if err := pool.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	subscribed, cancel := context.WithCancel(ctx)
+	events, err := pool.Subscribe(subscribed, nostr.Filter{Kinds: []int{30078}})
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	if event := <-events; event.ID != stored.ID {
+		t.Errorf("expected the stored event first, got %s", event.ID)
+	}
+
+	// A live event reaches the subscription through both relays
+	live := createSignedEvent(t, 30078, "live")
+	if err := pool.Publish(ctx, live); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if event := <-events; event.ID != live.ID {
+			t.Errorf("expected the live event, got %s", event.ID)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestPool_PublishAllRejected(t *testing.T) {
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	mock.RejectNext("blocked: spam")
+
+	pool, _ := NewPool([]string{mock.URL()})
+	defer pool.Close()
+
+	ctx := testContext(t)
+	if err := pool.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	if err := pool.Publish(ctx, createSignedEvent(t, 30078, "test")); !errors.Is(err, ErrPublishFailed) {
+		t.Errorf("expected ErrPublishFailed, got %v", err)
+	}
+}
+
+func TestPool_ConnectFailures(t *testing.T) {
+	if _, err := NewPool(nil); !errors.Is(err, ErrNoRelays) {
+		t.Errorf("expected ErrNoRelays for empty pool, got %v", err)
+	}
+
+	down := relaytest.NewRelay(relaytest.Options{})
+	down.SetRefuseConnections(true)
+	defer down.Close()
+
+	pool, _ := NewPool([]string{down.URL()})
+	if err := pool.Connect(testContext(t)); !errors.Is(err, ErrConnectionFailed) {
+		t.Errorf("expected ErrConnectionFailed, got %v", err)
+	}
+	if err := pool.Publish(testContext(t), createSignedEvent(t, 30078, "test")); !errors.Is(err, ErrNoRelays) {
+		t.Errorf("expected ErrNoRelays publishing without connections, got %v", err)
+	}
+}
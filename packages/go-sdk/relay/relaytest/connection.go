@@ -0,0 +1,215 @@
+package relaytest
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/coder/websocket"
+	"github.com/joinnextblock/attn-protocol/go-core/validation"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip42"
+)
+
+// connection is a single client WebSocket connection to the mock relay.
+type connection struct {
+	relay     *Relay
+	ws        *websocket.Conn
+	challenge string
+
+	mu            sync.Mutex
+	authed_pubkey string
+	subscriptions map[string]nostr.Filters
+}
+
+// handleMessage dispatches one client message.
+// Returns false when the connection should be closed.
+func (c *connection) handleMessage(ctx context.Context, message string) bool {
+	switch envelope := nostr.ParseMessage(message).(type) {
+	case *nostr.EventEnvelope:
+		return c.handleEvent(ctx, &envelope.Event)
+	case *nostr.ReqEnvelope:
+		c.handleReq(ctx, envelope)
+	case *nostr.CloseEnvelope:
+		c.mu.Lock()
+		delete(c.subscriptions, string(*envelope))
+		c.mu.Unlock()
+	case *nostr.AuthEnvelope:
+		c.handleAuth(ctx, &envelope.Event)
+	default:
+		notice := nostr.NoticeEnvelope("error: could not parse message")
+		c.send(ctx, notice)
+	}
+	return true
+}
+
+// handleEvent processes an EVENT message and answers with OK.
+func (c *connection) handleEvent(ctx context.Context, event *nostr.Event) bool {
+	r := c.relay
+
+	r.mu.Lock()
+	r.received = append(r.received, event)
+	disconnect := r.disconnect_on_event > 0
+	if disconnect {
+		r.disconnect_on_event--
+	}
+	r.mu.Unlock()
+
+	if disconnect {
+		c.ws.Close(websocket.StatusGoingAway, "injected disconnect")
+		return false
+	}
+
+	if reason, ok := c.requireAuth(); !ok {
+		c.sendOK(ctx, event.ID, false, reason)
+		return true
+	}
+
+	if !r.options.SkipVerification {
+		if !event.CheckID() {
+			c.sendOK(ctx, event.ID, false, "invalid: event id does not match")
+			return true
+		}
+		if ok, _ := event.CheckSignature(); !ok {
+			c.sendOK(ctx, event.ID, false, "invalid: bad signature")
+			return true
+		}
+	}
+
+	if reject, reason := r.nextRejection(event); reject {
+		c.sendOK(ctx, event.ID, false, reason)
+		return true
+	}
+
+	if r.options.ValidateATTN && validation.IsATTNProtocolKind(event.Kind) {
+		if result := validation.ValidateATTNEvent(event); !result.Valid {
+			c.sendOK(ctx, event.ID, false, "invalid: "+result.Message)
+			return true
+		}
+	}
+
+	status, err := r.events.Save(ctx, event)
+	if err != nil {
+		c.sendOK(ctx, event.ID, false, "error: "+err.Error())
+		return true
+	}
+
+	switch status {
+	case store.SaveDuplicate:
+		c.sendOK(ctx, event.ID, true, "duplicate: already have this event")
+	case store.SaveStale:
+		c.sendOK(ctx, event.ID, true, "duplicate: have a newer version of this event")
+	default:
+		c.sendOK(ctx, event.ID, true, "")
+		r.broadcast(ctx, event)
+	}
+
+	r.mu.Lock()
+	disconnect = r.disconnect_after_ok > 0
+	if disconnect {
+		r.disconnect_after_ok--
+	}
+	r.mu.Unlock()
+
+	if disconnect {
+		c.ws.Close(websocket.StatusGoingAway, "injected disconnect")
+		return false
+	}
+	return true
+}
+
+// handleReq answers a REQ with stored events and EOSE, then keeps the subscription live.
+func (c *connection) handleReq(ctx context.Context, req *nostr.ReqEnvelope) {
+	if reason, ok := c.requireAuth(); !ok {
+		c.send(ctx, nostr.ClosedEnvelope{SubscriptionID: req.SubscriptionID, Reason: reason})
+		return
+	}
+
+	c.mu.Lock()
+	c.subscriptions[req.SubscriptionID] = req.Filters
+	c.mu.Unlock()
+
+	seen := make(map[string]bool)
+	for _, filter := range req.Filters {
+		events, err := c.relay.events.Query(ctx, filter)
+		if err != nil {
+			c.send(ctx, nostr.ClosedEnvelope{SubscriptionID: req.SubscriptionID, Reason: "error: " + err.Error()})
+			return
+		}
+		for _, event := range events {
+			if seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+			subscription_id := req.SubscriptionID
+			c.send(ctx, nostr.EventEnvelope{SubscriptionID: &subscription_id, Event: *event})
+		}
+	}
+
+	eose := nostr.EOSEEnvelope(req.SubscriptionID)
+	c.send(ctx, eose)
+}
+
+// handleAuth verifies a NIP-42 AUTH event against this connection's challenge.
+func (c *connection) handleAuth(ctx context.Context, event *nostr.Event) {
+	pubkey, ok := nip42.ValidateAuthEvent(event, c.challenge, c.relay.url)
+	if !ok || c.challenge == "" {
+		c.sendOK(ctx, event.ID, false, "invalid: auth event does not match challenge")
+		return
+	}
+
+	c.mu.Lock()
+	c.authed_pubkey = pubkey
+	c.mu.Unlock()
+
+	c.relay.mu.Lock()
+	c.relay.authenticated[pubkey] = true
+	c.relay.mu.Unlock()
+
+	c.sendOK(ctx, event.ID, true, "")
+}
+
+// requireAuth returns an auth-required reason when the relay needs AUTH and
+// this connection has not completed it.
+func (c *connection) requireAuth() (string, bool) {
+	if !c.relay.options.RequireAuth {
+		return "", true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.authed_pubkey == "" {
+		return "auth-required: authenticate with NIP-42 first", false
+	}
+	return "", true
+}
+
+// deliver sends an event to every subscription on this connection that matches it.
+func (c *connection) deliver(ctx context.Context, event *nostr.Event) {
+	c.mu.Lock()
+	var matched []string
+	for subscription_id, filters := range c.subscriptions {
+		if filters.Match(event) {
+			matched = append(matched, subscription_id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, subscription_id := range matched {
+		c.send(ctx, nostr.EventEnvelope{SubscriptionID: &subscription_id, Event: *event})
+	}
+}
+
+// sendOK sends an OK message for an event.
+func (c *connection) sendOK(ctx context.Context, event_id string, ok bool, reason string) {
+	c.send(ctx, nostr.OKEnvelope{EventID: event_id, OK: ok, Reason: reason})
+}
+
+// send writes an envelope to the client. Write errors close the connection on the next read.
+func (c *connection) send(ctx context.Context, envelope json.Marshaler) {
+	message, err := json.Marshal(envelope)
+	if err != nil {
+		return
+	}
+	c.ws.Write(ctx, websocket.MessageText, message)
+}
@@ -0,0 +1,296 @@
+// Package relaytest provides an in-process Nostr relay for tests.
+//
+// The relay speaks NIP-01 (EVENT, REQ, CLOSE, EOSE, OK, CLOSED) over a real
+// WebSocket on a loopback address, optionally requires NIP-42 AUTH, and can
+// run ATTN Protocol validation on ingest. Tests can inject rejections,
+// latency and disconnects to exercise publish and query error paths offline.
+//
+// Example usage:
+//
+//	mock := relaytest.NewRelay(relaytest.Options{ValidateATTN: true})
+//	defer mock.Close()
+//
+//	mock.RejectNext("rate-limited: slow down")
+//	result, err := relay.PublishToRelay(ctx, event, mock.URL())
+package relaytest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Options holds configuration for a mock relay.
+type Options struct {
+	// RequireAuth sends a NIP-42 challenge on connect and refuses EVENT and REQ
+	// messages until the client has authenticated.
+	RequireAuth bool
+
+	// ValidateATTN runs validation.ValidateATTNEvent on ATTN Protocol kinds and
+	// rejects events that fail with an "invalid:" OK message.
+	ValidateATTN bool
+
+	// SkipVerification accepts events without checking their ID and signature.
+	SkipVerification bool
+
+	// Latency delays the handling of every client message.
+	Latency time.Duration
+}
+
+// RejectFunc decides whether the relay rejects an event.
+// A rejected event is answered with OK false and the returned reason.
+type RejectFunc func(event *nostr.Event) (reject bool, reason string)
+
+// Relay is an in-process Nostr relay backed by a store.MemoryStore.
+type Relay struct {
+	options Options
+	server  *httptest.Server
+	url     string
+	events  *store.MemoryStore
+
+	mu                  sync.Mutex
+	latency             time.Duration
+	refuse_connections  bool
+	reject_func         RejectFunc
+	reject_queue        []string
+	disconnect_on_event int
+	disconnect_after_ok int
+	received            []*nostr.Event
+	authenticated       map[string]bool
+	connections         map[*connection]struct{}
+}
+
+// NewRelay starts a mock relay listening on a loopback address.
+// Call Close when the test is done.
+func NewRelay(options Options) *Relay {
+	r := &Relay{
+		options:       options,
+		events:        store.NewMemoryStore(store.MemoryOptions{}),
+		latency:       options.Latency,
+		authenticated: make(map[string]bool),
+		connections:   make(map[*connection]struct{}),
+	}
+	r.server = httptest.NewServer(http.HandlerFunc(r.handle))
+	r.url = "ws" + strings.TrimPrefix(r.server.URL, "http")
+	return r
+}
+
+// URL returns the relay's WebSocket URL.
+func (r *Relay) URL() string {
+	return r.url
+}
+
+// Close disconnects every client and stops the relay.
+func (r *Relay) Close() {
+	r.DisconnectAll()
+	r.server.Close()
+	r.events.Close()
+}
+
+// Store returns the relay's event store. Accepted events are saved here.
+func (r *Relay) Store() store.Store {
+	return r.events
+}
+
+// Seed saves events directly into the relay's store, bypassing validation and
+// failure injection. Use it to prepare data for REQ queries.
+func (r *Relay) Seed(events ...*nostr.Event) error {
+	for _, event := range events {
+		if _, err := r.events.Save(context.Background(), event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Received returns every event the relay received via EVENT, accepted or not, in order.
+func (r *Relay) Received() []*nostr.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	received := make([]*nostr.Event, len(r.received))
+	copy(received, r.received)
+	return received
+}
+
+// RejectNext queues a rejection: the next EVENT is answered with OK false and reason.
+// Calls queue up, one rejection per future event.
+func (r *Relay) RejectNext(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reject_queue = append(r.reject_queue, reason)
+}
+
+// SetRejectFunc installs a function that decides rejections for every event.
+// Pass nil to remove it.
+func (r *Relay) SetRejectFunc(reject_func RejectFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reject_func = reject_func
+}
+
+// SetLatency changes the delay applied to every client message.
+func (r *Relay) SetLatency(latency time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latency = latency
+}
+
+// DisconnectOnNextEvent drops the connection when the next n EVENT messages
+// arrive, without sending OK or storing them.
+func (r *Relay) DisconnectOnNextEvent(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disconnect_on_event = n
+}
+
+// DisconnectAfterNextOK drops the connection right after accepting, storing
+// and acknowledging each of the next n EVENT messages.
+func (r *Relay) DisconnectAfterNextOK(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.disconnect_after_ok = n
+}
+
+// SetRefuseConnections makes the relay answer new WebSocket handshakes with
+// 503 Service Unavailable, simulating a relay that is down.
+func (r *Relay) SetRefuseConnections(refuse bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.refuse_connections = refuse
+}
+
+// DisconnectAll closes every open client connection.
+func (r *Relay) DisconnectAll() {
+	r.mu.Lock()
+	connections := make([]*connection, 0, len(r.connections))
+	for conn := range r.connections {
+		connections = append(connections, conn)
+	}
+	r.mu.Unlock()
+
+	for _, conn := range connections {
+		conn.ws.Close(websocket.StatusGoingAway, "relay closing connection")
+	}
+}
+
+// ConnectionCount returns the number of open client connections.
+func (r *Relay) ConnectionCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.connections)
+}
+
+// IsAuthenticated reports whether a pubkey has completed NIP-42 AUTH on any connection.
+func (r *Relay) IsAuthenticated(pubkey string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.authenticated[pubkey]
+}
+
+// handle upgrades an HTTP request to a WebSocket and serves it until it closes.
+func (r *Relay) handle(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	refuse := r.refuse_connections
+	r.mu.Unlock()
+	if refuse {
+		http.Error(w, "relay unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	ws, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		return
+	}
+	ws.SetReadLimit(1 << 20)
+
+	conn := &connection{
+		relay:         r,
+		ws:            ws,
+		subscriptions: make(map[string]nostr.Filters),
+	}
+
+	r.mu.Lock()
+	r.connections[conn] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.connections, conn)
+		r.mu.Unlock()
+		ws.CloseNow()
+	}()
+
+	ctx := req.Context()
+	if r.options.RequireAuth {
+		conn.challenge = newChallenge()
+		conn.send(ctx, nostr.AuthEnvelope{Challenge: &conn.challenge})
+	}
+
+	for {
+		_, message, err := ws.Read(ctx)
+		if err != nil {
+			return
+		}
+
+		r.mu.Lock()
+		latency := r.latency
+		r.mu.Unlock()
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !conn.handleMessage(ctx, string(message)) {
+			return
+		}
+	}
+}
+
+// nextRejection returns the reason for rejecting an event, if any rule applies.
+func (r *Relay) nextRejection(event *nostr.Event) (bool, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.reject_queue) > 0 {
+		reason := r.reject_queue[0]
+		r.reject_queue = r.reject_queue[1:]
+		return true, reason
+	}
+	if r.reject_func != nil {
+		return r.reject_func(event)
+	}
+	return false, ""
+}
+
+// broadcast sends an accepted event to every live subscription that matches it.
+func (r *Relay) broadcast(ctx context.Context, event *nostr.Event) {
+	r.mu.Lock()
+	connections := make([]*connection, 0, len(r.connections))
+	for conn := range r.connections {
+		connections = append(connections, conn)
+	}
+	r.mu.Unlock()
+
+	for _, conn := range connections {
+		conn.deliver(ctx, event)
+	}
+}
+
+// newChallenge returns a random NIP-42 challenge string.
+func newChallenge() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
@@ -0,0 +1,125 @@
+package relaytest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestRelay_SubscriptionReceivesEOSEAndLiveEvents(t *testing.T) {
+	mock := NewRelay(Options{})
+	defer mock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	secret_key := nostr.GeneratePrivateKey()
+	stored := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "stored"}
+	stored.Sign(secret_key)
+	if err := mock.Seed(stored); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+
+	client, err := nostr.RelayConnect(ctx, mock.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Close()
+
+	subscription, err := client.Subscribe(ctx, nostr.Filters{{Kinds: []int{1}}})
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+
+	select {
+	case event := <-subscription.Events:
+		if event.ID != stored.ID {
+			t.Errorf("expected stored event first, got %s", event.ID)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for stored event")
+	}
+	select {
+	case <-subscription.EndOfStoredEvents:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for EOSE")
+	}
+
+	live := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "live"}
+	live.Sign(secret_key)
+	if err := client.Publish(ctx, *live); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+
+	select {
+	case event := <-subscription.Events:
+		if event.ID != live.ID {
+			t.Errorf("expected live event, got %s", event.ID)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for live event")
+	}
+}
+
+func TestRelay_RequireAuth(t *testing.T) {
+	mock := NewRelay(Options{RequireAuth: true})
+	defer mock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	secret_key := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(secret_key)
+
+	client, err := nostr.RelayConnect(ctx, mock.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Close()
+
+	event := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "hello"}
+	event.Sign(secret_key)
+
+	err = client.Publish(ctx, *event)
+	if err == nil || !strings.Contains(err.Error(), "auth-required:") {
+		t.Fatalf("expected auth-required rejection, got %v", err)
+	}
+
+	// Give the client a moment to record the AUTH challenge sent on connect
+	time.Sleep(50 * time.Millisecond)
+	if err := client.Auth(ctx, func(auth_event *nostr.Event) error { return auth_event.Sign(secret_key) }); err != nil {
+		t.Fatalf("auth: %v", err)
+	}
+	if !mock.IsAuthenticated(pubkey) {
+		t.Error("expected pubkey to be authenticated")
+	}
+
+	if err := client.Publish(ctx, *event); err != nil {
+		t.Errorf("expected publish to succeed after auth, got %v", err)
+	}
+}
+
+func TestRelay_RejectsBadSignature(t *testing.T) {
+	mock := NewRelay(Options{})
+	defer mock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	event := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "hello"}
+	event.Sign(nostr.GeneratePrivateKey())
+	event.Sig = strings.Repeat("0", 128)
+
+	client, err := nostr.RelayConnect(ctx, mock.URL())
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Publish(ctx, *event); err == nil || !strings.Contains(err.Error(), "invalid:") {
+		t.Errorf("expected invalid: rejection for bad signature, got %v", err)
+	}
+}
@@ -0,0 +1,336 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrNoQuerier is returned when a router without a querier is queried.
+var ErrNoQuerier = errors.New("router has no querier")
+
+// Router cache defaults, used when RouterOptions leaves them zero.
+const (
+	// DefaultRouteCacheTTL is how long discovered relay lists are kept.
+	DefaultRouteCacheTTL = time.Hour
+
+	// DefaultRouteCacheSize is how many relay lists and marketplaces are kept.
+	DefaultRouteCacheSize = 10000
+)
+
+// marketplacePrefix starts the coordinate of every MARKETPLACE.
+var marketplacePrefix = strconv.Itoa(core.KindMarketplace) + ":"
+
+// Querier queries events from relays. *Pool implements it.
+type Querier interface {
+	Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+// RouterOptions holds configuration for a Router.
+type RouterOptions struct {
+	// Querier finds MARKETPLACE events and NIP-65 relay lists (kind 10002),
+	// usually a *Pool connected to well-known discovery relays. Without one,
+	// only the event's own r tags, observed events and DefaultRelays are used.
+	Querier Querier
+
+	// DefaultRelays receive every event routed.
+	DefaultRelays []string
+
+	// CacheTTL is how long a discovered relay list is used before it is looked
+	// up again. Defaults to DefaultRouteCacheTTL.
+	CacheTTL time.Duration
+
+	// CacheSize bounds how many relay lists and marketplaces are cached. A
+	// full cache drops expired entries, then those closest to expiry.
+	// Defaults to DefaultRouteCacheSize.
+	CacheSize int
+}
+
+// Router picks the relays an event is published to, following the outbox
+// model. An event is sent to:
+//
+//   - the relays in its own r tags
+//   - the r tags of the MARKETPLACE its a tags reference
+//   - the write relays in its author's NIP-65 relay list
+//   - the read relays in the NIP-65 relay list of every p-tagged party
+//   - RouterOptions.DefaultRelays
+//
+// Discovered lists are cached. Router implements Query and Publish, so it can
+// stand in for a *Pool wherever one is expected. It is safe for concurrent use.
+type Router struct {
+	options RouterOptions
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]routeEntry // "a:<coordinate>" or "p:<pubkey>" -> relays
+}
+
+// routeEntry is a cached relay list. Marketplaces have the same read and
+// write relays.
+type routeEntry struct {
+	read       []string
+	write      []string
+	created_at nostr.Timestamp
+	expires    time.Time
+}
+
+// NewRouter creates a router.
+func NewRouter(options RouterOptions) *Router {
+	if options.CacheTTL <= 0 {
+		options.CacheTTL = DefaultRouteCacheTTL
+	}
+	if options.CacheSize <= 0 {
+		options.CacheSize = DefaultRouteCacheSize
+	}
+	return &Router{options: options, now: time.Now, cache: make(map[string]routeEntry)}
+}
+
+// Routes returns the relays event should be published to, normalised and
+// without duplicates. Lookups that fail are skipped; their errors are
+// returned, with ErrNoRelays, only when no relay is found.
+func (r *Router) Routes(ctx context.Context, event *nostr.Event) ([]string, error) {
+	var routes, marketplaces, parties []string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "r":
+			routes = append(routes, tag[1])
+		case "a":
+			if strings.HasPrefix(tag[1], marketplacePrefix) {
+				marketplaces = append(marketplaces, tag[1])
+			}
+		case "p":
+			if tag[1] != event.PubKey {
+				parties = append(parties, tag[1])
+			}
+		}
+	}
+
+	var errs []error
+	for _, coordinate := range marketplaces {
+		entry, err := r.marketplace(ctx, coordinate)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		routes = append(routes, entry.read...)
+	}
+
+	lists, err := r.relayLists(ctx, append([]string{event.PubKey}, parties...))
+	if err != nil {
+		errs = append(errs, err)
+	}
+	routes = append(routes, lists[event.PubKey].write...)
+	for _, pubkey := range parties {
+		routes = append(routes, lists[pubkey].read...)
+	}
+	routes = append(routes, r.options.DefaultRelays...)
+
+	routes = normalizeURLs(routes)
+	if len(routes) == 0 {
+		return nil, errors.Join(append([]error{ErrNoRelays}, errs...)...)
+	}
+	return routes, nil
+}
+
+// Publish publishes event to its routes. Returns nil if at least one relay
+// accepts the event.
+func (r *Router) Publish(ctx context.Context, event *nostr.Event) error {
+	routes, err := r.Routes(ctx, event)
+	if err != nil {
+		return err
+	}
+	_, err = PublishToMultiple(ctx, event, routes)
+	return err
+}
+
+// Query queries the router's querier, and caches any MARKETPLACE events and
+// relay lists among the results.
+func (r *Router) Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	if r.options.Querier == nil {
+		return nil, ErrNoQuerier
+	}
+	results, err := r.options.Querier.Query(ctx, filter)
+	for _, event := range results {
+		r.Observe(event)
+	}
+	return results, err
+}
+
+// Observe caches the relays of a MARKETPLACE event or NIP-65 relay list seen
+// elsewhere, such as on a subscription. Other events are ignored, as are
+// events older than the cached ones and events whose ID or signature does
+// not verify.
+func (r *Router) Observe(event *nostr.Event) {
+	var key string
+	var entry routeEntry
+	switch event.Kind {
+	case core.KindMarketplace:
+		key = "a:" + marketplaceCoordinate(event)
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "r" {
+				entry.read = append(entry.read, tag[1])
+			}
+		}
+		entry.write = entry.read
+	case core.KindRelayList:
+		key = "p:" + event.PubKey
+		for _, tag := range event.Tags {
+			if len(tag) < 2 || tag[0] != "r" {
+				continue
+			}
+			marker := ""
+			if len(tag) >= 3 {
+				marker = tag[2]
+			}
+			if marker != "write" {
+				entry.read = append(entry.read, tag[1])
+			}
+			if marker != "read" {
+				entry.write = append(entry.write, tag[1])
+			}
+		}
+	default:
+		return
+	}
+	// CheckSignature verifies the signature over the computed ID, not the claimed one
+	if event.GetID() != event.ID {
+		return
+	}
+	if ok, err := event.CheckSignature(); !ok || err != nil {
+		return
+	}
+	entry.created_at = event.CreatedAt
+	entry.expires = r.now().Add(r.options.CacheTTL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, ok := r.cache[key]; ok && cached.created_at > entry.created_at {
+		return
+	}
+	r.put(key, entry)
+}
+
+// marketplace returns the cached relays of a MARKETPLACE, looking it up when
+// missing or expired.
+func (r *Router) marketplace(ctx context.Context, coordinate string) (routeEntry, error) {
+	if entry, ok := r.cached("a:" + coordinate); ok || r.options.Querier == nil {
+		return entry, nil
+	}
+	_, pubkey, d_tag, err := events.ParseCoordinate(coordinate)
+	if err != nil {
+		return routeEntry{}, nil
+	}
+	if _, err := r.Query(ctx, nostr.Filter{
+		Kinds:   []int{core.KindMarketplace},
+		Authors: []string{pubkey},
+		Tags:    nostr.TagMap{"d": []string{d_tag}},
+	}); err != nil {
+		return routeEntry{}, err
+	}
+	return r.negative("a:" + coordinate), nil
+}
+
+// relayLists returns the cached NIP-65 relay lists of pubkeys, looking up the
+// missing or expired ones in a single query.
+func (r *Router) relayLists(ctx context.Context, pubkeys []string) (map[string]routeEntry, error) {
+	lists := make(map[string]routeEntry, len(pubkeys))
+	var missing []string
+	for _, pubkey := range pubkeys {
+		if entry, ok := r.cached("p:" + pubkey); ok {
+			lists[pubkey] = entry
+		} else {
+			missing = append(missing, pubkey)
+		}
+	}
+	if len(missing) == 0 || r.options.Querier == nil {
+		return lists, nil
+	}
+	if _, err := r.Query(ctx, nostr.Filter{Kinds: []int{core.KindRelayList}, Authors: missing}); err != nil {
+		return lists, err
+	}
+	for _, pubkey := range missing {
+		lists[pubkey] = r.negative("p:" + pubkey)
+	}
+	return lists, nil
+}
+
+// cached returns an unexpired cache entry.
+func (r *Router) cached(key string) (routeEntry, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.cache[key]
+	if !ok || r.now().After(entry.expires) {
+		return routeEntry{}, false
+	}
+	return entry, true
+}
+
+// negative returns the entry a lookup just cached, or caches an empty one so
+// a key without a relay list is not looked up again until it expires.
+func (r *Router) negative(key string) routeEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, ok := r.cache[key]
+	if !ok || r.now().After(entry.expires) {
+		entry = routeEntry{expires: r.now().Add(r.options.CacheTTL)}
+		r.put(key, entry)
+	}
+	return entry
+}
+
+// put caches an entry. When the cache is full it first drops expired
+// entries, then the entry closest to expiry. Callers must hold r.mu.
+func (r *Router) put(key string, entry routeEntry) {
+	if _, ok := r.cache[key]; !ok && len(r.cache) >= r.options.CacheSize {
+		now := r.now()
+		for cached_key, cached := range r.cache {
+			if now.After(cached.expires) {
+				delete(r.cache, cached_key)
+			}
+		}
+		if len(r.cache) >= r.options.CacheSize {
+			oldest := ""
+			for cached_key, cached := range r.cache {
+				if oldest == "" || cached.expires.Before(r.cache[oldest].expires) {
+					oldest = cached_key
+				}
+			}
+			delete(r.cache, oldest)
+		}
+	}
+	r.cache[key] = entry
+}
+
+// marketplaceCoordinate returns the coordinate of a MARKETPLACE event.
+func marketplaceCoordinate(event *nostr.Event) string {
+	d_tag := ""
+	if tag := event.Tags.Find("d"); tag != nil {
+		d_tag = tag[1]
+	}
+	return marketplacePrefix + event.PubKey + ":" + d_tag
+}
+
+// normalizeURLs normalises relay URLs and drops empty ones and duplicates,
+// keeping the first occurrence.
+func normalizeURLs(urls []string) []string {
+	seen := make(map[string]bool, len(urls))
+	normalized := make([]string, 0, len(urls))
+	for _, url := range urls {
+		url = nostr.NormalizeURL(url)
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		normalized = append(normalized, url)
+	}
+	return normalized
+}
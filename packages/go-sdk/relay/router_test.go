@@ -0,0 +1,199 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// countingQuerier counts the queries that reach a querier.
+type countingQuerier struct {
+	Querier
+	count int
+}
+
+func (q *countingQuerier) Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	q.count++
+	return q.Querier.Query(ctx, filter)
+}
+
+// createRelayList creates a NIP-65 relay list signed by private_key.
+func createRelayList(t *testing.T, private_key string, tags ...nostr.Tag) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: core.KindRelayList, CreatedAt: nostr.Now(), Tags: tags}
+	if err := event.Sign(private_key); err != nil {
+		t.Fatalf("sign relay list: %v", err)
+	}
+	return event
+}
+
+func TestRouter_ConfirmationReachesEveryParty(t *testing.T) {
+	ctx := testContext(t)
+	relays := make(map[string]*relaytest.Relay)
+	for _, name := range []string{"discovery", "own", "marketplace", "billboard-inbox", "billboard-outbox", "provider-outbox", "unused"} {
+		relays[name] = relaytest.NewRelay(relaytest.Options{})
+		defer relays[name].Close()
+	}
+
+	marketplace_key, billboard_key, provider_key := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	marketplace, err := events.CreateMarketplace(marketplace_key, events.MarketplaceParams{
+		Name: "Market", MarketplaceID: "mk-1", BlockHeight: 870000, MinDuration: 15000, MaxDuration: 60000,
+		RelayList: []string{relays["marketplace"].URL()},
+	})
+	if err != nil {
+		t.Fatalf("CreateMarketplace: %v", err)
+	}
+	if err := relays["discovery"].Seed(
+		marketplace,
+		createRelayList(t, billboard_key,
+			nostr.Tag{"r", relays["billboard-inbox"].URL(), "read"},
+			nostr.Tag{"r", relays["billboard-outbox"].URL(), "write"}),
+		createRelayList(t, provider_key,
+			nostr.Tag{"r", relays["provider-outbox"].URL(), "write"},
+			nostr.Tag{"r", relays["unused"].URL(), "read"}),
+	); err != nil {
+		t.Fatalf("Seed: %v", err)
+	}
+
+	pool, err := NewPool([]string{relays["discovery"].URL()})
+	if err != nil {
+		t.Fatalf("NewPool: %v", err)
+	}
+	if err := pool.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer pool.Close()
+	querier := &countingQuerier{Querier: pool}
+	router := NewRouter(RouterOptions{Querier: querier})
+
+	marketplace_pubkey, _ := nostr.GetPublicKey(marketplace_key)
+	billboard_pubkey, _ := nostr.GetPublicKey(billboard_key)
+	confirmation, err := events.CreateAttentionConfirmation(provider_key, events.AttentionConfirmationParams{
+		ConfirmationID:        "m-1",
+		BlockHeight:           870001,
+		MarketplaceCoordinate: events.FormatCoordinate(core.KindMarketplace, marketplace_pubkey, events.FormatDTag("marketplace", "mk-1")),
+		MarketplacePubkey:     marketplace_pubkey,
+		BillboardPubkey:       billboard_pubkey,
+		RelayURLs:             []string{relays["own"].URL()},
+	})
+	if err != nil {
+		t.Fatalf("CreateAttentionConfirmation: %v", err)
+	}
+
+	if err := router.Publish(ctx, confirmation); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for _, name := range []string{"own", "marketplace", "billboard-inbox", "provider-outbox"} {
+		if _, err := relays[name].Store().GetByID(ctx, confirmation.ID); err != nil {
+			t.Errorf("expected the confirmation on the %s relay", name)
+		}
+	}
+	for _, name := range []string{"billboard-outbox", "unused"} {
+		if len(relays[name].Received()) != 0 {
+			t.Errorf("expected nothing sent to the %s relay", name)
+		}
+	}
+	if querier.count != 2 {
+		t.Errorf("expected one marketplace and one relay list query, got %d", querier.count)
+	}
+
+	// Discovered lists are cached, including the marketplace pubkey's lack of one
+	if _, err := router.Routes(ctx, confirmation); err != nil {
+		t.Fatalf("Routes: %v", err)
+	}
+	if querier.count != 2 {
+		t.Errorf("expected cached routes, got %d queries", querier.count)
+	}
+
+	// Until they expire
+	router.now = func() time.Time { return time.Now().Add(2 * DefaultRouteCacheTTL) }
+	if _, err := router.Routes(ctx, confirmation); err != nil {
+		t.Fatalf("Routes: %v", err)
+	}
+	if querier.count != 4 {
+		t.Errorf("expected expired routes to be looked up again, got %d queries", querier.count)
+	}
+}
+
+func TestRouter_Observe(t *testing.T) {
+	ctx := context.Background()
+	router := NewRouter(RouterOptions{DefaultRelays: []string{"wss://default.example.com/"}})
+	key := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(key)
+
+	event := &nostr.Event{PubKey: "author", Tags: nostr.Tags{{"p", pubkey}, {"r", "wss://own.example.com"}}}
+	routes, err := router.Routes(ctx, event)
+	if err != nil {
+		t.Fatalf("Routes: %v", err)
+	}
+	if !slices.Equal(routes, []string{"wss://own.example.com", "wss://default.example.com"}) {
+		t.Errorf("expected own and default relays without a querier, got %v", routes)
+	}
+
+	newer := createRelayList(t, key, nostr.Tag{"r", "wss://inbox.example.com"})
+	older := createRelayList(t, key, nostr.Tag{"r", "wss://stale.example.com"})
+	older.CreatedAt = newer.CreatedAt - 60
+	if err := older.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	router.Observe(newer)
+	router.Observe(older)
+	routes, _ = router.Routes(ctx, event)
+	if !slices.Contains(routes, "wss://inbox.example.com") || slices.Contains(routes, "wss://stale.example.com") {
+		t.Errorf("expected the newest observed relay list to be used, got %v", routes)
+	}
+
+	// Events that do not verify are not cached: a newer list claiming the
+	// pubkey, and a signed list whose tags were changed after signing
+	forged := createRelayList(t, nostr.GeneratePrivateKey(), nostr.Tag{"r", "wss://forged.example.com"})
+	forged.PubKey = pubkey
+	forged.CreatedAt = newer.CreatedAt + 60
+	forged.ID = forged.GetID()
+	tampered := createRelayList(t, key, nostr.Tag{"r", "wss://tampered.example.com"})
+	tampered.CreatedAt = newer.CreatedAt + 60
+	tampered.Tags = nostr.Tags{{"r", "wss://forged.example.com"}}
+	router.Observe(forged)
+	router.Observe(tampered)
+	routes, _ = router.Routes(ctx, event)
+	if slices.Contains(routes, "wss://forged.example.com") || !slices.Contains(routes, "wss://inbox.example.com") {
+		t.Errorf("expected unverified relay lists to be ignored, got %v", routes)
+	}
+
+	if _, err := NewRouter(RouterOptions{}).Routes(ctx, &nostr.Event{}); !errors.Is(err, ErrNoRelays) {
+		t.Errorf("expected ErrNoRelays, got %v", err)
+	}
+}
+
+func TestRouter_CacheSize(t *testing.T) {
+	router := NewRouter(RouterOptions{CacheSize: 2})
+	now := time.Now()
+	router.now = func() time.Time { return now }
+
+	keys := make([]string, 3)
+	for i := range keys {
+		keys[i] = nostr.GeneratePrivateKey()
+		router.Observe(createRelayList(t, keys[i], nostr.Tag{"r", "wss://inbox.example.com"}))
+		now = now.Add(time.Minute)
+	}
+	if len(router.cache) != 2 {
+		t.Fatalf("expected the cache to stay at its size, got %d entries", len(router.cache))
+	}
+	first, _ := nostr.GetPublicKey(keys[0])
+	if _, ok := router.cached("p:" + first); ok {
+		t.Error("expected the entry closest to expiry to be dropped")
+	}
+
+	// Expired entries are dropped first
+	now = now.Add(2 * DefaultRouteCacheTTL)
+	router.Observe(createRelayList(t, nostr.GeneratePrivateKey(), nostr.Tag{"r", "wss://inbox.example.com"}))
+	if len(router.cache) != 1 {
+		t.Errorf("expected expired entries to be dropped, got %d entries", len(router.cache))
+	}
+}
@@ -0,0 +1,97 @@
+package relay
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// okReasons are the NIP-01 machine-readable OK prefixes used as metric labels.
+// Other messages are labelled "other", to keep the number of series bounded.
+var okReasons = []string{"duplicate", "pow", "blocked", "rate-limited", "invalid", "error", "restricted", "auth-required", "mute"}
+
+// okMessage returns the OK message of a relay rejection, which go-nostr
+// reports as "msg: <OK message>".
+func okMessage(err error) (string, bool) {
+	return strings.CutPrefix(err.Error(), "msg: ")
+}
+
+// okReason returns the metric label for an OK message's prefix.
+func okReason(message string) string {
+	prefix, _, _ := strings.Cut(message, ":")
+	for _, reason := range okReasons {
+		if prefix == reason {
+			return reason
+		}
+	}
+	return "other"
+}
+
+// publishInstrumented is publishAndConfirm inside a span, recording the
+// latency per relay and the OK reason.
+func publishInstrumented(ctx context.Context, instrumentation telemetry.Instrumentation, relay *nostr.Relay, event *nostr.Event) error {
+	relay_label := telemetry.String(telemetry.KeyRelay, relay.URL)
+	ctx, span := instrumentation.StartSpan(ctx, telemetry.SpanPublish,
+		relay_label,
+		telemetry.String(telemetry.KeyEventID, event.ID),
+		telemetry.Int(telemetry.KeyEventKind, event.Kind))
+	defer span.End()
+
+	start := time.Now()
+	err := confirmPublish(ctx, relay, event)
+	elapsed := time.Since(start).Seconds()
+
+	outcome := "accepted"
+	if err == nil {
+		instrumentation.Add(telemetry.MetricRelayOK, 1, relay_label, telemetry.Bool(telemetry.KeyAccepted, true), telemetry.String(telemetry.KeyReason, ""))
+	} else if message, ok := okMessage(err); ok {
+		outcome = "rejected"
+		reason := okReason(message)
+		instrumentation.Add(telemetry.MetricRelayOK, 1, relay_label, telemetry.Bool(telemetry.KeyAccepted, false), telemetry.String(telemetry.KeyReason, reason))
+		span.SetAttributes(telemetry.String(telemetry.KeyReason, reason))
+	} else {
+		outcome = "error"
+	}
+	instrumentation.Observe(telemetry.MetricPublishDuration, elapsed, relay_label, telemetry.String(telemetry.KeyOutcome, outcome))
+
+	span.SetAttributes(telemetry.String(telemetry.KeyOutcome, outcome))
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+// queryRelay queries one relay, inside a span when telemetry is on.
+func queryRelay(ctx context.Context, relay *nostr.Relay, filter nostr.Filter) ([]*nostr.Event, error) {
+	instrumentation := telemetry.Default()
+	if instrumentation == nil {
+		return relay.QuerySync(ctx, filter)
+	}
+
+	relay_label := telemetry.String(telemetry.KeyRelay, relay.URL)
+	ctx, span := instrumentation.StartSpan(ctx, telemetry.SpanQuery, relay_label)
+	defer span.End()
+
+	start := time.Now()
+	results, err := relay.QuerySync(ctx, filter)
+	elapsed := time.Since(start).Seconds()
+
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+		span.RecordError(err)
+	}
+	instrumentation.Observe(telemetry.MetricQueryDuration, elapsed, relay_label, telemetry.String(telemetry.KeyOutcome, outcome))
+	span.SetAttributes(telemetry.String(telemetry.KeyOutcome, outcome), telemetry.Int(telemetry.KeyEvents, len(results)))
+	return results, err
+}
+
+// observeConnectFailure counts a failed connection when telemetry is on.
+func observeConnectFailure(relay_url string) {
+	if instrumentation := telemetry.Default(); instrumentation != nil {
+		instrumentation.Add(telemetry.MetricConnectFailures, 1, telemetry.String(telemetry.KeyRelay, relay_url))
+	}
+}
@@ -0,0 +1,71 @@
+package relay
+
+import (
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry"
+	"github.com/joinnextblock/attn-protocol/go-core/telemetry/telemetrytest"
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay/relaytest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestTelemetry_PublishAndQuery(t *testing.T) {
+	recorder := telemetrytest.Install(t)
+	mock := relaytest.NewRelay(relaytest.Options{})
+	defer mock.Close()
+	down := relaytest.NewRelay(relaytest.Options{})
+	defer down.Close()
+	down.SetRefuseConnections(true)
+
+	ctx := testContext(t)
+	pool := connectPool(t, ctx, mock)
+	defer pool.Close()
+
+	accepted := createSignedEvent(t, 30078, "accepted")
+	if err := pool.Publish(ctx, accepted); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	mock.RejectNext("blocked: not allowed")
+	pool.Publish(ctx, createSignedEvent(t, 30078, "blocked"))
+	mock.RejectNext("slow down")
+	pool.Publish(ctx, createSignedEvent(t, 30078, "other"))
+	PublishToRelay(ctx, accepted, down.URL())
+	if _, err := pool.Query(ctx, nostr.Filter{Kinds: []int{30078}}); err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	relay_label := telemetry.String(telemetry.KeyRelay, mock.URL())
+	ok_total := func(accepted bool, reason string) float64 {
+		return recorder.Counter(telemetry.MetricRelayOK, relay_label, telemetry.Bool(telemetry.KeyAccepted, accepted), telemetry.String(telemetry.KeyReason, reason))
+	}
+	if ok_total(true, "") != 1 || ok_total(false, "blocked") != 1 || ok_total(false, "other") != 1 {
+		t.Errorf("unexpected OK counters: accepted %v, blocked %v, other %v", ok_total(true, ""), ok_total(false, "blocked"), ok_total(false, "other"))
+	}
+	if count, _ := recorder.Histogram(telemetry.MetricPublishDuration, relay_label, telemetry.String(telemetry.KeyOutcome, "rejected")); count != 2 {
+		t.Errorf("expected 2 rejected publishes timed, got %d", count)
+	}
+	if recorder.Counter(telemetry.MetricConnectFailures, telemetry.String(telemetry.KeyRelay, down.URL())) != 1 {
+		t.Error("expected the refused connection counted")
+	}
+	if count, _ := recorder.Histogram(telemetry.MetricQueryDuration, relay_label, telemetry.String(telemetry.KeyOutcome, "ok")); count != 1 {
+		t.Errorf("expected 1 query timed, got %d", count)
+	}
+
+	publishes := recorder.Spans(telemetry.SpanPublish)
+	if len(publishes) != 3 || !publishes[0].Ended {
+		t.Fatalf("expected 3 ended publish spans, got %+v", publishes)
+	}
+	if id, _ := publishes[0].Attribute(telemetry.KeyEventID); id != accepted.ID {
+		t.Errorf("expected the event ID on the span, got %s", id)
+	}
+	if reason, _ := publishes[1].Attribute(telemetry.KeyReason); reason != "blocked" || publishes[1].Err == nil {
+		t.Errorf("expected the rejection recorded on the span, got %+v", publishes[1])
+	}
+	queries := recorder.Spans(telemetry.SpanQuery)
+	if len(queries) != 1 {
+		t.Fatalf("expected 1 query span, got %d", len(queries))
+	}
+	if events, _ := queries[0].Attribute(telemetry.KeyEvents); events != "1" {
+		t.Errorf("expected 1 event on the query span, got %s", events)
+	}
+}
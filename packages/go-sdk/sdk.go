@@ -21,8 +21,8 @@ package sdk
 
 import (
 	"encoding/hex"
-	"time"
 
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -30,6 +30,10 @@ import (
 type SdkConfig struct {
 	// PrivateKey is the hex-encoded private key for signing events.
 	PrivateKey string
+
+	// Clock sets CreatedAt on the events the SDK creates. Defaults to
+	// events.SystemClock.
+	Clock events.Clock
 }
 
 // Sdk provides methods for creating and publishing ATTN Protocol events.
@@ -37,6 +41,7 @@ type Sdk struct {
 	config     SdkConfig
 	privateKey string
 	publicKey  string
+	clock      events.Clock
 }
 
 // NewSdk creates a new SDK instance.
@@ -53,10 +58,16 @@ func NewSdk(config SdkConfig) (*Sdk, error) {
 		return nil, err
 	}
 
+	clock := config.Clock
+	if clock == nil {
+		clock = events.SystemClock
+	}
+
 	return &Sdk{
 		config:     config,
 		privateKey: config.PrivateKey,
 		publicKey:  pk,
+		clock:      clock,
 	}, nil
 }
 
@@ -74,7 +85,7 @@ func (s *Sdk) signEvent(event *nostr.Event) error {
 func (s *Sdk) createBaseEvent(kind int, content string, tags nostr.Tags) *nostr.Event {
 	return &nostr.Event{
 		PubKey:    s.publicKey,
-		CreatedAt: nostr.Timestamp(time.Now().Unix()),
+		CreatedAt: nostr.Timestamp(s.clock.Now().Unix()),
 		Kind:      kind,
 		Tags:      tags,
 		Content:   content,
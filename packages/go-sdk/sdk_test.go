@@ -0,0 +1,26 @@
+package sdk
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+)
+
+func TestSdk_Clock(t *testing.T) {
+	at := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	s, err := NewSdk(SdkConfig{PrivateKey: strings.Repeat("01", 32), Clock: events.FixedClock(at)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := s.createBaseEvent(38388, "{}", nil)
+	if event.CreatedAt.Time().Unix() != at.Unix() {
+		t.Errorf("expected created_at %d, got %d", at.Unix(), event.CreatedAt)
+	}
+
+	s, _ = NewSdk(SdkConfig{PrivateKey: strings.Repeat("01", 32)})
+	if event := s.createBaseEvent(38388, "{}", nil); time.Since(event.CreatedAt.Time()) > time.Minute {
+		t.Errorf("expected the system clock by default, got %v", event.CreatedAt.Time())
+	}
+}
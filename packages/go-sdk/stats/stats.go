@@ -0,0 +1,416 @@
+// Package stats derives marketplace statistics from indexed events.
+//
+// Compute counts the billboards, promotions, attention offers and matches that
+// reference a marketplace coordinate, and derives volume, average bid and ask,
+// and match rate for a block. A Service republishes the marketplace's
+// MARKETPLACE event at every new block with the counts of the block that just
+// closed, so callers no longer pass them to events.CreateMarketplace by hand.
+// Offers are often re-published at every block, replacing the version the
+// store held for the block before, so a Service also snapshots each block's
+// events as they arrive and counts them alongside the store's.
+//
+// Example usage:
+//
+//	service, err := stats.NewService(stats.Options{
+//	    PrivateKey:  private_key,
+//	    Store:       event_store,
+//	    Publisher:   pool,
+//	    Marketplace: events.MarketplaceParams{Name: "My Marketplace", MarketplaceID: "my-marketplace"},
+//	    ClockPubkey: clock_pubkey,
+//	})
+//
+//	// incoming carries the clock's block events and the events that
+//	// reference the marketplace
+//	err = service.Run(ctx, incoming)
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrNoStore is returned when a service has no event store.
+	ErrNoStore = errors.New("stats service has no event store")
+
+	// ErrNoPublisher is returned when a service has no publisher.
+	ErrNoPublisher = errors.New("stats service has no publisher")
+
+	// ErrNoMarketplaceID is returned when the marketplace params have no ID.
+	ErrNoMarketplaceID = errors.New("stats service has no marketplace ID")
+)
+
+// Querier answers filter queries against indexed events. store.Store implements it.
+type Querier interface {
+	Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+// Publisher publishes events to relays. *relay.Pool and *relay.Outbox implement it.
+type Publisher interface {
+	Publish(ctx context.Context, event *nostr.Event) error
+}
+
+// Stats are a marketplace's statistics for one block.
+type Stats struct {
+	// MarketplaceCoordinate is the marketplace coordinate (38188:pubkey:d_tag).
+	MarketplaceCoordinate string
+
+	// BlockHeight is the block the statistics cover.
+	BlockHeight int64
+
+	// BillboardCount counts the marketplace's billboards at any block; the
+	// other counts cover BlockHeight only. MatchCount counts only MATCH events
+	// signed by the marketplace.
+	BillboardCount int64
+	PromotionCount int64
+	AttentionCount int64
+	MatchCount     int64
+
+	// PaymentCount counts ATTENTION_PAYMENT_CONFIRMATION events signed by the
+	// owner of the attention they reference, and VolumeSats sums their
+	// sats_received.
+	PaymentCount int64
+	VolumeSats   int64
+
+	// AverageBid is the mean PROMOTION bid and AverageAsk the mean ATTENTION
+	// ask, in sats. Both are 0 when there is nothing to average.
+	AverageBid float64
+	AverageAsk float64
+
+	// MatchRate is matches per promotion, or 0 without promotions.
+	MatchRate float64
+}
+
+// Compute derives a marketplace's statistics at a block from the events that
+// reference its coordinate in an 'a' tag. Only the current version of each
+// event counts when querier is a store.Store.
+func Compute(ctx context.Context, querier Querier, marketplace_coordinate string, block_height int64) (Stats, error) {
+	return compute(ctx, querier, marketplace_coordinate, block_height, nil)
+}
+
+// compute is Compute, also counting observed: events of the block that the
+// store may have replaced since. Each coordinate counts once.
+func compute(ctx context.Context, querier Querier, marketplace_coordinate string, block_height int64, observed []*nostr.Event) (Stats, error) {
+	_, marketplace_pubkey, _, err := events.ParseCoordinate(marketplace_coordinate)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{MarketplaceCoordinate: marketplace_coordinate, BlockHeight: block_height}
+	query := func(kind int, at_block bool, authors ...string) ([]*nostr.Event, error) {
+		filter := nostr.Filter{
+			Kinds:   []int{kind},
+			Authors: authors,
+			Tags:    nostr.TagMap{"a": []string{marketplace_coordinate}},
+		}
+		if at_block {
+			filter.Tags["t"] = []string{strconv.FormatInt(block_height, 10)}
+		}
+		return querier.Query(ctx, filter)
+	}
+
+	billboards, err := query(core.KindBillboard, false)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats.BillboardCount = int64(len(billboards))
+
+	var at_block []*nostr.Event
+	for _, kind := range countedKinds {
+		var authors []string
+		if kind == core.KindMatch {
+			authors = []string{marketplace_pubkey}
+		}
+		found, err := query(kind, true, authors...)
+		if err != nil {
+			return Stats{}, err
+		}
+		at_block = append(at_block, found...)
+	}
+
+	seen := make(map[string]bool, len(at_block)+len(observed))
+	var bids, asks int64
+	for _, event := range append(at_block, observed...) {
+		coordinate := events.FormatCoordinate(event.Kind, event.PubKey, event.Tags.GetD())
+		if seen[coordinate] {
+			continue
+		}
+		seen[coordinate] = true
+
+		switch event.Kind {
+		case core.KindPromotion:
+			stats.PromotionCount++
+			var content core.PromotionData
+			if json.Unmarshal([]byte(event.Content), &content) == nil {
+				bids += content.Bid
+			}
+		case core.KindAttention:
+			stats.AttentionCount++
+			var content core.AttentionData
+			if json.Unmarshal([]byte(event.Content), &content) == nil {
+				asks += content.Ask
+			}
+		case core.KindMatch:
+			if event.PubKey == marketplace_pubkey {
+				stats.MatchCount++
+			}
+		case core.KindAttentionPaymentConfirmation:
+			if !paidByAttentionOwner(event) {
+				continue
+			}
+			stats.PaymentCount++
+			var content core.AttentionPaymentConfirmationData
+			if json.Unmarshal([]byte(event.Content), &content) == nil && content.SatsReceived > 0 {
+				stats.VolumeSats += content.SatsReceived
+			}
+		}
+	}
+
+	if stats.PromotionCount > 0 {
+		stats.AverageBid = float64(bids) / float64(stats.PromotionCount)
+		stats.MatchRate = float64(stats.MatchCount) / float64(stats.PromotionCount)
+	}
+	if stats.AttentionCount > 0 {
+		stats.AverageAsk = float64(asks) / float64(stats.AttentionCount)
+	}
+	return stats, nil
+}
+
+// countedKinds are the kinds counted per block.
+var countedKinds = []int{core.KindPromotion, core.KindAttention, core.KindMatch, core.KindAttentionPaymentConfirmation}
+
+// paidByAttentionOwner reports whether a payment confirmation is signed by the
+// owner of the first attention coordinate it references.
+func paidByAttentionOwner(event *nostr.Event) bool {
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		if kind, pubkey, _, err := events.ParseCoordinate(tag[1]); err == nil && kind == core.KindAttention {
+			return pubkey == event.PubKey
+		}
+	}
+	return false
+}
+
+// Options holds configuration for a Service.
+type Options struct {
+	// PrivateKey is the hex-encoded private key of the marketplace.
+	PrivateKey string
+
+	// Store holds the indexed events statistics are computed from.
+	Store Querier
+
+	// Publisher publishes MARKETPLACE events.
+	Publisher Publisher
+
+	// Marketplace holds the fields every MARKETPLACE event shares. MarketplaceID
+	// is required. BlockHeight and the counts are set by the service.
+	Marketplace events.MarketplaceParams
+
+	// ClockPubkey is the City Protocol clock whose block events Run publishes
+	// at. Block events from other pubkeys are ignored, as are all block events
+	// when it is empty; OnBlock still works.
+	ClockPubkey string
+
+	// OnError, if set, receives errors during Run, which otherwise continues
+	// with the next event.
+	OnError func(err error)
+}
+
+// Service republishes a MARKETPLACE event with up-to-date counts at every block.
+// It is safe for concurrent use.
+type Service struct {
+	options    Options
+	coordinate string
+
+	mu           sync.Mutex
+	block_height int64 // last block published
+	publishing   int64 // newest block being published
+	latest       Stats
+	created_at   nostr.Timestamp
+	observed     map[int64]map[string]*nostr.Event // block height -> coordinate -> newest version
+}
+
+// NewService creates a stats service. Nothing is published until the first block.
+func NewService(options Options) (*Service, error) {
+	switch {
+	case options.Store == nil:
+		return nil, ErrNoStore
+	case options.Publisher == nil:
+		return nil, ErrNoPublisher
+	case options.Marketplace.MarketplaceID == "":
+		return nil, ErrNoMarketplaceID
+	}
+
+	pubkey, err := nostr.GetPublicKey(options.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	if options.Marketplace.MarketplacePubkey == "" {
+		options.Marketplace.MarketplacePubkey = pubkey
+	}
+	return &Service{
+		options:    options,
+		coordinate: events.FormatCoordinate(core.KindMarketplace, pubkey, events.FormatDTag("marketplace", options.Marketplace.MarketplaceID)),
+		observed:   make(map[int64]map[string]*nostr.Event),
+	}, nil
+}
+
+// Coordinate returns the marketplace coordinate.
+func (s *Service) Coordinate() string {
+	return s.coordinate
+}
+
+// Latest returns the statistics last published.
+func (s *Service) Latest() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latest
+}
+
+// Run republishes the MARKETPLACE event for every block event signed by
+// Options.ClockPubkey, and observes other events, until the channel closes or
+// ctx is done. Run returns nil when the channel closes.
+func (s *Service) Run(ctx context.Context, incoming <-chan *nostr.Event) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-incoming:
+			if !ok {
+				return nil
+			}
+			block_height, ok := events.ParseBlock(event, s.options.ClockPubkey)
+			if !ok {
+				s.Observe(event)
+				continue
+			}
+			if _, err := s.OnBlock(ctx, block_height); err != nil && s.options.OnError != nil {
+				s.options.OnError(err)
+			}
+		}
+	}
+}
+
+// Observe snapshots a signed PROMOTION, ATTENTION, MATCH or
+// ATTENTION_PAYMENT_CONFIRMATION event that references the marketplace, so it
+// counts towards its block even if a later version replaces it in the store
+// before the block closes. Only events of the last block published, or of the
+// block after it, are kept; other events are ignored.
+func (s *Service) Observe(event *nostr.Event) {
+	if !slices.Contains(countedKinds, event.Kind) || !references(event, s.coordinate) {
+		return
+	}
+	block_height, ok := core.EventBlockHeight(event)
+	if !ok {
+		return
+	}
+	if valid, err := event.CheckSignature(); err != nil || !valid {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.block_height == 0 || block_height < s.block_height || block_height > s.block_height+1 {
+		return
+	}
+	observed, ok := s.observed[block_height]
+	if !ok {
+		observed = make(map[string]*nostr.Event)
+		s.observed[block_height] = observed
+	}
+	coordinate := events.FormatCoordinate(event.Kind, event.PubKey, event.Tags.GetD())
+	if existing, ok := observed[coordinate]; !ok || event.CreatedAt > existing.CreatedAt {
+		observed[coordinate] = event
+	}
+}
+
+// OnBlock computes the statistics of the block before block_height and
+// publishes the MARKETPLACE event for block_height with its counts. The
+// statistics count the events the store holds for that block and those
+// Observe saw for it. Blocks at or below the last one published or being
+// published are ignored. The store is queried and the event published without
+// holding the service's lock.
+func (s *Service) OnBlock(ctx context.Context, block_height int64) (Stats, error) {
+	s.mu.Lock()
+	if block_height <= max(s.block_height, s.publishing) {
+		latest := s.latest
+		s.mu.Unlock()
+		return latest, nil
+	}
+	s.publishing = block_height
+	observed := make([]*nostr.Event, 0, len(s.observed[block_height-1]))
+	for _, event := range s.observed[block_height-1] {
+		observed = append(observed, event)
+	}
+	// A replacement must be newer than the MARKETPLACE it replaces, including
+	// one still being published
+	created_at := max(nostr.Now(), s.created_at+1)
+	s.created_at = created_at
+	s.mu.Unlock()
+
+	stats, err := s.publish(ctx, block_height, created_at, observed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if s.publishing == block_height {
+			s.publishing = s.block_height
+		}
+		return Stats{}, err
+	}
+	if block_height > s.block_height {
+		s.block_height = block_height
+		s.latest = stats
+		for observed_height := range s.observed {
+			if observed_height < block_height {
+				delete(s.observed, observed_height)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// publish computes the statistics of the block before block_height and
+// publishes the MARKETPLACE event for block_height.
+func (s *Service) publish(ctx context.Context, block_height int64, created_at nostr.Timestamp, observed []*nostr.Event) (Stats, error) {
+	stats, err := compute(ctx, s.options.Store, s.coordinate, block_height-1, observed)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	params := s.options.Marketplace
+	params.BlockHeight = block_height
+	params.BillboardCount = stats.BillboardCount
+	params.PromotionCount = stats.PromotionCount
+	params.AttentionCount = stats.AttentionCount
+	params.MatchCount = stats.MatchCount
+	params.Clock = events.FixedClock(created_at.Time())
+
+	event, err := events.CreateMarketplace(s.options.PrivateKey, params)
+	if err != nil {
+		return Stats{}, err
+	}
+	if err := s.options.Publisher.Publish(ctx, event); err != nil {
+		return Stats{}, err
+	}
+	return stats, nil
+}
+
+// references reports whether an event has an 'a' tag for coordinate.
+func references(event *nostr.Event, coordinate string) bool {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "a" && tag[1] == coordinate {
+			return true
+		}
+	}
+	return false
+}
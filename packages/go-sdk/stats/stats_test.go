@@ -0,0 +1,293 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/events"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// recorder is a Publisher that keeps every event it is given.
+type recorder struct {
+	mu     sync.Mutex
+	events []*nostr.Event
+}
+
+func (r *recorder) Publish(_ context.Context, event *nostr.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+// index signs an event referencing a marketplace with key, saves it into a
+// store and returns it. references are extra 'a' coordinates.
+func index(t *testing.T, event_store store.Store, key string, kind int, d_tag, marketplace string, block_height int64, content interface{}, references ...string) *nostr.Event {
+	t.Helper()
+	data, _ := json.Marshal(content)
+	event := &nostr.Event{
+		Kind:      kind,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"d", d_tag}, {"t", fmt.Sprint(block_height)}, {"a", marketplace}},
+		Content:   string(data),
+	}
+	for _, reference := range references {
+		event.Tags = append(event.Tags, nostr.Tag{"a", reference})
+	}
+	if err := event.Sign(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := event_store.Save(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	return event
+}
+
+// marketplaceCoordinate returns the coordinate of marketplace mk-1 run by key.
+func marketplaceCoordinate(key string) string {
+	pubkey, _ := nostr.GetPublicKey(key)
+	return events.FormatCoordinate(core.KindMarketplace, pubkey, events.FormatDTag("marketplace", "mk-1"))
+}
+
+// populate indexes a market at block 870500 run by marketplace_key: two
+// billboards, four promotions, two attention offers, two matches and one
+// payment, plus a promotion at another block, one for another marketplace, a
+// match the marketplace did not sign and a payment not signed by the
+// attention owner.
+func populate(t *testing.T, event_store store.Store, marketplace_key string) {
+	t.Helper()
+	marketplace := marketplaceCoordinate(marketplace_key)
+	anyone := nostr.GeneratePrivateKey
+	for i := 0; i < 2; i++ {
+		index(t, event_store, anyone(), core.KindBillboard, fmt.Sprintf("bb-%d", i), marketplace, 870400, core.BillboardData{})
+	}
+	for i, bid := range []int64{1000, 2000, 3000, 4000} {
+		index(t, event_store, anyone(), core.KindPromotion, fmt.Sprintf("pr-%d", i), marketplace, 870500, core.PromotionData{Bid: bid})
+	}
+	index(t, event_store, anyone(), core.KindPromotion, "pr-old", marketplace, 870499, core.PromotionData{Bid: 9000})
+	index(t, event_store, anyone(), core.KindPromotion, "pr-other", "38188:other:org.attnprotocol:marketplace:x", 870500, core.PromotionData{Bid: 9000})
+
+	attention_key := anyone()
+	attention_pubkey, _ := nostr.GetPublicKey(attention_key)
+	attention := events.FormatCoordinate(core.KindAttention, attention_pubkey, events.FormatDTag("attention", "at-0"))
+	for i, ask := range []int64{500, 1500} {
+		index(t, event_store, anyone(), core.KindAttention, fmt.Sprintf("at-%d", i), marketplace, 870500, core.AttentionData{Ask: ask})
+	}
+
+	for i := 0; i < 2; i++ {
+		index(t, event_store, marketplace_key, core.KindMatch, fmt.Sprintf("m-%d", i), marketplace, 870500, core.MatchData{})
+	}
+	index(t, event_store, anyone(), core.KindMatch, "m-forged", marketplace, 870500, core.MatchData{})
+
+	index(t, event_store, attention_key, core.KindAttentionPaymentConfirmation, "pay-0", marketplace, 870500, core.AttentionPaymentConfirmationData{SatsReceived: 2500}, attention)
+	index(t, event_store, anyone(), core.KindAttentionPaymentConfirmation, "pay-forged", marketplace, 870500, core.AttentionPaymentConfirmationData{SatsReceived: 9000}, attention)
+}
+
+func TestCompute(t *testing.T) {
+	ctx := context.Background()
+	event_store := store.NewMemoryStore(store.MemoryOptions{})
+	defer event_store.Close()
+	marketplace_key := nostr.GeneratePrivateKey()
+	marketplace := marketplaceCoordinate(marketplace_key)
+	populate(t, event_store, marketplace_key)
+
+	stats, err := Compute(ctx, event_store, marketplace, 870500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Stats{
+		MarketplaceCoordinate: marketplace,
+		BlockHeight:           870500,
+		BillboardCount:        2,
+		PromotionCount:        4,
+		AttentionCount:        2,
+		MatchCount:            2,
+		PaymentCount:          1,
+		VolumeSats:            2500,
+		AverageBid:            2500,
+		AverageAsk:            1000,
+		MatchRate:             0.5,
+	}
+	if stats != want {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+
+	empty, err := Compute(ctx, event_store, marketplace, 870600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.BillboardCount != 2 || empty.PromotionCount != 0 || empty.MatchRate != 0 || empty.AverageBid != 0 {
+		t.Errorf("expected an empty block to keep billboards only, got %+v", empty)
+	}
+
+	if _, err := Compute(ctx, event_store, "not-a-coordinate", 870500); err == nil {
+		t.Error("expected a malformed marketplace coordinate to be rejected")
+	}
+}
+
+func TestNewService_Options(t *testing.T) {
+	valid := Options{PrivateKey: nostr.GeneratePrivateKey(), Store: store.NewMemoryStore(store.MemoryOptions{}), Publisher: &recorder{}, Marketplace: events.MarketplaceParams{MarketplaceID: "mk-1"}}
+
+	tests := []struct {
+		name   string
+		modify func(*Options)
+		want   error
+	}{
+		{"no store", func(o *Options) { o.Store = nil }, ErrNoStore},
+		{"no publisher", func(o *Options) { o.Publisher = nil }, ErrNoPublisher},
+		{"no marketplace ID", func(o *Options) { o.Marketplace.MarketplaceID = "" }, ErrNoMarketplaceID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := valid
+			tt.modify(&options)
+			if _, err := NewService(options); err != tt.want {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestService_RepublishesEachBlock(t *testing.T) {
+	ctx := context.Background()
+	event_store := store.NewMemoryStore(store.MemoryOptions{})
+	defer event_store.Close()
+	publisher := &recorder{}
+	marketplace_key := nostr.GeneratePrivateKey()
+	clock := nostr.GeneratePrivateKey()
+	clock_pubkey, _ := nostr.GetPublicKey(clock)
+	service, err := NewService(Options{
+		PrivateKey:  marketplace_key,
+		Store:       event_store,
+		Publisher:   publisher,
+		Marketplace: events.MarketplaceParams{Name: "Market", MarketplaceID: "mk-1", KindList: []int{34236}},
+		ClockPubkey: clock_pubkey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	populate(t, event_store, marketplace_key)
+
+	block := func(key string, height int64) *nostr.Event {
+		event := &nostr.Event{Kind: core.KindCityBlock, CreatedAt: nostr.Now(), Content: fmt.Sprintf(`{"block_height":%d}`, height)}
+		event.Sign(key)
+		return event
+	}
+	incoming := make(chan *nostr.Event, 4)
+	incoming <- block(clock, 870501)
+	incoming <- block(clock, 870501)                      // repeated block publishes nothing
+	incoming <- block(nostr.GeneratePrivateKey(), 870900) // not the clock: ignored
+	incoming <- block(clock, 870502)
+	close(incoming)
+	if err := service.Run(ctx, incoming); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(publisher.events) != 2 {
+		t.Fatalf("expected one MARKETPLACE per block, got %d", len(publisher.events))
+	}
+	first, second := publisher.events[0], publisher.events[1]
+	if first.Tags.Find("t")[1] != "870501" || second.CreatedAt <= first.CreatedAt {
+		t.Error("expected a newer MARKETPLACE for each block")
+	}
+	var content core.MarketplaceData
+	json.Unmarshal([]byte(first.Content), &content)
+	if content.Name != "Market" || content.BillboardCount != 2 || content.PromotionCount != 4 || content.AttentionCount != 2 || content.MatchCount != 2 {
+		t.Errorf("expected the counts of block 870500, got %+v", content)
+	}
+
+	// Block 870501 had no activity, but the counts are still present
+	if !strings.Contains(second.Content, `"match_count":0`) {
+		t.Errorf("expected zero counts to be encoded, got %s", second.Content)
+	}
+	if latest := service.Latest(); latest.BlockHeight != 870501 || latest.BillboardCount != 2 {
+		t.Errorf("unexpected latest stats %+v", latest)
+	}
+}
+
+// gatedPublisher holds Publish until release is closed.
+type gatedPublisher struct {
+	recorder
+	entered, release chan struct{}
+}
+
+func (p *gatedPublisher) Publish(ctx context.Context, event *nostr.Event) error {
+	close(p.entered)
+	<-p.release
+	return p.recorder.Publish(ctx, event)
+}
+
+func TestService_CountsReplacedEvents(t *testing.T) {
+	ctx := context.Background()
+	event_store := store.NewMemoryStore(store.MemoryOptions{})
+	defer event_store.Close()
+	publisher := &recorder{}
+	marketplace_key := nostr.GeneratePrivateKey()
+	marketplace := marketplaceCoordinate(marketplace_key)
+	service, err := NewService(Options{PrivateKey: marketplace_key, Store: event_store, Publisher: publisher, Marketplace: events.MarketplaceParams{MarketplaceID: "mk-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.OnBlock(ctx, 870501); err != nil {
+		t.Fatal(err)
+	}
+
+	// A promotion seen at block 870501 and re-published at 870502 before
+	// the block closed still counts towards 870501
+	promoter := nostr.GeneratePrivateKey()
+	service.Observe(index(t, event_store, promoter, core.KindPromotion, "pr-0", marketplace, 870501, core.PromotionData{Bid: 1000}))
+	index(t, event_store, promoter, core.KindPromotion, "pr-0", marketplace, 870502, core.PromotionData{Bid: 1000})
+	forged := index(t, event_store, promoter, core.KindPromotion, "pr-1", marketplace, 870501, core.PromotionData{Bid: 1000})
+	forged.Sig = strings.Repeat("0", 128)
+	service.Observe(forged)
+	event_store.Delete(ctx, forged.ID)
+
+	stats, err := service.OnBlock(ctx, 870502)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PromotionCount != 1 || stats.AverageBid != 1000 {
+		t.Errorf("expected the replaced promotion to count once, got %+v", stats)
+	}
+}
+
+func TestService_PublishesOutsideLock(t *testing.T) {
+	ctx := context.Background()
+	event_store := store.NewMemoryStore(store.MemoryOptions{})
+	defer event_store.Close()
+	publisher := &gatedPublisher{entered: make(chan struct{}), release: make(chan struct{})}
+	service, err := NewService(Options{PrivateKey: nostr.GeneratePrivateKey(), Store: event_store, Publisher: publisher, Marketplace: events.MarketplaceParams{MarketplaceID: "mk-1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := service.OnBlock(ctx, 870501)
+		done <- err
+	}()
+	<-publisher.entered
+
+	// While the block is published the service stays usable, and the same
+	// block is not published twice
+	if latest := service.Latest(); latest.BlockHeight != 0 {
+		t.Errorf("expected nothing committed yet, got %+v", latest)
+	}
+	if _, err := service.OnBlock(ctx, 870501); err != nil {
+		t.Fatal(err)
+	}
+	close(publisher.release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if latest := service.Latest(); latest.BlockHeight != 870500 || len(publisher.events) != 1 {
+		t.Errorf("expected one MARKETPLACE for block 870501, got %+v and %d events", latest, len(publisher.events))
+	}
+}
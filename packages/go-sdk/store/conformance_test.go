@@ -0,0 +1,14 @@
+package store_test
+
+import (
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store/storetest"
+)
+
+func TestMemoryStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, keep_history bool) store.Store {
+		return store.NewMemoryStore(store.MemoryOptions{KeepHistory: keep_history})
+	})
+}
@@ -0,0 +1,377 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// MemoryOptions holds configuration for a MemoryStore.
+type MemoryOptions struct {
+	// KeepHistory retains superseded versions of addressable events so they
+	// can be retrieved with History and GetByID.
+	KeepHistory bool
+}
+
+// MemoryStore is an in-memory Store.
+// It keeps the current version of each coordinate and indexes current events
+// by kind, pubkey and the tags listed in IndexedTags.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	keep_history bool
+	closed       bool
+
+	// events holds every stored event by ID, including superseded versions.
+	events map[string]*nostr.Event
+
+	// current holds the IDs of events visible to Query.
+	current map[string]struct{}
+
+	// by_coordinate maps a coordinate to the ID of its current version.
+	by_coordinate map[string]string
+
+	// history maps a coordinate to all kept versions, newest first.
+	history map[string][]*nostr.Event
+
+	by_kind   map[int]map[string]struct{}
+	by_pubkey map[string]map[string]struct{}
+	by_tag    map[string]map[string]map[string]struct{}
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore(options MemoryOptions) *MemoryStore {
+	by_tag := make(map[string]map[string]map[string]struct{}, len(IndexedTags))
+	for _, tag_name := range IndexedTags {
+		by_tag[tag_name] = make(map[string]map[string]struct{})
+	}
+
+	return &MemoryStore{
+		keep_history:  options.KeepHistory,
+		events:        make(map[string]*nostr.Event),
+		current:       make(map[string]struct{}),
+		by_coordinate: make(map[string]string),
+		history:       make(map[string][]*nostr.Event),
+		by_kind:       make(map[int]map[string]struct{}),
+		by_pubkey:     make(map[string]map[string]struct{}),
+		by_tag:        by_tag,
+	}
+}
+
+// Save stores an event, replacing the current version at its coordinate if the event is newer.
+func (m *MemoryStore) Save(ctx context.Context, event *nostr.Event) (SaveStatus, error) {
+	if event == nil {
+		return SaveStored, ErrNilEvent
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return SaveStored, ErrClosed
+	}
+
+	if _, exists := m.events[event.ID]; exists {
+		return SaveDuplicate, nil
+	}
+
+	stored := *event
+	coordinate := Coordinate(&stored)
+	if coordinate == "" {
+		m.addCurrent(&stored)
+		return SaveStored, nil
+	}
+
+	status := SaveStored
+	if current_id, ok := m.by_coordinate[coordinate]; ok {
+		previous := m.events[current_id]
+		if !IsNewer(&stored, previous) {
+			if m.keep_history {
+				m.events[stored.ID] = &stored
+				m.insertHistory(coordinate, &stored)
+			}
+			return SaveStale, nil
+		}
+
+		m.removeCurrent(previous)
+		if !m.keep_history {
+			delete(m.events, previous.ID)
+		}
+		status = SaveReplaced
+	}
+
+	m.addCurrent(&stored)
+	m.by_coordinate[coordinate] = stored.ID
+	if m.keep_history {
+		m.insertHistory(coordinate, &stored)
+	}
+
+	return status, nil
+}
+
+// Query returns current events matching the filter, newest first.
+func (m *MemoryStore) Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	limit := queryLimit(filter)
+	if limit == 0 {
+		return []*nostr.Event{}, nil
+	}
+
+	results := make([]*nostr.Event, 0)
+	for id := range m.candidates(filter) {
+		if _, ok := m.current[id]; !ok {
+			continue
+		}
+		event := m.events[id]
+		if filter.Matches(event) {
+			results = append(results, event)
+		}
+	}
+
+	sortNewestFirst(results)
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// GetByID returns the event with the given ID.
+func (m *MemoryStore) GetByID(ctx context.Context, id string) (*nostr.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	event, ok := m.events[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return event, nil
+}
+
+// GetByCoordinate returns the current event at a coordinate.
+func (m *MemoryStore) GetByCoordinate(ctx context.Context, coordinate string) (*nostr.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	id, ok := m.by_coordinate[coordinate]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return m.events[id], nil
+}
+
+// History returns every kept version at a coordinate, newest first.
+func (m *MemoryStore) History(ctx context.Context, coordinate string) ([]*nostr.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	if m.keep_history {
+		versions, ok := m.history[coordinate]
+		if !ok {
+			return nil, ErrNotFound
+		}
+		return slices.Clone(versions), nil
+	}
+
+	id, ok := m.by_coordinate[coordinate]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return []*nostr.Event{m.events[id]}, nil
+}
+
+// Delete removes the event with the given ID.
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	event, ok := m.events[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	delete(m.events, id)
+	if _, is_current := m.current[id]; is_current {
+		m.removeCurrent(event)
+	}
+
+	coordinate := Coordinate(event)
+	if coordinate == "" {
+		return nil
+	}
+	if m.by_coordinate[coordinate] == id {
+		delete(m.by_coordinate, coordinate)
+	}
+	if versions, ok := m.history[coordinate]; ok {
+		versions = slices.DeleteFunc(versions, func(e *nostr.Event) bool { return e.ID == id })
+		if len(versions) == 0 {
+			delete(m.history, coordinate)
+		} else {
+			m.history[coordinate] = versions
+		}
+	}
+
+	return nil
+}
+
+// Close releases the store's memory. The store cannot be used afterwards.
+func (m *MemoryStore) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	m.events = nil
+	m.current = nil
+	m.by_coordinate = nil
+	m.history = nil
+	m.by_kind = nil
+	m.by_pubkey = nil
+	m.by_tag = nil
+	return nil
+}
+
+// Len returns the number of current events in the store.
+func (m *MemoryStore) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.current)
+}
+
+// addCurrent stores an event and adds it to every index.
+func (m *MemoryStore) addCurrent(event *nostr.Event) {
+	m.events[event.ID] = event
+	m.current[event.ID] = struct{}{}
+	addToIndex(m.by_kind, event.Kind, event.ID)
+	addToIndex(m.by_pubkey, event.PubKey, event.ID)
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		if index, ok := m.by_tag[tag[0]]; ok {
+			addToIndex(index, tag[1], event.ID)
+		}
+	}
+}
+
+// removeCurrent removes an event from every index. The event itself is kept in m.events.
+func (m *MemoryStore) removeCurrent(event *nostr.Event) {
+	delete(m.current, event.ID)
+	removeFromIndex(m.by_kind, event.Kind, event.ID)
+	removeFromIndex(m.by_pubkey, event.PubKey, event.ID)
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		if index, ok := m.by_tag[tag[0]]; ok {
+			removeFromIndex(index, tag[1], event.ID)
+		}
+	}
+}
+
+// insertHistory adds a version to a coordinate's history, keeping it sorted newest first.
+func (m *MemoryStore) insertHistory(coordinate string, event *nostr.Event) {
+	versions := append(m.history[coordinate], event)
+	sortNewestFirst(versions)
+	m.history[coordinate] = versions
+}
+
+// candidates returns the smallest set of event IDs that can satisfy the filter,
+// using the most selective index available. Candidates still have to be matched.
+func (m *MemoryStore) candidates(filter nostr.Filter) map[string]struct{} {
+	var best map[string]struct{}
+	consider := func(set map[string]struct{}) {
+		if best == nil || len(set) < len(best) {
+			best = set
+		}
+	}
+
+	if filter.IDs != nil {
+		ids := make(map[string]struct{}, len(filter.IDs))
+		for _, id := range filter.IDs {
+			ids[id] = struct{}{}
+		}
+		consider(ids)
+	}
+	if filter.Kinds != nil {
+		consider(unionIndex(m.by_kind, filter.Kinds))
+	}
+	if filter.Authors != nil {
+		consider(unionIndex(m.by_pubkey, filter.Authors))
+	}
+	for tag_name, values := range filter.Tags {
+		if index, ok := m.by_tag[tag_name]; ok && values != nil {
+			consider(unionIndex(index, values))
+		}
+	}
+
+	if best == nil {
+		return m.current
+	}
+	return best
+}
+
+// addToIndex adds an event ID to the set stored under key.
+func addToIndex[K comparable](index map[K]map[string]struct{}, key K, id string) {
+	set, ok := index[key]
+	if !ok {
+		set = make(map[string]struct{})
+		index[key] = set
+	}
+	set[id] = struct{}{}
+}
+
+// removeFromIndex removes an event ID from the set stored under key.
+func removeFromIndex[K comparable](index map[K]map[string]struct{}, key K, id string) {
+	set, ok := index[key]
+	if !ok {
+		return
+	}
+	delete(set, id)
+	if len(set) == 0 {
+		delete(index, key)
+	}
+}
+
+// unionIndex returns the union of the sets stored under keys.
+// A single key returns the index's own set without copying.
+func unionIndex[K comparable](index map[K]map[string]struct{}, keys []K) map[string]struct{} {
+	if len(keys) == 1 {
+		if set, ok := index[keys[0]]; ok {
+			return set
+		}
+		return map[string]struct{}{}
+	}
+
+	union := make(map[string]struct{})
+	for _, key := range keys {
+		for id := range index[key] {
+			union[id] = struct{}{}
+		}
+	}
+	return union
+}
@@ -0,0 +1,209 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const test_pubkey = "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+
+// createTestEvent creates an addressable test event with an ID computed from its fields.
+func createTestEvent(kind int, d_tag string, created_at int64, extra_tags ...nostr.Tag) *nostr.Event {
+	tags := nostr.Tags{{"d", d_tag}}
+	tags = append(tags, extra_tags...)
+	event := &nostr.Event{
+		Kind:      kind,
+		PubKey:    test_pubkey,
+		CreatedAt: nostr.Timestamp(created_at),
+		Tags:      tags,
+		Content:   "{}",
+	}
+	event.ID = event.GetID()
+	return event
+}
+
+func TestMemoryStore_ReplacesOlderVersion(t *testing.T) {
+	ctx := context.Background()
+	event_store := NewMemoryStore(MemoryOptions{})
+
+	older := createTestEvent(38388, "org.attnprotocol:promotion:p1", 100)
+	newer := createTestEvent(38388, "org.attnprotocol:promotion:p1", 200)
+
+	if status, err := event_store.Save(ctx, older); err != nil || status != SaveStored {
+		t.Fatalf("expected stored, got %s (%v)", status, err)
+	}
+	if status, err := event_store.Save(ctx, newer); err != nil || status != SaveReplaced {
+		t.Fatalf("expected replaced, got %s (%v)", status, err)
+	}
+	if status, _ := event_store.Save(ctx, older); status != SaveStale {
+		t.Errorf("expected stale, got %s", status)
+	}
+	if status, _ := event_store.Save(ctx, newer); status != SaveDuplicate {
+		t.Errorf("expected duplicate, got %s", status)
+	}
+
+	current, err := event_store.GetByCoordinate(ctx, Coordinate(newer))
+	if err != nil {
+		t.Fatalf("GetByCoordinate: %v", err)
+	}
+	if current.ID != newer.ID {
+		t.Errorf("expected current version %s, got %s", newer.ID, current.ID)
+	}
+	if _, err := event_store.GetByID(ctx, older.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected superseded version to be dropped without history, got %v", err)
+	}
+	if event_store.Len() != 1 {
+		t.Errorf("expected 1 current event, got %d", event_store.Len())
+	}
+}
+
+func TestMemoryStore_KeepHistory(t *testing.T) {
+	ctx := context.Background()
+	event_store := NewMemoryStore(MemoryOptions{KeepHistory: true})
+
+	v1 := createTestEvent(38488, "org.attnprotocol:attention:a1", 100)
+	v2 := createTestEvent(38488, "org.attnprotocol:attention:a1", 200)
+	v3 := createTestEvent(38488, "org.attnprotocol:attention:a1", 300)
+	for _, event := range []*nostr.Event{v2, v3, v1} {
+		if _, err := event_store.Save(ctx, event); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	versions, err := event_store.History(ctx, Coordinate(v1))
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	expected := []string{v3.ID, v2.ID, v1.ID}
+	if len(versions) != len(expected) {
+		t.Fatalf("expected %d versions, got %d", len(expected), len(versions))
+	}
+	for i, version := range versions {
+		if version.ID != expected[i] {
+			t.Errorf("versions[%d]: expected %s, got %s", i, expected[i], version.ID)
+		}
+	}
+
+	if _, err := event_store.GetByID(ctx, v1.ID); err != nil {
+		t.Errorf("expected superseded version to be retrievable by ID, got %v", err)
+	}
+
+	results, err := event_store.Query(ctx, nostr.Filter{Kinds: []int{38488}})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != v3.ID {
+		t.Errorf("expected query to return only the current version")
+	}
+}
+
+func TestMemoryStore_QueryByTags(t *testing.T) {
+	ctx := context.Background()
+	event_store := NewMemoryStore(MemoryOptions{})
+
+	marketplace := "38188:" + test_pubkey + ":org.attnprotocol:marketplace:m1"
+	for i := 0; i < 5; i++ {
+		event := createTestEvent(38388, fmt.Sprintf("org.attnprotocol:promotion:p%d", i), int64(100+i),
+			nostr.Tag{"t", fmt.Sprintf("%d", 870000+i%2)},
+			nostr.Tag{"a", marketplace},
+		)
+		if _, err := event_store.Save(ctx, event); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+	other := createTestEvent(38488, "org.attnprotocol:attention:a1", 500, nostr.Tag{"t", "870000"})
+	if _, err := event_store.Save(ctx, other); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		filter   nostr.Filter
+		expected int
+	}{
+		{"by kind", nostr.Filter{Kinds: []int{38388}}, 5},
+		{"by block height", nostr.Filter{Tags: nostr.TagMap{"t": []string{"870000"}}}, 4},
+		{"by kind and block height", nostr.Filter{Kinds: []int{38388}, Tags: nostr.TagMap{"t": []string{"870001"}}}, 2},
+		{"by coordinate", nostr.Filter{Tags: nostr.TagMap{"a": []string{marketplace}}}, 5},
+		{"by author", nostr.Filter{Authors: []string{test_pubkey}}, 6},
+		{"by unindexed tag", nostr.Filter{Tags: nostr.TagMap{"d": []string{"org.attnprotocol:attention:a1"}}}, 1},
+		{"with limit", nostr.Filter{Kinds: []int{38388}, Limit: 2}, 2},
+		{"with limit zero", nostr.Filter{Kinds: []int{38388}, LimitZero: true}, 0},
+		{"no match", nostr.Filter{Kinds: []int{38888}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := event_store.Query(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			if len(results) != tt.expected {
+				t.Errorf("expected %d events, got %d", tt.expected, len(results))
+			}
+			for i := 1; i < len(results); i++ {
+				if results[i].CreatedAt > results[i-1].CreatedAt {
+					t.Errorf("results not ordered newest first")
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryStore_Delete(t *testing.T) {
+	ctx := context.Background()
+	event_store := NewMemoryStore(MemoryOptions{})
+
+	event := createTestEvent(38888, "org.attnprotocol:match:m1", 100, nostr.Tag{"t", "870000"})
+	if _, err := event_store.Save(ctx, event); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if err := event_store.Delete(ctx, event.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	if _, err := event_store.GetByCoordinate(ctx, Coordinate(event)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	results, _ := event_store.Query(ctx, nostr.Filter{Tags: nostr.TagMap{"t": []string{"870000"}}})
+	if len(results) != 0 {
+		t.Errorf("expected deleted event to be removed from indexes, got %d results", len(results))
+	}
+	if err := event_store.Delete(ctx, event.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestMemoryStore_Closed(t *testing.T) {
+	ctx := context.Background()
+	event_store := NewMemoryStore(MemoryOptions{})
+	event_store.Close()
+
+	if _, err := event_store.Save(ctx, createTestEvent(38388, "org.attnprotocol:promotion:p1", 100)); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+	if _, err := event_store.Query(ctx, nostr.Filter{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestCoordinate(t *testing.T) {
+	addressable := createTestEvent(38388, "org.attnprotocol:promotion:p1", 100)
+	if got := Coordinate(addressable); got != "38388:"+test_pubkey+":org.attnprotocol:promotion:p1" {
+		t.Errorf("unexpected addressable coordinate: %s", got)
+	}
+
+	replaceable := &nostr.Event{Kind: 10002, PubKey: test_pubkey}
+	if got := Coordinate(replaceable); got != "10002:"+test_pubkey+":" {
+		t.Errorf("unexpected replaceable coordinate: %s", got)
+	}
+
+	regular := &nostr.Event{Kind: 1, PubKey: test_pubkey}
+	if got := Coordinate(regular); got != "" {
+		t.Errorf("expected empty coordinate for regular kind, got %s", got)
+	}
+}
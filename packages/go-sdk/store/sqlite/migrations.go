@@ -0,0 +1,127 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration is a single forward-only schema change.
+type migration struct {
+	version    int
+	statements []string
+}
+
+// migrations lists every schema change in order. Applied versions are recorded
+// in schema_migrations; never edit a released migration, append a new one.
+var migrations = []migration{
+	{
+		// Version 1: events, replaceable-event bookkeeping and tag index
+		version: 1,
+		statements: []string{
+			`CREATE TABLE events (
+				id         TEXT PRIMARY KEY,
+				pubkey     TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				kind       INTEGER NOT NULL,
+				tags       TEXT NOT NULL,
+				content    TEXT NOT NULL,
+				sig        TEXT NOT NULL,
+				coordinate TEXT,
+				is_current INTEGER NOT NULL DEFAULT 1
+			)`,
+			`CREATE INDEX idx_events_kind ON events(kind, created_at DESC) WHERE is_current = 1`,
+			`CREATE INDEX idx_events_pubkey ON events(pubkey, created_at DESC) WHERE is_current = 1`,
+			`CREATE INDEX idx_events_created_at ON events(created_at DESC) WHERE is_current = 1`,
+			`CREATE INDEX idx_events_coordinate ON events(coordinate, created_at DESC)`,
+			`CREATE TABLE tags (
+				event_id TEXT NOT NULL,
+				name     TEXT NOT NULL,
+				value    TEXT NOT NULL
+			)`,
+			`CREATE INDEX idx_tags_name_value ON tags(name, value)`,
+			`CREATE INDEX idx_tags_event_id ON tags(event_id)`,
+		},
+	},
+	{
+		// Version 2: parsed ATTN content columns for analytics
+		version: 2,
+		statements: []string{
+			`ALTER TABLE events ADD COLUMN block_height INTEGER`,
+			`ALTER TABLE events ADD COLUMN bid INTEGER`,
+			`ALTER TABLE events ADD COLUMN ask INTEGER`,
+			`ALTER TABLE events ADD COLUMN duration INTEGER`,
+			`ALTER TABLE events ADD COLUMN min_duration INTEGER`,
+			`ALTER TABLE events ADD COLUMN max_duration INTEGER`,
+			`ALTER TABLE events ADD COLUMN sats_received INTEGER`,
+			`ALTER TABLE events ADD COLUMN match_fee_sats INTEGER`,
+			`ALTER TABLE events ADD COLUMN confirmation_fee_sats INTEGER`,
+			`CREATE INDEX idx_events_block_height ON events(block_height, kind) WHERE is_current = 1`,
+		},
+	},
+	{
+		// Version 3: relay outbox entries
+		version: 3,
+		statements: []string{
+			`CREATE TABLE outbox (
+				event_id    TEXT PRIMARY KEY,
+				entry       TEXT NOT NULL,
+				enqueued_at INTEGER NOT NULL,
+				pending     INTEGER NOT NULL
+			)`,
+			`CREATE INDEX idx_outbox_pending ON outbox(enqueued_at) WHERE pending = 1`,
+		},
+	},
+}
+
+// migrate applies every migration newer than the database's recorded version.
+// Each migration runs in its own transaction.
+func migrate(ctx context.Context, db *sql.DB) error {
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at INTEGER NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		for _, statement := range m.statements {
+			if _, err := tx.ExecContext(ctx, statement); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("migration %d: %w", m.version, err)
+			}
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)`, m.version, time.Now().Unix()); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("migration %d: %w", m.version, err)
+		}
+	}
+
+	return nil
+}
+
+// schemaVersion returns the highest applied migration version, or 0 for a new database.
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+)
+
+// OutboxStore is a relay.OutboxStore kept in the outbox table of a Store's
+// database, so events awaiting delivery share its file and backups.
+type OutboxStore struct {
+	db *sql.DB
+}
+
+var _ relay.OutboxStore = (*OutboxStore)(nil)
+
+// Outbox returns an outbox store on the same database.
+func (s *Store) Outbox() *OutboxStore {
+	return &OutboxStore{db: s.db}
+}
+
+// Save implements relay.OutboxStore.
+func (o *OutboxStore) Save(ctx context.Context, entry relay.OutboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	if !entry.Done() {
+		pending = 1
+	}
+	_, err = o.db.ExecContext(ctx,
+		`INSERT INTO outbox (event_id, entry, enqueued_at, pending) VALUES (?, ?, ?, ?)
+		ON CONFLICT(event_id) DO UPDATE SET entry = excluded.entry, pending = excluded.pending`,
+		entry.Event.ID, string(data), entry.EnqueuedAt.UnixNano(), pending)
+	return err
+}
+
+// Get implements relay.OutboxStore.
+func (o *OutboxStore) Get(ctx context.Context, event_id string) (relay.OutboxEntry, error) {
+	var data string
+	err := o.db.QueryRowContext(ctx, `SELECT entry FROM outbox WHERE event_id = ?`, event_id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return relay.OutboxEntry{}, relay.ErrNotInOutbox
+	}
+	if err != nil {
+		return relay.OutboxEntry{}, err
+	}
+	var entry relay.OutboxEntry
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		return relay.OutboxEntry{}, err
+	}
+	return entry, nil
+}
+
+// Pending implements relay.OutboxStore.
+func (o *OutboxStore) Pending(ctx context.Context) ([]relay.OutboxEntry, error) {
+	rows, err := o.db.QueryContext(ctx, `SELECT entry FROM outbox WHERE pending = 1 ORDER BY enqueued_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []relay.OutboxEntry
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry relay.OutboxEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Prune implements relay.OutboxStore.
+func (o *OutboxStore) Prune(ctx context.Context, before time.Time) (int, error) {
+	result, err := o.db.ExecContext(ctx, `DELETE FROM outbox WHERE pending = 0 AND enqueued_at < ?`, before.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
@@ -0,0 +1,396 @@
+// Package sqlite provides a persistent store.Store backed by SQLite.
+//
+// Events are stored with replaceable-event handling per coordinate, every
+// single-letter tag is indexed for #a, #e, #p, #t and #d queries, and parsed
+// ATTN content fields (bid, ask, duration, block height, ...) are kept in
+// dedicated columns so they can be queried for analytics through DB.
+//
+// Example usage:
+//
+//	event_store, err := sqlite.NewStore("attn.db", sqlite.Options{})
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	defer event_store.Close()
+//
+//	rows, err := event_store.DB().QueryContext(ctx,
+//	    `SELECT block_height, SUM(bid) FROM events WHERE kind = 38388 AND is_current = 1 GROUP BY block_height`)
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/joinnextblock/attn-protocol/go-core"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/nbd-wtf/go-nostr"
+	_ "modernc.org/sqlite"
+)
+
+// Options holds configuration for a SQLite store.
+type Options struct {
+	// KeepHistory retains superseded versions of addressable events so they
+	// can be retrieved with History and GetByID.
+	KeepHistory bool
+}
+
+// Store is a SQLite-backed store.Store.
+type Store struct {
+	db           *sql.DB
+	keep_history bool
+}
+
+var _ store.Store = (*Store)(nil)
+
+// event_columns is the column list read back into nostr.Event values.
+const event_columns = `id, pubkey, created_at, kind, tags, content, sig`
+
+// NewStore opens (or creates) a SQLite database at path and applies pending migrations.
+// Use ":memory:" for a private in-memory database.
+func NewStore(path string, options Options) (*Store, error) {
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; one connection also keeps ":memory:" databases shared.
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db, keep_history: options.KeepHistory}, nil
+}
+
+// DB returns the underlying database handle for analytics queries.
+// Callers must not modify the events or tags tables directly.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// SchemaVersion returns the highest applied migration version.
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	return schemaVersion(ctx, s.db)
+}
+
+// Save stores an event, replacing the current version at its coordinate if the event is newer.
+func (s *Store) Save(ctx context.Context, event *nostr.Event) (store.SaveStatus, error) {
+	if event == nil {
+		return store.SaveStored, store.ErrNilEvent
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return store.SaveStored, err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM events WHERE id = ?`, event.ID).Scan(&exists)
+	if err == nil {
+		return store.SaveDuplicate, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return store.SaveStored, err
+	}
+
+	status := store.SaveStored
+	is_current := true
+	coordinate := store.Coordinate(event)
+	if coordinate != "" {
+		previous, err := scanEvent(tx.QueryRowContext(ctx,
+			`SELECT `+event_columns+` FROM events WHERE coordinate = ? AND is_current = 1`, coordinate))
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+		case err != nil:
+			return store.SaveStored, err
+		case !store.IsNewer(event, previous):
+			if !s.keep_history {
+				return store.SaveStale, nil
+			}
+			status = store.SaveStale
+			is_current = false
+		default:
+			if s.keep_history {
+				_, err = tx.ExecContext(ctx, `UPDATE events SET is_current = 0 WHERE id = ?`, previous.ID)
+			} else {
+				err = deleteEvent(ctx, tx, previous.ID)
+			}
+			if err != nil {
+				return store.SaveStored, err
+			}
+			status = store.SaveReplaced
+		}
+	}
+
+	if err := insertEvent(ctx, tx, event, coordinate, is_current); err != nil {
+		return store.SaveStored, err
+	}
+	if err := tx.Commit(); err != nil {
+		return store.SaveStored, err
+	}
+
+	return status, nil
+}
+
+// Query returns current events matching the filter, newest first.
+func (s *Store) Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error) {
+	if filter.LimitZero {
+		return []*nostr.Event{}, nil
+	}
+
+	query, args := buildQuery(filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]*nostr.Event, 0)
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, event)
+	}
+
+	return results, rows.Err()
+}
+
+// GetByID returns the event with the given ID.
+func (s *Store) GetByID(ctx context.Context, id string) (*nostr.Event, error) {
+	event, err := scanEvent(s.db.QueryRowContext(ctx, `SELECT `+event_columns+` FROM events WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	return event, err
+}
+
+// GetByCoordinate returns the current event at a coordinate.
+func (s *Store) GetByCoordinate(ctx context.Context, coordinate string) (*nostr.Event, error) {
+	event, err := scanEvent(s.db.QueryRowContext(ctx,
+		`SELECT `+event_columns+` FROM events WHERE coordinate = ? AND is_current = 1`, coordinate))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, store.ErrNotFound
+	}
+	return event, err
+}
+
+// History returns every kept version at a coordinate, newest first.
+func (s *Store) History(ctx context.Context, coordinate string) ([]*nostr.Event, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+event_columns+` FROM events WHERE coordinate = ? ORDER BY created_at DESC, id ASC`, coordinate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []*nostr.Event
+	for rows.Next() {
+		event, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	return versions, nil
+}
+
+// Delete removes the event with the given ID.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists int
+	if err := tx.QueryRowContext(ctx, `SELECT 1 FROM events WHERE id = ?`, id).Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.ErrNotFound
+		}
+		return err
+	}
+	if err := deleteEvent(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// insertEvent inserts an event row, its tag index rows and its parsed content columns.
+func insertEvent(ctx context.Context, tx *sql.Tx, event *nostr.Event, coordinate string, is_current bool) error {
+	tags_json, err := json.Marshal(event.Tags)
+	if err != nil {
+		return err
+	}
+
+	var coordinate_value sql.NullString
+	if coordinate != "" {
+		coordinate_value = sql.NullString{String: coordinate, Valid: true}
+	}
+
+	columns := parseContentColumns(event)
+	_, err = tx.ExecContext(ctx, `INSERT INTO events (
+		id, pubkey, created_at, kind, tags, content, sig, coordinate, is_current,
+		block_height, bid, ask, duration, min_duration, max_duration, sats_received, match_fee_sats, confirmation_fee_sats
+	) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		event.ID, event.PubKey, int64(event.CreatedAt), event.Kind, string(tags_json), event.Content, event.Sig,
+		coordinate_value, is_current,
+		columns.BlockHeight, columns.Bid, columns.Ask, columns.Duration, columns.MinDuration, columns.MaxDuration,
+		columns.SatsReceived, columns.MatchFeeSats, columns.ConfirmationFeeSats,
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || len(tag[0]) != 1 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO tags (event_id, name, value) VALUES (?, ?, ?)`, event.ID, tag[0], tag[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteEvent removes an event row and its tag index rows.
+func deleteEvent(ctx context.Context, tx *sql.Tx, id string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM tags WHERE event_id = ?`, id); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, `DELETE FROM events WHERE id = ?`, id)
+	return err
+}
+
+// buildQuery translates a filter into SQL over current events.
+func buildQuery(filter nostr.Filter) (string, []any) {
+	conditions := []string{"is_current = 1"}
+	var args []any
+
+	if filter.IDs != nil {
+		conditions = append(conditions, "id IN ("+placeholders(len(filter.IDs))+")")
+		for _, id := range filter.IDs {
+			args = append(args, id)
+		}
+	}
+	if filter.Kinds != nil {
+		conditions = append(conditions, "kind IN ("+placeholders(len(filter.Kinds))+")")
+		for _, kind := range filter.Kinds {
+			args = append(args, kind)
+		}
+	}
+	if filter.Authors != nil {
+		conditions = append(conditions, "pubkey IN ("+placeholders(len(filter.Authors))+")")
+		for _, author := range filter.Authors {
+			args = append(args, author)
+		}
+	}
+	for tag_name, values := range filter.Tags {
+		if values == nil {
+			continue
+		}
+		conditions = append(conditions,
+			"id IN (SELECT event_id FROM tags WHERE name = ? AND value IN ("+placeholders(len(values))+"))")
+		args = append(args, tag_name)
+		for _, value := range values {
+			args = append(args, value)
+		}
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, int64(*filter.Since))
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at <= ?")
+		args = append(args, int64(*filter.Until))
+	}
+
+	query := `SELECT ` + event_columns + ` FROM events WHERE ` + strings.Join(conditions, " AND ") +
+		` ORDER BY created_at DESC, id ASC`
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
+	}
+
+	return query, args
+}
+
+// placeholders returns n comma-separated SQL placeholders.
+// An empty list yields NULL so that "IN (NULL)" matches nothing, as an empty filter list should.
+func placeholders(n int) string {
+	if n == 0 {
+		return "NULL"
+	}
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// scanEvent reads a row selected with event_columns into an event.
+func scanEvent(row scanner) (*nostr.Event, error) {
+	var event nostr.Event
+	var created_at int64
+	var tags_json string
+	if err := row.Scan(&event.ID, &event.PubKey, &created_at, &event.Kind, &tags_json, &event.Content, &event.Sig); err != nil {
+		return nil, err
+	}
+	event.CreatedAt = nostr.Timestamp(created_at)
+	if err := json.Unmarshal([]byte(tags_json), &event.Tags); err != nil {
+		return nil, fmt.Errorf("decode tags for %s: %w", event.ID, err)
+	}
+	return &event, nil
+}
+
+// contentColumns holds the parsed ATTN content fields stored for analytics.
+// A nil field is stored as NULL.
+type contentColumns struct {
+	BlockHeight         *int64 `json:"-"`
+	Bid                 *int64 `json:"bid"`
+	Ask                 *int64 `json:"ask"`
+	Duration            *int64 `json:"duration"`
+	MinDuration         *int64 `json:"min_duration"`
+	MaxDuration         *int64 `json:"max_duration"`
+	SatsReceived        *int64 `json:"sats_received"`
+	MatchFeeSats        *int64 `json:"match_fee_sats"`
+	ConfirmationFeeSats *int64 `json:"confirmation_fee_sats"`
+}
+
+// parseContentColumns extracts analytics columns from an event.
+// Content that is not JSON, fields of the wrong type, and t tags that
+// core.ParseBlockHeight rejects are stored as NULL.
+func parseContentColumns(event *nostr.Event) contentColumns {
+	var columns contentColumns
+	json.Unmarshal([]byte(event.Content), &columns)
+
+	if height, ok := core.EventBlockHeight(event); ok {
+		columns.BlockHeight = &height
+	}
+
+	return columns
+}
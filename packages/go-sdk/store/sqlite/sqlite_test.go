@@ -0,0 +1,205 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/relay"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/joinnextblock/attn-protocol/go-sdk/store/storetest"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestStore_Conformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T, keep_history bool) store.Store {
+		event_store, err := NewStore(filepath.Join(t.TempDir(), "attn.db"), Options{KeepHistory: keep_history})
+		if err != nil {
+			t.Fatalf("NewStore: %v", err)
+		}
+		return event_store
+	})
+}
+
+func TestStore_Migrations(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "attn.db")
+
+	event_store, err := NewStore(path, Options{})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	version, err := event_store.SchemaVersion(ctx)
+	if err != nil {
+		t.Fatalf("SchemaVersion: %v", err)
+	}
+	if version != migrations[len(migrations)-1].version {
+		t.Errorf("expected schema version %d, got %d", migrations[len(migrations)-1].version, version)
+	}
+	event_store.Close()
+
+	// Reopening an up-to-date database must not re-run migrations
+	event_store, err = NewStore(path, Options{})
+	if err != nil {
+		t.Fatalf("reopen NewStore: %v", err)
+	}
+	defer event_store.Close()
+
+	var applied int
+	if err := event_store.DB().QueryRowContext(ctx, `SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatalf("count migrations: %v", err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("expected %d applied migrations, got %d", len(migrations), applied)
+	}
+}
+
+func TestStore_PersistsAcrossRestarts(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "attn.db")
+
+	event := &nostr.Event{
+		Kind:      38388,
+		PubKey:    "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		CreatedAt: 100,
+		Tags:      nostr.Tags{{"d", "org.attnprotocol:promotion:p1"}, {"t", "870000"}},
+		Content:   "{}",
+	}
+	event.ID = event.GetID()
+
+	event_store, err := NewStore(path, Options{})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	if _, err := event_store.Save(ctx, event); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	event_store.Close()
+
+	event_store, err = NewStore(path, Options{})
+	if err != nil {
+		t.Fatalf("reopen NewStore: %v", err)
+	}
+	defer event_store.Close()
+
+	results, err := event_store.Query(ctx, nostr.Filter{Tags: nostr.TagMap{"t": []string{"870000"}}})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(results) != 1 || results[0].ID != event.ID {
+		t.Errorf("expected saved event after reopening, got %d results", len(results))
+	}
+}
+
+func TestStore_ContentColumns(t *testing.T) {
+	ctx := context.Background()
+	event_store, err := NewStore(filepath.Join(t.TempDir(), "attn.db"), Options{})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer event_store.Close()
+
+	pubkey := "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	events := []*nostr.Event{
+		{Kind: 38388, PubKey: pubkey, CreatedAt: 100, Tags: nostr.Tags{{"d", "org.attnprotocol:promotion:p1"}, {"t", "870000"}}, Content: `{"bid":5000,"duration":30000}`},
+		{Kind: 38388, PubKey: pubkey, CreatedAt: 101, Tags: nostr.Tags{{"d", "org.attnprotocol:promotion:p2"}, {"t", "870000"}}, Content: `{"bid":3000,"duration":15000}`},
+		{Kind: 38488, PubKey: pubkey, CreatedAt: 102, Tags: nostr.Tags{{"d", "org.attnprotocol:attention:a1"}, {"t", "870001"}}, Content: `{"ask":2000,"min_duration":15000,"max_duration":60000}`},
+		{Kind: 38388, PubKey: pubkey, CreatedAt: 103, Tags: nostr.Tags{{"d", "org.attnprotocol:promotion:p3"}, {"t", "not-a-height"}}, Content: `not json`},
+		{Kind: 38388, PubKey: pubkey, CreatedAt: 104, Tags: nostr.Tags{{"d", "org.attnprotocol:promotion:p4"}, {"t", "+870000"}}, Content: `{}`},
+	}
+	for _, event := range events {
+		event.ID = event.GetID()
+		if _, err := event_store.Save(ctx, event); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	var total_bid, promotion_count int64
+	err = event_store.DB().QueryRowContext(ctx,
+		`SELECT SUM(bid), COUNT(*) FROM events WHERE kind = 38388 AND block_height = 870000 AND is_current = 1`,
+	).Scan(&total_bid, &promotion_count)
+	if err != nil {
+		t.Fatalf("analytics query: %v", err)
+	}
+	if total_bid != 8000 || promotion_count != 2 {
+		t.Errorf("expected 2 promotions bidding 8000 sats at 870000, got %d bidding %d", promotion_count, total_bid)
+	}
+
+	var ask, min_duration, max_duration int64
+	err = event_store.DB().QueryRowContext(ctx,
+		`SELECT ask, min_duration, max_duration FROM events WHERE kind = 38488 AND block_height = 870001`,
+	).Scan(&ask, &min_duration, &max_duration)
+	if err != nil {
+		t.Fatalf("attention query: %v", err)
+	}
+	if ask != 2000 || min_duration != 15000 || max_duration != 60000 {
+		t.Errorf("unexpected attention columns: ask=%d min=%d max=%d", ask, min_duration, max_duration)
+	}
+
+	var null_count int64
+	err = event_store.DB().QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM events WHERE id IN (?, ?) AND block_height IS NULL AND bid IS NULL`, events[3].ID, events[4].ID,
+	).Scan(&null_count)
+	if err != nil {
+		t.Fatalf("null column query: %v", err)
+	}
+	if null_count != 2 {
+		t.Errorf("expected unparseable fields to be stored as NULL")
+	}
+}
+
+func TestOutboxStore(t *testing.T) {
+	ctx := context.Background()
+	event_store, err := NewStore(filepath.Join(t.TempDir(), "attn.db"), Options{})
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	defer event_store.Close()
+	outbox := event_store.Outbox()
+
+	enqueued_at := time.Date(2024, 11, 20, 12, 0, 0, 0, time.UTC)
+	entries := make([]relay.OutboxEntry, 2)
+	for i := range entries {
+		event := &nostr.Event{Kind: 38888, CreatedAt: nostr.Timestamp(100 + i), Content: "{}"}
+		event.ID = event.GetID()
+		entries[i] = relay.OutboxEntry{
+			Event:      event,
+			Deliveries: []relay.Delivery{{RelayURL: "wss://relay.example.com", State: relay.DeliveryPending}},
+			EnqueuedAt: enqueued_at.Add(time.Duration(1-i) * time.Second),
+		}
+		if err := outbox.Save(ctx, entries[i]); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	pending, err := outbox.Pending(ctx)
+	if err != nil || len(pending) != 2 || pending[0].Event.ID != entries[1].Event.ID {
+		t.Fatalf("expected both entries pending, oldest first, got %d, %v", len(pending), err)
+	}
+
+	entries[0].Deliveries[0].State = relay.DeliveryAcknowledged
+	if err := outbox.Save(ctx, entries[0]); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got, err := outbox.Get(ctx, entries[0].Event.ID)
+	if err != nil || got.Deliveries[0].State != relay.DeliveryAcknowledged || !got.EnqueuedAt.Equal(entries[0].EnqueuedAt) {
+		t.Errorf("expected the updated entry, got %+v, %v", got, err)
+	}
+	if pending, _ := outbox.Pending(ctx); len(pending) != 1 {
+		t.Errorf("expected one entry pending, got %d", len(pending))
+	}
+	if _, err := outbox.Get(ctx, "unknown"); !errors.Is(err, relay.ErrNotInOutbox) {
+		t.Errorf("expected ErrNotInOutbox, got %v", err)
+	}
+	if pruned, err := outbox.Prune(ctx, enqueued_at.Add(time.Hour)); err != nil || pruned != 1 {
+		t.Fatalf("expected the settled entry to be pruned, got %d, %v", pruned, err)
+	}
+	if _, err := outbox.Get(ctx, entries[0].Event.ID); !errors.Is(err, relay.ErrNotInOutbox) {
+		t.Errorf("expected the pruned entry gone, got %v", err)
+	}
+	if pending, _ := outbox.Pending(ctx); len(pending) != 1 {
+		t.Errorf("expected the pending entry kept, got %d", len(pending))
+	}
+}
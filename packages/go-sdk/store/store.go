@@ -0,0 +1,156 @@
+// Package store provides local event storage for ATTN Protocol services.
+//
+// All ATTN Protocol kinds are addressable (38xxx range), so a newer event with
+// the same pubkey, kind and d tag replaces an older one. Stores in this package
+// keep the latest version of each event per coordinate (kind:pubkey:d_tag) and
+// answer nostr.Filter queries against that current view of the market.
+//
+// Example usage:
+//
+//	event_store := store.NewMemoryStore(store.MemoryOptions{KeepHistory: true})
+//	defer event_store.Close()
+//
+//	status, err := event_store.Save(ctx, event)
+//	promotions, err := event_store.Query(ctx, nostr.Filter{
+//	    Kinds: []int{core.KindPromotion},
+//	    Tags:  nostr.TagMap{"t": []string{"870000"}},
+//	})
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var (
+	// ErrNotFound is returned when no event matches the requested ID or coordinate.
+	ErrNotFound = errors.New("event not found")
+
+	// ErrNilEvent is returned when a nil event is passed to Save.
+	ErrNilEvent = errors.New("event is nil")
+
+	// ErrClosed is returned when a store is used after Close.
+	ErrClosed = errors.New("store is closed")
+)
+
+// IndexedTags lists the single-letter tags stores index for tag-filtered queries.
+// Other tags in a filter are still honoured but are matched by scanning.
+var IndexedTags = []string{"a", "e", "p", "t"}
+
+// SaveStatus describes what Save did with an event.
+type SaveStatus int
+
+const (
+	// SaveStored means the event was new and is now the current version.
+	SaveStored SaveStatus = iota
+
+	// SaveReplaced means the event replaced an older version at the same coordinate.
+	SaveReplaced
+
+	// SaveDuplicate means an event with the same ID was already stored.
+	SaveDuplicate
+
+	// SaveStale means a newer version already exists at the same coordinate.
+	SaveStale
+)
+
+// String returns a human-readable name for the status.
+func (s SaveStatus) String() string {
+	switch s {
+	case SaveStored:
+		return "stored"
+	case SaveReplaced:
+		return "replaced"
+	case SaveDuplicate:
+		return "duplicate"
+	case SaveStale:
+		return "stale"
+	default:
+		return fmt.Sprintf("SaveStatus(%d)", int(s))
+	}
+}
+
+// Store is a local event store with addressable-event semantics.
+//
+// Implementations must be safe for concurrent use. Events returned by a store
+// are shared with it and must not be modified by the caller.
+type Store interface {
+	// Save stores an event. For addressable and replaceable kinds the event
+	// replaces the current version at its coordinate only if it is newer.
+	Save(ctx context.Context, event *nostr.Event) (SaveStatus, error)
+
+	// Query returns current events matching the filter, newest first.
+	// Superseded versions are never returned, even when history is kept.
+	Query(ctx context.Context, filter nostr.Filter) ([]*nostr.Event, error)
+
+	// GetByID returns the event with the given ID, including superseded
+	// versions when history is kept.
+	GetByID(ctx context.Context, id string) (*nostr.Event, error)
+
+	// GetByCoordinate returns the current event at a coordinate (kind:pubkey:d_tag).
+	GetByCoordinate(ctx context.Context, coordinate string) (*nostr.Event, error)
+
+	// History returns every stored version at a coordinate, newest first.
+	// Without history only the current version is returned.
+	History(ctx context.Context, coordinate string) ([]*nostr.Event, error)
+
+	// Delete removes the event with the given ID. Deleting the current version
+	// of a coordinate does not promote an older version in its place.
+	Delete(ctx context.Context, id string) error
+
+	// Close releases resources held by the store.
+	Close() error
+}
+
+// Coordinate returns the NIP-01 coordinate of an event: kind:pubkey:d_tag for
+// addressable kinds and kind:pubkey: for replaceable kinds.
+// Returns an empty string for regular and ephemeral kinds.
+func Coordinate(event *nostr.Event) string {
+	switch {
+	case nostr.IsAddressableKind(event.Kind):
+		return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, event.Tags.GetD())
+	case nostr.IsReplaceableKind(event.Kind):
+		return fmt.Sprintf("%d:%s:", event.Kind, event.PubKey)
+	default:
+		return ""
+	}
+}
+
+// IsNewer reports whether event a supersedes event b at the same coordinate.
+// Per NIP-01 the later created_at wins; on a tie the lowest event ID wins.
+func IsNewer(a, b *nostr.Event) bool {
+	if a.CreatedAt != b.CreatedAt {
+		return a.CreatedAt > b.CreatedAt
+	}
+	return strings.Compare(a.ID, b.ID) < 0
+}
+
+// queryLimit returns the maximum number of events a filter asks for.
+// Returns -1 when the filter has no limit.
+func queryLimit(filter nostr.Filter) int {
+	if filter.LimitZero {
+		return 0
+	}
+	if filter.Limit > 0 {
+		return filter.Limit
+	}
+	return -1
+}
+
+// sortNewestFirst orders events by created_at descending, breaking ties by ID.
+func sortNewestFirst(events []*nostr.Event) {
+	slices.SortFunc(events, func(a, b *nostr.Event) int {
+		if a.CreatedAt != b.CreatedAt {
+			if a.CreatedAt > b.CreatedAt {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
@@ -0,0 +1,405 @@
+// Package storetest provides a conformance suite for store.Store implementations.
+//
+// Every Store in this repository runs the same suite, so in-memory and
+// persistent stores give callers the same addressable-event semantics.
+//
+// Example usage:
+//
+//	func TestConformance(t *testing.T) {
+//	    storetest.Run(t, func(t *testing.T, keep_history bool) store.Store {
+//	        return store.NewMemoryStore(store.MemoryOptions{KeepHistory: keep_history})
+//	    })
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/joinnextblock/attn-protocol/go-sdk/store"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Factory creates an empty store for a single test.
+// The suite closes the store when the test finishes.
+type Factory func(t *testing.T, keep_history bool) store.Store
+
+const (
+	pubkey_a = "79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"
+	pubkey_b = "c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"
+)
+
+// Run runs the conformance suite against stores created by factory.
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, factory Factory)
+	}{
+		{"SaveStatuses", testSaveStatuses},
+		{"ReplaceTieBreak", testReplaceTieBreak},
+		{"RegularEvents", testRegularEvents},
+		{"HistoryDisabled", testHistoryDisabled},
+		{"HistoryEnabled", testHistoryEnabled},
+		{"QueryFilters", testQueryFilters},
+		{"QueryOrderAndLimit", testQueryOrderAndLimit},
+		{"ReplacedEventLeavesIndexes", testReplacedEventLeavesIndexes},
+		{"Delete", testDelete},
+		{"NotFound", testNotFound},
+		{"RoundTrip", testRoundTrip},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, factory)
+		})
+	}
+}
+
+// open creates a store and registers it to be closed when the test ends.
+func open(t *testing.T, factory Factory, keep_history bool) store.Store {
+	t.Helper()
+	event_store := factory(t, keep_history)
+	t.Cleanup(func() { event_store.Close() })
+	return event_store
+}
+
+// newEvent creates an event with an ID computed from its fields.
+func newEvent(kind int, pubkey string, created_at int64, tags ...nostr.Tag) *nostr.Event {
+	event := &nostr.Event{
+		Kind:      kind,
+		PubKey:    pubkey,
+		CreatedAt: nostr.Timestamp(created_at),
+		Tags:      nostr.Tags(tags),
+		Content:   fmt.Sprintf(`{"created_at":%d}`, created_at),
+		Sig:       "00",
+	}
+	event.ID = event.GetID()
+	return event
+}
+
+// mustSave saves an event and fails the test if the status is not the expected one.
+func mustSave(t *testing.T, event_store store.Store, event *nostr.Event, expected store.SaveStatus) {
+	t.Helper()
+	status, err := event_store.Save(context.Background(), event)
+	if err != nil {
+		t.Fatalf("Save(%s): %v", event.ID, err)
+	}
+	if status != expected {
+		t.Fatalf("Save(%s): expected %s, got %s", event.ID, expected, status)
+	}
+}
+
+// mustQuery runs a query and returns the IDs of the results in order.
+func mustQuery(t *testing.T, event_store store.Store, filter nostr.Filter) []string {
+	t.Helper()
+	results, err := event_store.Query(context.Background(), filter)
+	if err != nil {
+		t.Fatalf("Query(%s): %v", filter, err)
+	}
+	ids := make([]string, len(results))
+	for i, event := range results {
+		ids[i] = event.ID
+	}
+	return ids
+}
+
+// expectIDs fails the test if got does not equal expected, in order.
+func expectIDs(t *testing.T, label string, got []string, expected ...string) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Errorf("%s: expected %d events, got %d", label, len(expected), len(got))
+		return
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("%s: position %d: expected %s, got %s", label, i, expected[i], got[i])
+		}
+	}
+}
+
+func testSaveStatuses(t *testing.T, factory Factory) {
+	event_store := open(t, factory, false)
+	d_tag := nostr.Tag{"d", "org.attnprotocol:promotion:p1"}
+
+	older := newEvent(38388, pubkey_a, 100, d_tag)
+	newer := newEvent(38388, pubkey_a, 200, d_tag)
+
+	mustSave(t, event_store, older, store.SaveStored)
+	mustSave(t, event_store, newer, store.SaveReplaced)
+	mustSave(t, event_store, newer, store.SaveDuplicate)
+	mustSave(t, event_store, newEvent(38388, pubkey_a, 150, d_tag), store.SaveStale)
+
+	// Same d tag under a different pubkey or kind is a different coordinate
+	mustSave(t, event_store, newEvent(38388, pubkey_b, 100, d_tag), store.SaveStored)
+	mustSave(t, event_store, newEvent(38488, pubkey_a, 100, d_tag), store.SaveStored)
+
+	if _, err := event_store.Save(context.Background(), nil); !errors.Is(err, store.ErrNilEvent) {
+		t.Errorf("expected ErrNilEvent for nil event, got %v", err)
+	}
+}
+
+func testReplaceTieBreak(t *testing.T, factory Factory) {
+	event_store := open(t, factory, false)
+
+	first := newEvent(38488, pubkey_a, 100, nostr.Tag{"d", "org.attnprotocol:attention:a1"}, nostr.Tag{"t", "1"})
+	second := newEvent(38488, pubkey_a, 100, nostr.Tag{"d", "org.attnprotocol:attention:a1"}, nostr.Tag{"t", "2"})
+	lower, higher := first, second
+	if higher.ID < lower.ID {
+		lower, higher = higher, lower
+	}
+
+	mustSave(t, event_store, higher, store.SaveStored)
+	mustSave(t, event_store, lower, store.SaveReplaced)
+	mustSave(t, event_store, higher, store.SaveStale)
+
+	current, err := event_store.GetByCoordinate(context.Background(), store.Coordinate(first))
+	if err != nil {
+		t.Fatalf("GetByCoordinate: %v", err)
+	}
+	if current.ID != lower.ID {
+		t.Errorf("expected lowest ID to win a created_at tie, got %s", current.ID)
+	}
+}
+
+func testRegularEvents(t *testing.T, factory Factory) {
+	event_store := open(t, factory, false)
+
+	note_1 := newEvent(1, pubkey_a, 100)
+	note_2 := newEvent(1, pubkey_a, 200)
+	mustSave(t, event_store, note_1, store.SaveStored)
+	mustSave(t, event_store, note_2, store.SaveStored)
+	mustSave(t, event_store, note_1, store.SaveDuplicate)
+
+	expectIDs(t, "regular kinds are never replaced", mustQuery(t, event_store, nostr.Filter{Kinds: []int{1}}), note_2.ID, note_1.ID)
+
+	relay_list_1 := newEvent(10002, pubkey_a, 100)
+	relay_list_2 := newEvent(10002, pubkey_a, 200)
+	mustSave(t, event_store, relay_list_1, store.SaveStored)
+	mustSave(t, event_store, relay_list_2, store.SaveReplaced)
+	expectIDs(t, "replaceable kinds keep one version", mustQuery(t, event_store, nostr.Filter{Kinds: []int{10002}}), relay_list_2.ID)
+}
+
+func testHistoryDisabled(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	event_store := open(t, factory, false)
+	d_tag := nostr.Tag{"d", "org.attnprotocol:match:m1"}
+
+	v1 := newEvent(38888, pubkey_a, 100, d_tag)
+	v2 := newEvent(38888, pubkey_a, 200, d_tag)
+	mustSave(t, event_store, v1, store.SaveStored)
+	mustSave(t, event_store, v2, store.SaveReplaced)
+
+	versions, err := event_store.History(ctx, store.Coordinate(v1))
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(versions) != 1 || versions[0].ID != v2.ID {
+		t.Errorf("expected only the current version without history")
+	}
+	if _, err := event_store.GetByID(ctx, v1.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("expected superseded version to be dropped, got %v", err)
+	}
+}
+
+func testHistoryEnabled(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	event_store := open(t, factory, true)
+	d_tag := nostr.Tag{"d", "org.attnprotocol:match:m1"}
+
+	v1 := newEvent(38888, pubkey_a, 100, d_tag)
+	v2 := newEvent(38888, pubkey_a, 200, d_tag)
+	v3 := newEvent(38888, pubkey_a, 300, d_tag)
+	mustSave(t, event_store, v2, store.SaveStored)
+	mustSave(t, event_store, v3, store.SaveReplaced)
+	mustSave(t, event_store, v1, store.SaveStale)
+
+	versions, err := event_store.History(ctx, store.Coordinate(v1))
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	ids := make([]string, len(versions))
+	for i, version := range versions {
+		ids[i] = version.ID
+	}
+	expectIDs(t, "history newest first", ids, v3.ID, v2.ID, v1.ID)
+
+	for _, version := range []*nostr.Event{v1, v2} {
+		if _, err := event_store.GetByID(ctx, version.ID); err != nil {
+			t.Errorf("expected superseded version %s to be retrievable, got %v", version.ID, err)
+		}
+	}
+	expectIDs(t, "query sees only the current version", mustQuery(t, event_store, nostr.Filter{Kinds: []int{38888}}), v3.ID)
+	expectIDs(t, "query by superseded ID", mustQuery(t, event_store, nostr.Filter{IDs: []string{v1.ID}}))
+}
+
+func testQueryFilters(t *testing.T, factory Factory) {
+	event_store := open(t, factory, false)
+
+	marketplace := "38188:" + pubkey_a + ":org.attnprotocol:marketplace:m1"
+	other_marketplace := "38188:" + pubkey_a + ":org.attnprotocol:marketplace:m2"
+	match_event_id := "d1f3b5c7e9a1b3c5d7e9f1a3b5c7d9e1f3a5b7c9d1e3f5a7b9c1d3e5f7a9b1c3"
+
+	promotion := newEvent(38388, pubkey_a, 100,
+		nostr.Tag{"d", "org.attnprotocol:promotion:p1"},
+		nostr.Tag{"t", "870000"},
+		nostr.Tag{"a", marketplace},
+		nostr.Tag{"p", pubkey_b},
+	)
+	attention := newEvent(38488, pubkey_b, 200,
+		nostr.Tag{"d", "org.attnprotocol:attention:a1"},
+		nostr.Tag{"t", "870001"},
+		nostr.Tag{"a", other_marketplace},
+		nostr.Tag{"p", pubkey_a},
+	)
+	confirmation := newEvent(38688, pubkey_b, 300,
+		nostr.Tag{"d", "org.attnprotocol:attention-confirmation:c1"},
+		nostr.Tag{"t", "870001"},
+		nostr.Tag{"a", marketplace},
+		nostr.Tag{"e", match_event_id, "", "match"},
+	)
+	for _, event := range []*nostr.Event{promotion, attention, confirmation} {
+		mustSave(t, event_store, event, store.SaveStored)
+	}
+
+	since := nostr.Timestamp(150)
+	until := nostr.Timestamp(250)
+
+	tests := []struct {
+		name     string
+		filter   nostr.Filter
+		expected []string
+	}{
+		{"empty filter", nostr.Filter{}, []string{confirmation.ID, attention.ID, promotion.ID}},
+		{"ids", nostr.Filter{IDs: []string{promotion.ID, attention.ID}}, []string{attention.ID, promotion.ID}},
+		{"kinds", nostr.Filter{Kinds: []int{38388, 38688}}, []string{confirmation.ID, promotion.ID}},
+		{"authors", nostr.Filter{Authors: []string{pubkey_b}}, []string{confirmation.ID, attention.ID}},
+		{"#a", nostr.Filter{Tags: nostr.TagMap{"a": []string{marketplace}}}, []string{confirmation.ID, promotion.ID}},
+		{"#e", nostr.Filter{Tags: nostr.TagMap{"e": []string{match_event_id}}}, []string{confirmation.ID}},
+		{"#p", nostr.Filter{Tags: nostr.TagMap{"p": []string{pubkey_a}}}, []string{attention.ID}},
+		{"#t", nostr.Filter{Tags: nostr.TagMap{"t": []string{"870001"}}}, []string{confirmation.ID, attention.ID}},
+		{"#d", nostr.Filter{Tags: nostr.TagMap{"d": []string{"org.attnprotocol:promotion:p1"}}}, []string{promotion.ID}},
+		{"#t multiple values", nostr.Filter{Tags: nostr.TagMap{"t": []string{"870000", "870001"}}}, []string{confirmation.ID, attention.ID, promotion.ID}},
+		{"tags are ANDed", nostr.Filter{Tags: nostr.TagMap{"a": []string{marketplace}, "t": []string{"870001"}}}, []string{confirmation.ID}},
+		{"kind and author", nostr.Filter{Kinds: []int{38488}, Authors: []string{pubkey_a}}, []string{}},
+		{"since", nostr.Filter{Since: &since}, []string{confirmation.ID, attention.ID}},
+		{"until", nostr.Filter{Until: &until}, []string{attention.ID, promotion.ID}},
+		{"since and until", nostr.Filter{Since: &since, Until: &until}, []string{attention.ID}},
+		{"no match", nostr.Filter{Kinds: []int{38988}}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectIDs(t, tt.name, mustQuery(t, event_store, tt.filter), tt.expected...)
+		})
+	}
+}
+
+func testQueryOrderAndLimit(t *testing.T, factory Factory) {
+	event_store := open(t, factory, false)
+
+	var expected []string
+	for i := 5; i >= 1; i-- {
+		event := newEvent(38388, pubkey_a, int64(i*100), nostr.Tag{"d", fmt.Sprintf("org.attnprotocol:promotion:p%d", i)})
+		mustSave(t, event_store, event, store.SaveStored)
+		expected = append(expected, event.ID)
+	}
+
+	expectIDs(t, "newest first", mustQuery(t, event_store, nostr.Filter{Kinds: []int{38388}}), expected...)
+	expectIDs(t, "limit", mustQuery(t, event_store, nostr.Filter{Kinds: []int{38388}, Limit: 2}), expected[:2]...)
+	expectIDs(t, "limit zero", mustQuery(t, event_store, nostr.Filter{Kinds: []int{38388}, LimitZero: true}))
+}
+
+func testReplacedEventLeavesIndexes(t *testing.T, factory Factory) {
+	event_store := open(t, factory, true)
+	d_tag := nostr.Tag{"d", "org.attnprotocol:promotion:p1"}
+
+	old_version := newEvent(38388, pubkey_a, 100, d_tag, nostr.Tag{"t", "870000"})
+	new_version := newEvent(38388, pubkey_a, 200, d_tag, nostr.Tag{"t", "870005"})
+	mustSave(t, event_store, old_version, store.SaveStored)
+	mustSave(t, event_store, new_version, store.SaveReplaced)
+
+	expectIDs(t, "old block height", mustQuery(t, event_store, nostr.Filter{Tags: nostr.TagMap{"t": []string{"870000"}}}))
+	expectIDs(t, "new block height", mustQuery(t, event_store, nostr.Filter{Tags: nostr.TagMap{"t": []string{"870005"}}}), new_version.ID)
+}
+
+func testDelete(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	event_store := open(t, factory, false)
+
+	event := newEvent(38888, pubkey_a, 100, nostr.Tag{"d", "org.attnprotocol:match:m1"}, nostr.Tag{"t", "870000"})
+	mustSave(t, event_store, event, store.SaveStored)
+
+	if err := event_store.Delete(ctx, event.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := event_store.GetByID(ctx, event.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByID after delete: expected ErrNotFound, got %v", err)
+	}
+	if _, err := event_store.GetByCoordinate(ctx, store.Coordinate(event)); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByCoordinate after delete: expected ErrNotFound, got %v", err)
+	}
+	expectIDs(t, "query after delete", mustQuery(t, event_store, nostr.Filter{Tags: nostr.TagMap{"t": []string{"870000"}}}))
+	if err := event_store.Delete(ctx, event.ID); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("second Delete: expected ErrNotFound, got %v", err)
+	}
+
+	// A deleted coordinate accepts any version again
+	mustSave(t, event_store, newEvent(38888, pubkey_a, 50, nostr.Tag{"d", "org.attnprotocol:match:m1"}), store.SaveStored)
+}
+
+func testNotFound(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	event_store := open(t, factory, true)
+
+	if _, err := event_store.GetByID(ctx, "missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByID: expected ErrNotFound, got %v", err)
+	}
+	if _, err := event_store.GetByCoordinate(ctx, "38388:"+pubkey_a+":missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("GetByCoordinate: expected ErrNotFound, got %v", err)
+	}
+	if _, err := event_store.History(ctx, "38388:"+pubkey_a+":missing"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("History: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testRoundTrip(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	event_store := open(t, factory, false)
+
+	event := newEvent(38388, pubkey_a, 100,
+		nostr.Tag{"d", "org.attnprotocol:promotion:p1"},
+		nostr.Tag{"e", "abc", "wss://relay.example.com", "match"},
+		nostr.Tag{"k", "34236"},
+	)
+	event.Content = `{"bid":5000,"duration":30000}`
+	event.ID = event.GetID()
+	mustSave(t, event_store, event, store.SaveStored)
+
+	got, err := event_store.GetByID(ctx, event.ID)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.ID != event.ID || got.PubKey != event.PubKey || got.Kind != event.Kind ||
+		got.CreatedAt != event.CreatedAt || got.Content != event.Content || got.Sig != event.Sig {
+		t.Errorf("stored event differs from saved event: %s", got)
+	}
+	if len(got.Tags) != len(event.Tags) {
+		t.Fatalf("expected %d tags, got %d", len(event.Tags), len(got.Tags))
+	}
+	for i := range event.Tags {
+		if len(got.Tags[i]) != len(event.Tags[i]) {
+			t.Errorf("tag %d: expected %v, got %v", i, event.Tags[i], got.Tags[i])
+			continue
+		}
+		for j := range event.Tags[i] {
+			if got.Tags[i][j] != event.Tags[i][j] {
+				t.Errorf("tag %d: expected %v, got %v", i, event.Tags[i], got.Tags[i])
+			}
+		}
+	}
+	if !got.CheckID() {
+		t.Errorf("stored event ID no longer matches its serialization")
+	}
+}
@@ -0,0 +1,45 @@
+import { describe, it, expect } from 'vitest';
+import { readdirSync, readFileSync } from 'node:fs';
+import { join } from 'node:path';
+import { fileURLToPath } from 'node:url';
+import { validate_attn_event } from './event-validation.js';
+
+/**
+ * Cross-language conformance vectors shared with go-core/validation.
+ * See /conformance/README.md for the file format.
+ */
+const vectors_dir = fileURLToPath(new URL('../../../conformance/vectors', import.meta.url));
+
+interface ConformanceVector {
+  name: string;
+  description: string;
+  event: { kind: number; content: string; tags: string[][] };
+  expected: { valid: boolean; code?: string };
+}
+
+interface ConformanceFile {
+  kind: number;
+  vectors: ConformanceVector[];
+}
+
+const files = readdirSync(vectors_dir)
+  .filter((file) => file.endsWith('.json'))
+  .map((file) => JSON.parse(readFileSync(join(vectors_dir, file), 'utf8')) as ConformanceFile);
+
+describe('conformance vectors', () => {
+  it('should find vectors', () => {
+    expect(files.length).toBeGreaterThan(0);
+  });
+
+  for (const file of files) {
+    describe(`kind ${file.kind}`, () => {
+      for (const vector of file.vectors) {
+        it(`${vector.name}: ${vector.description}`, () => {
+          const result = validate_attn_event(vector.event);
+          expect(result.valid).toBe(vector.expected.valid);
+          expect(result.code).toBe(vector.expected.code);
+        });
+      }
+    });
+  }
+});
@@ -0,0 +1,568 @@
+/**
+ * Full ATTN-01 event validation: tags, required content fields and content schemas.
+ * Mirrors go-core/validation, and the two agree on every vector in /conformance.
+ * @module
+ */
+
+import type { z } from 'zod';
+import { ATTN_EVENT_KINDS, CITY_PROTOCOL_KINDS } from './constants.js';
+import {
+  marketplace_data_schema,
+  billboard_data_schema,
+  promotion_data_schema,
+  attention_data_schema,
+  match_data_schema,
+  billboard_confirmation_data_schema,
+  attention_confirmation_data_schema,
+  marketplace_confirmation_data_schema,
+  attention_payment_confirmation_data_schema,
+} from './validation.js';
+
+/**
+ * The parts of a Nostr event validation reads
+ */
+export interface ValidatableEvent {
+  kind: number;
+  tags: string[][];
+  content: string;
+}
+
+/**
+ * Result of validate_attn_event. `code` is one of the failure codes in
+ * /conformance/README.md and is omitted for valid events.
+ */
+export interface EventValidationResult {
+  valid: boolean;
+  code?: string;
+  message: string;
+}
+
+/**
+ * Spec version this validator implements, and the NIP-32 namespace of version labels
+ */
+export const CURRENT_SPEC_VERSION = 2;
+export const SPEC_VERSION_LABEL_NAMESPACE = 'org.attnprotocol:version';
+
+/**
+ * Official Nostr tags ATTN-01 allows on protocol events. L and l are NIP-32 labels.
+ */
+const official_tags = new Set(['d', 't', 'a', 'e', 'p', 'r', 'k', 'u', 'L', 'l']);
+
+/**
+ * Video content kind promotions reference
+ */
+const VIDEO_KIND = 34236;
+
+/**
+ * Tag requirements checked after the d and t tags, in the order go-core checks them
+ */
+type TagCheck =
+  | { coordinate: number; name: string }
+  | { video: true }
+  | { list: string; name: string }
+  | { e_marker: string }
+  | { e_count: number; names: string }
+  | { p_count: number; names: string }
+  | { r: true }
+  | { k: 'count' | 'first' }
+  | { u: true };
+
+interface KindRules {
+  event_type: string;
+  tags: TagCheck[];
+  fields: string[];
+  schema: z.ZodType;
+}
+
+const coordinate = (kind: number, name: string): TagCheck => ({ coordinate: kind, name });
+
+const confirmation_coordinates: TagCheck[] = [
+  coordinate(ATTN_EVENT_KINDS.MARKETPLACE, 'marketplace'),
+  coordinate(ATTN_EVENT_KINDS.BILLBOARD, 'billboard'),
+  coordinate(ATTN_EVENT_KINDS.PROMOTION, 'promotion'),
+  coordinate(ATTN_EVENT_KINDS.ATTENTION, 'attention'),
+  coordinate(ATTN_EVENT_KINDS.MATCH, 'match'),
+];
+
+const all_pubkeys = 'marketplace_pubkey, promotion_pubkey, attention_pubkey, billboard_pubkey';
+
+const confirmation_fields = [
+  'ref_match_event_id',
+  'ref_match_id',
+  'ref_marketplace_pubkey',
+  'ref_billboard_pubkey',
+  'ref_promotion_pubkey',
+  'ref_attention_pubkey',
+  'ref_marketplace_id',
+  'ref_billboard_id',
+  'ref_promotion_id',
+  'ref_attention_id',
+];
+
+/**
+ * Rules by kind. Field lists are in the order go-core checks them.
+ */
+const kind_rules: Record<number, KindRules> = {
+  [ATTN_EVENT_KINDS.MARKETPLACE]: {
+    event_type: 'marketplace',
+    tags: [
+      { coordinate: CITY_PROTOCOL_KINDS.BLOCK, name: 'block' },
+      { k: 'count' },
+      { p_count: 2, names: 'marketplace_pubkey and clock_pubkey' },
+      { r: true },
+    ],
+    fields: [
+      'name',
+      'description',
+      'admin_pubkey',
+      'min_duration',
+      'max_duration',
+      'match_fee_sats',
+      'confirmation_fee_sats',
+      'ref_marketplace_pubkey',
+      'ref_marketplace_id',
+      'ref_clock_pubkey',
+      'ref_block_id',
+      'billboard_count',
+      'promotion_count',
+      'attention_count',
+      'match_count',
+    ],
+    schema: marketplace_data_schema,
+  },
+  [ATTN_EVENT_KINDS.BILLBOARD]: {
+    event_type: 'billboard',
+    tags: [
+      coordinate(ATTN_EVENT_KINDS.MARKETPLACE, 'marketplace'),
+      { p_count: 2, names: 'billboard_pubkey and marketplace_pubkey' },
+      { r: true },
+      { k: 'first' },
+      { u: true },
+    ],
+    fields: [
+      'name',
+      'confirmation_fee_sats',
+      'ref_billboard_pubkey',
+      'ref_billboard_id',
+      'ref_marketplace_pubkey',
+      'ref_marketplace_id',
+    ],
+    schema: billboard_data_schema,
+  },
+  [ATTN_EVENT_KINDS.PROMOTION]: {
+    event_type: 'promotion',
+    tags: [
+      coordinate(ATTN_EVENT_KINDS.MARKETPLACE, 'marketplace'),
+      { video: true },
+      coordinate(ATTN_EVENT_KINDS.BILLBOARD, 'billboard'),
+      { p_count: 3, names: 'marketplace_pubkey, billboard_pubkey, and promotion_pubkey' },
+      { r: true },
+      { k: 'first' },
+      { u: true },
+    ],
+    fields: [
+      'duration',
+      'bid',
+      'event_id',
+      'call_to_action',
+      'call_to_action_url',
+      'escrow_id_list',
+      'ref_promotion_pubkey',
+      'ref_promotion_id',
+      'ref_marketplace_pubkey',
+      'ref_marketplace_id',
+      'ref_billboard_pubkey',
+      'ref_billboard_id',
+    ],
+    schema: promotion_data_schema,
+  },
+  [ATTN_EVENT_KINDS.ATTENTION]: {
+    event_type: 'attention',
+    tags: [
+      coordinate(ATTN_EVENT_KINDS.MARKETPLACE, 'marketplace'),
+      { list: 'org.attnprotocol:promotion:blocked', name: 'blocked promotions' },
+      { list: 'org.attnprotocol:promoter:blocked', name: 'blocked promoters' },
+      { p_count: 2, names: 'attention_pubkey and marketplace_pubkey' },
+      { r: true },
+      { k: 'count' },
+    ],
+    fields: [
+      'ask',
+      'min_duration',
+      'max_duration',
+      'ref_attention_pubkey',
+      'ref_attention_id',
+      'ref_marketplace_pubkey',
+      'ref_marketplace_id',
+      'blocked_promotions_id',
+      'blocked_promoters_id',
+    ],
+    schema: attention_data_schema,
+  },
+  [ATTN_EVENT_KINDS.BILLBOARD_CONFIRMATION]: {
+    event_type: 'billboard-confirmation',
+    tags: [
+      ...confirmation_coordinates,
+      { e_marker: 'match' },
+      { e_count: 5, names: 'marketplace, billboard, promotion, attention, and match events' },
+      { p_count: 4, names: all_pubkeys },
+      { r: true },
+    ],
+    fields: confirmation_fields,
+    schema: billboard_confirmation_data_schema,
+  },
+  [ATTN_EVENT_KINDS.ATTENTION_CONFIRMATION]: {
+    event_type: 'attention-confirmation',
+    tags: [
+      ...confirmation_coordinates,
+      { e_marker: 'match' },
+      { e_count: 5, names: 'marketplace, billboard, promotion, attention, and match events' },
+      { p_count: 4, names: all_pubkeys },
+      { r: true },
+    ],
+    fields: confirmation_fields,
+    schema: attention_confirmation_data_schema,
+  },
+  [ATTN_EVENT_KINDS.MARKETPLACE_CONFIRMATION]: {
+    event_type: 'marketplace-confirmation',
+    tags: [
+      ...confirmation_coordinates,
+      { e_marker: 'match' },
+      { e_marker: 'billboard_confirmation' },
+      { e_marker: 'attention_confirmation' },
+      {
+        e_count: 7,
+        names: 'marketplace, billboard, promotion, attention, match, billboard_confirmation, and attention_confirmation events',
+      },
+      { p_count: 4, names: all_pubkeys },
+      { r: true },
+    ],
+    fields: [
+      'ref_match_event_id',
+      'ref_match_id',
+      'ref_billboard_confirmation_event_id',
+      'ref_attention_confirmation_event_id',
+      'ref_marketplace_pubkey',
+      'ref_billboard_pubkey',
+      'ref_promotion_pubkey',
+      'ref_attention_pubkey',
+      'ref_marketplace_id',
+      'ref_billboard_id',
+      'ref_promotion_id',
+      'ref_attention_id',
+    ],
+    schema: marketplace_confirmation_data_schema,
+  },
+  [ATTN_EVENT_KINDS.MATCH]: {
+    event_type: 'match',
+    tags: [
+      coordinate(ATTN_EVENT_KINDS.MARKETPLACE, 'marketplace'),
+      coordinate(ATTN_EVENT_KINDS.BILLBOARD, 'billboard'),
+      coordinate(ATTN_EVENT_KINDS.PROMOTION, 'promotion'),
+      coordinate(ATTN_EVENT_KINDS.ATTENTION, 'attention'),
+      { p_count: 4, names: all_pubkeys },
+      { r: true },
+      { k: 'count' },
+    ],
+    fields: [
+      'ref_match_id',
+      'ref_promotion_id',
+      'ref_attention_id',
+      'ref_billboard_id',
+      'ref_marketplace_id',
+      'ref_marketplace_pubkey',
+      'ref_promotion_pubkey',
+      'ref_attention_pubkey',
+      'ref_billboard_pubkey',
+    ],
+    schema: match_data_schema,
+  },
+  [ATTN_EVENT_KINDS.ATTENTION_PAYMENT_CONFIRMATION]: {
+    event_type: 'attention-payment-confirmation',
+    tags: [
+      { e_marker: 'marketplace_confirmation' },
+      ...confirmation_coordinates,
+      { p_count: 4, names: all_pubkeys },
+      { r: true },
+    ],
+    fields: [
+      'sats_received',
+      'ref_match_event_id',
+      'ref_match_id',
+      'ref_marketplace_confirmation_event_id',
+      'ref_marketplace_pubkey',
+      'ref_billboard_pubkey',
+      'ref_promotion_pubkey',
+      'ref_attention_pubkey',
+      'ref_marketplace_id',
+      'ref_billboard_id',
+      'ref_promotion_id',
+      'ref_attention_id',
+    ],
+    schema: attention_payment_confirmation_data_schema,
+  },
+};
+
+/**
+ * Everything validation reads from an event's tags, collected in one pass
+ */
+interface TagIndex {
+  first: Map<string, string>;
+  counts: Map<string, number>;
+  coordinates: Map<string, string>;
+  lists: string[];
+  e_markers: Set<string>;
+  version?: string;
+}
+
+function index_tags(tags: string[][]): TagIndex {
+  const index: TagIndex = { first: new Map(), counts: new Map(), coordinates: new Map(), lists: [], e_markers: new Set() };
+  for (const tag of tags) {
+    if (tag.length < 2) {
+      continue;
+    }
+    const [name, value] = tag as [string, string];
+    if (!index.first.has(name)) {
+      index.first.set(name, value);
+    }
+    index.counts.set(name, (index.counts.get(name) ?? 0) + 1);
+
+    if (name === 'e' && tag.length >= 4) {
+      index.e_markers.add(tag[3] as string);
+    }
+    if (name === 'a' && value.length >= 6 && value[5] === ':') {
+      const kind = value.slice(0, 5);
+      if (kind === '30000') {
+        index.lists.push(value);
+      } else if (!index.coordinates.has(kind)) {
+        index.coordinates.set(kind, value);
+      }
+    }
+    if (name === 'l' && tag.length >= 3 && tag[2] === SPEC_VERSION_LABEL_NAMESPACE && index.version === undefined) {
+      index.version = value;
+    }
+  }
+  return index;
+}
+
+/**
+ * Event types by kind, as they appear in d tags
+ */
+const event_types: Record<number, string> = Object.fromEntries(
+  Object.entries(kind_rules).map(([kind, rules]) => [kind, rules.event_type])
+);
+
+/**
+ * Check a d tag's namespace and event type. Returns an error message, or undefined if valid.
+ */
+function check_d_tag(kind: number, d_tag: string): string | undefined {
+  if (kind === CITY_PROTOCOL_KINDS.BLOCK) {
+    return d_tag.startsWith('org.cityprotocol:block:')
+      ? undefined
+      : "d tag must be in format 'org.cityprotocol:block:<height>:<hash>'";
+  }
+  const prefix = 'org.attnprotocol:';
+  if (!d_tag.startsWith(prefix)) {
+    return `d tag must start with '${prefix}'`;
+  }
+  const expected_type = event_types[kind];
+  if (expected_type === undefined) {
+    return `unknown event kind: ${kind}`;
+  }
+  const remaining = d_tag.slice(prefix.length);
+  const separator = remaining.indexOf(':');
+  if (separator < 0) {
+    return `d tag format invalid: expected org.attnprotocol:<event_type>:<identifier>, got '${d_tag}'`;
+  }
+  if (remaining.slice(0, separator) !== expected_type) {
+    return `d tag event type mismatch: expected '${expected_type}', got '${remaining.slice(0, separator)}'`;
+  }
+  if (separator === remaining.length - 1) {
+    return 'd tag identifier is empty';
+  }
+  return undefined;
+}
+
+/**
+ * Check a kind:pubkey:d_tag coordinate. Returns an error message, or undefined if valid.
+ */
+function check_coordinate(value: string, expected_kind: number): string | undefined {
+  const first = value.indexOf(':');
+  const second = first < 0 ? -1 : value.indexOf(':', first + 1);
+  if (second < 0) {
+    return 'coordinate format invalid: expected kind:pubkey:identifier';
+  }
+  if (!/^[+-]?[0-9]+$/.test(value.slice(0, first)) || Number(value.slice(0, first)) !== expected_kind) {
+    return `coordinate kind mismatch: expected ${expected_kind}`;
+  }
+  if (second === first + 1) {
+    return 'coordinate pubkey is empty';
+  }
+  const d_tag = value.slice(second + 1);
+  if (d_tag === '') {
+    return 'coordinate identifier is empty';
+  }
+  const protocol_kind =
+    expected_kind === CITY_PROTOCOL_KINDS.BLOCK ||
+    (expected_kind >= ATTN_EVENT_KINDS.MARKETPLACE && expected_kind <= ATTN_EVENT_KINDS.ATTENTION_PAYMENT_CONFIRMATION);
+  if (protocol_kind) {
+    const error = check_d_tag(expected_kind, d_tag);
+    if (error !== undefined) {
+      return `coordinate identifier invalid: ${error}`;
+    }
+  }
+  return undefined;
+}
+
+/**
+ * Block heights are base-10 digits without sign or leading zeros, within int64
+ */
+function is_block_height(value: string): boolean {
+  return /^(0|[1-9][0-9]*)$/.test(value) && BigInt(value) <= 9223372036854775807n;
+}
+
+function fail(code: string, message: string): EventValidationResult {
+  return { valid: false, code, message };
+}
+
+function check_tag(index: TagIndex, check: TagCheck): EventValidationResult | undefined {
+  if ('coordinate' in check) {
+    const value = index.coordinates.get(String(check.coordinate));
+    if (value === undefined) {
+      return fail('missing_coordinate', `Missing ${check.name} coordinate 'a' tag`);
+    }
+    const error = check_coordinate(value, check.coordinate);
+    return error === undefined ? undefined : fail('invalid_coordinate', `Invalid ${check.name} coordinate format: ${error}`);
+  }
+  if ('video' in check) {
+    const value = index.coordinates.get(String(VIDEO_KIND));
+    if (value === undefined) {
+      return fail('missing_coordinate', "Must reference a Video via 'a' tag (format: 34236:pubkey:d_tag)");
+    }
+    return value.includes('org.attnprotocol:')
+      ? fail('invalid_coordinate', "Video coordinate should not include 'org.attnprotocol:' prefix")
+      : undefined;
+  }
+  if ('list' in check) {
+    return index.lists.some((value) => value.endsWith(check.list))
+      ? undefined
+      : fail('missing_coordinate', `Missing ${check.name} coordinate 'a' tag (format: 30000:<pubkey>:${check.list})`);
+  }
+  if ('e_marker' in check) {
+    return index.e_markers.has(check.e_marker)
+      ? undefined
+      : fail('missing_tag', `Missing 'e' tag with '${check.e_marker}' marker`);
+  }
+  if ('e_count' in check) {
+    return (index.counts.get('e') ?? 0) >= check.e_count
+      ? undefined
+      : fail('missing_tag', `Missing required 'e' tags (must reference ${check.names})`);
+  }
+  if ('p_count' in check) {
+    return (index.counts.get('p') ?? 0) >= check.p_count
+      ? undefined
+      : fail('missing_tag', `Missing required 'p' tags (${check.names})`);
+  }
+  if ('r' in check) {
+    return index.counts.has('r') ? undefined : fail('missing_tag', "Missing required 'r' tags (relay URLs)");
+  }
+  if ('k' in check) {
+    const present = check.k === 'count' ? index.counts.has('k') : Boolean(index.first.get('k'));
+    return present ? undefined : fail('missing_tag', "Missing required 'k' tag (event kind)");
+  }
+  return index.first.get('u') ? undefined : fail('missing_tag', "Missing required 'u' tag (URL)");
+}
+
+/**
+ * Validate an ATTN Protocol event the way go-core's validation.ValidateATTNEvent does:
+ * official tags only, the spec version label, the kind's required tags, then its content.
+ *
+ * @example
+ * ```ts
+ * const result = validate_attn_event(event);
+ * if (!result.valid) {
+ *   console.log(result.code, result.message);
+ * }
+ * ```
+ */
+export function validate_attn_event(event: ValidatableEvent): EventValidationResult {
+  const rules = kind_rules[event.kind];
+  if (!rules) {
+    return fail('unknown_kind', 'Not an ATTN Protocol event kind');
+  }
+
+  for (const tag of event.tags) {
+    if (tag.length > 0 && !official_tags.has(tag[0] as string)) {
+      return fail(
+        'non_standard_tag',
+        `Non-standard tag '${tag[0]}' not allowed. Only official Nostr tags are permitted: ${[...official_tags].join(', ')}`
+      );
+    }
+  }
+
+  const index = index_tags(event.tags);
+  if (index.version !== undefined && !(/^[+-]?[0-9]+$/.test(index.version) && Number(index.version) === CURRENT_SPEC_VERSION)) {
+    return fail('unsupported_version', `Unsupported spec version '${index.version}' for kind ${event.kind}`);
+  }
+
+  const d_tag = index.first.get('d');
+  if (!d_tag) {
+    return fail('missing_d_tag', "Missing 'd' tag");
+  }
+  const d_error = check_d_tag(event.kind, d_tag);
+  if (d_error !== undefined) {
+    return fail('invalid_d_tag', `Invalid d tag format: ${d_error}`);
+  }
+
+  const block_height = index.first.get('t');
+  if (!block_height) {
+    return fail('missing_block_height', "Missing 't' tag (block height)");
+  }
+  if (!is_block_height(block_height)) {
+    return fail('invalid_block_height', "Invalid block height in 't' tag: must be a non-negative integer");
+  }
+
+  for (const check of rules.tags) {
+    const result = check_tag(index, check);
+    if (result) {
+      return result;
+    }
+  }
+
+  let data: unknown;
+  try {
+    data = JSON.parse(event.content);
+  } catch {
+    return fail('invalid_json', 'Content must be valid JSON');
+  }
+  // go-core reads null content as an object with no fields
+  if (data === null) {
+    data = {};
+  }
+  if (typeof data !== 'object' || Array.isArray(data)) {
+    return fail('invalid_json', 'Content must be valid JSON');
+  }
+
+  const fields = data as Record<string, unknown>;
+  const missing = rules.fields.find((field) => !(field in fields));
+  if (missing !== undefined) {
+    return fail('missing_field', `Content must include ${missing}`);
+  }
+  if (event.kind === ATTN_EVENT_KINDS.ATTENTION) {
+    const trusted: Array<[string, string]> = [
+      ['org.attnprotocol:marketplace:trusted', 'trusted_marketplaces_id'],
+      ['org.attnprotocol:billboard:trusted', 'trusted_billboards_id'],
+    ];
+    for (const [list, field] of trusted) {
+      if (index.lists.some((value) => value.endsWith(list)) && !(field in fields)) {
+        return fail('missing_field', `${field} must be present in content if the list coordinate is in tags`);
+      }
+    }
+  }
+
+  const parsed = rules.schema.safeParse(fields);
+  if (!parsed.success) {
+    return fail('invalid_field', parsed.error.issues[0]?.message ?? 'Invalid content field');
+  }
+  return { valid: true, message: 'Valid event' };
+}
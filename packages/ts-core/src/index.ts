@@ -72,3 +72,10 @@ export {
   attention_payment_confirmation_data_schema,
 } from './validation.js';
 
+// Event validation
+export {
+  validate_attn_event,
+  CURRENT_SPEC_VERSION,
+  SPEC_VERSION_LABEL_NAMESPACE,
+} from './event-validation.js';
+export type { ValidatableEvent, EventValidationResult } from './event-validation.js';
@@ -391,4 +391,17 @@ describe('attention_payment_confirmation_data_schema', () => {
     };
     expect(() => attention_payment_confirmation_data_schema.parse(invalid_data)).toThrow();
   });
+
+  it('should validate structured payment proofs', () => {
+    const preimage = 'ab'.repeat(32);
+    for (const payment_proof of [`bolt11:lnbc10u1pvjluez:${preimage}`, `zap:${valid_event_id}`]) {
+      expect(() => attention_payment_confirmation_data_schema.parse({ payment_proof })).not.toThrow();
+    }
+  });
+
+  it('should reject malformed structured payment proofs', () => {
+    for (const payment_proof of ['zap:abc', 'bolt11:lnbc10u1pvjluez', `bolt11:LNBC10U:${'ab'.repeat(32)}`]) {
+      expect(() => attention_payment_confirmation_data_schema.parse({ payment_proof })).toThrow();
+    }
+  });
 });
@@ -45,6 +45,11 @@ const merkle_root_schema: z.ZodString = z.string().regex(/^[0-9a-f]+$/i, 'Merkle
  */
 const positive_integer_schema: z.ZodNumber = z.number().int().nonnegative();
 
+/**
+ * Duration in milliseconds (must be > 0)
+ */
+const duration_schema: z.ZodNumber = z.number().int().positive();
+
 /**
  * Positive integer for fees, bids, asks, etc. (must be > 0)
  */
@@ -55,6 +60,17 @@ const positive_sats_schema: z.ZodNumber = z.number().int().positive();
  */
 const nonnegative_fee_sats_schema: z.ZodNumber = z.number().int().nonnegative();
 
+/**
+ * Payment proof: free-form, unless it starts with "bolt11:" or "zap:", when it must be
+ * bolt11:<invoice>:<preimage> or zap:<zap_receipt_event_id>
+ */
+const payment_proof_schema: z.ZodString = z
+  .string()
+  .refine(
+    (proof) => !/^(bolt11|zap):/.test(proof) || /^(bolt11:ln[a-z0-9]+:[0-9a-f]{64}|zap:[0-9a-f]{64})$/.test(proof),
+    'payment_proof must be bolt11:<invoice>:<preimage> or zap:<event_id>'
+  );
+
 /**
  * Unix timestamp (optional, informational)
  */
@@ -65,6 +81,15 @@ const unix_timestamp_schema: z.ZodOptional<z.ZodNumber> = z.number().int().nonne
  */
 const string_array_schema: z.ZodOptional<z.ZodArray<z.ZodString>> = z.array(z.string()).optional();
 
+/**
+ * Refinement: min_duration must not exceed max_duration when both are present
+ */
+function durations_in_order(data: { min_duration?: number; max_duration?: number }): boolean {
+  return data.min_duration === undefined || data.max_duration === undefined || data.min_duration <= data.max_duration;
+}
+
+const durations_in_order_message = { message: 'min_duration must be <= max_duration', path: ['min_duration'] };
+
 /**
  * BLOCK event content schema (kind 38808 - City Protocol)
  * @deprecated Block events are now published by City Protocol. Use CityBlockData type from @attn/core.
@@ -104,8 +129,8 @@ export const marketplace_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
   name: z.string().optional(),
   description: z.string().optional(),
   admin_pubkey: pubkey_schema.optional(),
-  min_duration: positive_integer_schema.optional(), // Milliseconds
-  max_duration: positive_integer_schema.optional(), // Milliseconds
+  min_duration: duration_schema.optional(), // Milliseconds
+  max_duration: duration_schema.optional(), // Milliseconds
   match_fee_sats: nonnegative_fee_sats_schema.optional(),
   confirmation_fee_sats: nonnegative_fee_sats_schema.optional(),
   ref_marketplace_pubkey: pubkey_schema.optional(),
@@ -116,7 +141,7 @@ export const marketplace_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
   promotion_count: positive_integer_schema.optional(),
   attention_count: positive_integer_schema.optional(),
   match_count: positive_integer_schema.optional(),
-});
+}).refine(durations_in_order, durations_in_order_message);
 
 /**
  * BILLBOARD event content schema (kind 38288)
@@ -135,7 +160,7 @@ export const billboard_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
  * PROMOTION event content schema (kind 38388)
  */
 export const promotion_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
-  duration: positive_integer_schema.optional(), // Milliseconds
+  duration: duration_schema.optional(), // Milliseconds
   bid: positive_sats_schema.optional(),
   event_id: event_id_schema.optional(),
   call_to_action: z.string().optional(),
@@ -154,8 +179,8 @@ export const promotion_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
  */
 export const attention_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
   ask: positive_sats_schema.optional(),
-  min_duration: positive_integer_schema.optional(), // Milliseconds
-  max_duration: positive_integer_schema.optional(), // Milliseconds
+  min_duration: duration_schema.optional(), // Milliseconds
+  max_duration: duration_schema.optional(), // Milliseconds
   blocked_promotions_id: z.string().optional(),
   blocked_promoters_id: z.string().optional(),
   trusted_marketplaces_id: z.string().optional(),
@@ -164,7 +189,7 @@ export const attention_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
   ref_attention_id: z.string().optional(),
   ref_marketplace_pubkey: pubkey_schema.optional(),
   ref_marketplace_id: z.string().optional(),
-});
+}).refine(durations_in_order, durations_in_order_message);
 
 /**
  * MATCH event content schema (kind 38888)
@@ -241,7 +266,7 @@ export const marketplace_confirmation_data_schema: z.ZodObject<z.ZodRawShape> =
  */
 export const attention_payment_confirmation_data_schema: z.ZodObject<z.ZodRawShape> = z.object({
   sats_received: positive_sats_schema.optional(),
-  payment_proof: z.string().optional(),
+  payment_proof: payment_proof_schema.optional(),
   ref_match_event_id: event_id_schema.optional(),
   ref_match_id: z.string().optional(),
   ref_marketplace_confirmation_event_id: event_id_schema.optional(),